@@ -7,6 +7,8 @@ import (
 	"syscall"
 
 	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/metrics"
+	"github.com/danilo/edp_gestao_utilizadores/internal/middleware"
 	"github.com/danilo/edp_gestao_utilizadores/internal/models"
 	"github.com/danilo/edp_gestao_utilizadores/internal/plc"
 	"github.com/danilo/edp_gestao_utilizadores/internal/routes"
@@ -43,6 +45,13 @@ func main() {
 		&plc.FaultStatus{},
 		&plc.FaultHistory{},
 		&plc.WordMonitor{},
+		&plc.DisponibilidadePLC{},
+		&plc.NoAtivo{},
+		// Receitas
+		&plc.Receita{},
+		&plc.ReceitaTag{},
+		&plc.ReceitaVersao{},
+		&plc.ReceitaValor{},
 	)
 
 	if err != nil {
@@ -51,6 +60,11 @@ func main() {
 		log.Println("Esquema do banco de dados migrado com sucesso")
 	}
 
+	// Migrações de dados do sistema PLC
+	if err := plc.RunMigrations(); err != nil {
+		log.Printf("Aviso: erro na migração de dados PLC: %v", err)
+	}
+
 	// Inicializar configurações básicas
 	utils.InitializeDatabase()
 
@@ -74,6 +88,7 @@ func main() {
 	// Middleware global
 	app.Use(logger.New())
 	app.Use(recover.New())
+	app.Use(middleware.MetricsMiddleware())
 
 	// Configuração CORS
 	app.Use(cors.New(cors.Config{
@@ -94,42 +109,6 @@ func main() {
 		})
 	})
 
-	// Adicionar endpoint para informações sobre conexão NATS (para clientes)
-	app.Get("/nats-info", func(c *fiber.Ctx) error {
-		natsURL := os.Getenv("NATS_PUBLIC_URL")
-		if natsURL == "" {
-			natsURL = os.Getenv("NATS_URL")
-		}
-		if natsURL == "" {
-			natsURL = "nats://localhost:4222"
-		}
-
-		// Se o URL começar com nats:// e não tivermos um NATS_PUBLIC_URL,
-		// verificar se precisamos converter para ws:// para navegadores
-		if natsURL[:7] == "nats://" && os.Getenv("NATS_PUBLIC_URL") == "" {
-			// Converter para WebSocket para clientes de navegador
-			natsURL = "ws://" + natsURL[7:]
-			// Usar porta 8443 para WebSocket, caso esteja usando a padrão 4222
-			if natsURL[len(natsURL)-5:] == ":4222" {
-				natsURL = natsURL[:len(natsURL)-5] + ":8443"
-			}
-		}
-
-		// Fornecer informações para o frontend se conectar ao NATS
-		return c.JSON(fiber.Map{
-			"url": natsURL,
-			"subjects": map[string]string{
-				"plc_status":  "plc.status",
-				"tag_updates": "plc.tags.updates",
-				"plc_updates": "plc.updates",
-				"tag_write":   "plc.tags.write",
-				// Novos tópicos para falhas
-				"fault_updates": "eclusa.falhas",
-				"fault_ack":     "eclusa.falhas.reconhecidas",
-			},
-		})
-	})
-
 	// Inicializar gerenciador PLC
 	log.Println("Inicializando gerenciador PLC...")
 	plcManager := plc.NewManager()
@@ -139,6 +118,11 @@ func main() {
 		log.Println("Gerenciador PLC inicializado com sucesso")
 	}
 
+	// Métricas para o Prometheus, protegidas por METRICS_TOKEN ou METRICS_ALLOW
+	metrics.RegisterDatabase()
+	metrics.Register(plcManager.MetricsCollectors()...)
+	app.Get("/metrics", middleware.MetricsAccessMiddleware(), metrics.Handler())
+
 	// Configurar grupos de rotas
 	routes.SetupRoutes(app, plcManager)
 
@@ -0,0 +1,48 @@
+// Comando modbus-sim inicia um servidor Modbus TCP local que substitui os equipamentos
+// auxiliares (bombas, sensores de nível, variadores) durante o desenvolvimento.
+//
+// Valores simulados:
+//   - IR0: nível em cm, oscilando entre 0 e 1000
+//   - DI0: heartbeat que alterna a cada segundo
+//
+// Os restantes registos e coils começam a zero e podem ser escritos pelo backend.
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/plc/modbus"
+)
+
+func main() {
+	endereco := flag.String("endereco", ":5020", "endereço de escuta host:porta")
+	tamanho := flag.Int("tamanho", 10000, "número de posições em cada tabela")
+	flag.Parse()
+
+	server := modbus.NewServer(*tamanho)
+
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		nivel, passo := 0, 25
+		heartbeat := false
+		for range ticker.C {
+			nivel += passo
+			if nivel >= 1000 || nivel <= 0 {
+				passo = -passo
+			}
+			heartbeat = !heartbeat
+
+			server.SetInputRegister(0, uint16(nivel))
+			server.SetDiscreteInput(0, heartbeat)
+		}
+	}()
+
+	log.Printf("Simulador Modbus TCP a escutar em %s", *endereco)
+	if err := server.ListenAndServe(*endereco); err != nil {
+		log.Fatalf("Erro no servidor Modbus: %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+// Comando nats-setup gera as chaves de operador e de conta e um ficheiro de configuração
+// para um nats-server local em modo de contas (resolver em memória).
+//
+// A seed da conta é escrita no fim; deve ser definida em NATS_ACCOUNT_SEED no backend,
+// que a usa para se autenticar e para emitir credenciais aos clientes.
+//
+//	go run ./cmd/nats-setup -saida nats-server.conf
+//	nats-server -c nats-server.conf
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nkeys"
+)
+
+func main() {
+	saida := flag.String("saida", "nats-server.conf", "ficheiro de configuração a gerar")
+	porta := flag.Int("porta", 4222, "porta do cliente NATS")
+	portaWS := flag.Int("porta-ws", 8443, "porta WebSocket para navegadores (0 para desativar)")
+	flag.Parse()
+
+	operator, err := nkeys.CreateOperator()
+	check(err)
+	operatorPub, err := operator.PublicKey()
+	check(err)
+
+	operatorClaims := jwt.NewOperatorClaims(operatorPub)
+	operatorClaims.Name = "EDP"
+	operatorJWT, err := operatorClaims.Encode(operator)
+	check(err)
+
+	systemJWT, systemPub, _ := newAccount(operator, "SYS")
+	accountJWT, accountPub, accountSeed := newAccount(operator, "EDP")
+
+	config := fmt.Sprintf(`# Gerado por cmd/nats-setup
+port: %d
+
+operator: %s
+system_account: %s
+
+resolver: MEMORY
+resolver_preload: {
+  %s: %s
+  %s: %s
+}
+`, *porta, operatorJWT, systemPub, systemPub, systemJWT, accountPub, accountJWT)
+
+	if *portaWS > 0 {
+		config += fmt.Sprintf(`
+websocket {
+  port: %d
+  no_tls: true
+}
+`, *portaWS)
+	}
+
+	check(os.WriteFile(*saida, []byte(config), 0600))
+
+	log.Printf("Configuração escrita em %s", *saida)
+	fmt.Printf("NATS_ACCOUNT_SEED=%s\n", accountSeed)
+}
+
+// newAccount cria uma conta assinada pelo operador, devolvendo o JWT, a chave pública e a seed
+func newAccount(operator nkeys.KeyPair, name string) (string, string, string) {
+	account, err := nkeys.CreateAccount()
+	check(err)
+	pub, err := account.PublicKey()
+	check(err)
+	seed, err := account.Seed()
+	check(err)
+
+	claims := jwt.NewAccountClaims(pub)
+	claims.Name = name
+	token, err := claims.Encode(operator)
+	check(err)
+
+	return token, pub, string(seed)
+}
+
+// check termina o programa em caso de erro
+func check(err error) {
+	if err != nil {
+		log.Fatalf("Erro: %v", err)
+	}
+}
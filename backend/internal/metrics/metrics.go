@@ -0,0 +1,115 @@
+// Package metrics expõe as métricas do backend no formato do Prometheus.
+package metrics
+
+import (
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry contém todas as métricas expostas em /metrics
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "edp_http_requests_total",
+		Help: "Pedidos HTTP atendidos, por método, rota e código de resposta.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "edp_http_request_duration_seconds",
+		Help:    "Duração dos pedidos HTTP, por método e rota.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "edp_redis_up",
+			Help: "1 se o Redis está disponível.",
+		}, func() float64 {
+			return boolValue(config.IsRedisAvailable())
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "edp_sessions_active",
+			Help: "Sessões de utilizador não expiradas.",
+		}, activeSessions),
+	)
+}
+
+// RegisterDatabase regista as estatísticas do pool de conexões da base de dados
+func RegisterDatabase() {
+	if config.DB == nil {
+		return
+	}
+
+	sqlDB, err := config.DB.DB()
+	if err != nil {
+		log.Printf("Aviso: métricas do pool da base de dados indisponíveis: %v", err)
+		return
+	}
+	Registry.MustRegister(collectors.NewDBStatsCollector(sqlDB, "postgres"))
+}
+
+// Register regista coletores adicionais (ex.: os do gerenciador PLC)
+func Register(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := Registry.Register(c); err != nil {
+			log.Printf("Aviso: falha ao registar coletor de métricas: %v", err)
+		}
+	}
+}
+
+// ObserveRequest regista um pedido HTTP atendido
+func ObserveRequest(method, route string, status int, duration time.Duration) {
+	httpRequests.WithLabelValues(method, route, statusLabel(status)).Inc()
+	httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// Handler retorna o handler Fiber que serve as métricas
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+}
+
+// activeSessions conta as sessões ainda válidas
+func activeSessions() float64 {
+	if config.DB == nil {
+		return 0
+	}
+
+	var total int64
+	if err := config.DB.Model(&models.Sessao{}).Where("expira_em > ?", time.Now()).Count(&total).Error; err != nil {
+		return 0
+	}
+	return float64(total)
+}
+
+// statusLabel agrupa os códigos de resposta pouco comuns para limitar a cardinalidade
+func statusLabel(status int) string {
+	switch status {
+	case 200, 201, 204, 304, 400, 401, 403, 404, 409, 422, 429, 500, 502, 503:
+		return strconv.Itoa(status)
+	}
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// boolValue converte um booleano em 0 ou 1
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -11,6 +11,109 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// AuthenticatedUser contém os dados do utilizador extraídos de um token de acesso válido
+type AuthenticatedUser struct {
+	ID     uint
+	Nome   string
+	Email  interface{}
+	Perfil string
+}
+
+// AuthError descreve a falha na validação de um token de acesso
+type AuthError struct {
+	Mensagem string
+	Causa    error
+}
+
+func (e *AuthError) Error() string {
+	if e.Causa != nil {
+		return fmt.Sprintf("%s: %v", e.Mensagem, e.Causa)
+	}
+	return e.Mensagem
+}
+
+// ValidateAccessToken valida um token JWT de acesso e confirma que o utilizador existe e está ativo.
+// É usada pelo AuthMiddleware e por canais fora do HTTP, como os comandos NATS.
+func ValidateAccessToken(tokenString string) (*AuthenticatedUser, error) {
+	// Validar o token JWT
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Verificar algoritmo de assinatura
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("método de assinatura inesperado: %v", token.Header["alg"])
+		}
+
+		// Retornar chave de verificação
+		return []byte(utils.GetJWTSecret()), nil
+	})
+
+	// Verificar erro na validação do token
+	if err != nil {
+		return nil, &AuthError{Mensagem: "Token inválido", Causa: err}
+	}
+
+	// Verificar se o token é válido
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, &AuthError{Mensagem: "Token inválido"}
+	}
+
+	// Verificar tipo de token
+	tokenTypeRaw, exists := claims["token_type"]
+	if !exists {
+		return nil, &AuthError{Mensagem: "Token inválido: tipo não especificado"}
+	}
+
+	tokenType, ok := tokenTypeRaw.(string)
+	if !ok || tokenType != "access" {
+		return nil, &AuthError{Mensagem: "Tipo de token inválido"}
+	}
+
+	// Extrair ID do utilizador
+	userIDRaw, exists := claims["sub"]
+	if !exists {
+		return nil, &AuthError{Mensagem: "Token inválido: ID do utilizador ausente"}
+	}
+
+	// Converter ID para uint
+	var userID uint
+	switch v := userIDRaw.(type) {
+	case float64:
+		userID = uint(v)
+	case int:
+		userID = uint(v)
+	case uint:
+		userID = v
+	default:
+		return nil, &AuthError{Mensagem: "Token inválido: formato de ID incorreto"}
+	}
+
+	// Verificar se o utilizador existe e está ativo
+	var user models.Utilizador
+	result := config.DB.Where("id = ? AND estado = ?", userID, "Ativo").First(&user)
+	if result.Error != nil {
+		return nil, &AuthError{Mensagem: "Utilizador não encontrado ou inativo"}
+	}
+
+	authUser := &AuthenticatedUser{
+		ID:     userID,
+		Nome:   user.Nome,
+		Perfil: user.Perfil,
+	}
+
+	// Verificar outros campos essenciais, com fallback para o banco de dados
+	if email, ok := claims["email"]; ok {
+		authUser.Email = email
+	}
+	if name, ok := claims["name"].(string); ok {
+		authUser.Nome = name
+	}
+	if profile, ok := claims["profile"].(string); ok {
+		authUser.Perfil = profile
+	}
+
+	return authUser, nil
+}
+
 // AuthMiddleware verifica se o utilizador está autenticado
 func AuthMiddleware() fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -32,110 +135,28 @@ func AuthMiddleware() fiber.Handler {
 			})
 		}
 
-		tokenString := parts[1]
-
-		// Validar o token JWT
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Verificar algoritmo de assinatura
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("método de assinatura inesperado: %v", token.Header["alg"])
-			}
-
-			// Retornar chave de verificação
-			return []byte(utils.GetJWTSecret()), nil
-		})
-
-		// Verificar erro na validação do token
+		user, err := ValidateAccessToken(parts[1])
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			response := fiber.Map{
 				"sucesso":  false,
-				"mensagem": "Token inválido",
-				"erro":     err.Error(),
-			})
-		}
-
-		// Verificar se o token é válido
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok || !token.Valid {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"sucesso":  false,
-				"mensagem": "Token inválido",
-			})
-		}
-
-		// Verificar tipo de token
-		tokenTypeRaw, exists := claims["token_type"]
-		if !exists {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"sucesso":  false,
-				"mensagem": "Token inválido: tipo não especificado",
-			})
-		}
-
-		tokenType, ok := tokenTypeRaw.(string)
-		if !ok || tokenType != "access" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"sucesso":  false,
-				"mensagem": "Tipo de token inválido",
-			})
-		}
-
-		// Extrair ID do utilizador
-		userIDRaw, exists := claims["sub"]
-		if !exists {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"sucesso":  false,
-				"mensagem": "Token inválido: ID do utilizador ausente",
-			})
-		}
-
-		// Converter ID para uint
-		var userID uint
-		switch v := userIDRaw.(type) {
-		case float64:
-			userID = uint(v)
-		case int:
-			userID = uint(v)
-		case uint:
-			userID = v
-		default:
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"sucesso":  false,
-				"mensagem": "Token inválido: formato de ID incorreto",
-			})
-		}
-
-		// Verificar se o utilizador existe e está ativo
-		var user models.Utilizador
-		result := config.DB.Where("id = ? AND estado = ?", userID, "Ativo").First(&user)
-		if result.Error != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"sucesso":  false,
-				"mensagem": "Utilizador não encontrado ou inativo",
-			})
+				"mensagem": err.Error(),
+			}
+			if authErr, ok := err.(*AuthError); ok {
+				response["mensagem"] = authErr.Mensagem
+				if authErr.Causa != nil {
+					response["erro"] = authErr.Causa.Error()
+				}
+			}
+			return c.Status(fiber.StatusUnauthorized).JSON(response)
 		}
 
 		// Guardar informações do utilizador no contexto para uso posterior
-		c.Locals("user_id", userID)
-
-		// Verificar outros campos essenciais
-		if email, ok := claims["email"]; ok {
-			c.Locals("user_email", email)
-		}
-
-		if name, ok := claims["name"]; ok {
-			c.Locals("user_name", name)
-		} else {
-			// Fallback para o nome do banco de dados se não estiver no token
-			c.Locals("user_name", user.Nome)
-		}
-
-		if profile, ok := claims["profile"]; ok {
-			c.Locals("user_profile", profile)
-		} else {
-			// Fallback para o perfil do banco de dados
-			c.Locals("user_profile", user.Perfil)
+		c.Locals("user_id", user.ID)
+		if user.Email != nil {
+			c.Locals("user_email", user.Email)
 		}
+		c.Locals("user_name", user.Nome)
+		c.Locals("user_profile", user.Perfil)
 
 		// Continuar para o próximo middleware/handler
 		return c.Next()
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/metrics"
+	"github.com/gofiber/fiber/v2"
+)
+
+// MetricsMiddleware regista a contagem e a duração dos pedidos HTTP por rota
+func MetricsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
+		}
+
+		// Usar o padrão da rota (ex: /api/plc/:id) e não o caminho, para limitar a cardinalidade.
+		// Pedidos que não correspondem a nenhuma rota ficam só com o middleware global em "/".
+		route := c.Route().Path
+		if route == "/" && c.Path() != "/" {
+			route = "desconhecida"
+		}
+
+		metrics.ObserveRequest(c.Method(), route, status, time.Since(start))
+		return err
+	}
+}
+
+// MetricsAccessMiddleware protege o endpoint de métricas.
+// Aceita o token de METRICS_TOKEN (Authorization: Bearer) ou IPs/redes de METRICS_ALLOW (ex: 10.0.0.0/8,127.0.0.1).
+// Sem nenhum dos dois configurado, só aceita pedidos locais.
+func MetricsAccessMiddleware() fiber.Handler {
+	token := os.Getenv("METRICS_TOKEN")
+	allowed := parseAllowList(os.Getenv("METRICS_ALLOW"))
+	if token == "" && len(allowed) == 0 {
+		allowed = parseAllowList("127.0.0.1,::1")
+	}
+
+	return func(c *fiber.Ctx) error {
+		if token != "" {
+			bearer := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+				return c.Next()
+			}
+		}
+
+		if ip := net.ParseIP(c.IP()); ip != nil {
+			for _, network := range allowed {
+				if network.Contains(ip) {
+					return c.Next()
+				}
+			}
+		}
+
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Acesso às métricas não autorizado",
+		})
+	}
+}
+
+// parseAllowList converte uma lista de IPs e redes CIDR separados por vírgulas
+func parseAllowList(list string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		if !strings.Contains(item, "/") {
+			if ip := net.ParseIP(item); ip != nil && ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			log.Printf("Aviso: entrada inválida em METRICS_ALLOW: %s", item)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
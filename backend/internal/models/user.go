@@ -125,6 +125,16 @@ func RegistrarAuditoria(utilizadorID uint, nomeUtilizador, acao, modulo, ip stri
 	return config.DB.Create(&log).Error
 }
 
+// PerfilTemPermissao verifica se o perfil tem a permissão do módulo e ação indicados
+func PerfilTemPermissao(perfil, modulo, acao string) (bool, error) {
+	var count int64
+	err := config.DB.Model(&PerfilPermissao{}).
+		Joins("JOIN permissoes ON permissoes.id = perfil_permissoes.permissao_id").
+		Where("perfil_permissoes.perfil = ? AND permissoes.modulo = ? AND permissoes.acao = ?", perfil, modulo, acao).
+		Count(&count).Error
+	return count > 0, err
+}
+
 // GetUserByEmail busca um utilizador pelo email
 func GetUserByEmail(email string) (*Utilizador, error) {
 	var user Utilizador
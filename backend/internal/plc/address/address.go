@@ -0,0 +1,259 @@
+// Package address interpreta e formata endereços absolutos no estilo Siemens
+// (ex.: DB10.DBX4.3, DB12.DBW20, MD100, %I0.1, T5) e endereços Modbus
+// (ex.: HR100, IR5, CO3, DI7 ou a notação clássica 40101).
+package address
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Width indica a largura do acesso codificada no endereço
+type Width string
+
+// Larguras de acesso suportadas
+const (
+	WidthBit     Width = "X"
+	WidthByte    Width = "B"
+	WidthWord    Width = "W"
+	WidthDWord   Width = "D"
+	WidthElement Width = "" // Temporizadores, contadores e registos Modbus
+)
+
+// Size retorna o número de bytes correspondente à largura
+func (w Width) Size() int {
+	switch w {
+	case WidthBit, WidthByte:
+		return 1
+	case WidthWord, WidthElement:
+		return 2
+	case WidthDWord:
+		return 4
+	}
+	return 0
+}
+
+// Address representa um endereço absoluto de memória de um CLP S7
+type Address struct {
+	Area       string // DB, I, Q, M, T, C, HR, IR, CO ou DI
+	DBNumber   int
+	ByteOffset int // Número do elemento para T e C, do registo, coil ou entrada no Modbus
+	BitOffset  *int
+	Width      Width
+}
+
+var (
+	dbPattern      = regexp.MustCompile(`^DB(\d+)\.DB([XBWD])(\d+)(?:\.(\d+))?$`)
+	areaPattern    = regexp.MustCompile(`^([IEQAM])([XBWD]?)(\d+)(?:\.(\d+))?$`)
+	elementPattern = regexp.MustCompile(`^([TCZ])(\d+)$`)
+	modbusPattern  = regexp.MustCompile(`^(HR|IR|CO|DI)(\d+)(?:\.(\d+))?$`)
+	modiconPattern = regexp.MustCompile(`^([0134])(\d{4,5})$`)
+)
+
+// Áreas Modbus na notação clássica Modicon (0xxxx, 1xxxx, 3xxxx, 4xxxx), numeradas a partir de 1
+var modiconAreas = map[string]string{
+	"0": "CO",
+	"1": "DI",
+	"3": "IR",
+	"4": "HR",
+}
+
+// Aliases alemães usados no STEP 7 (E = Eingang, A = Ausgang, Z = Zähler)
+var areaAliases = map[string]string{
+	"I": "I", "E": "I",
+	"Q": "Q", "A": "Q",
+	"M": "M",
+	"T": "T",
+	"C": "C", "Z": "C",
+}
+
+// Parse interpreta um endereço, aceitando o prefixo % e letras minúsculas
+func Parse(text string) (Address, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(text))
+	normalized = strings.TrimPrefix(normalized, "%")
+	normalized = strings.ReplaceAll(normalized, " ", "")
+
+	if normalized == "" {
+		return Address{}, fmt.Errorf("endereço vazio")
+	}
+
+	if m := dbPattern.FindStringSubmatch(normalized); m != nil {
+		dbNumber, _ := strconv.Atoi(m[1])
+		if dbNumber == 0 {
+			return Address{}, fmt.Errorf("endereço %q: número de DB deve ser maior que zero", text)
+		}
+		return build(text, "DB", dbNumber, Width(m[2]), m[3], m[4])
+	}
+
+	if m := areaPattern.FindStringSubmatch(normalized); m != nil {
+		width := Width(m[2])
+		// Sem letra de largura (I0.1, M10.0) é um acesso a bit
+		if width == "" {
+			width = WidthBit
+		}
+		return build(text, areaAliases[m[1]], 0, width, m[3], m[4])
+	}
+
+	if m := modbusPattern.FindStringSubmatch(normalized); m != nil {
+		return buildModbus(text, m[1], m[2], m[3])
+	}
+
+	if m := modiconPattern.FindStringSubmatch(normalized); m != nil {
+		number, _ := strconv.Atoi(m[2])
+		if number == 0 {
+			return Address{}, fmt.Errorf("endereço %q: a notação Modicon começa em 1", text)
+		}
+		return buildModbus(text, modiconAreas[m[1]], strconv.Itoa(number-1), "")
+	}
+
+	if m := elementPattern.FindStringSubmatch(normalized); m != nil {
+		number, err := strconv.Atoi(m[2])
+		if err != nil || number > 0xFFFF {
+			return Address{}, fmt.Errorf("endereço %q: número fora do intervalo", text)
+		}
+		return Address{Area: areaAliases[m[1]], ByteOffset: number, Width: WidthElement}, nil
+	}
+
+	return Address{}, fmt.Errorf("endereço %q com formato inválido", text)
+}
+
+// build valida as partes numéricas comuns a endereços de DB e de áreas de bytes
+func build(text, area string, dbNumber int, width Width, byteText, bitText string) (Address, error) {
+	byteOffset, err := strconv.Atoi(byteText)
+	if err != nil || byteOffset > 0xFFFF {
+		return Address{}, fmt.Errorf("endereço %q: offset de byte fora do intervalo", text)
+	}
+
+	addr := Address{
+		Area:       area,
+		DBNumber:   dbNumber,
+		ByteOffset: byteOffset,
+		Width:      width,
+	}
+
+	if width == WidthBit {
+		if bitText == "" {
+			return Address{}, fmt.Errorf("endereço %q: acesso a bit requer o número do bit (ex.: .3)", text)
+		}
+		bit, _ := strconv.Atoi(bitText)
+		if bit > 7 {
+			return Address{}, fmt.Errorf("endereço %q: número do bit deve estar entre 0 e 7", text)
+		}
+		addr.BitOffset = &bit
+	} else if bitText != "" {
+		return Address{}, fmt.Errorf("endereço %q: número de bit só é permitido em acessos X", text)
+	}
+
+	return addr, nil
+}
+
+// buildModbus valida um endereço Modbus. Coils e entradas discretas são bits sem número de bit;
+// registos aceitam um bit de 0 a 15 (usado pelas definições de falha).
+func buildModbus(text, area, numberText, bitText string) (Address, error) {
+	number, err := strconv.Atoi(numberText)
+	if err != nil || number > 0xFFFF {
+		return Address{}, fmt.Errorf("endereço %q: número fora do intervalo", text)
+	}
+
+	addr := Address{Area: area, ByteOffset: number, Width: WidthElement}
+
+	if area == "CO" || area == "DI" {
+		if bitText != "" {
+			return Address{}, fmt.Errorf("endereço %q: coils e entradas discretas não têm número de bit", text)
+		}
+		addr.Width = WidthBit
+		return addr, nil
+	}
+
+	if bitText != "" {
+		bit, _ := strconv.Atoi(bitText)
+		if bit > 15 {
+			return Address{}, fmt.Errorf("endereço %q: número do bit deve estar entre 0 e 15", text)
+		}
+		addr.Width = WidthBit
+		addr.BitOffset = &bit
+	}
+
+	return addr, nil
+}
+
+// IsModbus indica se o endereço pertence a uma área Modbus
+func (a Address) IsModbus() bool {
+	switch a.Area {
+	case "HR", "IR", "CO", "DI":
+		return true
+	}
+	return false
+}
+
+// String retorna a forma canónica do endereço (sem o prefixo %)
+func (a Address) String() string {
+	switch a.Area {
+	case "DB":
+		base := fmt.Sprintf("DB%d.DB%s%d", a.DBNumber, a.Width, a.ByteOffset)
+		if a.Width == WidthBit && a.BitOffset != nil {
+			base += fmt.Sprintf(".%d", *a.BitOffset)
+		}
+		return base
+
+	case "T", "C":
+		return fmt.Sprintf("%s%d", a.Area, a.ByteOffset)
+
+	case "HR", "IR", "CO", "DI":
+		if a.BitOffset != nil {
+			return fmt.Sprintf("%s%d.%d", a.Area, a.ByteOffset, *a.BitOffset)
+		}
+		return fmt.Sprintf("%s%d", a.Area, a.ByteOffset)
+
+	default:
+		if a.Width == WidthBit {
+			bit := 0
+			if a.BitOffset != nil {
+				bit = *a.BitOffset
+			}
+			return fmt.Sprintf("%s%d.%d", a.Area, a.ByteOffset, bit)
+		}
+		return fmt.Sprintf("%s%s%d", a.Area, a.Width, a.ByteOffset)
+	}
+}
+
+// DefaultType retorna o tipo de dado S7 mais comum para a largura do endereço
+func (a Address) DefaultType() string {
+	switch a.Area {
+	case "T":
+		return "S5Time"
+	case "C":
+		return "Counter"
+	case "HR", "IR":
+		if a.Width == WidthBit {
+			return "Bool"
+		}
+		return "Word"
+	}
+
+	switch a.Width {
+	case WidthBit:
+		return "Bool"
+	case WidthByte:
+		return "Byte"
+	case WidthWord:
+		return "Word"
+	case WidthDWord:
+		return "DWord"
+	}
+	return ""
+}
+
+// WidthForSize retorna a largura usada para formatar um valor com o tamanho em bytes indicado.
+// Tipos maiores que 4 bytes (strings, DTL, LReal) são endereçados pelo byte inicial.
+func WidthForSize(size int) Width {
+	switch size {
+	case 2:
+		return WidthWord
+	case 4:
+		return WidthDWord
+	}
+	return WidthByte
+}
@@ -0,0 +1,389 @@
+package plc
+
+import (
+	"strconv"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AssetController gerencia endpoints da API para a hierarquia de ativos
+type AssetController struct {
+	manager      *Manager
+	faultManager *FaultManager
+}
+
+// NewAssetController cria um novo controlador da hierarquia de ativos
+func NewAssetController(manager *Manager, faultManager *FaultManager) *AssetController {
+	return &AssetController{
+		manager:      manager,
+		faultManager: faultManager,
+	}
+}
+
+// assetPayload é o corpo aceite na criação e atualização de nós
+type assetPayload struct {
+	PaiID     *uint   `json:"pai_id"`
+	Nivel     string  `json:"nivel"`
+	Nome      string  `json:"nome"`
+	Descricao *string `json:"descricao"`
+}
+
+// GetAssetTree retorna a hierarquia de ativos em árvore, ou em lista com ?plano=true
+func (c *AssetController) GetAssetTree(ctx *fiber.Ctx) error {
+	var nodes []NoAtivo
+	query := config.DB.Order("nome")
+	if nivel := ctx.Query("nivel"); nivel != "" {
+		query = query.Where("nivel = ?", nivel)
+	}
+
+	if err := query.Find(&nodes).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao obter hierarquia de ativos",
+			"erro":     err.Error(),
+		})
+	}
+
+	if ctx.QueryBool("plano") || ctx.Query("nivel") != "" {
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"sucesso": true,
+			"dados":   nodes,
+			"total":   len(nodes),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   buildAssetTree(nodes),
+		"total":   len(nodes),
+	})
+}
+
+// GetAssetByID retorna um nó com o caminho desde o site, a subárvore e o número de tags e falhas ligadas
+func (c *AssetController) GetAssetByID(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	path, err := assetPath(config.DB, uint(id))
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Ativo não encontrado",
+		})
+	}
+
+	ids, err := assetSubtreeIDs(config.DB, uint(id))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao obter subárvore do ativo",
+			"erro":     err.Error(),
+		})
+	}
+
+	var nodes []NoAtivo
+	var tags, falhas int64
+	err = config.DB.Where("id IN ?", ids).Find(&nodes).Error
+	if err == nil {
+		err = config.DB.Model(&Tag{}).Where("ativo_id IN ?", ids).Count(&tags).Error
+	}
+	if err == nil {
+		err = config.DB.Model(&FaultDefinition{}).Where("ativo_id IN ?", ids).Count(&falhas).Error
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao obter ativo",
+			"erro":     err.Error(),
+		})
+	}
+
+	// A raiz da subárvore é o próprio nó
+	var node *NoAtivo
+	for _, root := range buildAssetTree(nodes) {
+		if root.ID == uint(id) {
+			node = root
+		}
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   node,
+		"caminho": path,
+		"tags":    tags,
+		"falhas":  falhas,
+	})
+}
+
+// CreateAsset cria um nó da hierarquia
+func (c *AssetController) CreateAsset(ctx *fiber.Ctx) error {
+	var payload assetPayload
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Formato de solicitação inválido",
+			"erro":     err.Error(),
+		})
+	}
+
+	node := NoAtivo{
+		PaiID:     payload.PaiID,
+		Nivel:     payload.Nivel,
+		Nome:      payload.Nome,
+		Descricao: payload.Descricao,
+	}
+
+	if err := validateAssetNode(config.DB, &node); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
+	if err := config.DB.Create(&node).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao criar ativo",
+			"erro":     err.Error(),
+		})
+	}
+
+	models.RegistrarAuditoria(
+		ctx.Locals("user_id").(uint),
+		ctx.Locals("user_name").(string),
+		"Criar",
+		"Ativo",
+		ctx.IP(),
+		map[string]interface{}{
+			"id":     node.ID,
+			"pai_id": node.PaiID,
+			"nivel":  node.Nivel,
+			"nome":   node.Nome,
+		},
+	)
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Ativo criado com sucesso",
+		"dados":    node,
+	})
+}
+
+// UpdateAsset renomeia ou move um nó. O nível não muda; os nomes de eclusa e subsistema
+// guardados nas tags e definições de falha da subárvore são atualizados.
+func (c *AssetController) UpdateAsset(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var node NoAtivo
+	if err := config.DB.First(&node, id).Error; err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Ativo não encontrado",
+		})
+	}
+
+	var payload assetPayload
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Formato de solicitação inválido",
+			"erro":     err.Error(),
+		})
+	}
+
+	if payload.Nivel != "" && payload.Nivel != node.Nivel {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "O nível de um ativo não pode ser alterado",
+		})
+	}
+
+	oldNome := node.Nome
+	oldPaiID := node.PaiID
+	if payload.Nome != "" {
+		node.Nome = payload.Nome
+	}
+	if payload.Descricao != nil {
+		node.Descricao = payload.Descricao
+	}
+	if payload.PaiID != nil {
+		node.PaiID = payload.PaiID
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := validateAssetNode(tx, &node); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if err := tx.Omit("Filhos").Save(&node).Error; err != nil {
+			return err
+		}
+		return syncAssetNames(tx, node.ID)
+	})
+	if err != nil {
+		return assetError(ctx, "Erro ao atualizar ativo", err)
+	}
+
+	// Os nomes publicados com as falhas vêm das definições
+	if node.Nome != oldNome || !uintPtrEqual(node.PaiID, oldPaiID) {
+		go c.faultManager.ReloadDefinitions()
+	}
+
+	models.RegistrarAuditoria(
+		ctx.Locals("user_id").(uint),
+		ctx.Locals("user_name").(string),
+		"Atualizar",
+		"Ativo",
+		ctx.IP(),
+		map[string]interface{}{
+			"id":          node.ID,
+			"pai_id":      node.PaiID,
+			"nivel":       node.Nivel,
+			"nome":        node.Nome,
+			"nome_antigo": oldNome,
+		},
+	)
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Ativo atualizado com sucesso",
+		"dados":    node,
+	})
+}
+
+// DeleteAsset exclui um nó sem filhos e sem tags ou definições de falha ligadas
+func (c *AssetController) DeleteAsset(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var node NoAtivo
+	if err := config.DB.First(&node, id).Error; err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Ativo não encontrado",
+		})
+	}
+
+	var filhos, tags, falhas int64
+	err = config.DB.Model(&NoAtivo{}).Where("pai_id = ?", node.ID).Count(&filhos).Error
+	if err == nil {
+		err = config.DB.Model(&Tag{}).Where("ativo_id = ?", node.ID).Count(&tags).Error
+	}
+	if err == nil {
+		err = config.DB.Model(&FaultDefinition{}).Where("ativo_id = ?", node.ID).Count(&falhas).Error
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao verificar utilização do ativo",
+			"erro":     err.Error(),
+		})
+	}
+
+	if filhos > 0 || tags > 0 || falhas > 0 {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Ativo em uso: mova ou exclua primeiro os filhos, tags e definições de falha",
+			"dados": fiber.Map{
+				"filhos": filhos,
+				"tags":   tags,
+				"falhas": falhas,
+			},
+		})
+	}
+
+	if err := config.DB.Delete(&node).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao excluir ativo",
+			"erro":     err.Error(),
+		})
+	}
+
+	models.RegistrarAuditoria(
+		ctx.Locals("user_id").(uint),
+		ctx.Locals("user_name").(string),
+		"Excluir",
+		"Ativo",
+		ctx.IP(),
+		map[string]interface{}{
+			"id":    node.ID,
+			"nivel": node.Nivel,
+			"nome":  node.Nome,
+		},
+	)
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Ativo excluído com sucesso",
+	})
+}
+
+// assetError responde com o código de um fiber.Error ou com erro interno
+func assetError(ctx *fiber.Ctx, mensagem string, err error) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return ctx.Status(fe.Code).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": fe.Message,
+		})
+	}
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"sucesso":  false,
+		"mensagem": mensagem,
+		"erro":     err.Error(),
+	})
+}
+
+// assetFilterIDs lê o filtro ?ativo_id e retorna os IDs da subárvore (nil sem filtro)
+func assetFilterIDs(ctx *fiber.Ctx) ([]uint, error) {
+	value := ctx.Query("ativo_id")
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "ativo_id inválido")
+	}
+
+	ids, err := assetSubtreeIDs(config.DB, uint(id))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return ids, nil
+}
+
+// copyPtr retorna um ponteiro para uma cópia do valor, ou nil
+func copyPtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// uintPtrEqual compara dois IDs opcionais
+func uintPtrEqual(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,487 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"gorm.io/gorm"
+)
+
+// Níveis da hierarquia de ativos, do topo para a base
+const (
+	NivelSite        = "site"
+	NivelEclusa      = "eclusa"
+	NivelSubsistema  = "subsistema"
+	NivelEquipamento = "equipamento"
+)
+
+// NiveisAtivo lista os níveis pela ordem da hierarquia
+var NiveisAtivo = []string{NivelSite, NivelEclusa, NivelSubsistema, NivelEquipamento}
+
+// NoAtivo é um nó da hierarquia de ativos (site → eclusa → subsistema → equipamento),
+// ao qual se ligam tags e definições de falha
+type NoAtivo struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	PaiID     *uint      `json:"pai_id" gorm:"index"` // NULL apenas para sites
+	Nivel     string     `json:"nivel" gorm:"size:20;not null"`
+	Nome      string     `json:"nome" gorm:"size:50;not null"`
+	Descricao *string    `json:"descricao" gorm:"type:text"`
+	Filhos    []*NoAtivo `json:"filhos,omitempty" gorm:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// TableName especifica o nome da tabela para o modelo NoAtivo
+func (NoAtivo) TableName() string {
+	return "ativos"
+}
+
+// nivelIndex retorna a posição do nível na hierarquia, -1 se desconhecido
+func nivelIndex(nivel string) int {
+	for i, n := range NiveisAtivo {
+		if n == nivel {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeAssetName reduz um nome à forma usada nas comparações (sem maiúsculas nem espaços extra)
+func normalizeAssetName(nome string) string {
+	return strings.ToLower(strings.Join(strings.Fields(nome), " "))
+}
+
+// validateAssetNode verifica o nome, o nível e o pai de um nó e que não há um irmão com o mesmo nome
+func validateAssetNode(tx *gorm.DB, node *NoAtivo) error {
+	node.Nome = strings.Join(strings.Fields(node.Nome), " ")
+	if node.Nome == "" {
+		return fmt.Errorf("nome é obrigatório")
+	}
+
+	level := nivelIndex(node.Nivel)
+	if level < 0 {
+		return fmt.Errorf("nível inválido: %s (válidos: %s)", node.Nivel, strings.Join(NiveisAtivo, ", "))
+	}
+
+	if node.PaiID == nil {
+		if node.Nivel != NivelSite {
+			return fmt.Errorf("apenas sites podem ficar na raiz da hierarquia")
+		}
+	} else {
+		var parent NoAtivo
+		if err := tx.First(&parent, *node.PaiID).Error; err != nil {
+			return fmt.Errorf("nó pai não encontrado")
+		}
+		if nivelIndex(parent.Nivel) != level-1 {
+			return fmt.Errorf("um nó do nível %s deve ficar sob um nó do nível %s", node.Nivel, NiveisAtivo[level-1])
+		}
+	}
+
+	var siblings []NoAtivo
+	query := tx.Where("id <> ?", node.ID)
+	if node.PaiID == nil {
+		query = query.Where("pai_id IS NULL")
+	} else {
+		query = query.Where("pai_id = ?", *node.PaiID)
+	}
+	if err := query.Find(&siblings).Error; err != nil {
+		return err
+	}
+	for _, sibling := range siblings {
+		if normalizeAssetName(sibling.Nome) == normalizeAssetName(node.Nome) {
+			return fmt.Errorf("já existe %q neste ramo da hierarquia", sibling.Nome)
+		}
+	}
+
+	return nil
+}
+
+// assetPath retorna os nós desde o site até ao nó indicado
+func assetPath(tx *gorm.DB, id uint) ([]NoAtivo, error) {
+	var path []NoAtivo
+	current := &id
+
+	for current != nil {
+		if len(path) > len(NiveisAtivo) {
+			return nil, fmt.Errorf("hierarquia de ativos inconsistente no nó %d", id)
+		}
+
+		var node NoAtivo
+		if err := tx.First(&node, *current).Error; err != nil {
+			return nil, fmt.Errorf("ativo %d não encontrado", *current)
+		}
+		path = append([]NoAtivo{node}, path...)
+		current = node.PaiID
+	}
+
+	return path, nil
+}
+
+// assetNames retorna os nomes da eclusa e do subsistema de um caminho da hierarquia
+func assetNames(path []NoAtivo) (eclusa string, subsistema string) {
+	for _, node := range path {
+		switch node.Nivel {
+		case NivelEclusa:
+			eclusa = node.Nome
+		case NivelSubsistema:
+			subsistema = node.Nome
+		}
+	}
+	return eclusa, subsistema
+}
+
+// assetSubtreeIDs retorna o ID do nó e de todos os seus descendentes
+func assetSubtreeIDs(tx *gorm.DB, id uint) ([]uint, error) {
+	var ids []uint
+	err := tx.Raw(`
+		WITH RECURSIVE subarvore AS (
+			SELECT id FROM ativos WHERE id = ?
+			UNION ALL
+			SELECT a.id FROM ativos a JOIN subarvore s ON a.pai_id = s.id
+		)
+		SELECT id FROM subarvore`, id).Scan(&ids).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("ativo %d não encontrado", id)
+	}
+	return ids, nil
+}
+
+// findAssetsByName procura os nós de um nível pelo nome normalizado, opcionalmente sob os pais indicados
+func findAssetsByName(tx *gorm.DB, nivel string, nome string, parentIDs []uint) ([]NoAtivo, error) {
+	var nodes []NoAtivo
+	query := tx.Where("nivel = ?", nivel)
+	if parentIDs != nil {
+		query = query.Where("pai_id IN ?", parentIDs)
+	}
+	if err := query.Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	var matches []NoAtivo
+	for _, node := range nodes {
+		if normalizeAssetName(node.Nome) == normalizeAssetName(nome) {
+			matches = append(matches, node)
+		}
+	}
+	return matches, nil
+}
+
+// resolveFaultAsset liga a definição de falha a um nó da hierarquia e copia os nomes
+// da eclusa e do subsistema. Sem ativo_id, o nó é procurado pelos nomes indicados,
+// que têm de existir na hierarquia.
+func resolveFaultAsset(tx *gorm.DB, def *FaultDefinition) error {
+	if def.AtivoID == nil {
+		if strings.TrimSpace(def.Eclusa) == "" || strings.TrimSpace(def.Subsistema) == "" {
+			return fmt.Errorf("indique ativo_id ou a eclusa e o subsistema")
+		}
+
+		eclusas, err := findAssetsByName(tx, NivelEclusa, def.Eclusa, nil)
+		if err != nil {
+			return err
+		}
+		if len(eclusas) == 0 {
+			return fmt.Errorf("eclusa %q não existe na hierarquia de ativos", def.Eclusa)
+		}
+
+		eclusaIDs := make([]uint, len(eclusas))
+		for i, eclusa := range eclusas {
+			eclusaIDs[i] = eclusa.ID
+		}
+		subsistemas, err := findAssetsByName(tx, NivelSubsistema, def.Subsistema, eclusaIDs)
+		if err != nil {
+			return err
+		}
+		switch len(subsistemas) {
+		case 0:
+			return fmt.Errorf("subsistema %q não existe na eclusa %q", def.Subsistema, def.Eclusa)
+		case 1:
+			def.AtivoID = &subsistemas[0].ID
+		default:
+			return fmt.Errorf("eclusa %q existe em mais de um site; indique ativo_id", def.Eclusa)
+		}
+	}
+
+	path, err := assetPath(tx, *def.AtivoID)
+	if err != nil {
+		return err
+	}
+	eclusa, subsistema := assetNames(path)
+	if eclusa == "" || subsistema == "" {
+		return fmt.Errorf("definições de falha devem ficar num subsistema ou equipamento")
+	}
+
+	def.Eclusa = eclusa
+	def.Subsistema = subsistema
+	return nil
+}
+
+// resolveTagAsset liga a tag a um nó da hierarquia e copia o nome do subsistema.
+// Sem ativo_id, um subsistema indicado por nome tem de existir e ser único na hierarquia.
+func resolveTagAsset(tx *gorm.DB, tag *Tag) error {
+	if tag.AtivoID == nil {
+		if tag.Subsistema == nil || strings.TrimSpace(*tag.Subsistema) == "" {
+			tag.Subsistema = nil
+			return nil
+		}
+
+		subsistemas, err := findAssetsByName(tx, NivelSubsistema, *tag.Subsistema, nil)
+		if err != nil {
+			return err
+		}
+		switch len(subsistemas) {
+		case 0:
+			return fmt.Errorf("subsistema %q não existe na hierarquia de ativos", *tag.Subsistema)
+		case 1:
+			tag.AtivoID = &subsistemas[0].ID
+		default:
+			return fmt.Errorf("subsistema %q existe em mais de uma eclusa; indique ativo_id", *tag.Subsistema)
+		}
+	}
+
+	path, err := assetPath(tx, *tag.AtivoID)
+	if err != nil {
+		return err
+	}
+	_, subsistema := assetNames(path)
+	tag.Subsistema = nil
+	if subsistema != "" {
+		tag.Subsistema = &subsistema
+	}
+	return nil
+}
+
+// syncAssetNames atualiza os nomes de eclusa e subsistema guardados nas tags e definições de falha
+// ligadas ao nó e aos seus descendentes, depois de um nó ser renomeado ou movido
+func syncAssetNames(tx *gorm.DB, id uint) error {
+	ids, err := assetSubtreeIDs(tx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, nodeID := range ids {
+		path, err := assetPath(tx, nodeID)
+		if err != nil {
+			return err
+		}
+		eclusa, subsistema := assetNames(path)
+
+		var tagSubsistema *string
+		if subsistema != "" {
+			tagSubsistema = &subsistema
+		}
+		if err := tx.Model(&Tag{}).Where("ativo_id = ?", nodeID).
+			Update("subsistema", tagSubsistema).Error; err != nil {
+			return err
+		}
+
+		if eclusa != "" && subsistema != "" {
+			if err := tx.Model(&FaultDefinition{}).Where("ativo_id = ?", nodeID).
+				Updates(map[string]interface{}{"eclusa": eclusa, "subsistema": subsistema}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// buildAssetTree monta a árvore a partir da lista plana de nós, ordenando os irmãos por nome
+func buildAssetTree(nodes []NoAtivo) []*NoAtivo {
+	byID := make(map[uint]*NoAtivo, len(nodes))
+	for i := range nodes {
+		nodes[i].Filhos = nil
+		byID[nodes[i].ID] = &nodes[i]
+	}
+
+	var roots []*NoAtivo
+	for i := range nodes {
+		node := &nodes[i]
+		if node.PaiID != nil {
+			if parent, ok := byID[*node.PaiID]; ok {
+				parent.Filhos = append(parent.Filhos, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+
+	var sortNodes func(list []*NoAtivo)
+	sortNodes = func(list []*NoAtivo) {
+		sort.Slice(list, func(i, j int) bool {
+			return normalizeAssetName(list[i].Nome) < normalizeAssetName(list[j].Nome)
+		})
+		for _, node := range list {
+			sortNodes(node.Filhos)
+		}
+	}
+	sortNodes(roots)
+
+	return roots
+}
+
+// assetNamesList retorna os nomes distintos dos nós de um nível, opcionalmente sob eclusas com o nome indicado
+func assetNamesList(nivel string, eclusa string) ([]string, error) {
+	var nodes []NoAtivo
+	query := config.DB.Where("nivel = ?", nivel)
+
+	if eclusa != "" {
+		eclusas, err := findAssetsByName(config.DB, NivelEclusa, eclusa, nil)
+		if err != nil {
+			return nil, err
+		}
+		ids := make([]uint, len(eclusas))
+		for i, e := range eclusas {
+			ids[i] = e.ID
+		}
+		if len(ids) == 0 {
+			return []string{}, nil
+		}
+		query = query.Where("pai_id IN ?", ids)
+	}
+
+	if err := query.Order("nome").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	seen := map[string]bool{}
+	for _, node := range nodes {
+		key := normalizeAssetName(node.Nome)
+		if !seen[key] {
+			seen[key] = true
+			names = append(names, node.Nome)
+		}
+	}
+	return names, nil
+}
+
+// migrateAssetHierarchy cria a hierarquia de ativos a partir dos nomes livres de eclusa e subsistema
+// das definições de falha e das tags ainda sem ativo_id. Nomes que diferem apenas em maiúsculas
+// ou espaços ficam no mesmo nó. Pode ser executada várias vezes.
+func migrateAssetHierarchy() error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		var defs []FaultDefinition
+		if err := tx.Where("ativo_id IS NULL").Order("id").Find(&defs).Error; err != nil {
+			return err
+		}
+		var tags []Tag
+		if err := tx.Where("ativo_id IS NULL AND subsistema IS NOT NULL AND TRIM(subsistema) <> ''").
+			Order("id").Find(&tags).Error; err != nil {
+			return err
+		}
+		if len(defs) == 0 && len(tags) == 0 {
+			return nil
+		}
+
+		site, err := migrationSite(tx)
+		if err != nil {
+			return err
+		}
+
+		linkedDefs := 0
+		for _, def := range defs {
+			eclusa, err := ensureAssetNode(tx, &site.ID, NivelEclusa, def.Eclusa)
+			if err != nil {
+				return err
+			}
+			subsistema, err := ensureAssetNode(tx, &eclusa.ID, NivelSubsistema, def.Subsistema)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&FaultDefinition{}).Where("id = ?", def.ID).Updates(map[string]interface{}{
+				"ativo_id": subsistema.ID, "eclusa": eclusa.Nome, "subsistema": subsistema.Nome,
+			}).Error; err != nil {
+				return err
+			}
+			linkedDefs++
+		}
+
+		// As tags só têm o subsistema: ligam-se ao subsistema com o mesmo nome se for único;
+		// sem correspondência o subsistema é criado numa eclusa "Sem eclusa" para revisão
+		linkedTags, ambiguous := 0, 0
+		for _, tag := range tags {
+			matches, err := findAssetsByName(tx, NivelSubsistema, *tag.Subsistema, nil)
+			if err != nil {
+				return err
+			}
+
+			var node *NoAtivo
+			switch len(matches) {
+			case 0:
+				orphans, err := ensureAssetNode(tx, &site.ID, NivelEclusa, "Sem eclusa")
+				if err != nil {
+					return err
+				}
+				if node, err = ensureAssetNode(tx, &orphans.ID, NivelSubsistema, *tag.Subsistema); err != nil {
+					return err
+				}
+			case 1:
+				node = &matches[0]
+			default:
+				log.Printf("Migração: tag %s (ID: %d) não ligada, subsistema %q existe em várias eclusas",
+					tag.Nome, tag.ID, *tag.Subsistema)
+				ambiguous++
+				continue
+			}
+
+			if err := tx.Model(&Tag{}).Where("id = ?", tag.ID).Updates(map[string]interface{}{
+				"ativo_id": node.ID, "subsistema": node.Nome,
+			}).Error; err != nil {
+				return err
+			}
+			linkedTags++
+		}
+
+		log.Printf("Migração: hierarquia de ativos ligada a %d definições de falha e %d tags (%d tags ambíguas por rever)",
+			linkedDefs, linkedTags, ambiguous)
+		return nil
+	})
+}
+
+// migrationSite retorna o site onde a migração cria as eclusas: o primeiro existente ou um novo
+func migrationSite(tx *gorm.DB) (*NoAtivo, error) {
+	var site NoAtivo
+	err := tx.Where("nivel = ? AND pai_id IS NULL", NivelSite).Order("id").First(&site).Error
+	if err == nil {
+		return &site, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	site = NoAtivo{Nivel: NivelSite, Nome: "Site principal"}
+	if err := tx.Create(&site).Error; err != nil {
+		return nil, err
+	}
+	return &site, nil
+}
+
+// ensureAssetNode retorna o filho com o nome indicado, criando-o se não existir
+func ensureAssetNode(tx *gorm.DB, parentID *uint, nivel string, nome string) (*NoAtivo, error) {
+	nome = strings.Join(strings.Fields(nome), " ")
+	if nome == "" {
+		nome = "Sem nome"
+	}
+
+	matches, err := findAssetsByName(tx, nivel, nome, []uint{*parentID})
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) > 0 {
+		return &matches[0], nil
+	}
+
+	node := NoAtivo{PaiID: parentID, Nivel: nivel, Nome: nome}
+	if err := tx.Create(&node).Error; err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
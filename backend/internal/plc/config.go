@@ -6,17 +6,53 @@ import "time"
 type PLCConfig struct {
 	// Configurações de conexão
 	ConnectionTimeout     time.Duration
-	ConnectionRetryDelay  time.Duration
+	ConnectionRetryDelay  time.Duration // Espera após a primeira falha; duplica a cada tentativa
 	ConnectionCheckPeriod time.Duration
 
+	// Configurações da supervisão da conexão
+	ReconnectMaxDelay       time.Duration // Espera máxima entre tentativas
+	ReconnectJitter         float64       // Variação aleatória da espera (fração, ex.: 0.2 = ±20%)
+	CircuitBreakerThreshold int           // Leituras falhadas consecutivas que abrem o disjuntor
+
 	// Configurações de leitura/monitoramento
 	DefaultTagInterval time.Duration
+	BlockMaxGap        int // Maior intervalo de bytes não utilizados entre tags para juntar num mesmo bloco
+
+	// Configurações de qualidade dos valores
+	StaleMultiplier  float64       // Valor é antigo após este múltiplo do intervalo de atualização sem leitura boa
+	StaleCheckPeriod time.Duration // Período da verificação de valores antigos
+
+	// Configurações do diagnóstico da CPU
+	CPUStatePeriod time.Duration // Período da verificação do estado RUN/STOP
+
+	// Configurações das tags virtuais
+	VirtualTagPeriod time.Duration // Período da reavaliação das expressões com funções de tempo
+
+	// Configurações das estatísticas de comunicação
+	StatsLatencyWindow int           // Leituras consideradas no cálculo do p95 da latência
+	StatsPersistPeriod time.Duration // Período da gravação da disponibilidade diária
 
 	// Configurações para monitoramento de falhas
 	MonitorInterval    time.Duration
 	BatchProcessPeriod time.Duration
 	BatchMaxSize       int
 
+	// Configurações do histórico
+	HistorianBufferSize           int           // Amostras em espera antes de começar a descartar
+	HistorianBatchSize            int           // Amostras por inserção
+	HistorianFlushPeriod          time.Duration // Tempo máximo de uma amostra em espera
+	HistorianRetentionPeriod      time.Duration // Período da limpeza por retenção
+	HistorianDefaultRetentionDays int           // Retenção das tags sem historico_retencao_dias
+
+	// Configurações das consultas de tendências
+	TrendMaxTags       int // Tags por consulta
+	TrendDefaultPoints int // Pontos por série quando não indicado
+	TrendMaxPoints     int // Pontos ou intervalos por série
+	TrendMaxRawSamples int // Amostras lidas por série
+
+	// Configurações da importação de fontes de DB
+	DBImportMaxTags int // Membros elementares por importação
+
 	// Configurações de paginação
 	DefaultPageSize int
 	MaxPageSize     int
@@ -25,15 +61,35 @@ type PLCConfig struct {
 // DefaultPLCConfig retorna configurações padrão
 func DefaultPLCConfig() *PLCConfig {
 	return &PLCConfig{
-		ConnectionTimeout:     5 * time.Second,
-		ConnectionRetryDelay:  5 * time.Second,
-		ConnectionCheckPeriod: 30 * time.Second,
-		DefaultTagInterval:    1000 * time.Millisecond,
-		MonitorInterval:       1 * time.Second,
-		BatchProcessPeriod:    200 * time.Millisecond,
-		BatchMaxSize:          50,
-		DefaultPageSize:       20,
-		MaxPageSize:           100,
+		ConnectionTimeout:             5 * time.Second,
+		ConnectionRetryDelay:          1 * time.Second,
+		ReconnectMaxDelay:             60 * time.Second,
+		ReconnectJitter:               0.2,
+		CircuitBreakerThreshold:       5,
+		ConnectionCheckPeriod:         30 * time.Second,
+		DefaultTagInterval:            1000 * time.Millisecond,
+		BlockMaxGap:                   32,
+		StaleMultiplier:               3,
+		StaleCheckPeriod:              1 * time.Second,
+		CPUStatePeriod:                5 * time.Second,
+		VirtualTagPeriod:              1 * time.Second,
+		StatsLatencyWindow:            1000,
+		StatsPersistPeriod:            1 * time.Minute,
+		MonitorInterval:               1 * time.Second,
+		BatchProcessPeriod:            200 * time.Millisecond,
+		BatchMaxSize:                  50,
+		HistorianBufferSize:           10000,
+		HistorianBatchSize:            500,
+		HistorianFlushPeriod:          2 * time.Second,
+		HistorianRetentionPeriod:      1 * time.Hour,
+		HistorianDefaultRetentionDays: 90,
+		TrendMaxTags:                  20,
+		TrendDefaultPoints:            1000,
+		TrendMaxPoints:                10000,
+		TrendMaxRawSamples:            200000,
+		DBImportMaxTags:               5000,
+		DefaultPageSize:               20,
+		MaxPageSize:                   100,
 	}
 }
 
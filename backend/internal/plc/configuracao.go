@@ -0,0 +1,868 @@
+package plc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/plc/expr"
+	"github.com/gofiber/fiber/v2"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// ConfigVersao é a versão do formato do documento de configuração. Documentos de versões
+// posteriores são recusados.
+const ConfigVersao = 1
+
+// Estratégias para entidades que já existem no destino com outra configuração
+const (
+	ConflitoIgnorar    = "ignorar"    // Manter a configuração existente
+	ConflitoSubstituir = "substituir" // Gravar a configuração do documento
+	ConflitoFalhar     = "falhar"     // Cancelar a importação
+)
+
+// EstrategiasConflito lista as estratégias de conflito aceites
+var EstrategiasConflito = []string{ConflitoIgnorar, ConflitoSubstituir, ConflitoFalhar}
+
+// Ações da importação de configuração, além das da importação de fontes de DB
+const (
+	ImportacaoIgnorada = "ignorada"
+	ImportacaoConflito = "conflito"
+)
+
+// Entidades do documento de configuração
+const (
+	EntidadeAtivo = "ativo"
+	EntidadePLC   = "plc"
+	EntidadeTag   = "tag"
+	EntidadeFalha = "falha"
+)
+
+// errConfigConflicts cancela a transação quando há conflitos com a estratégia falhar
+var errConfigConflicts = errors.New("conflitos na importação")
+
+// errConfigDryRun cancela a transação de uma simulação depois de calculadas as diferenças
+var errConfigDryRun = errors.New("simulação")
+
+// ConfigDocument é a configuração exportada de PLCs, tags, definições de falha e hierarquia de ativos.
+// Os IDs são os da instalação de origem e servem apenas para ligar as entidades entre si;
+// na importação cada entidade é associada à existente pela sua chave natural.
+type ConfigDocument struct {
+	Versao      int           `json:"versao" yaml:"versao"`
+	ExportadoEm time.Time     `json:"exportado_em" yaml:"exportado_em"`
+	Ativos      []ConfigAtivo `json:"ativos" yaml:"ativos"`
+	PLCs        []ConfigPLC   `json:"plcs" yaml:"plcs"`
+}
+
+// ConfigAtivo é um nó da hierarquia de ativos, identificado pelo nome sob o mesmo pai
+type ConfigAtivo struct {
+	ID        uint    `json:"id" yaml:"id"`
+	PaiID     *uint   `json:"pai_id,omitempty" yaml:"pai_id,omitempty"`
+	Nivel     string  `json:"nivel" yaml:"nivel"`
+	Nome      string  `json:"nome" yaml:"nome"`
+	Descricao *string `json:"descricao,omitempty" yaml:"descricao,omitempty"`
+}
+
+// ConfigPLC é a configuração de um PLC, identificado pelo nome, com as suas tags e definições de falha
+type ConfigPLC struct {
+	ID                   uint          `json:"id" yaml:"id"`
+	Nome                 string        `json:"nome" yaml:"nome"`
+	Protocolo            string        `json:"protocolo" yaml:"protocolo"`
+	IPAddress            string        `json:"ip_address" yaml:"ip_address"`
+	Porta                int           `json:"porta" yaml:"porta"`
+	Rack                 int           `json:"rack" yaml:"rack"`
+	Slot                 int           `json:"slot" yaml:"slot"`
+	UnitID               int           `json:"unit_id" yaml:"unit_id"`
+	Gateway              *string       `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+	Ativo                bool          `json:"ativo" yaml:"ativo"`
+	TipoConexao          string        `json:"tipo_conexao" yaml:"tipo_conexao"`
+	LocalTSAP            *int          `json:"local_tsap,omitempty" yaml:"local_tsap,omitempty"`
+	RemoteTSAP           *int          `json:"remote_tsap,omitempty" yaml:"remote_tsap,omitempty"`
+	PDUPreferida         int           `json:"pdu_preferida" yaml:"pdu_preferida"`
+	TimeoutMs            int           `json:"timeout_ms" yaml:"timeout_ms"`
+	TimeoutInatividadeMs int           `json:"timeout_inatividade_ms" yaml:"timeout_inatividade_ms"`
+	SubredeS7            *string       `json:"subrede_s7,omitempty" yaml:"subrede_s7,omitempty"`
+	EnderecoMPI          *int          `json:"endereco_mpi,omitempty" yaml:"endereco_mpi,omitempty"`
+	Tags                 []ConfigTag   `json:"tags" yaml:"tags"`
+	Falhas               []ConfigFalha `json:"falhas" yaml:"falhas"`
+}
+
+// ConfigTag é a configuração de uma tag, identificada pelo nome dentro do PLC.
+// As expressões das tags virtuais referem os IDs do documento.
+type ConfigTag struct {
+	ID                    uint     `json:"id" yaml:"id"`
+	Nome                  string   `json:"nome" yaml:"nome"`
+	Endereco              string   `json:"endereco,omitempty" yaml:"endereco,omitempty"` // Informativo; o endereço é dado pelos campos seguintes
+	Area                  string   `json:"area" yaml:"area"`
+	DBNumber              int      `json:"db_number" yaml:"db_number"`
+	ByteOffset            int      `json:"byte_offset" yaml:"byte_offset"`
+	BitOffset             *int     `json:"bit_offset,omitempty" yaml:"bit_offset,omitempty"`
+	Tipo                  string   `json:"tipo" yaml:"tipo"`
+	Tamanho               int      `json:"tamanho" yaml:"tamanho"`
+	AtivoID               *uint    `json:"ativo_id,omitempty" yaml:"ativo_id,omitempty"`
+	Subsistema            *string  `json:"subsistema,omitempty" yaml:"subsistema,omitempty"`
+	Descricao             *string  `json:"descricao,omitempty" yaml:"descricao,omitempty"`
+	Ativo                 bool     `json:"ativo" yaml:"ativo"`
+	UpdateInterval        int      `json:"update_interval_ms" yaml:"update_interval_ms"`
+	OnlyOnChange          bool     `json:"only_on_change" yaml:"only_on_change"`
+	OrdemPalavras         string   `json:"ordem_palavras" yaml:"ordem_palavras"`
+	Expressao             *string  `json:"expressao,omitempty" yaml:"expressao,omitempty"`
+	BrutoMin              *float64 `json:"bruto_min,omitempty" yaml:"bruto_min,omitempty"`
+	BrutoMax              *float64 `json:"bruto_max,omitempty" yaml:"bruto_max,omitempty"`
+	EngMin                *float64 `json:"eng_min,omitempty" yaml:"eng_min,omitempty"`
+	EngMax                *float64 `json:"eng_max,omitempty" yaml:"eng_max,omitempty"`
+	Limitar               bool     `json:"limitar" yaml:"limitar"`
+	Unidade               *string  `json:"unidade,omitempty" yaml:"unidade,omitempty"`
+	Precisao              *int     `json:"precisao,omitempty" yaml:"precisao,omitempty"`
+	BandaMorta            *float64 `json:"banda_morta,omitempty" yaml:"banda_morta,omitempty"`
+	BandaMortaPct         *float64 `json:"banda_morta_pct,omitempty" yaml:"banda_morta_pct,omitempty"`
+	SilencioMaxS          int      `json:"silencio_max_s" yaml:"silencio_max_s"`
+	HistoricoModo         string   `json:"historico_modo" yaml:"historico_modo"`
+	HistoricoIntervaloS   int      `json:"historico_intervalo_s" yaml:"historico_intervalo_s"`
+	HistoricoRetencaoDias int      `json:"historico_retencao_dias" yaml:"historico_retencao_dias"`
+	Gravavel              bool     `json:"gravavel" yaml:"gravavel"`
+	EscritaMin            *float64 `json:"escrita_min,omitempty" yaml:"escrita_min,omitempty"`
+	EscritaMax            *float64 `json:"escrita_max,omitempty" yaml:"escrita_max,omitempty"`
+	ValoresPermitidos     *string  `json:"valores_permitidos,omitempty" yaml:"valores_permitidos,omitempty"`
+	TaxaMaxima            *float64 `json:"taxa_maxima,omitempty" yaml:"taxa_maxima,omitempty"`
+	PerfilEscrita         *string  `json:"perfil_escrita,omitempty" yaml:"perfil_escrita,omitempty"`
+}
+
+// ConfigFalha é uma definição de falha, identificada pelo bit monitorado dentro do PLC
+type ConfigFalha struct {
+	ID         uint   `json:"id" yaml:"id"`
+	WordName   string `json:"word_name" yaml:"word_name"`
+	Endereco   string `json:"endereco,omitempty" yaml:"endereco,omitempty"` // Informativo
+	DBNumber   int    `json:"db_number" yaml:"db_number"`
+	ByteOffset int    `json:"byte_offset" yaml:"byte_offset"`
+	BitOffset  int    `json:"bit_offset" yaml:"bit_offset"`
+	AtivoID    *uint  `json:"ativo_id,omitempty" yaml:"ativo_id,omitempty"`
+	Eclusa     string `json:"eclusa" yaml:"eclusa"`
+	Subsistema string `json:"subsistema" yaml:"subsistema"`
+	Descricao  string `json:"descricao" yaml:"descricao"`
+	Tipo       string `json:"tipo" yaml:"tipo"`
+	Ativo      bool   `json:"ativo" yaml:"ativo"`
+}
+
+// ConfigImportItem é o resultado da importação de uma entidade
+type ConfigImportItem struct {
+	Entidade   string   `json:"entidade"`
+	Chave      string   `json:"chave"`
+	IDOrigem   uint     `json:"id_origem"`
+	ID         uint     `json:"id,omitempty"`
+	Acao       string   `json:"acao"`
+	Alteracoes []string `json:"alteracoes,omitempty"` // Campos com valores diferentes dos existentes
+}
+
+// ConfigImportResult resume uma importação ou simulação
+type ConfigImportResult struct {
+	Simulacao   bool               `json:"simulacao"`
+	Estrategia  string             `json:"estrategia"`
+	Itens       []ConfigImportItem `json:"itens"`
+	Criar       int                `json:"criar"`
+	Atualizar   int                `json:"atualizar"`
+	Inalterados int                `json:"inalterados"`
+	Ignorados   int                `json:"ignorados"`
+	Conflitos   int                `json:"conflitos"`
+
+	plcsAlterados  map[uint]bool // PLCs criados ou com a configuração alterada
+	tagsAlteradas  map[uint]bool // PLCs com tags criadas ou alteradas
+	falhasGravadas bool
+}
+
+// clearCreatedIDs remove os IDs das entidades a criar quando a transação foi anulada,
+// já que só existiam nela
+func (r *ConfigImportResult) clearCreatedIDs() {
+	for i := range r.Itens {
+		if r.Itens[i].Acao == ImportacaoCriar {
+			r.Itens[i].ID = 0
+		}
+	}
+}
+
+// convertJSON copia os campos com o mesmo nome JSON de um valor para outro
+func convertJSON(src interface{}, dst interface{}) error {
+	data, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// exportConfig constrói o documento de configuração dos PLCs indicados (todos se vazio),
+// com a hierarquia de ativos completa
+func exportConfig(plcIDs []uint) (*ConfigDocument, error) {
+	doc := &ConfigDocument{
+		Versao:      ConfigVersao,
+		ExportadoEm: time.Now(),
+		Ativos:      []ConfigAtivo{},
+		PLCs:        []ConfigPLC{},
+	}
+
+	var nodes []NoAtivo
+	if err := config.DB.Order("id").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	// Os pais antes dos filhos
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nivelIndex(nodes[i].Nivel) < nivelIndex(nodes[j].Nivel)
+	})
+	for _, node := range nodes {
+		doc.Ativos = append(doc.Ativos, ConfigAtivo{
+			ID:        node.ID,
+			PaiID:     node.PaiID,
+			Nivel:     node.Nivel,
+			Nome:      node.Nome,
+			Descricao: node.Descricao,
+		})
+	}
+
+	query := config.DB.Order("id")
+	if len(plcIDs) > 0 {
+		query = query.Where("id IN ?", plcIDs)
+	}
+	var plcs []PLC
+	if err := query.Find(&plcs).Error; err != nil {
+		return nil, err
+	}
+
+	for _, plc := range plcs {
+		var cfg ConfigPLC
+		if err := convertJSON(plc, &cfg); err != nil {
+			return nil, err
+		}
+		cfg.Tags = []ConfigTag{}
+		cfg.Falhas = []ConfigFalha{}
+
+		var tags []Tag
+		if err := config.DB.Where("plc_id = ?", plc.ID).Order("id").Find(&tags).Error; err != nil {
+			return nil, err
+		}
+		for _, tag := range tags {
+			var tagCfg ConfigTag
+			if err := convertJSON(tag, &tagCfg); err != nil {
+				return nil, err
+			}
+			cfg.Tags = append(cfg.Tags, tagCfg)
+		}
+
+		var defs []FaultDefinition
+		if err := config.DB.Where("plc_id = ?", plc.ID).Order("id").Find(&defs).Error; err != nil {
+			return nil, err
+		}
+		for _, def := range defs {
+			var defCfg ConfigFalha
+			if err := convertJSON(def, &defCfg); err != nil {
+				return nil, err
+			}
+			cfg.Falhas = append(cfg.Falhas, defCfg)
+		}
+
+		doc.PLCs = append(doc.PLCs, cfg)
+	}
+
+	// Um documento parcial não pode ser importado se as tags virtuais referirem tags de outros PLCs
+	if missing := missingConfigRefs(doc); len(missing) > 0 {
+		var refs []Tag
+		if err := config.DB.Where("id IN ?", missing).Find(&refs).Error; err != nil {
+			return nil, err
+		}
+		others := map[uint]bool{}
+		var ids []string
+		for _, tag := range refs {
+			if !others[tag.PLCID] {
+				others[tag.PLCID] = true
+				ids = append(ids, fmt.Sprint(tag.PLCID))
+			}
+		}
+		if len(ids) > 0 {
+			sort.Strings(ids)
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf(
+				"as tags virtuais exportadas referem tags dos PLCs %s; inclua-os em plc_id", strings.Join(ids, ", ")))
+		}
+	}
+
+	return doc, nil
+}
+
+// encodeConfigDocument serializa o documento em JSON ou YAML
+func encodeConfigDocument(doc *ConfigDocument, formato string) ([]byte, error) {
+	if formato == "yaml" {
+		var buffer bytes.Buffer
+		encoder := yaml.NewEncoder(&buffer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		if err := encoder.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// decodeConfigDocument interpreta um documento em JSON ou YAML e verifica a versão
+func decodeConfigDocument(data []byte) (*ConfigDocument, error) {
+	var doc ConfigDocument
+
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("documento vazio")
+	}
+	if trimmed[0] == '{' {
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return nil, fmt.Errorf("JSON inválido: %v", err)
+		}
+	} else if err := yaml.Unmarshal(trimmed, &doc); err != nil {
+		return nil, fmt.Errorf("YAML inválido: %v", err)
+	}
+
+	if doc.Versao <= 0 {
+		return nil, fmt.Errorf("o documento não indica a versão")
+	}
+	if doc.Versao > ConfigVersao {
+		return nil, fmt.Errorf("versão %d do documento não suportada (máxima: %d)", doc.Versao, ConfigVersao)
+	}
+	return &doc, nil
+}
+
+// configDiff lista os campos com valores diferentes entre dois modelos, comparando as suas
+// representações no documento (tipo T). IDs e endereços informativos não contam.
+func configDiff[T any](current interface{}, desired interface{}) []string {
+	var a, b T
+	if convertJSON(current, &a) != nil || convertJSON(desired, &b) != nil {
+		return []string{"*"}
+	}
+
+	var fieldsA, fieldsB map[string]interface{}
+	if convertJSON(a, &fieldsA) != nil || convertJSON(b, &fieldsB) != nil {
+		return []string{"*"}
+	}
+
+	keys := map[string]bool{}
+	for key := range fieldsA {
+		keys[key] = true
+	}
+	for key := range fieldsB {
+		keys[key] = true
+	}
+
+	var changes []string
+	for key := range keys {
+		switch key {
+		case "id", "endereco", "tags", "falhas":
+			continue
+		}
+		if !reflect.DeepEqual(fieldsA[key], fieldsB[key]) {
+			changes = append(changes, key)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+// configImporter aplica um documento dentro de uma transação, associando os IDs do documento
+// aos IDs do destino
+type configImporter struct {
+	tx     *gorm.DB
+	result *ConfigImportResult
+
+	ativos      map[uint]uint   // ID no documento -> ID no destino
+	ativoChaves map[uint]string // ID no documento -> caminho na hierarquia
+	plcs        map[uint]*PLC   // ID no documento -> PLC no destino
+	tags        map[uint]uint   // ID no documento -> ID no destino
+}
+
+// importConfig aplica o documento na transação indicada com a estratégia de conflito escolhida.
+// Os erros de validação são *fiber.Error com código 400.
+func importConfig(tx *gorm.DB, doc *ConfigDocument, estrategia string) (*ConfigImportResult, error) {
+	im := &configImporter{
+		tx: tx,
+		result: &ConfigImportResult{
+			Estrategia:    estrategia,
+			Itens:         []ConfigImportItem{},
+			plcsAlterados: map[uint]bool{},
+			tagsAlteradas: map[uint]bool{},
+		},
+		ativos:      map[uint]uint{},
+		ativoChaves: map[uint]string{},
+		plcs:        map[uint]*PLC{},
+		tags:        map[uint]uint{},
+	}
+
+	if err := validateConfigDocument(doc); err != nil {
+		return nil, err
+	}
+	if err := im.importAssets(doc.Ativos); err != nil {
+		return nil, err
+	}
+	for i := range doc.PLCs {
+		if err := im.importPLC(&doc.PLCs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	// As tags virtuais depois das que referem, para que as referências das expressões já existam
+	tags, err := orderConfigTags(doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range tags {
+		if err := im.importTag(ref.plc, ref.tag); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range doc.PLCs {
+		p := &doc.PLCs[i]
+		for j := range p.Falhas {
+			if err := im.importFault(p, &p.Falhas[j]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return im.result, nil
+}
+
+// configTagRef é uma tag do documento com o PLC a que pertence
+type configTagRef struct {
+	plc *ConfigPLC
+	tag *ConfigTag
+}
+
+// isConfigVirtualTag indica se a tag do documento é virtual
+func isConfigVirtualTag(t *ConfigTag) bool {
+	return t.Expressao != nil && strings.TrimSpace(*t.Expressao) != ""
+}
+
+// orderConfigTags retorna as tags do documento pela ordem de importação: primeiro as físicas,
+// depois as virtuais, cada uma depois das tags virtuais que a sua expressão refere
+func orderConfigTags(doc *ConfigDocument) ([]configTagRef, error) {
+	var ordered, virtuals []configTagRef
+	virtualIndex := map[uint]int{} // ID no documento -> posição em virtuals
+	for i := range doc.PLCs {
+		p := &doc.PLCs[i]
+		for j := range p.Tags {
+			ref := configTagRef{plc: p, tag: &p.Tags[j]}
+			if isConfigVirtualTag(ref.tag) {
+				virtualIndex[ref.tag.ID] = len(virtuals)
+				virtuals = append(virtuals, ref)
+			} else {
+				ordered = append(ordered, ref)
+			}
+		}
+	}
+
+	// Ordenação topológica em profundidade; 1 = em visita, 2 = já ordenada
+	state := make([]int, len(virtuals))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case 1:
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tag %s / %s: dependência circular entre tags virtuais",
+				virtuals[i].plc.Nome, virtuals[i].tag.Nome))
+		case 2:
+			return nil
+		}
+
+		state[i] = 1
+		// Expressões inválidas são recusadas na importação da própria tag
+		if program, err := expr.Compile(*virtuals[i].tag.Expressao); err == nil {
+			for _, id := range program.Refs() {
+				if k, virtual := virtualIndex[id]; virtual {
+					if err := visit(k); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		state[i] = 2
+
+		ordered = append(ordered, virtuals[i])
+		return nil
+	}
+	for i := range virtuals {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return ordered, nil
+}
+
+// missingConfigRefs retorna os IDs das tags referidas pelas expressões das tags virtuais
+// que não estão no documento
+func missingConfigRefs(doc *ConfigDocument) []uint {
+	present := map[uint]bool{}
+	for _, p := range doc.PLCs {
+		for _, t := range p.Tags {
+			present[t.ID] = true
+		}
+	}
+
+	var missing []uint
+	for _, p := range doc.PLCs {
+		for i := range p.Tags {
+			if !isConfigVirtualTag(&p.Tags[i]) {
+				continue
+			}
+			program, err := expr.Compile(*p.Tags[i].Expressao)
+			if err != nil {
+				continue
+			}
+			for _, id := range program.Refs() {
+				if !present[id] {
+					present[id] = true
+					missing = append(missing, id)
+				}
+			}
+		}
+	}
+	return missing
+}
+
+// validateConfigDocument verifica as chaves repetidas e os IDs do documento
+func validateConfigDocument(doc *ConfigDocument) error {
+	ativoIDs := map[uint]bool{}
+	for _, a := range doc.Ativos {
+		if a.ID == 0 || ativoIDs[a.ID] {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("ativo %q: id em falta ou repetido", a.Nome))
+		}
+		ativoIDs[a.ID] = true
+	}
+
+	plcNames := map[string]bool{}
+	tagIDs := map[uint]bool{}
+	for _, p := range doc.PLCs {
+		if strings.TrimSpace(p.Nome) == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "PLC sem nome no documento")
+		}
+		if plcNames[p.Nome] {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("PLC %q repetido no documento", p.Nome))
+		}
+		plcNames[p.Nome] = true
+
+		tagNames := map[string]bool{}
+		for _, t := range p.Tags {
+			if tagNames[t.Nome] {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tag %q repetida no PLC %q", t.Nome, p.Nome))
+			}
+			tagNames[t.Nome] = true
+
+			if t.ID == 0 || tagIDs[t.ID] {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tag %q: id em falta ou repetido", t.Nome))
+			}
+			tagIDs[t.ID] = true
+		}
+	}
+	return nil
+}
+
+// decide aplica a estratégia de conflito a uma entidade existente e regista o resultado.
+// Retorna true se a configuração do documento deve ser gravada.
+func (im *configImporter) decide(item ConfigImportItem, changes []string) bool {
+	write := false
+
+	switch {
+	case len(changes) == 0:
+		item.Acao = ImportacaoInalterada
+		im.result.Inalterados++
+	case im.result.Estrategia == ConflitoSubstituir:
+		item.Acao = ImportacaoAtualizar
+		im.result.Atualizar++
+		write = true
+	case im.result.Estrategia == ConflitoIgnorar:
+		item.Acao = ImportacaoIgnorada
+		im.result.Ignorados++
+	default:
+		item.Acao = ImportacaoConflito
+		im.result.Conflitos++
+	}
+
+	item.Alteracoes = changes
+	im.result.Itens = append(im.result.Itens, item)
+	return write
+}
+
+// created regista uma entidade criada
+func (im *configImporter) created(item ConfigImportItem) {
+	item.Acao = ImportacaoCriar
+	im.result.Criar++
+	im.result.Itens = append(im.result.Itens, item)
+}
+
+// importAssets associa os nós do documento aos do destino pelo nome sob o mesmo pai,
+// criando os que faltam. Os pais são tratados antes dos filhos.
+func (im *configImporter) importAssets(ativos []ConfigAtivo) error {
+	sorted := append([]ConfigAtivo(nil), ativos...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return nivelIndex(sorted[i].Nivel) < nivelIndex(sorted[j].Nivel)
+	})
+
+	for _, a := range sorted {
+		chave := a.Nome
+		var parentIDs []uint
+		var paiID *uint
+
+		if a.PaiID != nil {
+			parent, ok := im.ativos[*a.PaiID]
+			if !ok {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("ativo %q: o pai %d não está no documento", a.Nome, *a.PaiID))
+			}
+			parentIDs = []uint{parent}
+			paiID = &parent
+			chave = im.ativoChaves[*a.PaiID] + " / " + a.Nome
+		} else if a.Nivel != NivelSite {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("ativo %q: apenas sites podem ficar na raiz da hierarquia", a.Nome))
+		}
+		im.ativoChaves[a.ID] = chave
+
+		matches, err := findAssetsByName(im.tx, a.Nivel, a.Nome, parentIDs)
+		if err != nil {
+			return err
+		}
+
+		item := ConfigImportItem{Entidade: EntidadeAtivo, Chave: chave, IDOrigem: a.ID}
+
+		if len(matches) > 0 {
+			node := matches[0]
+			item.ID = node.ID
+			im.ativos[a.ID] = node.ID
+
+			var changes []string
+			if !stringPtrEqual(node.Descricao, a.Descricao) {
+				changes = []string{"descricao"}
+			}
+			if im.decide(item, changes) {
+				if err := im.tx.Model(&node).Update("descricao", a.Descricao).Error; err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		node := NoAtivo{PaiID: paiID, Nivel: a.Nivel, Nome: a.Nome, Descricao: a.Descricao}
+		if err := validateAssetNode(im.tx, &node); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("ativo %q: %v", chave, err))
+		}
+		if err := im.tx.Create(&node).Error; err != nil {
+			return err
+		}
+		im.ativos[a.ID] = node.ID
+		item.ID = node.ID
+		im.created(item)
+	}
+	return nil
+}
+
+// mapAsset converte o ativo_id do documento no ID do destino
+func (im *configImporter) mapAsset(id *uint, entidade string) (*uint, error) {
+	if id == nil {
+		return nil, nil
+	}
+	mapped, ok := im.ativos[*id]
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s: o ativo %d não está no documento", entidade, *id))
+	}
+	return &mapped, nil
+}
+
+// importPLC associa o PLC do documento ao existente com o mesmo nome ou cria-o
+func (im *configImporter) importPLC(p *ConfigPLC) error {
+	var desired PLC
+	if err := convertJSON(p, &desired); err != nil {
+		return err
+	}
+	desired.ID = 0
+	desired.Tags = nil
+	if desired.Protocolo == "" {
+		desired.Protocolo = ProtocoloS7
+	}
+	if err := validatePLCProtocolo(&desired); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("PLC %q: %v", p.Nome, err))
+	}
+
+	item := ConfigImportItem{Entidade: EntidadePLC, Chave: p.Nome, IDOrigem: p.ID}
+
+	var existing PLC
+	err := im.tx.Where("nome = ?", p.Nome).First(&existing).Error
+	if err == nil {
+		desired.ID = existing.ID
+		item.ID = existing.ID
+		im.plcs[p.ID] = &existing
+
+		if im.decide(item, configDiff[ConfigPLC](existing, desired)) {
+			if err := im.tx.Save(&desired).Error; err != nil {
+				return err
+			}
+			im.plcs[p.ID] = &desired
+			im.result.plcsAlterados[desired.ID] = true
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err := createConfigRecord(im.tx, &desired, "ativo"); err != nil {
+		return err
+	}
+	item.ID = desired.ID
+	im.plcs[p.ID] = &desired
+	im.result.plcsAlterados[desired.ID] = true
+	im.created(item)
+	return nil
+}
+
+// importTag associa a tag do documento à existente com o mesmo nome no PLC ou cria-a
+func (im *configImporter) importTag(p *ConfigPLC, t *ConfigTag) error {
+	plc := im.plcs[p.ID]
+	chave := p.Nome + " / " + t.Nome
+
+	var desired Tag
+	if err := convertJSON(t, &desired); err != nil {
+		return err
+	}
+	desired.ID = 0
+	desired.PLCID = plc.ID
+	desired.Endereco = ""
+
+	ativoID, err := im.mapAsset(t.AtivoID, "tag "+chave)
+	if err != nil {
+		return err
+	}
+	desired.AtivoID = ativoID
+	if err := resolveTagAsset(im.tx, &desired); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tag %s: %v", chave, err))
+	}
+
+	if isVirtualTag(&desired) {
+		expressao, err := expr.RewriteRefs(*desired.Expressao, func(id uint) (uint, bool) {
+			mapped, ok := im.tags[id]
+			return mapped, ok
+		})
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tag %s: expressão: %v", chave, err))
+		}
+		desired.Expressao = &expressao
+		prepareVirtualTag(&desired)
+	} else if desired.Area == "" {
+		desired.Area = defaultTagArea(plc)
+	}
+
+	if !IsTipoTagSuportado(desired.Tipo) {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tag %s: tipo de tag não suportado: %s", chave, desired.Tipo))
+	}
+
+	item := ConfigImportItem{Entidade: EntidadeTag, Chave: chave, IDOrigem: t.ID}
+
+	var existing Tag
+	err = im.tx.Where("plc_id = ? AND nome = ?", plc.ID, desired.Nome).First(&existing).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	exists := err == nil
+	if exists {
+		desired.ID = existing.ID
+		item.ID = existing.ID
+		im.tags[t.ID] = existing.ID
+
+		if !im.decide(item, configDiff[ConfigTag](existing, desired)) {
+			return nil
+		}
+	}
+
+	if err := validateTagConfig(im.tx, &desired, plc); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("tag %s: %v", chave, err))
+	}
+
+	if exists {
+		if err := im.tx.Save(&desired).Error; err != nil {
+			return err
+		}
+	} else {
+		if err := createConfigRecord(im.tx, &desired, "ativo", "gravavel"); err != nil {
+			return err
+		}
+		im.tags[t.ID] = desired.ID
+		item.ID = desired.ID
+		im.created(item)
+	}
+
+	im.result.tagsAlteradas[plc.ID] = true
+	return nil
+}
+
+// importFault associa a definição de falha do documento à existente para o mesmo bit do PLC ou cria-a
+func (im *configImporter) importFault(p *ConfigPLC, f *ConfigFalha) error {
+	plc := im.plcs[p.ID]
+
+	var desired FaultDefinition
+	if err := convertJSON(f, &desired); err != nil {
+		return err
+	}
+	desired.ID = 0
+	desired.PLCID = plc.ID
+	chave := p.Nome + " / " + faultAddress(&desired).String()
+
+	if desired.BitOffset < 0 || desired.BitOffset > 15 {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("falha %s: offset de bit deve estar entre 0 e 15", chave))
+	}
+
+	ativoID, err := im.mapAsset(f.AtivoID, "falha "+chave)
+	if err != nil {
+		return err
+	}
+	desired.AtivoID = ativoID
+	if err := resolveFaultAsset(im.tx, &desired); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("falha %s: %v", chave, err))
+	}
+
+	item := ConfigImportItem{Entidade: EntidadeFalha, Chave: chave, IDOrigem: f.ID}
+
+	var existing FaultDefinition
+	err = im.tx.Where("plc_id = ? AND db_number = ? AND byte_offset = ? AND bit_offset = ?",
+		plc.ID, desired.DBNumber, desired.ByteOffset, desired.BitOffset).First(&existing).Error
+	if err == nil {
+		desired.ID = existing.ID
+		desired.CreatedAt = existing.CreatedAt
+		item.ID = existing.ID
+
+		if im.decide(item, configDiff[ConfigFalha](existing, desired)) {
+			if err := im.tx.Save(&desired).Error; err != nil {
+				return err
+			}
+			im.result.falhasGravadas = true
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if err := createConfigRecord(im.tx, &desired, "ativo"); err != nil {
+		return err
+	}
+	item.ID = desired.ID
+	im.result.falhasGravadas = true
+	im.created(item)
+	return nil
+}
+
+// createConfigRecord cria o registo e grava depois os campos booleanos indicados: o GORM omite
+// os valores zero na criação e a base de dados aplicaria o valor padrão (true) em vez de false
+func createConfigRecord(tx *gorm.DB, value interface{}, boolFields ...string) error {
+	if err := tx.Create(value).Error; err != nil {
+		return err
+	}
+	return tx.Model(value).Select(boolFields).Updates(value).Error
+}
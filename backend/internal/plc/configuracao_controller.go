@@ -0,0 +1,271 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ConfigTransferController gerencia a exportação e importação da configuração de PLCs,
+// tags, definições de falha e hierarquia de ativos entre instalações
+type ConfigTransferController struct {
+	manager      *Manager
+	faultManager *FaultManager
+}
+
+// NewConfigTransferController cria um novo controlador de exportação e importação de configuração
+func NewConfigTransferController(manager *Manager, faultManager *FaultManager) *ConfigTransferController {
+	return &ConfigTransferController{
+		manager:      manager,
+		faultManager: faultManager,
+	}
+}
+
+// ExportConfig exporta a configuração em JSON (padrão) ou YAML (?formato=yaml),
+// opcionalmente apenas dos PLCs indicados (?plc_id=1,2). A exportação parcial é recusada
+// se as tags virtuais dos PLCs indicados referirem tags de outros PLCs.
+func (c *ConfigTransferController) ExportConfig(ctx *fiber.Ctx) error {
+	formato := strings.ToLower(ctx.Query("formato", "json"))
+	if formato != "json" && formato != "yaml" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Formato inválido (válidos: json, yaml)",
+		})
+	}
+
+	var plcIDs []uint
+	if value := ctx.Query("plc_id"); value != "" {
+		for _, part := range strings.Split(value, ",") {
+			id, err := strconv.ParseUint(strings.TrimSpace(part), 10, 32)
+			if err != nil {
+				return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"sucesso":  false,
+					"mensagem": "plc_id inválido",
+				})
+			}
+			plcIDs = append(plcIDs, uint(id))
+		}
+	}
+
+	doc, err := exportConfig(plcIDs)
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return ctx.Status(fe.Code).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": fe.Message,
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao exportar configuração",
+			"erro":     err.Error(),
+		})
+	}
+
+	data, err := encodeConfigDocument(doc, formato)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao serializar configuração",
+			"erro":     err.Error(),
+		})
+	}
+
+	// Registrar log de auditoria
+	userID := ctx.Locals("user_id").(uint)
+	userName := ctx.Locals("user_name").(string)
+
+	models.RegistrarAuditoria(
+		userID,
+		userName,
+		"Exportar",
+		"Configuracao",
+		ctx.IP(),
+		map[string]interface{}{
+			"formato": formato,
+			"plcs":    len(doc.PLCs),
+			"ativos":  len(doc.Ativos),
+		},
+	)
+
+	contentType := fiber.MIMEApplicationJSON
+	if formato == "yaml" {
+		contentType = "application/yaml"
+	}
+	ctx.Set(fiber.HeaderContentType, contentType)
+	ctx.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="configuracao-%s.%s"`,
+		doc.ExportadoEm.Format("20060102-150405"), formato))
+	return ctx.Status(fiber.StatusOK).Send(data)
+}
+
+// ImportConfig importa um documento de configuração (JSON ou YAML, no corpo ou no ficheiro "arquivo").
+// As entidades existentes com outra configuração seguem ?estrategia=ignorar|substituir|falhar (padrão falhar);
+// com ?simular=true as diferenças são calculadas e nada é gravado. A importação é feita numa única transação.
+func (c *ConfigTransferController) ImportConfig(ctx *fiber.Ctx) error {
+	estrategia := strings.ToLower(ctx.Query("estrategia", ConflitoFalhar))
+	valid := false
+	for _, e := range EstrategiasConflito {
+		if e == estrategia {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":             false,
+			"mensagem":            "Estratégia de conflito inválida: " + estrategia,
+			"estrategias_validas": EstrategiasConflito,
+		})
+	}
+	simular := ctx.QueryBool("simular", false)
+
+	data := ctx.Body()
+	if file, err := ctx.FormFile("arquivo"); err == nil {
+		content, err := readFormFile(file)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Erro ao ler o ficheiro",
+				"erro":     err.Error(),
+			})
+		}
+		data = []byte(content)
+	}
+
+	doc, err := decodeConfigDocument(data)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Documento de configuração inválido",
+			"erro":     err.Error(),
+		})
+	}
+
+	var result *ConfigImportResult
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if result, err = importConfig(tx, doc, estrategia); err != nil {
+			return err
+		}
+		if result.Conflitos > 0 {
+			return errConfigConflicts
+		}
+		if simular {
+			return errConfigDryRun
+		}
+		return nil
+	})
+
+	switch {
+	case errors.Is(err, errConfigDryRun):
+		result.Simulacao = true
+		result.clearCreatedIDs()
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"sucesso":  true,
+			"mensagem": "Simulação concluída; nenhuma alteração foi gravada",
+			"dados":    result,
+		})
+	case errors.Is(err, errConfigConflicts):
+		result.Simulacao = simular
+		result.clearCreatedIDs()
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": fmt.Sprintf("%d entidades existem com outra configuração; nenhuma alteração foi gravada", result.Conflitos),
+			"dados":    result,
+		})
+	case err != nil:
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			return ctx.Status(fe.Code).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Importação cancelada; nenhuma alteração foi gravada",
+				"erro":     fe.Message,
+			})
+		}
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao importar configuração; nenhuma alteração foi gravada",
+			"erro":     err.Error(),
+		})
+	}
+
+	// Registrar log de auditoria
+	userID := ctx.Locals("user_id").(uint)
+	userName := ctx.Locals("user_name").(string)
+
+	models.RegistrarAuditoria(
+		userID,
+		userName,
+		"Importar",
+		"Configuracao",
+		ctx.IP(),
+		map[string]interface{}{
+			"versao":       doc.Versao,
+			"exportado_em": doc.ExportadoEm.Format(time.RFC3339),
+			"estrategia":   estrategia,
+			"criados":      result.Criar,
+			"atualizados":  result.Atualizar,
+			"ignorados":    result.Ignorados,
+		},
+	)
+
+	c.refreshAfterImport(result)
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Configuração importada com sucesso",
+		"dados":    result,
+	})
+}
+
+// refreshAfterImport aplica a configuração importada ao gerenciador e ao monitoramento de falhas
+func (c *ConfigTransferController) refreshAfterImport(result *ConfigImportResult) {
+	plcIDs := map[uint]bool{}
+	for id := range result.plcsAlterados {
+		plcIDs[id] = true
+	}
+	for id := range result.tagsAlteradas {
+		plcIDs[id] = true
+	}
+
+	for id := range plcIDs {
+		var plc PLC
+		if err := config.DB.First(&plc, id).Error; err != nil {
+			log.Printf("Erro ao carregar PLC %d após importação: %v", id, err)
+			continue
+		}
+
+		if !plc.Ativo {
+			c.manager.RemovePLC(plc.ID)
+			continue
+		}
+
+		if _, managed := c.manager.GetPLC(plc.ID); !managed {
+			// AddPLC carrega as tags
+			c.manager.AddPLC(&plc)
+			continue
+		}
+
+		if result.plcsAlterados[plc.ID] {
+			c.manager.UpdatePLC(&plc)
+		}
+		if err := c.manager.ReloadPLCTags(plc.ID); err != nil {
+			log.Printf("Erro ao recarregar tags do PLC %s após importação: %v", plc.Nome, err)
+		}
+	}
+
+	if c.faultManager != nil {
+		if err := c.faultManager.ReloadDefinitions(); err != nil {
+			log.Printf("Erro ao recarregar definições de falha após importação: %v", err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package plc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configDocWithTags monta um documento de configuração com as tags indicadas num único PLC.
+// As tags com expressão são virtuais.
+func configDocWithTags(tags map[uint]string) *ConfigDocument {
+	p := ConfigPLC{ID: 1, Nome: "PLC1"}
+	for id := uint(1); len(p.Tags) < len(tags); id++ {
+		expressao, exists := tags[id]
+		if !exists {
+			continue
+		}
+		t := ConfigTag{ID: id, Nome: "T" + string(rune('0'+id))}
+		if expressao != "" {
+			t.Expressao = &expressao
+		}
+		p.Tags = append(p.Tags, t)
+	}
+	return &ConfigDocument{Versao: ConfigVersao, PLCs: []ConfigPLC{p}}
+}
+
+func TestOrderConfigTags(t *testing.T) {
+	tests := []struct {
+		name  string
+		tags  map[uint]string // ID -> expressão ("" = tag física)
+		order []uint
+		err   string
+	}{
+		{
+			name:  "físicas primeiro",
+			tags:  map[uint]string{1: "[2] * 2", 2: "", 3: ""},
+			order: []uint{2, 3, 1},
+		},
+		{
+			name:  "virtual referida por outra anterior no documento",
+			tags:  map[uint]string{1: "", 2: "[4] + 1", 3: "[2] + [4]", 4: "[1] * 10"},
+			order: []uint{1, 4, 2, 3},
+		},
+		{
+			name:  "cadeia em ordem inversa",
+			tags:  map[uint]string{1: "[2]", 2: "[3]", 3: "[4]", 4: "[5]", 5: ""},
+			order: []uint{5, 4, 3, 2, 1},
+		},
+		{
+			name:  "expressão inválida mantém a posição",
+			tags:  map[uint]string{1: "[2] +", 2: "[3]", 3: ""},
+			order: []uint{3, 1, 2},
+		},
+		{
+			name: "dependência circular",
+			tags: map[uint]string{1: "[2]", 2: "[3]", 3: "[1]"},
+			err:  "dependência circular",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			refs, err := orderConfigTags(configDocWithTags(tt.tags))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("erro = %v, esperado %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var order []uint
+			for _, ref := range refs {
+				order = append(order, ref.tag.ID)
+			}
+			if !reflect.DeepEqual(order, tt.order) {
+				t.Errorf("ordem = %v, esperado %v", order, tt.order)
+			}
+		})
+	}
+}
+
+func TestMissingConfigRefs(t *testing.T) {
+	tests := []struct {
+		name    string
+		tags    map[uint]string
+		missing []uint
+	}{
+		{name: "todas no documento", tags: map[uint]string{1: "", 2: "[1] + 1"}},
+		{name: "tags de outro PLC", tags: map[uint]string{1: "", 2: "[1] + [7] + [9] - [7]"}, missing: []uint{7, 9}},
+		{name: "expressão inválida ignorada", tags: map[uint]string{1: "[8] +"}},
+	}
+
+	for _, tt := range tests {
+		if got := missingConfigRefs(configDocWithTags(tt.tags)); !reflect.DeepEqual(got, tt.missing) {
+			t.Errorf("%s: %v, esperado %v", tt.name, got, tt.missing)
+		}
+	}
+}
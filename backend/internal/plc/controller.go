@@ -1,7 +1,12 @@
 package plc
 
 import (
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/danilo/edp_gestao_utilizadores/internal/config"
@@ -74,6 +79,10 @@ func (c *Controller) GetPLCByID(ctx *fiber.Ctx) error {
 		plc.Conectado = activePLC.Conectado
 		plc.UltimoErro = activePLC.UltimoErro
 		plc.UltimaLeitura = activePLC.UltimaLeitura
+		if activePLC.Client != nil {
+			saude := activePLC.Client.Health()
+			plc.Saude = &saude
+		}
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -82,6 +91,88 @@ func (c *Controller) GetPLCByID(ctx *fiber.Ctx) error {
 	})
 }
 
+// GetPLCDiagnostics lê a identificação e o estado da CPU de um PLC
+func (c *Controller) GetPLCDiagnostics(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	activePLC, exists := c.manager.GetPLC(uint(id))
+	if !exists {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "PLC não encontrado ou inativo",
+		})
+	}
+
+	diag, err := c.manager.GetDiagnostics(uint(id))
+	if err != nil {
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Falha ao ler diagnóstico da CPU",
+			"erro":     err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   diag,
+		"plc": fiber.Map{
+			"id":        activePLC.ID,
+			"nome":      activePLC.Nome,
+			"conectado": activePLC.Conectado,
+		},
+	})
+}
+
+// GetPLCStatistics retorna as estatísticas de comunicação de um PLC e a sua disponibilidade diária
+func (c *Controller) GetPLCStatistics(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	dias := ctx.QueryInt("dias", 30)
+	if dias < 1 || dias > 366 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Parâmetro dias deve estar entre 1 e 366",
+		})
+	}
+
+	stats, exists := c.manager.PLCStatistics(uint(id))
+	if !exists {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "PLC não encontrado ou inativo",
+		})
+	}
+
+	disponibilidade, err := c.manager.GetAvailability(uint(id), dias)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Falha ao consultar disponibilidade diária",
+			"erro":     err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados": fiber.Map{
+			"estatisticas":           stats,
+			"disponibilidade_diaria": disponibilidade,
+		},
+	})
+}
+
 // CreatePLC cria um novo PLC
 func (c *Controller) CreatePLC(ctx *fiber.Ctx) error {
 	var plc PLC
@@ -94,6 +185,18 @@ func (c *Controller) CreatePLC(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if plc.Protocolo == "" {
+		plc.Protocolo = ProtocoloS7
+	}
+
+	if err := validatePLCProtocolo(&plc); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":            false,
+			"mensagem":           err.Error(),
+			"protocolos_validos": ProtocolosSuportados,
+		})
+	}
+
 	result := config.DB.Create(&plc)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -114,9 +217,10 @@ func (c *Controller) CreatePLC(ctx *fiber.Ctx) error {
 		"PLC",
 		ctx.IP(),
 		map[string]interface{}{
-			"id":       plc.ID,
-			"nome":     plc.Nome,
-			"endereco": plc.IPAddress,
+			"id":        plc.ID,
+			"nome":      plc.Nome,
+			"protocolo": plc.Protocolo,
+			"endereco":  plc.IPAddress,
 		},
 	)
 
@@ -164,6 +268,18 @@ func (c *Controller) UpdatePLC(ctx *fiber.Ctx) error {
 	// Garantir que o ID não mude
 	plc.ID = uint(id)
 
+	if plc.Protocolo == "" {
+		plc.Protocolo = ProtocoloS7
+	}
+
+	if err := validatePLCProtocolo(&plc); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":            false,
+			"mensagem":           err.Error(),
+			"protocolos_validos": ProtocolosSuportados,
+		})
+	}
+
 	result = config.DB.Save(&plc)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -184,10 +300,17 @@ func (c *Controller) UpdatePLC(ctx *fiber.Ctx) error {
 		"PLC",
 		ctx.IP(),
 		map[string]interface{}{
-			"id":       plc.ID,
-			"nome":     plc.Nome,
-			"endereco": plc.IPAddress,
-			"ativo":    plc.Ativo,
+			"id":           plc.ID,
+			"nome":         plc.Nome,
+			"protocolo":    plc.Protocolo,
+			"endereco":     plc.IPAddress,
+			"ativo":        plc.Ativo,
+			"tipo_conexao": plc.TipoConexao,
+			"gateway":      plc.Gateway,
+			"local_tsap":   plc.LocalTSAP,
+			"remote_tsap":  plc.RemoteTSAP,
+			"subrede_s7":   plc.SubredeS7,
+			"endereco_mpi": plc.EnderecoMPI,
 		},
 	)
 
@@ -199,8 +322,8 @@ func (c *Controller) UpdatePLC(ctx *fiber.Ctx) error {
 			c.manager.RemovePLC(plc.ID)
 		}
 	} else if plc.Ativo {
-		// Se continua ativo, reiniciar a conexão para aplicar mudanças
-		c.manager.RestartPLC(&plc)
+		// Se continua ativo, aplicar as mudanças (a conexão só é reiniciada se os parâmetros mudaram)
+		c.manager.UpdatePLC(&plc)
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
@@ -276,8 +399,17 @@ func (c *Controller) GetPLCTags(ctx *fiber.Ctx) error {
 		})
 	}
 
+	assetIDs, err := assetFilterIDs(ctx)
+	if err != nil {
+		return assetError(ctx, "Erro ao obter subárvore do ativo", err)
+	}
+
 	var tags []Tag
-	result := config.DB.Where("plc_id = ?", id).Find(&tags)
+	query := config.DB.Where("plc_id = ?", id)
+	if assetIDs != nil {
+		query = query.Where("ativo_id IN ?", assetIDs)
+	}
+	result := query.Find(&tags)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"sucesso":  false,
@@ -289,9 +421,11 @@ func (c *Controller) GetPLCTags(ctx *fiber.Ctx) error {
 	// Adicionar valores atuais para tags se o PLC estiver ativo
 	if activePLC, exists := c.manager.GetPLC(uint(id)); exists {
 		for i, tag := range tags {
-			for _, activeTag := range activePLC.Tags {
+			for _, activeTag := range activePLC.tagList() {
 				if activeTag.ID == tag.ID {
 					tags[i].UltimoValor = activeTag.UltimoValor
+					tags[i].UltimoValorBruto = activeTag.UltimoValorBruto
+					tags[i].Qualidade = activeTag.Qualidade
 					tags[i].UltimaLeitura = activeTag.UltimaLeitura
 					tags[i].UltimoErro = activeTag.UltimoErro
 					tags[i].UltimoErroTime = activeTag.UltimoErroTime
@@ -329,9 +463,11 @@ func (c *Controller) GetTagByID(ctx *fiber.Ctx) error {
 
 	// Adicionar valor atual se o PLC estiver ativo
 	if activePLC, exists := c.manager.GetPLC(tag.PLCID); exists {
-		for _, activeTag := range activePLC.Tags {
+		for _, activeTag := range activePLC.tagList() {
 			if activeTag.ID == tag.ID {
 				tag.UltimoValor = activeTag.UltimoValor
+				tag.UltimoValorBruto = activeTag.UltimoValorBruto
+				tag.Qualidade = activeTag.Qualidade
 				tag.UltimaLeitura = activeTag.UltimaLeitura
 				tag.UltimoErro = activeTag.UltimoErro
 				tag.UltimoErroTime = activeTag.UltimoErroTime
@@ -358,6 +494,18 @@ func (c *Controller) CreateTag(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if isVirtualTag(&tag) {
+		prepareVirtualTag(&tag)
+	} else if tag.Endereco != "" {
+		if err := applyTagAddress(&tag); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Endereço inválido",
+				"erro":     err.Error(),
+			})
+		}
+	}
+
 	// Verificar se o PLC existe
 	var plc PLC
 	result := config.DB.First(&plc, tag.PLCID)
@@ -368,6 +516,32 @@ func (c *Controller) CreateTag(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if tag.Area == "" {
+		tag.Area = defaultTagArea(&plc)
+	}
+
+	if err := resolveTagAsset(config.DB, &tag); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
+	if !IsTipoTagSuportado(tag.Tipo) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":       false,
+			"mensagem":      "Tipo de tag não suportado: " + tag.Tipo,
+			"tipos_validos": TiposTagSuportados,
+		})
+	}
+
+	if err := validateTagConfig(config.DB, &tag, &plc); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
 	result = config.DB.Create(&tag)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -391,8 +565,11 @@ func (c *Controller) CreateTag(ctx *fiber.Ctx) error {
 			"id":        tag.ID,
 			"nome":      tag.Nome,
 			"plc_id":    tag.PLCID,
+			"area":      tag.Area,
 			"db_number": tag.DBNumber,
 			"tipo":      tag.Tipo,
+			"expressao": tag.Expressao,
+			"ativo_id":  tag.AtivoID,
 		},
 	)
 
@@ -429,6 +606,12 @@ func (c *Controller) UpdateTag(ctx *fiber.Ctx) error {
 
 	oldPLCID := tag.PLCID
 	oldActive := tag.Ativo
+	// Cópias: o BodyParser escreve sobre os valores apontados pelos campos
+	oldAtivoID := copyPtr(tag.AtivoID)
+	oldSubsistema := copyPtr(tag.Subsistema)
+
+	// O endereço só é reinterpretado se vier no pedido
+	tag.Endereco = ""
 
 	if err := ctx.BodyParser(&tag); err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -441,6 +624,23 @@ func (c *Controller) UpdateTag(ctx *fiber.Ctx) error {
 	// Garantir que o ID não mude
 	tag.ID = uint(id)
 
+	// Um subsistema alterado sem ativo_id é procurado na hierarquia
+	if uintPtrEqual(tag.AtivoID, oldAtivoID) && !stringPtrEqual(tag.Subsistema, oldSubsistema) {
+		tag.AtivoID = nil
+	}
+
+	if isVirtualTag(&tag) {
+		prepareVirtualTag(&tag)
+	} else if tag.Endereco != "" {
+		if err := applyTagAddress(&tag); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Endereço inválido",
+				"erro":     err.Error(),
+			})
+		}
+	}
+
 	// Verificar se o PLC existe
 	var plc PLC
 	result = config.DB.First(&plc, tag.PLCID)
@@ -451,6 +651,32 @@ func (c *Controller) UpdateTag(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if tag.Area == "" {
+		tag.Area = defaultTagArea(&plc)
+	}
+
+	if err := resolveTagAsset(config.DB, &tag); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
+	if !IsTipoTagSuportado(tag.Tipo) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":       false,
+			"mensagem":      "Tipo de tag não suportado: " + tag.Tipo,
+			"tipos_validos": TiposTagSuportados,
+		})
+	}
+
+	if err := validateTagConfig(config.DB, &tag, &plc); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
 	result = config.DB.Save(&tag)
 	if result.Error != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -474,8 +700,11 @@ func (c *Controller) UpdateTag(ctx *fiber.Ctx) error {
 			"id":        tag.ID,
 			"nome":      tag.Nome,
 			"plc_id":    tag.PLCID,
+			"area":      tag.Area,
 			"db_number": tag.DBNumber,
 			"tipo":      tag.Tipo,
+			"expressao": tag.Expressao,
+			"ativo_id":  tag.AtivoID,
 			"ativo":     tag.Ativo,
 		},
 	)
@@ -534,6 +763,27 @@ func (c *Controller) DeleteTag(ctx *fiber.Ctx) error {
 		})
 	}
 
+	// Não excluir tags usadas nas expressões de tags virtuais
+	dependents, err := virtualTagsReferencing(tag.ID)
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao verificar tags virtuais",
+			"erro":     err.Error(),
+		})
+	}
+	if len(dependents) > 0 {
+		nomes := make([]string, len(dependents))
+		for i, dependent := range dependents {
+			nomes[i] = dependent.Nome
+		}
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Tag usada nas expressões de tags virtuais",
+			"dados":    nomes,
+		})
+	}
+
 	// Remover do gerenciador primeiro se estiver ativa
 	if tag.Ativo {
 		c.manager.RemoveTagFromPLC(tag.PLCID, tag.ID)
@@ -591,7 +841,7 @@ func (c *Controller) ReadTagValue(ctx *fiber.Ctx) error {
 		})
 	}
 
-	value, err := c.manager.ReadTag(tag.PLCID, tag.ID)
+	value, raw, err := c.manager.ReadTag(tag.PLCID, tag.ID)
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"sucesso":  false,
@@ -603,14 +853,121 @@ func (c *Controller) ReadTagValue(ctx *fiber.Ctx) error {
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 		"sucesso": true,
 		"dados": fiber.Map{
-			"id":        tag.ID,
-			"nome":      tag.Nome,
-			"valor":     value,
-			"timestamp": time.Now(),
+			"id":          tag.ID,
+			"nome":        tag.Nome,
+			"valor":       value,
+			"valor_bruto": raw,
+			"unidade":     tag.Unidade,
+			"qualidade":   QualidadeBoa,
+			"timestamp":   time.Now(),
 		},
 	})
 }
 
+// GetTagHistory retorna o histórico de uma tag (amostras, intervalos agregados ou série reduzida)
+func (c *Controller) GetTagHistory(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	return c.queryHistory(ctx, []uint{uint(id)})
+}
+
+// GetTagsHistory retorna o histórico de várias tags, indicadas em ids=1,2,3
+func (c *Controller) GetTagsHistory(ctx *fiber.Ctx) error {
+	var ids []uint
+	for _, part := range strings.Split(ctx.Query("ids"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "ID inválido: " + part,
+			})
+		}
+		ids = append(ids, uint(id))
+	}
+
+	return c.queryHistory(ctx, ids)
+}
+
+// queryHistory interpreta os parâmetros inicio, fim, modo, intervalo e pontos e executa a consulta
+func (c *Controller) queryHistory(ctx *fiber.Ctx, ids []uint) error {
+	query := TrendQuery{
+		TagIDs: ids,
+		Modo:   ctx.Query("modo"),
+	}
+
+	var err error
+	if inicio := ctx.Query("inicio"); inicio != "" {
+		if query.Inicio, err = time.Parse(time.RFC3339, inicio); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "inicio inválido, use o formato RFC3339",
+			})
+		}
+	}
+	if fim := ctx.Query("fim"); fim != "" {
+		if query.Fim, err = time.Parse(time.RFC3339, fim); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "fim inválido, use o formato RFC3339",
+			})
+		}
+	}
+	if intervalo := ctx.Query("intervalo"); intervalo != "" {
+		if query.Intervalo, err = time.ParseDuration(intervalo); err != nil || query.Intervalo <= 0 {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "intervalo inválido, use por exemplo 30s, 5m ou 1h",
+			})
+		}
+	}
+	if pontos := ctx.Query("pontos"); pontos != "" {
+		if query.Pontos, err = strconv.Atoi(pontos); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "pontos inválido",
+			})
+		}
+	}
+
+	series, err := QueryTrends(query)
+	if errors.Is(err, errTagNaoEncontrada) {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Tag não encontrada",
+		})
+	}
+	if errors.Is(err, errConsultaInvalida) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Parâmetros de consulta inválidos",
+			"erro":     err.Error(),
+		})
+	}
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao consultar histórico",
+			"erro":     err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   series,
+		"total":   len(series),
+	})
+}
+
 // WriteTagValue escreve um valor em uma tag
 func (c *Controller) WriteTagValue(ctx *fiber.Ctx) error {
 	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
@@ -642,7 +999,23 @@ func (c *Controller) WriteTagValue(ctx *fiber.Ctx) error {
 		})
 	}
 
-	if err := c.manager.WriteTag(tag.PLCID, tag.ID, payload.Valor); err != nil {
+	// A política de escrita e a auditoria são aplicadas pelo gerenciador
+	wc := WriteContext{
+		UtilizadorID:   ctx.Locals("user_id").(uint),
+		NomeUtilizador: ctx.Locals("user_name").(string),
+		Perfil:         ctx.Locals("user_profile").(string),
+		Origem:         ctx.IP(),
+	}
+
+	if err := c.manager.WriteTag(tag.PLCID, tag.ID, payload.Valor, wc); err != nil {
+		var rejected *WriteRejectedError
+		if errors.As(err, &rejected) {
+			return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Escrita recusada",
+				"erro":     rejected.Motivo,
+			})
+		}
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"sucesso":  false,
 			"mensagem": "Erro ao escrever na tag",
@@ -650,6 +1023,165 @@ func (c *Controller) WriteTagValue(ctx *fiber.Ctx) error {
 		})
 	}
 
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Valor escrito com sucesso",
+	})
+}
+
+// GetNatsInfo retorna o URL do NATS para clientes e o mapa de subjects
+func (c *Controller) GetNatsInfo(ctx *fiber.Ctx) error {
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados": fiber.Map{
+			"url":      NatsPublicURL(),
+			"subjects": NatsSubjects,
+		},
+	})
+}
+
+// GetNatsCredentials emite credenciais NATS de curta duração para o utilizador autenticado,
+// com permissões de publicação e assinatura derivadas do seu perfil
+func (c *Controller) GetNatsCredentials(ctx *fiber.Ctx) error {
+	userID := ctx.Locals("user_id").(uint)
+	perfil := ctx.Locals("user_profile").(string)
+
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Utilizador não encontrado",
+		})
+	}
+
+	credentials, err := IssueNatsCredentials(user, perfil)
+	if err != nil {
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao emitir credenciais NATS",
+			"erro":     err.Error(),
+		})
+	}
+
+	models.RegistrarAuditoria(
+		user.ID,
+		user.Nome,
+		"Emitir Credenciais",
+		"NATS",
+		ctx.IP(),
+		map[string]interface{}{
+			"expira_em": credentials.ExpiraEm,
+			"publicar":  credentials.Publicar,
+		},
+	)
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   credentials,
+	})
+}
+
+// dbSourcePayload é o pedido de importação de uma fonte de DB, em JSON ou em formulário multipart
+// com o ficheiro no campo "arquivo"
+type dbSourcePayload struct {
+	Fonte          string  `json:"fonte" form:"fonte"`
+	Bloco          string  `json:"bloco" form:"bloco"`
+	DBNumber       int     `json:"db_number" form:"db_number"`
+	Prefixo        *string `json:"prefixo" form:"prefixo"`
+	UpdateInterval int     `json:"update_interval_ms" form:"update_interval_ms"`
+	AtivoID        *uint   `json:"ativo_id" form:"ativo_id"`
+	Aplicar        bool    `json:"aplicar" form:"aplicar"` // false = apenas pré-visualizar
+}
+
+// ImportDBSource importa as tags de uma fonte de DB do TIA Portal/STEP 7 (.db/.scl) para o PLC.
+// Sem aplicar=true devolve apenas a pré-visualização das tags a criar e a atualizar.
+func (c *Controller) ImportDBSource(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var plc PLC
+	if result := config.DB.First(&plc, id); result.Error != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "PLC não encontrado",
+		})
+	}
+
+	if plcProtocolo(&plc) != ProtocoloS7 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "A importação de fontes de DB só é suportada em PLCs S7",
+		})
+	}
+
+	var payload dbSourcePayload
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Formato de solicitação inválido",
+			"erro":     err.Error(),
+		})
+	}
+
+	if file, err := ctx.FormFile("arquivo"); err == nil {
+		content, err := readFormFile(file)
+		if err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Erro ao ler o ficheiro",
+				"erro":     err.Error(),
+			})
+		}
+		payload.Fonte = content
+	}
+
+	if strings.TrimSpace(payload.Fonte) == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Indique a fonte do DB em fonte ou no ficheiro arquivo",
+		})
+	}
+
+	if payload.UpdateInterval <= 0 {
+		payload.UpdateInterval = int(Config.DefaultTagInterval / time.Millisecond)
+	}
+
+	plan, err := planDBImport(&plc, payload.Fonte, dbImportOptions{
+		Bloco:          payload.Bloco,
+		DBNumber:       payload.DBNumber,
+		Prefixo:        payload.Prefixo,
+		UpdateInterval: payload.UpdateInterval,
+		AtivoID:        payload.AtivoID,
+	})
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Fonte do DB inválida",
+			"erro":     err.Error(),
+		})
+	}
+
+	if !payload.Aplicar {
+		return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+			"sucesso":  true,
+			"mensagem": "Pré-visualização da importação; envie aplicar=true para gravar",
+			"dados":    plan,
+		})
+	}
+
+	if err := applyDBImport(plan); err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao importar tags; nenhuma alteração foi gravada",
+			"erro":     err.Error(),
+		})
+	}
+
 	// Registrar log de auditoria
 	userID := ctx.Locals("user_id").(uint)
 	userName := ctx.Locals("user_name").(string)
@@ -657,18 +1189,44 @@ func (c *Controller) WriteTagValue(ctx *fiber.Ctx) error {
 	models.RegistrarAuditoria(
 		userID,
 		userName,
-		"Escrever",
+		"Importar",
 		"Tag",
 		ctx.IP(),
 		map[string]interface{}{
-			"id":    tag.ID,
-			"nome":  tag.Nome,
-			"valor": payload.Valor,
+			"plc_id":      plc.ID,
+			"bloco":       plan.Bloco,
+			"db_number":   plan.DBNumber,
+			"criadas":     plan.Criar,
+			"atualizadas": plan.Atualizar,
+			"ativo_id":    payload.AtivoID,
 		},
 	)
 
+	// Recarregar as tags de uma só vez em vez de reiniciar os leitores tag a tag
+	if plc.Ativo && plan.Criar+plan.Atualizar > 0 {
+		if err := c.manager.ReloadPLCTags(plc.ID); err != nil {
+			log.Printf("Erro ao recarregar tags do PLC %s após importação: %v", plc.Nome, err)
+		}
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 		"sucesso":  true,
-		"mensagem": "Valor escrito com sucesso",
+		"mensagem": "Importação concluída",
+		"dados":    plan,
 	})
 }
+
+// readFormFile lê o conteúdo de um ficheiro enviado num formulário multipart
+func readFormFile(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
@@ -0,0 +1,251 @@
+// Package dbsource interpreta fontes de data blocks exportadas do TIA Portal ou do STEP 7
+// (ficheiros .db/.scl com DATA_BLOCK e TYPE) e calcula os endereços absolutos de cada membro
+// segundo as regras de alinhamento dos DBs não otimizados:
+//
+//   - Bool ocupam um bit; Bool seguidos partilham o mesmo byte
+//   - Byte, Char, SInt e USInt começam no byte seguinte
+//   - os restantes tipos, estruturas e arrays começam num endereço par
+//   - estruturas e arrays ocupam um número par de bytes
+package dbsource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Member é um membro elementar do DB com o seu endereço absoluto
+type Member struct {
+	Path       string // Caminho simbólico, ex.: Motor.Velocidade ou Alarmes[3]
+	Type       string // Tipo declarado, ex.: Real, String
+	Length     int    // Comprimento máximo de String e WString
+	ByteOffset int
+	BitOffset  *int // Apenas Bool
+	Comment    string
+}
+
+// Block é um data block da fonte
+type Block struct {
+	Name    string // Nome simbólico ou DBn
+	Number  int    // Número do DB se a fonte o indicar (DATA_BLOCK DB10), 0 caso contrário
+	Size    int    // Tamanho total em bytes
+	Members []Member
+}
+
+// Parse interpreta a fonte e retorna os data blocks que contém, com os membros elementares
+// ordenados por endereço. maxMembers limita o total de membros (0 = sem limite).
+func Parse(source string, maxMembers int) ([]*Block, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, types: make(map[string]*typeDecl)}
+	decls, err := p.parseFile()
+	if err != nil {
+		return nil, err
+	}
+	if len(decls) == 0 {
+		return nil, fmt.Errorf("a fonte não contém nenhum DATA_BLOCK")
+	}
+
+	var blocks []*Block
+	total := 0
+	for _, decl := range decls {
+		l := &layout{types: p.types, maxMembers: maxMembers, count: total}
+		end, err := l.place(decl.typ, "", "", 0)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", decl.name, err)
+		}
+		total = l.count
+
+		blocks = append(blocks, &Block{
+			Name:    decl.name,
+			Number:  decl.number,
+			Size:    alignWord(end) / 8,
+			Members: l.members,
+		})
+	}
+
+	return blocks, nil
+}
+
+// Tamanho em bytes dos tipos elementares com mais de um byte
+var elementarySizes = map[string]int{
+	"int": 2, "uint": 2, "word": 2, "date": 2, "s5time": 2, "wchar": 2,
+	"dint": 4, "udint": 4, "dword": 4, "real": 4, "time": 4, "time_of_day": 4, "tod": 4,
+	"lint": 8, "ulint": 8, "lword": 8, "lreal": 8, "ltime": 8, "ltod": 8, "ldt": 8,
+	"date_and_time": 8, "dt": 8,
+	"dtl": 12,
+}
+
+// Tipos de um byte, alinhados ao byte
+var byteTypes = map[string]bool{"byte": true, "char": true, "sint": true, "usint": true}
+
+// typeDecl é a declaração de um tipo: elementar, String, estrutura, array ou tipo de dados do utilizador
+type typeDecl struct {
+	name    string    // Tipo elementar ou nome do UDT
+	length  int       // String[n] e WString[n]
+	members []*field  // Estrutura
+	dims    [][2]int  // Array: limites de cada dimensão
+	elem    *typeDecl // Array: tipo dos elementos
+	kind    declKind
+}
+
+type declKind int
+
+const (
+	kindElementary declKind = iota
+	kindString
+	kindWString
+	kindStruct
+	kindArray
+	kindUDT
+)
+
+// field é um membro de uma estrutura
+type field struct {
+	name    string
+	typ     *typeDecl
+	comment string
+}
+
+// blockDecl é um DATA_BLOCK da fonte
+type blockDecl struct {
+	name   string
+	number int
+	typ    *typeDecl
+}
+
+// layout percorre os tipos e atribui endereços aos membros elementares
+type layout struct {
+	types      map[string]*typeDecl
+	members    []Member
+	maxMembers int
+	count      int
+	depth      int
+}
+
+// alignByte avança o cursor (em bits) para o início do byte seguinte, se estiver a meio de um byte
+func alignByte(bits int) int {
+	return (bits + 7) / 8 * 8
+}
+
+// alignWord avança o cursor (em bits) para o endereço par seguinte
+func alignWord(bits int) int {
+	return (bits + 15) / 16 * 16
+}
+
+// place coloca o tipo na posição indicada (em bits) e retorna a posição a seguir
+func (l *layout) place(t *typeDecl, path string, comment string, cursor int) (int, error) {
+	switch t.kind {
+	case kindStruct:
+		cursor = alignWord(cursor)
+		for _, f := range t.members {
+			var err error
+			if cursor, err = l.place(f.typ, joinPath(path, f.name), f.comment, cursor); err != nil {
+				return 0, err
+			}
+		}
+		return alignWord(cursor), nil
+
+	case kindUDT:
+		udt, exists := l.types[strings.ToLower(t.name)]
+		if !exists {
+			return 0, fmt.Errorf("tipo %q não está definido na fonte; exporte o DB com os tipos de que depende", t.name)
+		}
+		l.depth++
+		defer func() { l.depth-- }()
+		if l.depth > 32 {
+			return 0, fmt.Errorf("tipo %q definido recursivamente", t.name)
+		}
+		return l.place(udt, path, comment, cursor)
+
+	case kindArray:
+		cursor = alignWord(cursor)
+		indexes := make([]int, len(t.dims))
+		for i, dim := range t.dims {
+			indexes[i] = dim[0]
+		}
+		for {
+			var err error
+			if cursor, err = l.place(t.elem, path+formatIndex(indexes), comment, cursor); err != nil {
+				return 0, err
+			}
+			if !nextIndex(indexes, t.dims) {
+				break
+			}
+		}
+		return alignWord(cursor), nil
+	}
+
+	// Tipos elementares e strings
+	name := strings.ToLower(t.name)
+	member := Member{Path: path, Type: t.name, Comment: comment}
+
+	switch {
+	case t.kind == kindString:
+		cursor = alignWord(cursor)
+		member.Length = t.length
+		member.ByteOffset = cursor / 8
+		cursor += (t.length + 2) * 8
+	case t.kind == kindWString:
+		cursor = alignWord(cursor)
+		member.Length = t.length
+		member.ByteOffset = cursor / 8
+		cursor += (2*t.length + 4) * 8
+	case name == "bool":
+		bit := cursor % 8
+		member.ByteOffset = cursor / 8
+		member.BitOffset = &bit
+		cursor++
+	case byteTypes[name]:
+		cursor = alignByte(cursor)
+		member.ByteOffset = cursor / 8
+		cursor += 8
+	default:
+		size, known := elementarySizes[name]
+		if !known {
+			return 0, fmt.Errorf("tipo desconhecido %q em %s", t.name, path)
+		}
+		cursor = alignWord(cursor)
+		member.ByteOffset = cursor / 8
+		cursor += size * 8
+	}
+
+	l.count++
+	if l.maxMembers > 0 && l.count > l.maxMembers {
+		return 0, fmt.Errorf("a fonte tem mais de %d membros", l.maxMembers)
+	}
+	l.members = append(l.members, member)
+	return cursor, nil
+}
+
+// joinPath junta o nome de um membro ao caminho da estrutura que o contém
+func joinPath(path string, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// formatIndex formata os índices de um elemento de array, ex.: [1,2]
+func formatIndex(indexes []int) string {
+	parts := make([]string, len(indexes))
+	for i, index := range indexes {
+		parts[i] = strconv.Itoa(index)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// nextIndex avança os índices de um array multidimensional; o último índice varia mais depressa
+func nextIndex(indexes []int, dims [][2]int) bool {
+	for i := len(indexes) - 1; i >= 0; i-- {
+		if indexes[i] < dims[i][1] {
+			indexes[i]++
+			return true
+		}
+		indexes[i] = dims[i][0]
+	}
+	return false
+}
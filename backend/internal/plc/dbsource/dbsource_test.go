@@ -0,0 +1,278 @@
+package dbsource
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dbHeader é o cabeçalho de um DB não otimizado tal como o TIA Portal o exporta
+const dbHeader = `{ S7_Optimized_Access := 'FALSE' }
+VERSION : 0.1
+NON_RETAIN
+`
+
+// formatMember descreve um membro como "caminho byte" ou "caminho byte.bit"
+func formatMember(m Member) string {
+	if m.BitOffset != nil {
+		return fmt.Sprintf("%s %d.%d", m.Path, m.ByteOffset, *m.BitOffset)
+	}
+	return fmt.Sprintf("%s %d", m.Path, m.ByteOffset)
+}
+
+// TestParseOffsets compara os endereços calculados com os que o TIA Portal mostra na coluna
+// Offset de DBs não otimizados com as mesmas declarações
+func TestParseOffsets(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		size    int
+		members []string
+	}{
+		{
+			name: "Bool seguidos partilham o byte",
+			source: `DATA_BLOCK "Bits"
+` + dbHeader + `   STRUCT
+      A : Bool;
+      B : Bool;
+      C : Bool;
+      D : Bool;
+      E : Bool;
+      F : Bool;
+      G : Bool;
+      H : Bool;
+      I : Bool;
+      N : Int;
+      J : Bool;
+   END_STRUCT;
+BEGIN
+   N := 5;
+END_DATA_BLOCK
+`,
+			size: 6,
+			members: []string{
+				"A 0.0", "B 0.1", "C 0.2", "D 0.3", "E 0.4", "F 0.5", "G 0.6", "H 0.7",
+				"I 1.0", "N 2", "J 4.0",
+			},
+		},
+		{
+			name: "tipos de um byte depois de Bool",
+			source: `DATA_BLOCK "Bytes"
+` + dbHeader + `   STRUCT
+      X : Bool;
+      Y : Byte;
+      Z : Bool;
+      W : Char;
+      V : SInt;
+      Q : Bool;
+      U : USInt;
+      R : Int;
+   END_STRUCT;
+BEGIN
+END_DATA_BLOCK
+`,
+			size:    10,
+			members: []string{"X 0.0", "Y 1", "Z 2.0", "W 3", "V 4", "Q 5.0", "U 6", "R 8"},
+		},
+		{
+			name: "estruturas e arrays começam e acabam em endereço par",
+			source: `DATA_BLOCK "Alinhamento"
+` + dbHeader + `   STRUCT
+      B1 : Byte;
+      S : Struct
+         X : Byte;
+      END_STRUCT;
+      B2 : Byte;
+      Arr : Array[0..2] of Byte;
+      B3 : Byte;
+      Bits : Array[0..9] of Bool;
+      R : Real;
+   END_STRUCT;
+BEGIN
+END_DATA_BLOCK
+`,
+			size: 18,
+			members: []string{
+				"B1 0", "S.X 2", "B2 4", "Arr[0] 6", "Arr[1] 7", "Arr[2] 8", "B3 10",
+				"Bits[0] 12.0", "Bits[1] 12.1", "Bits[2] 12.2", "Bits[3] 12.3", "Bits[4] 12.4",
+				"Bits[5] 12.5", "Bits[6] 12.6", "Bits[7] 12.7", "Bits[8] 13.0", "Bits[9] 13.1",
+				"R 14",
+			},
+		},
+		{
+			name: "String[n] ocupa n+2 bytes",
+			source: `DATA_BLOCK "Textos"
+` + dbHeader + `   STRUCT
+      Flag : Bool;
+      Nome : String[10];
+      Codigo : Byte;
+      Curto : String[5] := 'abc';
+      Ultimo : Byte;
+      Padrao : String;
+      N : Int;
+      Largo : WString[3];
+      C : WChar;
+   END_STRUCT;
+BEGIN
+END_DATA_BLOCK
+`,
+			size: 294,
+			members: []string{
+				"Flag 0.0", "Nome 2", "Codigo 14", "Curto 16", "Ultimo 23", "Padrao 24", "N 280",
+				"Largo 282", "C 292",
+			},
+		},
+		{
+			name: "arrays multidimensionais com o último índice a variar mais depressa",
+			source: `DATA_BLOCK DB 12
+` + dbHeader + `   STRUCT
+      M : Array[1..2, 0..2] of Int;
+      B : Array[0..1, 0..4] of Bool;
+      C : Char;
+      L : Array[-1..0] of LReal;
+   END_STRUCT;
+BEGIN
+END_DATA_BLOCK
+`,
+			size: 32,
+			members: []string{
+				"M[1,0] 0", "M[1,1] 2", "M[1,2] 4", "M[2,0] 6", "M[2,1] 8", "M[2,2] 10",
+				"B[0,0] 12.0", "B[0,1] 12.1", "B[0,2] 12.2", "B[0,3] 12.3", "B[0,4] 12.4",
+				"B[1,0] 12.5", "B[1,1] 12.6", "B[1,2] 12.7", "B[1,3] 13.0", "B[1,4] 13.1",
+				"C 14", "L[-1] 16", "L[0] 24",
+			},
+		},
+		{
+			name: "tipos de dados do utilizador aninhados",
+			source: `TYPE "Motor"
+VERSION : 0.1
+   STRUCT
+      Ligado : Bool;
+      Falha : Bool;
+      Velocidade : Real;
+      Modo : Byte;
+   END_STRUCT;
+
+END_TYPE
+
+TYPE "Linha"
+VERSION : 0.1
+   STRUCT
+      Ativa : Bool;
+      Motores : Array[1..2] of "Motor";
+      Contador : DInt;
+   END_STRUCT;
+
+END_TYPE
+
+DATA_BLOCK "Fabrica"
+` + dbHeader + `   STRUCT
+      Estado : Byte;
+      L1 : "Linha";
+      L2 : "Linha";
+      Fim : Bool;
+   END_STRUCT;
+BEGIN
+END_DATA_BLOCK
+`,
+			size: 48,
+			members: []string{
+				"Estado 0",
+				"L1.Ativa 2.0",
+				"L1.Motores[1].Ligado 4.0", "L1.Motores[1].Falha 4.1", "L1.Motores[1].Velocidade 6", "L1.Motores[1].Modo 10",
+				"L1.Motores[2].Ligado 12.0", "L1.Motores[2].Falha 12.1", "L1.Motores[2].Velocidade 14", "L1.Motores[2].Modo 18",
+				"L1.Contador 20",
+				"L2.Ativa 24.0",
+				"L2.Motores[1].Ligado 26.0", "L2.Motores[1].Falha 26.1", "L2.Motores[1].Velocidade 28", "L2.Motores[1].Modo 32",
+				"L2.Motores[2].Ligado 34.0", "L2.Motores[2].Falha 34.1", "L2.Motores[2].Velocidade 36", "L2.Motores[2].Modo 40",
+				"L2.Contador 42",
+				"Fim 46.0",
+			},
+		},
+		{
+			name: "tipos elementares de 2, 4, 8 e 12 bytes",
+			source: `DATA_BLOCK "Tempos"
+` + dbHeader + `   STRUCT
+      A : Bool;
+      T : Time;
+      D : Date;
+      L : LReal;
+      X : DTL;
+      W : Word;
+      Z : Bool;
+   END_STRUCT;
+BEGIN
+END_DATA_BLOCK
+`,
+			size:    32,
+			members: []string{"A 0.0", "T 2", "D 6", "L 8", "X 16", "W 28", "Z 30.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := Parse(tt.source, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(blocks) != 1 {
+				t.Fatalf("%d blocos, esperado 1", len(blocks))
+			}
+
+			block := blocks[0]
+			if block.Size != tt.size {
+				t.Errorf("tamanho = %d, esperado %d", block.Size, tt.size)
+			}
+
+			got := make([]string, len(block.Members))
+			for i, m := range block.Members {
+				got[i] = formatMember(m)
+			}
+			if !reflect.DeepEqual(got, tt.members) {
+				t.Errorf("membros:\n  obtido   %v\n  esperado %v", got, tt.members)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		err    string
+	}{
+		{
+			name:   "DB otimizado",
+			source: "DATA_BLOCK \"Opt\"\n{ S7_Optimized_Access := 'TRUE' }\nSTRUCT\n A : Int;\nEND_STRUCT;\nBEGIN\nEND_DATA_BLOCK\n",
+			err:    "acesso otimizado",
+		},
+		{
+			name:   "tipo do utilizador em falta",
+			source: "DATA_BLOCK \"Db\"\n" + dbHeader + "STRUCT\n M : \"Motor\";\nEND_STRUCT;\nBEGIN\nEND_DATA_BLOCK\n",
+			err:    "não está definido na fonte",
+		},
+		{
+			name:   "DB de instância",
+			source: "DATA_BLOCK \"Inst\"\n" + dbHeader + "FB10\nBEGIN\nEND_DATA_BLOCK\n",
+			err:    "DB de instância",
+		},
+		{
+			name:   "limites de array com constantes",
+			source: "DATA_BLOCK \"Db\"\n" + dbHeader + "STRUCT\n A : Array[0..#MAX] of Int;\nEND_STRUCT;\nBEGIN\nEND_DATA_BLOCK\n",
+			err:    "constantes nos limites",
+		},
+		{
+			name:   "sem data blocks",
+			source: "TYPE \"Vazio\"\nSTRUCT\n A : Int;\nEND_STRUCT;\nEND_TYPE\n",
+			err:    "não contém nenhum DATA_BLOCK",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.source, 0)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: erro = %v, esperado %q", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package dbsource
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Limite de elementos de um array, para não expandir declarações absurdas
+const maxArrayElements = 100000
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokQuoted  // Nome entre aspas: "Motor"
+	tokString  // Texto entre plicas: 'TRUE'
+	tokNumber  // Número, incluindo literais como 16#FF
+	tokSymbol  // Pontuação: : ; [ ] , .. := { } ( ) ...
+	tokComment // Comentário de linha: // ...
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	line int
+}
+
+// tokenize divide a fonte em símbolos. Os comentários de bloco (* *) são descartados; os de linha
+// são mantidos para servirem de descrição ao membro declarado na mesma linha.
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+	line := 1
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case r == '\n':
+			line++
+			i++
+		case unicode.IsSpace(r):
+			i++
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			start := i + 2
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokComment, text: strings.TrimSpace(string(runes[start:i])), line: line})
+		case r == '(' && i+1 < len(runes) && runes[i+1] == '*':
+			startLine := line
+			i += 2
+			for i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == ')') {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("linha %d: comentário (* sem fim", startLine)
+			}
+			i += 2
+		case r == '"' || r == '\'':
+			startLine := line
+			start := i + 1
+			i++
+			for i < len(runes) && runes[i] != r {
+				if runes[i] == '\n' {
+					line++
+				}
+				i++
+			}
+			if i >= len(runes) {
+				return nil, fmt.Errorf("linha %d: texto sem aspas de fecho", startLine)
+			}
+			kind := tokQuoted
+			if r == '\'' {
+				kind = tokString
+			}
+			tokens = append(tokens, token{kind: kind, text: string(runes[start:i]), line: startLine})
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: string(runes[start:i]), line: line})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) {
+				c := runes[i]
+				if unicode.IsDigit(c) || unicode.IsLetter(c) || c == '_' || c == '#' {
+					i++
+				} else if c == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1]) {
+					i++
+				} else {
+					break
+				}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: string(runes[start:i]), line: line})
+		case r == '.' && i+1 < len(runes) && runes[i+1] == '.':
+			tokens = append(tokens, token{kind: tokSymbol, text: "..", line: line})
+			i += 2
+		case r == ':' && i+1 < len(runes) && runes[i+1] == '=':
+			tokens = append(tokens, token{kind: tokSymbol, text: ":=", line: line})
+			i += 2
+		default:
+			tokens = append(tokens, token{kind: tokSymbol, text: string(r), line: line})
+			i++
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, line: line}), nil
+}
+
+// parser interpreta os blocos TYPE e DATA_BLOCK da fonte
+type parser struct {
+	tokens []token
+	pos    int
+	types  map[string]*typeDecl // Nome do tipo em minúsculas -> declaração
+}
+
+// peek retorna o próximo símbolo, ignorando comentários
+func (p *parser) peek() token {
+	for p.tokens[p.pos].kind == tokComment {
+		p.pos++
+	}
+	return p.tokens[p.pos]
+}
+
+// next consome o próximo símbolo, ignorando comentários
+func (p *parser) next() token {
+	tok := p.peek()
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// isKeyword indica se o símbolo é a palavra-chave indicada (sem distinção de maiúsculas)
+func isKeyword(tok token, keyword string) bool {
+	return tok.kind == tokIdent && strings.EqualFold(tok.text, keyword)
+}
+
+// isSymbol indica se o símbolo é a pontuação indicada
+func isSymbol(tok token, symbol string) bool {
+	return tok.kind == tokSymbol && tok.text == symbol
+}
+
+// unexpected formata o erro de um símbolo inesperado
+func unexpected(tok token, expected string) error {
+	if tok.kind == tokEOF {
+		return fmt.Errorf("fim da fonte inesperado, esperado %s", expected)
+	}
+	return fmt.Errorf("linha %d: %q inesperado, esperado %s", tok.line, tok.text, expected)
+}
+
+// expectSymbol consome a pontuação indicada
+func (p *parser) expectSymbol(symbol string) error {
+	if tok := p.next(); !isSymbol(tok, symbol) {
+		return unexpected(tok, fmt.Sprintf("%q", symbol))
+	}
+	return nil
+}
+
+// expectKeyword consome a palavra-chave indicada
+func (p *parser) expectKeyword(keyword string) error {
+	if tok := p.next(); !isKeyword(tok, keyword) {
+		return unexpected(tok, keyword)
+	}
+	return nil
+}
+
+// skipSemicolon consome um ; opcional
+func (p *parser) skipSemicolon() {
+	if isSymbol(p.peek(), ";") {
+		p.next()
+	}
+}
+
+// parseFile interpreta a fonte completa. Os tipos ficam em p.types; retorna os data blocks.
+func (p *parser) parseFile() ([]*blockDecl, error) {
+	var blocks []*blockDecl
+
+	for {
+		tok := p.next()
+		switch {
+		case tok.kind == tokEOF:
+			return blocks, nil
+		case isKeyword(tok, "TYPE"):
+			if err := p.parseTypeBlock(); err != nil {
+				return nil, err
+			}
+		case isKeyword(tok, "DATA_BLOCK"):
+			block, err := p.parseDataBlock()
+			if err != nil {
+				return nil, err
+			}
+			blocks = append(blocks, block)
+		case isKeyword(tok, "FUNCTION_BLOCK"), isKeyword(tok, "FUNCTION"), isKeyword(tok, "ORGANIZATION_BLOCK"):
+			return nil, fmt.Errorf("linha %d: a fonte contém blocos de código (%s); exporte apenas o DB e os tipos de que depende", tok.line, tok.text)
+		default:
+			return nil, unexpected(tok, "TYPE ou DATA_BLOCK")
+		}
+	}
+}
+
+// parseBlockName lê o nome de um bloco: "Nome", Nome, DB10 ou DB 10. Retorna o número se o indicar.
+func (p *parser) parseBlockName(prefix string) (string, int, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokQuoted:
+		return tok.text, 0, nil
+	case tokIdent:
+		upper := strings.ToUpper(tok.text)
+		if upper == prefix && p.peek().kind == tokNumber {
+			numberTok := p.next()
+			number, err := strconv.Atoi(numberTok.text)
+			if err != nil {
+				return "", 0, fmt.Errorf("linha %d: número de bloco inválido %q", numberTok.line, numberTok.text)
+			}
+			return prefix + numberTok.text, number, nil
+		}
+		if strings.HasPrefix(upper, prefix) {
+			if number, err := strconv.Atoi(upper[len(prefix):]); err == nil {
+				return tok.text, number, nil
+			}
+		}
+		return tok.text, 0, nil
+	}
+	return "", 0, unexpected(tok, "nome do bloco")
+}
+
+// parseAttributes lê um bloco de atributos { Nome := 'valor'; ... } já aberto
+func (p *parser) parseAttributes() (map[string]string, error) {
+	attributes := make(map[string]string)
+	for {
+		tok := p.next()
+		switch {
+		case isSymbol(tok, "}"):
+			return attributes, nil
+		case tok.kind == tokEOF:
+			return nil, unexpected(tok, "}")
+		case tok.kind == tokIdent && isSymbol(p.peek(), ":="):
+			p.next()
+			value := p.next()
+			attributes[strings.ToLower(tok.text)] = value.text
+		}
+	}
+}
+
+// parseHeader ignora as propriedades do bloco (atributos, TITLE, VERSION, NON_RETAIN, ...)
+// até à declaração das variáveis. Retorna os atributos encontrados.
+func (p *parser) parseHeader() (map[string]string, error) {
+	attributes := make(map[string]string)
+
+	for {
+		tok := p.peek()
+		switch {
+		case isSymbol(tok, "{"):
+			p.next()
+			attrs, err := p.parseAttributes()
+			if err != nil {
+				return nil, err
+			}
+			for name, value := range attrs {
+				attributes[name] = value
+			}
+		case isKeyword(tok, "TITLE"):
+			// TITLE = texto livre até ao fim da linha
+			p.next()
+			for p.peek().kind != tokEOF && p.peek().line == tok.line {
+				p.next()
+			}
+		case isKeyword(tok, "VERSION"), isKeyword(tok, "AUTHOR"), isKeyword(tok, "FAMILY"), isKeyword(tok, "NAME"):
+			p.next()
+			if err := p.expectSymbol(":"); err != nil {
+				return nil, err
+			}
+			for p.peek().kind != tokEOF && p.peek().line == tok.line {
+				p.next()
+			}
+		case isKeyword(tok, "NON_RETAIN"), isKeyword(tok, "KNOW_HOW_PROTECT"), isKeyword(tok, "UNLINKED"), isKeyword(tok, "READ_ONLY"):
+			p.next()
+		default:
+			return attributes, nil
+		}
+	}
+}
+
+// parseTypeBlock interpreta TYPE "Nome" ... STRUCT ... END_STRUCT; END_TYPE
+func (p *parser) parseTypeBlock() error {
+	name, _, err := p.parseBlockName("UDT")
+	if err != nil {
+		return err
+	}
+	if _, err := p.parseHeader(); err != nil {
+		return err
+	}
+	if err := p.expectKeyword("STRUCT"); err != nil {
+		return err
+	}
+
+	decl, err := p.parseStruct()
+	if err != nil {
+		return err
+	}
+	p.skipSemicolon()
+	if err := p.expectKeyword("END_TYPE"); err != nil {
+		return err
+	}
+
+	key := strings.ToLower(name)
+	if _, exists := p.types[key]; exists {
+		return fmt.Errorf("tipo %q definido mais de uma vez", name)
+	}
+	p.types[key] = decl
+	return nil
+}
+
+// parseDataBlock interpreta DATA_BLOCK "Nome" ... STRUCT ... END_STRUCT; BEGIN ... END_DATA_BLOCK.
+// O DB pode também ser declarado com um tipo de dados do utilizador em vez da estrutura.
+func (p *parser) parseDataBlock() (*blockDecl, error) {
+	name, number, err := p.parseBlockName("DB")
+	if err != nil {
+		return nil, err
+	}
+
+	attributes, err := p.parseHeader()
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(attributes["s7_optimized_access"], "TRUE") {
+		return nil, fmt.Errorf("o DB %s usa acesso otimizado e não tem endereços absolutos; desative 'Optimized block access' nas propriedades do DB", name)
+	}
+
+	block := &blockDecl{name: name, number: number}
+
+	tok := p.next()
+	switch {
+	case isKeyword(tok, "STRUCT"):
+		if block.typ, err = p.parseStruct(); err != nil {
+			return nil, err
+		}
+		p.skipSemicolon()
+	case tok.kind == tokQuoted || tok.kind == tokIdent:
+		if tok.kind == tokIdent && isInstanceType(tok.text) {
+			return nil, fmt.Errorf("o DB %s é um DB de instância, que não é suportado", name)
+		}
+		block.typ = &typeDecl{kind: kindUDT, name: tok.text}
+		p.skipSemicolon()
+	default:
+		return nil, unexpected(tok, "STRUCT")
+	}
+
+	if err := p.expectKeyword("BEGIN"); err != nil {
+		return nil, err
+	}
+
+	// Os valores atuais não interessam para os endereços
+	for {
+		tok := p.next()
+		if isKeyword(tok, "END_DATA_BLOCK") {
+			return block, nil
+		}
+		if tok.kind == tokEOF {
+			return nil, unexpected(tok, "END_DATA_BLOCK")
+		}
+	}
+}
+
+// isInstanceType indica se o tipo de um DB é um bloco de função (FB10, SFB4), caso de um DB de instância
+func isInstanceType(name string) bool {
+	upper := strings.ToUpper(name)
+	for _, prefix := range []string{"SFB", "FB"} {
+		if strings.HasPrefix(upper, prefix) {
+			if _, err := strconv.Atoi(upper[len(prefix):]); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseStruct interpreta os membros de uma estrutura até END_STRUCT (STRUCT já consumido)
+func (p *parser) parseStruct() (*typeDecl, error) {
+	decl := &typeDecl{kind: kindStruct}
+	names := make(map[string]bool)
+
+	for {
+		tok := p.peek()
+		if isKeyword(tok, "END_STRUCT") {
+			p.next()
+			return decl, nil
+		}
+
+		f, err := p.parseMember()
+		if err != nil {
+			return nil, err
+		}
+
+		key := strings.ToLower(f.name)
+		if names[key] {
+			return nil, fmt.Errorf("linha %d: membro %q declarado mais de uma vez", tok.line, f.name)
+		}
+		names[key] = true
+		decl.members = append(decl.members, f)
+	}
+}
+
+// parseMember interpreta Nome [{atributos}] : Tipo [:= valor inicial]; [// comentário]
+func (p *parser) parseMember() (*field, error) {
+	tok := p.next()
+	if tok.kind != tokIdent && tok.kind != tokQuoted {
+		return nil, unexpected(tok, "nome do membro ou END_STRUCT")
+	}
+	f := &field{name: tok.text}
+
+	if isSymbol(p.peek(), "{") {
+		p.next()
+		if _, err := p.parseAttributes(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expectSymbol(":"); err != nil {
+		return nil, err
+	}
+
+	// Comentário na linha de abertura de uma estrutura: Motor : Struct // comentário
+	typeLine := p.peek().line
+
+	typ, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	f.typ = typ
+
+	if isSymbol(p.peek(), ":=") {
+		p.next()
+		if err := p.skipInitialValue(); err != nil {
+			return nil, err
+		}
+	}
+
+	semicolon := p.next()
+	if !isSymbol(semicolon, ";") {
+		return nil, unexpected(semicolon, "\";\"")
+	}
+
+	if typ.kind == kindStruct {
+		f.comment = p.commentOnLine(typeLine)
+	} else if p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokComment && p.tokens[p.pos].line == semicolon.line {
+		f.comment = p.tokens[p.pos].text
+		p.pos++
+	}
+	return f, nil
+}
+
+// commentOnLine procura o comentário de linha de uma linha já interpretada
+func (p *parser) commentOnLine(line int) string {
+	for i := p.pos - 1; i >= 0 && p.tokens[i].line >= line; i-- {
+		if p.tokens[i].kind == tokComment && p.tokens[i].line == line {
+			return p.tokens[i].text
+		}
+	}
+	return ""
+}
+
+// skipInitialValue ignora o valor inicial de um membro até ao ; que o termina
+func (p *parser) skipInitialValue() error {
+	depth := 0
+	for {
+		tok := p.peek()
+		switch {
+		case tok.kind == tokEOF:
+			return unexpected(tok, "\";\"")
+		case isSymbol(tok, "(") || isSymbol(tok, "["):
+			depth++
+		case isSymbol(tok, ")") || isSymbol(tok, "]"):
+			depth--
+		case isSymbol(tok, ";") && depth <= 0:
+			return nil
+		}
+		p.next()
+	}
+}
+
+// parseType interpreta um tipo: elementar, String[n], WString[n], Struct, Array[..] of ou tipo do utilizador
+func (p *parser) parseType() (*typeDecl, error) {
+	tok := p.next()
+
+	switch {
+	case tok.kind == tokQuoted:
+		return &typeDecl{kind: kindUDT, name: tok.text}, nil
+	case tok.kind != tokIdent:
+		return nil, unexpected(tok, "tipo de dados")
+	case isKeyword(tok, "STRUCT"):
+		return p.parseStruct()
+	case isKeyword(tok, "ARRAY"):
+		return p.parseArray()
+	case isKeyword(tok, "STRING"), isKeyword(tok, "WSTRING"):
+		decl := &typeDecl{kind: kindString, name: "String", length: 254}
+		if isKeyword(tok, "WSTRING") {
+			decl.kind = kindWString
+			decl.name = "WString"
+		}
+		if isSymbol(p.peek(), "[") {
+			p.next()
+			length, err := p.parseInt()
+			if err != nil {
+				return nil, err
+			}
+			if length < 1 || length > 254 {
+				return nil, fmt.Errorf("linha %d: comprimento de %s inválido: %d", tok.line, decl.name, length)
+			}
+			decl.length = length
+			if err := p.expectSymbol("]"); err != nil {
+				return nil, err
+			}
+		}
+		return decl, nil
+	case isKeyword(tok, "UDT") && p.peek().kind == tokNumber:
+		return &typeDecl{kind: kindUDT, name: "UDT" + p.next().text}, nil
+	}
+
+	name := strings.ToLower(tok.text)
+	if name == "bool" || byteTypes[name] || elementarySizes[name] > 0 {
+		return &typeDecl{kind: kindElementary, name: tok.text}, nil
+	}
+	return &typeDecl{kind: kindUDT, name: tok.text}, nil
+}
+
+// parseArray interpreta [a..b, c..d] of Tipo (ARRAY já consumido)
+func (p *parser) parseArray() (*typeDecl, error) {
+	decl := &typeDecl{kind: kindArray}
+	if err := p.expectSymbol("["); err != nil {
+		return nil, err
+	}
+
+	elements := 1
+	for {
+		line := p.peek().line
+		low, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectSymbol(".."); err != nil {
+			return nil, err
+		}
+		high, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		if high < low {
+			return nil, fmt.Errorf("linha %d: limites do array invertidos: %d..%d", line, low, high)
+		}
+
+		elements *= high - low + 1
+		if elements > maxArrayElements {
+			return nil, fmt.Errorf("linha %d: array com mais de %d elementos", line, maxArrayElements)
+		}
+		decl.dims = append(decl.dims, [2]int{low, high})
+
+		tok := p.next()
+		if isSymbol(tok, "]") {
+			break
+		}
+		if !isSymbol(tok, ",") {
+			return nil, unexpected(tok, "\",\" ou \"]\"")
+		}
+	}
+
+	if err := p.expectKeyword("OF"); err != nil {
+		return nil, err
+	}
+	elem, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	decl.elem = elem
+	return decl, nil
+}
+
+// parseInt lê um inteiro, eventualmente negativo. Constantes simbólicas (#N) não são suportadas.
+func (p *parser) parseInt() (int, error) {
+	tok := p.next()
+	sign := 1
+	if isSymbol(tok, "-") {
+		sign = -1
+		tok = p.next()
+	}
+	if tok.kind != tokNumber {
+		if isSymbol(tok, "#") || tok.kind == tokQuoted {
+			return 0, fmt.Errorf("linha %d: constantes nos limites não são suportadas; use valores numéricos", tok.line)
+		}
+		return 0, unexpected(tok, "número")
+	}
+
+	value, err := strconv.Atoi(tok.text)
+	if err != nil {
+		return 0, fmt.Errorf("linha %d: número inválido %q", tok.line, tok.text)
+	}
+	return sign * value, nil
+}
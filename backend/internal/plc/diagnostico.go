@@ -0,0 +1,324 @@
+package plc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Estados de operação da CPU
+const (
+	EstadoCPURun          = "RUN"
+	EstadoCPUStop         = "STOP"
+	EstadoCPUDesconhecido = "DESCONHECIDO"
+)
+
+// CPUDiagnostics contém a identificação e o estado da CPU lidos das listas de sistema (SZL)
+type CPUDiagnostics struct {
+	CodigoEncomenda string    `json:"codigo_encomenda"` // Ex: 6ES7 315-2EH14-0AB0
+	Firmware        string    `json:"firmware"`
+	NomeModulo      string    `json:"nome_modulo"`
+	TipoModulo      string    `json:"tipo_modulo"`
+	NumeroSerie     string    `json:"numero_serie"`
+	NomeSistema     string    `json:"nome_sistema"` // Nome do sistema de automação
+	Copyright       string    `json:"copyright,omitempty"`
+	EstadoCPU       string    `json:"estado_cpu"`     // RUN, STOP ou DESCONHECIDO
+	NivelProtecao   int       `json:"nivel_protecao"` // Nível de proteção efetivo (0 = sem proteção)
+	SeletorModo     string    `json:"seletor_modo"`   // Posição do seletor de modo, quando existe
+	PDUMaxima       int       `json:"pdu_maxima"`
+	MaxConexoes     int       `json:"max_conexoes"`
+	Erros           []string  `json:"erros,omitempty"` // Listas SZL que não puderam ser lidas
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// DiagnosticDriver é implementado pelos drivers que conseguem ler a identificação e o estado da CPU
+type DiagnosticDriver interface {
+	Diagnostics() (*CPUDiagnostics, error)
+	CPUState() (string, error)
+}
+
+// safeSZL executa uma leitura SZL da gos7, convertendo em erro os pânicos causados por
+// respostas mais curtas que o esperado (a biblioteca não verifica os tamanhos)
+func safeSZL(name string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: resposta inválida da CPU (%v)", name, r)
+		}
+	}()
+	if err = fn(); err != nil {
+		err = fmt.Errorf("%s: %v", name, err)
+	}
+	return err
+}
+
+// cpuStateName converte o código de estado da gos7 para o nome do estado
+func cpuStateName(status int) string {
+	switch status {
+	case 8:
+		return EstadoCPURun
+	case 4:
+		return EstadoCPUStop
+	}
+	return EstadoCPUDesconhecido
+}
+
+// modeSelectorName converte a posição do seletor de modo (bart_sch) para texto
+func modeSelectorName(bartSch uint64) string {
+	switch bartSch {
+	case 1:
+		return "RUN"
+	case 2:
+		return "RUN-P"
+	case 3:
+		return "STOP"
+	case 4:
+		return "MRES"
+	}
+	return ""
+}
+
+// unexportedUint lê um campo inteiro não exportado de uma struct da gos7
+func unexportedUint(v interface{}, field string) uint64 {
+	f := reflect.ValueOf(v).FieldByName(field)
+	if !f.IsValid() {
+		return 0
+	}
+	return f.Uint()
+}
+
+// Diagnostics lê a identificação, o estado e a proteção da CPU.
+// Falhas em listas individuais são devolvidas em Erros; só falha se nenhuma puder ser lida.
+func (s *S7Client) Diagnostics() (*CPUDiagnostics, error) {
+	if !s.conectado {
+		return nil, fmt.Errorf("não conectado ao PLC")
+	}
+
+	diag := &CPUDiagnostics{Timestamp: time.Now()}
+	var erros []string
+
+	if err := safeSZL("código de encomenda", func() error {
+		code, err := s.client.GetOrderCode()
+		if err == nil {
+			diag.CodigoEncomenda = strings.TrimSpace(strings.Trim(code.Code, "\x00"))
+			diag.Firmware = fmt.Sprintf("V%d.%d.%d", code.V1, code.V2, code.V3)
+		}
+		return err
+	}); err != nil {
+		erros = append(erros, err.Error())
+	}
+
+	if err := safeSZL("identificação do módulo", func() error {
+		info, err := s.client.GetCPUInfo()
+		if err == nil {
+			diag.NomeModulo = strings.Trim(info.ModuleName, "\x00 ")
+			diag.TipoModulo = strings.Trim(info.ModuleTypeName, "\x00 ")
+			diag.NumeroSerie = strings.Trim(info.SerialNumber, "\x00 ")
+			diag.NomeSistema = strings.Trim(info.ASName, "\x00 ")
+			diag.Copyright = strings.Trim(info.Copyright, "\x00 ")
+		}
+		return err
+	}); err != nil {
+		erros = append(erros, err.Error())
+	}
+
+	if err := safeSZL("comunicação", func() error {
+		info, err := s.client.GetCPInfo()
+		if err == nil {
+			diag.PDUMaxima = info.MaxPduLength
+			diag.MaxConexoes = info.MaxConnections
+		}
+		return err
+	}); err != nil {
+		erros = append(erros, err.Error())
+	}
+
+	if err := safeSZL("proteção", func() error {
+		protection, err := s.client.GetProtection()
+		if err == nil {
+			diag.NivelProtecao = int(unexportedUint(protection, "schRel"))
+			diag.SeletorModo = modeSelectorName(unexportedUint(protection, "bartSch"))
+		}
+		return err
+	}); err != nil {
+		erros = append(erros, err.Error())
+	}
+
+	estado, err := s.CPUState()
+	if err != nil {
+		erros = append(erros, err.Error())
+	}
+	diag.EstadoCPU = estado
+
+	if len(erros) == 5 {
+		return nil, fmt.Errorf("falha ao ler diagnóstico da CPU: %s", strings.Join(erros, "; "))
+	}
+	diag.Erros = erros
+	return diag, nil
+}
+
+// CPUState lê o estado de operação da CPU (RUN/STOP)
+func (s *S7Client) CPUState() (string, error) {
+	if !s.conectado {
+		return EstadoCPUDesconhecido, fmt.Errorf("não conectado ao PLC")
+	}
+
+	estado := EstadoCPUDesconhecido
+	err := safeSZL("estado da CPU", func() error {
+		status, err := s.client.PLCGetStatus()
+		if err == nil {
+			estado = cpuStateName(status)
+		}
+		return err
+	})
+	return estado, err
+}
+
+// Diagnostics devolve uma identificação fixa da CPU simulada
+func (s *SimulatorDriver) Diagnostics() (*CPUDiagnostics, error) {
+	estado, err := s.CPUState()
+	if err != nil {
+		return nil, err
+	}
+
+	return &CPUDiagnostics{
+		CodigoEncomenda: "SIMULADOR",
+		Firmware:        "V1.0.0",
+		NomeModulo:      s.plc.Nome,
+		TipoModulo:      "CPU simulada",
+		NomeSistema:     s.plc.Nome,
+		EstadoCPU:       estado,
+		PDUMaxima:       s.MaxBlockSize(),
+		Timestamp:       time.Now(),
+	}, nil
+}
+
+// CPUState devolve RUN enquanto o simulador está conectado
+func (s *SimulatorDriver) CPUState() (string, error) {
+	if !s.IsConnected() {
+		return EstadoCPUDesconhecido, fmt.Errorf("não conectado ao simulador")
+	}
+	return EstadoCPURun, nil
+}
+
+// GetDiagnostics lê o diagnóstico da CPU de um PLC gerido
+func (m *Manager) GetDiagnostics(plcID uint) (*CPUDiagnostics, error) {
+	plc, exists := m.GetPLC(plcID)
+	if !exists {
+		return nil, fmt.Errorf("PLC não encontrado")
+	}
+	if plc.Client == nil || !canRead(plc) {
+		return nil, readUnavailableError(plc)
+	}
+
+	driver, ok := plc.Client.(DiagnosticDriver)
+	if !ok {
+		return nil, fmt.Errorf("diagnóstico não suportado pelo protocolo %s", plcProtocolo(plc))
+	}
+
+	diag, err := driver.Diagnostics()
+	reportDiagnosticRead(plc, err)
+	if err != nil {
+		return nil, err
+	}
+
+	m.updateCPUState(plc, diag.EstadoCPU)
+	return diag, nil
+}
+
+// reportDiagnosticRead encaminha ao supervisor apenas as quebras de conexão nas leituras de
+// diagnóstico; as recusas da CPU (lista SZL não suportada, proteção) não contam para o disjuntor
+func reportDiagnosticRead(plc *PLC, err error) {
+	if err != nil && isConnectionError(err) {
+		reportRead(plc, plc.Client, err)
+	}
+}
+
+// monitorCPUState verifica periodicamente o estado das CPUs e publica as mudanças
+func (m *Manager) monitorCPUState() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(Config.CPUStatePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case <-ticker.C:
+			m.mutex.RLock()
+			plcs := make([]*PLC, 0, len(m.plcs))
+			for _, plc := range m.plcs {
+				plcs = append(plcs, plc)
+			}
+			m.mutex.RUnlock()
+
+			for _, plc := range plcs {
+				driver, ok := plc.Client.(DiagnosticDriver)
+				if !ok || !canRead(plc) {
+					continue
+				}
+
+				estado, err := driver.CPUState()
+				reportDiagnosticRead(plc, err)
+				if err != nil {
+					continue
+				}
+				m.updateCPUState(plc, estado)
+			}
+		}
+	}
+}
+
+// updateCPUState guarda o estado da CPU e publica um evento quando ele muda
+func (m *Manager) updateCPUState(plc *PLC, estado string) {
+	anterior := plc.EstadoCPU
+	if anterior == estado {
+		return
+	}
+	plc.EstadoCPU = estado
+
+	// O primeiro estado lido após o arranque não é uma mudança
+	if anterior == "" {
+		return
+	}
+
+	log.Printf("\033[33m[CPU] PLC %s: %s → %s\033[0m", plc.Nome, anterior, estado)
+
+	if m.natsClient != nil && m.natsClient.IsConnected() {
+		if err := m.natsClient.PublishCPUState(plc, anterior, estado); err != nil {
+			log.Printf("Falha ao publicar estado da CPU no NATS: %v", err)
+		}
+	}
+}
+
+// PublishCPUState publica uma mudança de estado da CPU (ex: RUN → STOP)
+func (c *NatsClient) PublishCPUState(plc *PLC, anterior, atual string) error {
+	if !c.IsConnected() {
+		return fmt.Errorf("cliente NATS não está conectado")
+	}
+
+	msg := NatsMessage{
+		Type: "cpu_state",
+		Data: map[string]interface{}{
+			"plc_id":    plc.ID,
+			"plc_nome":  plc.Nome,
+			"anterior":  anterior,
+			"atual":     atual,
+			"timestamp": time.Now(),
+		},
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("falha ao serializar estado da CPU: %v", err)
+	}
+
+	subject := c.subjects["cpu_state"]
+	if err := c.conn.Publish(fmt.Sprintf("%s.%d", subject, plc.ID), payload); err != nil {
+		return err
+	}
+	return c.conn.Publish(subject, payload)
+}
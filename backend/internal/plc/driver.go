@@ -0,0 +1,189 @@
+package plc
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Protocolos de comunicação suportados
+const (
+	ProtocoloS7     = "s7"
+	ProtocoloModbus = "modbus"
+)
+
+// ProtocolosSuportados lista os valores aceites no campo Protocolo do PLC
+var ProtocolosSuportados = []string{ProtocoloS7, ProtocoloModbus}
+
+// plcProtocolo retorna o protocolo do PLC, assumindo S7 para registos antigos
+func plcProtocolo(plc *PLC) string {
+	if plc.Protocolo == "" {
+		return ProtocoloS7
+	}
+	return plc.Protocolo
+}
+
+// plcTimeout retorna o timeout de conexão e de requisição do PLC, ou o global se não configurado
+func plcTimeout(plc *PLC) time.Duration {
+	if plc.TimeoutMs > 0 {
+		return time.Duration(plc.TimeoutMs) * time.Millisecond
+	}
+	return Config.ConnectionTimeout
+}
+
+// plcIdleTimeout retorna o tempo sem atividade após o qual a conexão é fechada
+func plcIdleTimeout(plc *PLC) time.Duration {
+	if plc.TimeoutInatividadeMs > 0 {
+		return time.Duration(plc.TimeoutInatividadeMs) * time.Millisecond
+	}
+	return plcTimeout(plc) * 2
+}
+
+// validatePLCProtocolo verifica o protocolo e os parâmetros específicos dele
+func validatePLCProtocolo(plc *PLC) error {
+	if plc.TimeoutMs < 0 || plc.TimeoutInatividadeMs < 0 {
+		return fmt.Errorf("timeouts não podem ser negativos (0 = padrão)")
+	}
+
+	switch plcProtocolo(plc) {
+	case ProtocoloS7:
+		if err := validateS7Conexao(plc); err != nil {
+			return err
+		}
+	case ProtocoloModbus:
+		if plc.UnitID < 0 || plc.UnitID > 255 {
+			return fmt.Errorf("unit_id deve estar entre 0 e 255")
+		}
+	default:
+		return fmt.Errorf("protocolo não suportado: %s", plc.Protocolo)
+	}
+
+	if plc.Porta < 0 || plc.Porta > 65535 {
+		return fmt.Errorf("porta deve estar entre 0 e 65535 (0 = padrão do protocolo)")
+	}
+	return nil
+}
+
+// Driver é a interface comum aos drivers de comunicação com CLPs.
+// Manager e FaultManager só dependem desta interface, nunca de um driver concreto.
+type Driver interface {
+	// Connect estabelece a conexão com o equipamento
+	Connect() error
+	// Disconnect fecha a conexão
+	Disconnect() error
+	// IsConnected retorna o status da conexão
+	IsConnected() bool
+	// ReadTag lê e descodifica o valor de uma tag
+	ReadTag(tag *Tag) (interface{}, error)
+	// WriteTag codifica e escreve o valor de uma tag
+	WriteTag(tag *Tag, value interface{}) error
+	// ReadBytes lê uma faixa contígua de bytes de uma área
+	ReadBytes(area string, dbNumber int, start int, size int) ([]byte, error)
+	// MaxBlockSize retorna o maior bloco que deve ser lido numa única requisição
+	MaxBlockSize() int
+	// Health retorna um resumo do estado do driver
+	Health() DriverHealth
+}
+
+// DriverHealth resume o estado de saúde de um driver
+type DriverHealth struct {
+	Driver          string    `json:"driver"`
+	Conectado       bool      `json:"conectado"`
+	UltimoErro      string    `json:"ultimo_erro,omitempty"`
+	UltimoErroTime  time.Time `json:"ultimo_erro_time,omitempty"`
+	UltimaAtividade time.Time `json:"ultima_atividade"`
+}
+
+// NewDriver cria o driver adequado ao protocolo do PLC.
+// A variável de ambiente PLC_DRIVER=simulador substitui todos os drivers pelo simulador.
+func NewDriver(plc *PLC) (Driver, error) {
+	if os.Getenv("PLC_DRIVER") == "simulador" {
+		return NewSimulatorDriver(plc), nil
+	}
+
+	switch plcProtocolo(plc) {
+	case ProtocoloS7:
+		return NewS7Client(plc)
+	case ProtocoloModbus:
+		return NewModbusDriver(plc)
+	}
+	return nil, fmt.Errorf("protocolo não suportado: %s", plc.Protocolo)
+}
+
+// readTagWith lê os bytes de uma tag através do driver e descodifica o valor
+func readTagWith(d Driver, tag *Tag) (interface{}, error) {
+	size := tagByteSize(tag)
+	if size == 0 {
+		return nil, errTipoNaoSuportado(tag)
+	}
+
+	buffer, err := d.ReadBytes(tagArea(tag), tag.DBNumber, tagBufferOffset(tag), size)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeTagValue(tag, buffer)
+}
+
+// encodeTagWrite prepara os bytes a escrever numa tag.
+// Para bits é feita leitura-modificação-escrita do byte que os contém.
+func encodeTagWrite(d Driver, tag *Tag, value interface{}) ([]byte, error) {
+	buffer, err := encodeTagValue(tag, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag.Tipo == "Bool" && tag.BitOffset != nil {
+		current, err := d.ReadBytes(tagArea(tag), tag.DBNumber, tag.ByteOffset, 1)
+		if err != nil {
+			return nil, err
+		}
+
+		if buffer[0] != 0 {
+			// Setar o bit
+			current[0] |= (1 << uint(*tag.BitOffset))
+		} else {
+			// Limpar o bit
+			current[0] &= ^(1 << uint(*tag.BitOffset))
+		}
+		buffer = current
+	}
+
+	return buffer, nil
+}
+
+// driverStatus regista erros e atividade para o relatório de saúde dos drivers
+type driverStatus struct {
+	mutex           sync.Mutex
+	ultimoErro      string
+	ultimoErroTime  time.Time
+	ultimaAtividade time.Time
+}
+
+// record regista o resultado de uma operação
+func (s *driverStatus) record(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err != nil {
+		s.ultimoErro = err.Error()
+		s.ultimoErroTime = time.Now()
+		return
+	}
+	s.ultimaAtividade = time.Now()
+}
+
+// health monta o relatório de saúde com os dados registados
+func (s *driverStatus) health(driver string, conectado bool) DriverHealth {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return DriverHealth{
+		Driver:          driver,
+		Conectado:       conectado,
+		UltimoErro:      s.ultimoErro,
+		UltimoErroTime:  s.ultimoErroTime,
+		UltimaAtividade: s.ultimaAtividade,
+	}
+}
@@ -0,0 +1,141 @@
+package plc
+
+import (
+	"fmt"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/plc/address"
+)
+
+// tagAddress monta o endereço absoluto da tag a partir dos seus campos
+func tagAddress(tag *Tag) address.Address {
+	addr := address.Address{
+		Area:       tagArea(tag),
+		DBNumber:   tag.DBNumber,
+		ByteOffset: tag.ByteOffset,
+	}
+
+	switch {
+	case isElementArea(addr.Area) || isRegisterArea(addr.Area):
+		addr.Width = address.WidthElement
+	case addr.Area == AreaCoils || addr.Area == AreaDiscreteInputs:
+		addr.Width = address.WidthBit
+	case tag.Tipo == "Bool" && tag.BitOffset != nil:
+		addr.Width = address.WidthBit
+		addr.BitOffset = tag.BitOffset
+	default:
+		addr.Width = address.WidthForSize(tagByteSize(tag))
+	}
+
+	return addr
+}
+
+// applyTagAddress preenche área, DB e offsets a partir de tag.Endereco e deriva o tipo se não foi
+// indicado. Retorna erro se o endereço for inválido ou incompatível com o tipo.
+func applyTagAddress(tag *Tag) error {
+	addr, err := address.Parse(tag.Endereco)
+	if err != nil {
+		return err
+	}
+
+	if isRegisterArea(addr.Area) && addr.BitOffset != nil {
+		return fmt.Errorf("endereço %s: bits de registos só são suportados em definições de falha", addr)
+	}
+
+	if tag.Tipo == "" {
+		tag.Tipo = addr.DefaultType()
+	}
+
+	if addr.Width != address.WidthElement && !addr.IsModbus() {
+		size := tagByteSize(&Tag{Tipo: tag.Tipo, Tamanho: tag.Tamanho})
+
+		switch {
+		case addr.Width == address.WidthBit && tag.Tipo != "Bool":
+			return fmt.Errorf("endereço %s é um bit, incompatível com o tipo %s", addr, tag.Tipo)
+		case addr.Width != address.WidthBit && tag.Tipo == "Bool":
+			return fmt.Errorf("tipo Bool requer um endereço de bit (ex.: %s%d.0)", addr.Area, addr.ByteOffset)
+		case addr.Width == address.WidthByte && size > 1 && size <= 4:
+			return fmt.Errorf("endereço %s é um byte, incompatível com o tipo %s (%d bytes)", addr, tag.Tipo, size)
+		case (addr.Width == address.WidthWord || addr.Width == address.WidthDWord) && size != addr.Width.Size():
+			return fmt.Errorf("endereço %s tem %d bytes, incompatível com o tipo %s", addr, addr.Width.Size(), tag.Tipo)
+		}
+	}
+
+	tag.Area = addr.Area
+	tag.DBNumber = addr.DBNumber
+	tag.ByteOffset = addr.ByteOffset
+	tag.BitOffset = addr.BitOffset
+	tag.Endereco = addr.String()
+
+	return nil
+}
+
+// faultWordTag monta a tag usada para ler a word de uma definição de falha.
+// Sem DB (db_number 0) a word é o holding register indicado em byte_offset, para equipamentos Modbus.
+func faultWordTag(dbNumber int, byteOffset int) Tag {
+	if dbNumber == 0 {
+		return Tag{Area: AreaHoldingRegisters, ByteOffset: byteOffset, Tipo: "Word"}
+	}
+	return Tag{Area: AreaDB, DBNumber: dbNumber, ByteOffset: byteOffset, Tipo: "Word"}
+}
+
+// faultAddress monta o endereço do bit monitorado por uma definição de falha.
+// A word é lida em big endian: os bits 8-15 ficam no primeiro byte e os bits 0-7 no segundo.
+func faultAddress(def *FaultDefinition) address.Address {
+	if def.DBNumber == 0 {
+		bit := def.BitOffset
+		return address.Address{
+			Area:       AreaHoldingRegisters,
+			ByteOffset: def.ByteOffset,
+			BitOffset:  &bit,
+			Width:      address.WidthBit,
+		}
+	}
+
+	byteOffset := def.ByteOffset
+	bit := def.BitOffset
+	if bit < 8 {
+		byteOffset++
+	} else {
+		bit -= 8
+	}
+
+	return address.Address{
+		Area:       AreaDB,
+		DBNumber:   def.DBNumber,
+		ByteOffset: byteOffset,
+		BitOffset:  &bit,
+		Width:      address.WidthBit,
+	}
+}
+
+// applyFaultAddress preenche DB, word e bit a partir de def.Endereco.
+// O bit é associado à word que começa no byte par (ex.: DB10.DBX5.2 → DBW4, bit 2).
+// Em equipamentos Modbus o endereço é um bit de holding register (ex.: HR12.3).
+func applyFaultAddress(def *FaultDefinition) error {
+	addr, err := address.Parse(def.Endereco)
+	if err != nil {
+		return err
+	}
+
+	if addr.Area == AreaHoldingRegisters && addr.BitOffset != nil {
+		def.DBNumber = 0
+		def.ByteOffset = addr.ByteOffset
+		def.BitOffset = *addr.BitOffset
+		def.Endereco = addr.String()
+		return nil
+	}
+
+	if addr.Area != AreaDB || addr.Width != address.WidthBit {
+		return fmt.Errorf("definições de falha requerem um endereço de bit num DB (ex.: DB10.DBX4.3) ou num holding register (ex.: HR12.3)")
+	}
+
+	def.DBNumber = addr.DBNumber
+	def.ByteOffset = addr.ByteOffset &^ 1
+	def.BitOffset = *addr.BitOffset
+	if addr.ByteOffset%2 == 0 {
+		def.BitOffset += 8
+	}
+	def.Endereco = addr.String()
+
+	return nil
+}
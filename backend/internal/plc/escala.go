@@ -0,0 +1,120 @@
+package plc
+
+import (
+	"fmt"
+	"math"
+)
+
+// hasScaling indica se a tag tem escala linear completa configurada
+func hasScaling(tag *Tag) bool {
+	return tag.BrutoMin != nil && tag.BrutoMax != nil && tag.EngMin != nil && tag.EngMax != nil
+}
+
+// isTipoNumerico indica se o tipo da tag pode ser escalado
+func isTipoNumerico(tipo string) bool {
+	switch tipo {
+	case "Byte", "Int", "Word", "DInt", "DWord", "UDInt", "Real", "LReal":
+		return true
+	}
+	return false
+}
+
+// validateTagScaling verifica a configuração de escala, limites e precisão da tag
+func validateTagScaling(tag *Tag) error {
+	configured := 0
+	for _, v := range []*float64{tag.BrutoMin, tag.BrutoMax, tag.EngMin, tag.EngMax} {
+		if v != nil {
+			configured++
+		}
+	}
+
+	if configured != 0 && configured != 4 {
+		return fmt.Errorf("escala requer bruto_min, bruto_max, eng_min e eng_max")
+	}
+
+	if configured == 4 {
+		if !isTipoNumerico(tag.Tipo) {
+			return fmt.Errorf("escala só é suportada em tags numéricas, não em %s", tag.Tipo)
+		}
+		if *tag.BrutoMin == *tag.BrutoMax {
+			return fmt.Errorf("bruto_min e bruto_max não podem ser iguais")
+		}
+		if *tag.EngMin == *tag.EngMax {
+			return fmt.Errorf("eng_min e eng_max não podem ser iguais")
+		}
+	} else if tag.Limitar {
+		return fmt.Errorf("limitar requer escala configurada")
+	}
+
+	if tag.Precisao != nil && (*tag.Precisao < 0 || *tag.Precisao > 10) {
+		return fmt.Errorf("precisao deve estar entre 0 e 10 casas decimais")
+	}
+
+	return nil
+}
+
+// scaleValue converte um valor bruto lido do PLC em unidades de engenharia.
+// Valores não numéricos e tags sem escala são devolvidos sem alteração (exceto o arredondamento de floats).
+func scaleValue(tag *Tag, raw interface{}) interface{} {
+	if !hasScaling(tag) {
+		if f, ok := raw.(float64); ok && tag.Precisao != nil {
+			return roundPrecision(f, *tag.Precisao)
+		}
+		if f, ok := raw.(float32); ok && tag.Precisao != nil {
+			return roundPrecision(float64(f), *tag.Precisao)
+		}
+		return raw
+	}
+
+	value, err := toFloat64(raw)
+	if err != nil {
+		return raw
+	}
+
+	eng := *tag.EngMin + (value-*tag.BrutoMin)*(*tag.EngMax-*tag.EngMin)/(*tag.BrutoMax-*tag.BrutoMin)
+
+	if tag.Limitar {
+		eng = clampRange(eng, *tag.EngMin, *tag.EngMax)
+	}
+
+	if tag.Precisao != nil {
+		eng = roundPrecision(eng, *tag.Precisao)
+	}
+
+	return eng
+}
+
+// unscaleValue converte um valor em unidades de engenharia no valor bruto a escrever no PLC
+func unscaleValue(tag *Tag, value interface{}) (interface{}, error) {
+	if !hasScaling(tag) {
+		return value, nil
+	}
+
+	eng, err := toFloat64(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if tag.Limitar {
+		eng = clampRange(eng, *tag.EngMin, *tag.EngMax)
+	}
+
+	raw := *tag.BrutoMin + (eng-*tag.EngMin)*(*tag.BrutoMax-*tag.BrutoMin)/(*tag.EngMax-*tag.EngMin)
+
+	if tag.Tipo == "Real" || tag.Tipo == "LReal" {
+		return raw, nil
+	}
+	return int64(math.Round(raw)), nil
+}
+
+// clampRange limita o valor ao intervalo, aceitando limites em qualquer ordem
+func clampRange(value, a, b float64) float64 {
+	low, high := math.Min(a, b), math.Max(a, b)
+	return math.Max(low, math.Min(high, value))
+}
+
+// roundPrecision arredonda o valor ao número de casas decimais indicado
+func roundPrecision(value float64, casas int) float64 {
+	factor := math.Pow(10, float64(casas))
+	return math.Round(value*factor) / factor
+}
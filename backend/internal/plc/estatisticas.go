@@ -0,0 +1,487 @@
+package plc
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+)
+
+// DisponibilidadePLC guarda os números diários de disponibilidade da ligação a um PLC
+type DisponibilidadePLC struct {
+	ID                   uint      `json:"id" gorm:"primaryKey"`
+	PLCID                uint      `json:"plc_id" gorm:"not null;column:plc_id;uniqueIndex:idx_plc_disponibilidade_dia"`
+	Data                 time.Time `json:"data" gorm:"type:date;not null;uniqueIndex:idx_plc_disponibilidade_dia"`
+	SegundosConectado    float64   `json:"segundos_conectado" gorm:"not null;default:0"`
+	SegundosDesconectado float64   `json:"segundos_desconectado" gorm:"not null;default:0"`
+	Reconexoes           int64     `json:"reconexoes" gorm:"not null;default:0"`
+	LeiturasOK           int64     `json:"leituras_ok" gorm:"column:leituras_ok;not null;default:0"`
+	LeiturasFalha        int64     `json:"leituras_falha" gorm:"not null;default:0"`
+	Disponibilidade      float64   `json:"disponibilidade" gorm:"-"` // Percentagem do tempo monitorizado em que esteve conectado
+}
+
+// TableName define o nome da tabela
+func (DisponibilidadePLC) TableName() string {
+	return "plc_disponibilidade"
+}
+
+// PLCStatistics é o retrato das estatísticas de comunicação de um PLC
+type PLCStatistics struct {
+	PLCID                uint            `json:"plc_id"`
+	Conectado            bool            `json:"conectado"`
+	LeiturasOK           int64           `json:"leituras_ok"`
+	LeiturasFalha        int64           `json:"leituras_falha"`
+	TaxaSucesso          float64         `json:"taxa_sucesso"` // Percentagem de leituras bem-sucedidas
+	LatenciaMediaMs      float64         `json:"latencia_media_ms"`
+	LatenciaP95Ms        float64         `json:"latencia_p95_ms"` // Sobre as últimas leituras (StatsLatencyWindow)
+	Conexoes             int64           `json:"conexoes"`
+	Reconexoes           int64           `json:"reconexoes"`
+	UltimaConexao        *time.Time      `json:"ultima_conexao,omitempty"`
+	UltimaDesconexao     *time.Time      `json:"ultima_desconexao,omitempty"`
+	SegundosConectado    float64         `json:"segundos_conectado"`
+	SegundosDesconectado float64         `json:"segundos_desconectado"`
+	Disponibilidade      float64         `json:"disponibilidade"` // Percentagem desde o início da monitorização
+	Desde                time.Time       `json:"desde"`
+	Tags                 []TagStatistics `json:"tags,omitempty"`
+}
+
+// TagStatistics é o retrato das estatísticas de leitura de uma tag
+type TagStatistics struct {
+	TagID           uint       `json:"tag_id"`
+	Nome            string     `json:"nome,omitempty"`
+	LeiturasOK      int64      `json:"leituras_ok"`
+	LeiturasFalha   int64      `json:"leituras_falha"`
+	LatenciaMediaMs float64    `json:"latencia_media_ms"`
+	UltimaFalha     *time.Time `json:"ultima_falha,omitempty"`
+}
+
+// commStats acumula os contadores de comunicação de um PLC
+type commStats struct {
+	mutex sync.Mutex
+
+	leiturasOK    int64
+	leiturasFalha int64
+	latenciaSoma  time.Duration
+	latencias     []time.Duration // Janela circular para o p95
+	latenciaIdx   int
+
+	ativo             bool // Tempo só é contabilizado enquanto o PLC é gerido
+	conectado         bool
+	conexoes          int64
+	ultimaConexao     time.Time
+	ultimaDesconexao  time.Time
+	conectadoTotal    time.Duration
+	desconectadoTotal time.Duration
+	contabilizadoAte  time.Time
+	inicio            time.Time
+
+	tags   map[uint]*tagCommStats
+	diario map[string]*dailyCommStats // Incrementos por dia ainda não gravados
+}
+
+// tagCommStats acumula os contadores de leitura de uma tag
+type tagCommStats struct {
+	leiturasOK    int64
+	leiturasFalha int64
+	latenciaSoma  time.Duration
+	ultimaFalha   time.Time
+}
+
+// dailyCommStats são os incrementos de um dia desde a última gravação
+type dailyCommStats struct {
+	conectado     time.Duration
+	desconectado  time.Duration
+	reconexoes    int64
+	leiturasOK    int64
+	leiturasFalha int64
+}
+
+// statsRegistry guarda as estatísticas de todos os PLCs, mantidas entre reinícios do PLC
+type statsRegistry struct {
+	mutex sync.Mutex
+	plcs  map[uint]*commStats
+}
+
+// newStatsRegistry cria um registo vazio
+func newStatsRegistry() *statsRegistry {
+	return &statsRegistry{plcs: make(map[uint]*commStats)}
+}
+
+// get retorna as estatísticas de um PLC, criando-as se necessário
+func (r *statsRegistry) get(plcID uint) *commStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, exists := r.plcs[plcID]
+	if !exists {
+		now := time.Now()
+		s = &commStats{
+			inicio:           now,
+			contabilizadoAte: now,
+			tags:             make(map[uint]*tagCommStats),
+			diario:           make(map[string]*dailyCommStats),
+		}
+		r.plcs[plcID] = s
+	}
+	return s
+}
+
+// all retorna os IDs e estatísticas de todos os PLCs registados
+func (r *statsRegistry) all() map[uint]*commStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	all := make(map[uint]*commStats, len(r.plcs))
+	for id, s := range r.plcs {
+		all[id] = s
+	}
+	return all
+}
+
+// day retorna os incrementos do dia de t
+func (s *commStats) day(t time.Time) *dailyCommStats {
+	key := t.Format("2006-01-02")
+	d, exists := s.diario[key]
+	if !exists {
+		d = &dailyCommStats{}
+		s.diario[key] = d
+	}
+	return d
+}
+
+// accountTime atribui o tempo decorrido desde a última contabilização ao estado atual,
+// dividindo-o pelos dias que atravessa. Deve ser chamado com o mutex bloqueado.
+func (s *commStats) accountTime(now time.Time) {
+	from := s.contabilizadoAte
+	s.contabilizadoAte = now
+	if !s.ativo || !now.After(from) {
+		return
+	}
+
+	for from.Before(now) {
+		y, mo, d := from.Date()
+		midnight := time.Date(y, mo, d+1, 0, 0, 0, 0, from.Location())
+		to := now
+		if midnight.Before(now) {
+			to = midnight
+		}
+
+		elapsed := to.Sub(from)
+		if s.conectado {
+			s.conectadoTotal += elapsed
+			s.day(from).conectado += elapsed
+		} else {
+			s.desconectadoTotal += elapsed
+			s.day(from).desconectado += elapsed
+		}
+		from = to
+	}
+}
+
+// start marca o início da gestão do PLC (desconectado até à primeira conexão)
+func (s *commStats) start() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accountTime(time.Now())
+	s.ativo = true
+	s.conectado = false
+}
+
+// stop deixa de contabilizar tempo para o PLC
+func (s *commStats) stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accountTime(time.Now())
+	s.ativo = false
+	s.conectado = false
+}
+
+// connected regista uma conexão bem-sucedida
+func (s *commStats) connected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.accountTime(now)
+	if s.conexoes > 0 {
+		s.day(now).reconexoes++
+	}
+	s.conexoes++
+	s.conectado = true
+	s.ultimaConexao = now
+}
+
+// disconnected regista a perda (ou falha) de conexão
+func (s *commStats) disconnected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	s.accountTime(now)
+	if s.conectado {
+		s.ultimaDesconexao = now
+	}
+	s.conectado = false
+}
+
+// recordRead regista o resultado de uma leitura e as tags abrangidas
+func (s *commStats) recordRead(tags []*Tag, latency time.Duration, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	if err != nil {
+		s.leiturasFalha++
+		s.day(now).leiturasFalha++
+	} else {
+		s.leiturasOK++
+		s.day(now).leiturasOK++
+		s.latenciaSoma += latency
+
+		if len(s.latencias) < Config.StatsLatencyWindow {
+			s.latencias = append(s.latencias, latency)
+		} else if len(s.latencias) > 0 {
+			s.latencias[s.latenciaIdx] = latency
+			s.latenciaIdx = (s.latenciaIdx + 1) % len(s.latencias)
+		}
+	}
+
+	for _, tag := range tags {
+		ts, exists := s.tags[tag.ID]
+		if !exists {
+			ts = &tagCommStats{}
+			s.tags[tag.ID] = ts
+		}
+		if err != nil {
+			ts.leiturasFalha++
+			ts.ultimaFalha = now
+		} else {
+			ts.leiturasOK++
+			ts.latenciaSoma += latency
+		}
+	}
+}
+
+// recordTagFailure regista uma falha de uma tag sem falha da leitura (ex.: erro de descodificação)
+func (s *commStats) recordTagFailure(tag *Tag) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ts, exists := s.tags[tag.ID]
+	if !exists {
+		ts = &tagCommStats{}
+		s.tags[tag.ID] = ts
+	}
+	ts.leiturasFalha++
+	ts.ultimaFalha = time.Now()
+}
+
+// removeTag descarta as estatísticas de uma tag removida
+func (s *commStats) removeTag(tagID uint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.tags, tagID)
+}
+
+// snapshot monta o retrato das estatísticas
+func (s *commStats) snapshot(plcID uint, tags []*Tag) PLCStatistics {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accountTime(time.Now())
+
+	stats := PLCStatistics{
+		PLCID:                plcID,
+		Conectado:            s.conectado,
+		LeiturasOK:           s.leiturasOK,
+		LeiturasFalha:        s.leiturasFalha,
+		TaxaSucesso:          percentage(float64(s.leiturasOK), float64(s.leiturasOK+s.leiturasFalha)),
+		LatenciaP95Ms:        durationMs(percentile(s.latencias, 0.95)),
+		Conexoes:             s.conexoes,
+		SegundosConectado:    s.conectadoTotal.Seconds(),
+		SegundosDesconectado: s.desconectadoTotal.Seconds(),
+		Disponibilidade:      percentage(s.conectadoTotal.Seconds(), (s.conectadoTotal + s.desconectadoTotal).Seconds()),
+		Desde:                s.inicio,
+	}
+	if s.leiturasOK > 0 {
+		stats.LatenciaMediaMs = durationMs(s.latenciaSoma / time.Duration(s.leiturasOK))
+	}
+	if s.conexoes > 1 {
+		stats.Reconexoes = s.conexoes - 1
+	}
+	if !s.ultimaConexao.IsZero() {
+		t := s.ultimaConexao
+		stats.UltimaConexao = &t
+	}
+	if !s.ultimaDesconexao.IsZero() {
+		t := s.ultimaDesconexao
+		stats.UltimaDesconexao = &t
+	}
+
+	for _, tag := range tags {
+		ts := TagStatistics{TagID: tag.ID, Nome: tag.Nome}
+		if counters, exists := s.tags[tag.ID]; exists {
+			ts.LeiturasOK = counters.leiturasOK
+			ts.LeiturasFalha = counters.leiturasFalha
+			if counters.leiturasOK > 0 {
+				ts.LatenciaMediaMs = durationMs(counters.latenciaSoma / time.Duration(counters.leiturasOK))
+			}
+			if !counters.ultimaFalha.IsZero() {
+				t := counters.ultimaFalha
+				ts.UltimaFalha = &t
+			}
+		}
+		stats.Tags = append(stats.Tags, ts)
+	}
+
+	return stats
+}
+
+// takeDaily contabiliza o tempo e retorna os incrementos diários pendentes, limpando-os
+func (s *commStats) takeDaily() map[string]*dailyCommStats {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.accountTime(time.Now())
+	diario := s.diario
+	s.diario = make(map[string]*dailyCommStats)
+	return diario
+}
+
+// restoreDaily devolve incrementos que não puderam ser gravados
+func (s *commStats) restoreDaily(diario map[string]*dailyCommStats) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for key, d := range diario {
+		current, exists := s.diario[key]
+		if !exists {
+			s.diario[key] = d
+			continue
+		}
+		current.conectado += d.conectado
+		current.desconectado += d.desconectado
+		current.reconexoes += d.reconexoes
+		current.leiturasOK += d.leiturasOK
+		current.leiturasFalha += d.leiturasFalha
+	}
+}
+
+// percentile calcula o percentil p (0-1) de uma amostra de durações
+func percentile(samples []time.Duration, p float64) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+
+	sorted := make([]time.Duration, len(samples))
+	copy(sorted, samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	idx := int(float64(len(sorted))*p+0.5) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// percentage calcula part/total em percentagem, com duas casas decimais
+func percentage(part, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(int64(part/total*10000+0.5)) / 100
+}
+
+// durationMs converte uma duração em milissegundos com três casas decimais
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// PLCStatistics retorna as estatísticas de comunicação de um PLC gerido
+func (m *Manager) PLCStatistics(plcID uint) (PLCStatistics, bool) {
+	plc, exists := m.GetPLC(plcID)
+	if !exists {
+		return PLCStatistics{}, false
+	}
+	return m.stats.get(plcID).snapshot(plcID, plc.tagList()), true
+}
+
+// plcStatsSummary retorna as estatísticas de um PLC sem o detalhe por tag
+func (m *Manager) plcStatsSummary(plcID uint) PLCStatistics {
+	return m.stats.get(plcID).snapshot(plcID, nil)
+}
+
+// GetAvailability retorna a disponibilidade diária gravada de um PLC nos últimos dias
+func (m *Manager) GetAvailability(plcID uint, dias int) ([]DisponibilidadePLC, error) {
+	// Gravar primeiro os incrementos pendentes para incluir o dia atual
+	m.persistStats()
+
+	desde := time.Now().AddDate(0, 0, -dias+1)
+	var registos []DisponibilidadePLC
+	err := config.DB.Where("plc_id = ? AND data >= ?", plcID, desde.Format("2006-01-02")).
+		Order("data").
+		Find(&registos).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range registos {
+		r := &registos[i]
+		r.Disponibilidade = percentage(r.SegundosConectado, r.SegundosConectado+r.SegundosDesconectado)
+	}
+	return registos, nil
+}
+
+// runStatsPersistence grava periodicamente os números diários de disponibilidade
+func (m *Manager) runStatsPersistence() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(Config.StatsPersistPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			m.persistStats()
+			return
+		case <-ticker.C:
+			m.persistStats()
+		}
+	}
+}
+
+// persistStats soma os incrementos diários pendentes de cada PLC na tabela de disponibilidade
+func (m *Manager) persistStats() {
+	m.statsPersistMutex.Lock()
+	defer m.statsPersistMutex.Unlock()
+
+	for plcID, s := range m.stats.all() {
+		diario := s.takeDaily()
+		for key, d := range diario {
+			err := config.DB.Exec(`
+				INSERT INTO plc_disponibilidade
+					(plc_id, data, segundos_conectado, segundos_desconectado, reconexoes, leituras_ok, leituras_falha)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+				ON CONFLICT (plc_id, data) DO UPDATE SET
+					segundos_conectado = plc_disponibilidade.segundos_conectado + EXCLUDED.segundos_conectado,
+					segundos_desconectado = plc_disponibilidade.segundos_desconectado + EXCLUDED.segundos_desconectado,
+					reconexoes = plc_disponibilidade.reconexoes + EXCLUDED.reconexoes,
+					leituras_ok = plc_disponibilidade.leituras_ok + EXCLUDED.leituras_ok,
+					leituras_falha = plc_disponibilidade.leituras_falha + EXCLUDED.leituras_falha`,
+				plcID, key, d.conectado.Seconds(), d.desconectado.Seconds(),
+				d.reconexoes, d.leiturasOK, d.leiturasFalha).Error
+			if err != nil {
+				log.Printf("Falha ao gravar disponibilidade do PLC %d (%s): %v", plcID, key, err)
+				s.restoreDaily(map[string]*dailyCommStats{key: d})
+			}
+		}
+	}
+}
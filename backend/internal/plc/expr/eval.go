@@ -0,0 +1,397 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ErrNoValue indica que uma tag referida ainda não tem valor
+var ErrNoValue = errors.New("tag referida sem valor")
+
+// Env fornece à avaliação os valores das tags referidas
+type Env interface {
+	Value(tagID uint) (interface{}, error)
+}
+
+// Eval avalia a expressão no instante indicado. O resultado é float64 ou bool.
+func (p *Program) Eval(env Env, now time.Time) (interface{}, error) {
+	ctx := &evalContext{env: env, now: now}
+	return p.root.eval(ctx)
+}
+
+// evalContext reúne o ambiente e o instante de uma avaliação
+type evalContext struct {
+	env Env
+	now time.Time
+}
+
+type node interface {
+	eval(ctx *evalContext) (interface{}, error)
+}
+
+type constNode struct {
+	value interface{}
+}
+
+func (n *constNode) eval(ctx *evalContext) (interface{}, error) {
+	return n.value, nil
+}
+
+type refNode struct {
+	id uint
+}
+
+func (n *refNode) eval(ctx *evalContext) (interface{}, error) {
+	value, err := ctx.env.Value(n.id)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case nil:
+		return nil, fmt.Errorf("[%d]: %w", n.id, ErrNoValue)
+	}
+
+	num, ok := toNumber(value)
+	if !ok {
+		return nil, fmt.Errorf("[%d]: valor do tipo %T não é numérico nem booleano", n.id, value)
+	}
+	return num, nil
+}
+
+type unaryNode struct {
+	op      string
+	operand node
+}
+
+func (n *unaryNode) eval(ctx *evalContext) (interface{}, error) {
+	value, err := n.operand.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "!" {
+		return !asBool(value), nil
+	}
+	return -asNumber(value), nil
+}
+
+type binaryNode struct {
+	op          string
+	left, right node
+}
+
+func (n *binaryNode) eval(ctx *evalContext) (interface{}, error) {
+	left, err := n.left.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Avaliação em curto-circuito dos operadores booleanos
+	switch n.op {
+	case "&&":
+		if !asBool(left) {
+			return false, nil
+		}
+	case "||":
+		if asBool(left) {
+			return true, nil
+		}
+	}
+
+	right, err := n.right.eval(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "&&", "||":
+		return asBool(right), nil
+	case "==", "!=":
+		equal := asNumber(left) == asNumber(right)
+		if lb, ok := left.(bool); ok {
+			if rb, ok := right.(bool); ok {
+				equal = lb == rb
+			}
+		}
+		return equal == (n.op == "=="), nil
+	}
+
+	a, b := asNumber(left), asNumber(right)
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, errors.New("divisão por zero")
+		}
+		return a / b, nil
+	case "%":
+		if b == 0 {
+			return nil, errors.New("divisão por zero")
+		}
+		return math.Mod(a, b), nil
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	case ">=":
+		return a >= b, nil
+	}
+
+	return nil, fmt.Errorf("operador desconhecido %s", n.op)
+}
+
+// callNode é a chamada de uma função. O estado das funções temporais fica no próprio nó,
+// por isso duas chamadas a integral na mesma expressão acumulam em separado.
+type callNode struct {
+	name  string
+	def   funcDef
+	args  []node
+	state funcState
+}
+
+func (n *callNode) eval(ctx *evalContext) (interface{}, error) {
+	// if avalia apenas o ramo escolhido
+	if n.name == "if" {
+		cond, err := n.args[0].eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if asBool(cond) {
+			return n.args[1].eval(ctx)
+		}
+		return n.args[2].eval(ctx)
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		value, err := arg.eval(ctx)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = value
+	}
+
+	return n.def.fn(ctx, &n.state, args)
+}
+
+// funcState guarda o estado das funções temporais entre avaliações
+type funcState struct {
+	started bool
+	last    time.Time
+	lastX   float64
+	total   float64
+	since   time.Time
+}
+
+type funcDef struct {
+	minArgs  int
+	maxArgs  int // -1 = sem limite
+	temporal bool
+	fn       func(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error)
+}
+
+// funcs são as funções disponíveis nas expressões
+var funcs = map[string]funcDef{
+	"min":   {minArgs: 1, maxArgs: -1, fn: fnMin},
+	"max":   {minArgs: 1, maxArgs: -1, fn: fnMax},
+	"abs":   {minArgs: 1, maxArgs: 1, fn: mathFunc(math.Abs)},
+	"floor": {minArgs: 1, maxArgs: 1, fn: mathFunc(math.Floor)},
+	"ceil":  {minArgs: 1, maxArgs: 1, fn: mathFunc(math.Ceil)},
+	"sqrt":  {minArgs: 1, maxArgs: 1, fn: fnSqrt},
+	"round": {minArgs: 1, maxArgs: 2, fn: fnRound},
+	"pow":   {minArgs: 2, maxArgs: 2, fn: fnPow},
+	"if":    {minArgs: 3, maxArgs: 3}, // Tratada em callNode.eval
+
+	// Tempo local do servidor
+	"now":     {maxArgs: 0, temporal: true, fn: timeFunc(func(t time.Time) float64 { return float64(t.Unix()) })},
+	"hour":    {maxArgs: 0, temporal: true, fn: timeFunc(func(t time.Time) float64 { return float64(t.Hour()) })},
+	"minute":  {maxArgs: 0, temporal: true, fn: timeFunc(func(t time.Time) float64 { return float64(t.Minute()) })},
+	"second":  {maxArgs: 0, temporal: true, fn: timeFunc(func(t time.Time) float64 { return float64(t.Second()) })},
+	"weekday": {maxArgs: 0, temporal: true, fn: timeFunc(func(t time.Time) float64 { return float64(t.Weekday()) })}, // 0 = domingo
+	"day":     {maxArgs: 0, temporal: true, fn: timeFunc(func(t time.Time) float64 { return float64(t.Day()) })},
+	"month":   {maxArgs: 0, temporal: true, fn: timeFunc(func(t time.Time) float64 { return float64(t.Month()) })},
+
+	// integral(x[, periodo_s]): soma de x ao longo do tempo (unidades de x × segundos), reposta
+	// a zero no início de cada período alinhado à meia-noite local (86400 = diário, 3600 = horário)
+	"integral": {minArgs: 1, maxArgs: 2, temporal: true, fn: fnIntegral},
+	// ontime(cond): segundos desde que cond passou a verdadeira, 0 enquanto falsa
+	"ontime": {minArgs: 1, maxArgs: 1, temporal: true, fn: fnOnTime},
+}
+
+func fnMin(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+	result := asNumber(args[0])
+	for _, arg := range args[1:] {
+		result = math.Min(result, asNumber(arg))
+	}
+	return result, nil
+}
+
+func fnMax(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+	result := asNumber(args[0])
+	for _, arg := range args[1:] {
+		result = math.Max(result, asNumber(arg))
+	}
+	return result, nil
+}
+
+func fnSqrt(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+	x := asNumber(args[0])
+	if x < 0 {
+		return nil, errors.New("sqrt de número negativo")
+	}
+	return math.Sqrt(x), nil
+}
+
+func fnRound(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+	x := asNumber(args[0])
+	if len(args) == 1 {
+		return math.Round(x), nil
+	}
+	factor := math.Pow(10, math.Round(asNumber(args[1])))
+	return math.Round(x*factor) / factor, nil
+}
+
+func fnPow(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+	result := math.Pow(asNumber(args[0]), asNumber(args[1]))
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return nil, errors.New("pow fora do domínio")
+	}
+	return result, nil
+}
+
+func fnIntegral(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+	x := asNumber(args[0])
+
+	if len(args) == 2 {
+		period, err := integralPeriod(asNumber(args[1]))
+		if err != nil {
+			return nil, err
+		}
+		if state.started && periodStart(ctx.now, period) != periodStart(state.last, period) {
+			state.total = 0
+			state.last = periodStart(ctx.now, period)
+		}
+	}
+
+	// Regra do trapézio entre avaliações consecutivas
+	if state.started {
+		if dt := ctx.now.Sub(state.last).Seconds(); dt > 0 {
+			state.total += (state.lastX + x) / 2 * dt
+		}
+	}
+
+	state.started = true
+	state.last = ctx.now
+	state.lastX = x
+	return state.total, nil
+}
+
+func fnOnTime(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+	if !asBool(args[0]) {
+		state.started = false
+		return 0.0, nil
+	}
+
+	if !state.started {
+		state.started = true
+		state.since = ctx.now
+	}
+	return ctx.now.Sub(state.since).Seconds(), nil
+}
+
+// integralPeriod converte o período de integral, em segundos, numa duração. Períodos abaixo de
+// um segundo são recusados; a partir de um dia a reposição é sempre diária.
+func integralPeriod(seconds float64) (time.Duration, error) {
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) || seconds < 1 {
+		return 0, errors.New("integral: período deve ser de pelo menos 1 segundo")
+	}
+	if seconds >= 86400 {
+		return 24 * time.Hour, nil
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// periodStart retorna o início do período que contém t, contado desde a meia-noite local.
+// period deve ser positivo (ver integralPeriod).
+func periodStart(t time.Time, period time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if period >= 24*time.Hour {
+		return midnight
+	}
+	return midnight.Add(t.Sub(midnight) / period * period)
+}
+
+func mathFunc(f func(float64) float64) func(*evalContext, *funcState, []interface{}) (interface{}, error) {
+	return func(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+		return f(asNumber(args[0])), nil
+	}
+}
+
+func timeFunc(f func(time.Time) float64) func(*evalContext, *funcState, []interface{}) (interface{}, error) {
+	return func(ctx *evalContext, state *funcState, args []interface{}) (interface{}, error) {
+		return f(ctx.now), nil
+	}
+}
+
+// asNumber converte um valor da avaliação em número (true = 1)
+func asNumber(value interface{}) float64 {
+	if b, ok := value.(bool); ok {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	num, _ := toNumber(value)
+	return num
+}
+
+// asBool converte um valor da avaliação em booleano (número diferente de zero = verdadeiro)
+func asBool(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return asNumber(value) != 0
+}
+
+// toNumber converte os tipos numéricos lidos dos drivers em float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,206 @@
+package expr
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mapEnv fornece valores de tags fixos às avaliações
+type mapEnv map[uint]interface{}
+
+func (e mapEnv) Value(tagID uint) (interface{}, error) {
+	value, exists := e[tagID]
+	if !exists {
+		return nil, ErrNoValue
+	}
+	return value, nil
+}
+
+func TestEval(t *testing.T) {
+	env := mapEnv{1: 10.0, 2: int16(4), 3: true, 4: false, 5: uint32(7), 6: nil, 7: "texto"}
+	now := time.Date(2024, 3, 10, 14, 30, 15, 0, time.Local)
+
+	tests := []struct {
+		source string
+		want   interface{}
+		err    string
+	}{
+		{source: "[1] - [2]", want: 6.0},
+		{source: "[1] / [2]", want: 2.5},
+		{source: "[5] % 4", want: 3.0},
+		{source: "-[1] + 2 * 3", want: -4.0},
+		{source: "[3] && ![4]", want: true},
+		{source: "[3] + [3]", want: 2.0},
+		{source: "[1] >= 10", want: true},
+		{source: "[3] == true", want: true},
+		{source: "[1] != 10", want: false},
+		{source: "min(5, [1], [2])", want: 4.0},
+		{source: "max(3, [1], [2])", want: 10.0},
+		{source: "round(2.345, 2)", want: 2.35},
+		{source: "if([4], 1 / 0, 5)", want: 5.0},
+		{source: "[4] && 1 / 0", want: false},
+		{source: "hour() * 100 + minute()", want: 1430.0},
+		{source: "weekday()", want: 0.0},
+
+		{source: "[1] / 0", err: "divisão por zero"},
+		{source: "[1] % 0", err: "divisão por zero"},
+		{source: "sqrt(-1)", err: "sqrt de número negativo"},
+		{source: "pow(-8, 0.5)", err: "pow fora do domínio"},
+		{source: "[6] + 1", err: ErrNoValue.Error()},
+		{source: "[99] + 1", err: ErrNoValue.Error()},
+		{source: "[7] + 1", err: "não é numérico"},
+	}
+
+	for _, tt := range tests {
+		program, err := Compile(tt.source)
+		if err != nil {
+			t.Errorf("Compile(%q): %v", tt.source, err)
+			continue
+		}
+
+		got, err := program.Eval(env, now)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Eval(%q): erro = %v, esperado %q", tt.source, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Eval(%q): erro inesperado %v", tt.source, err)
+			continue
+		}
+		if f, ok := got.(float64); ok {
+			if want, ok := tt.want.(float64); ok && math.Abs(f-want) < 1e-9 {
+				continue
+			}
+		}
+		if got != tt.want {
+			t.Errorf("Eval(%q) = %v (%T), esperado %v", tt.source, got, got, tt.want)
+		}
+	}
+}
+
+func TestEvalNoValueIsWrapped(t *testing.T) {
+	program, err := Compile("[6]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := program.Eval(mapEnv{6: nil}, time.Now()); !errors.Is(err, ErrNoValue) {
+		t.Errorf("erro = %v, esperado ErrNoValue", err)
+	}
+}
+
+// step é uma avaliação de uma expressão temporal: valor das tags, instante e resultado esperado
+type step struct {
+	env  mapEnv
+	at   time.Duration // Desde a meia-noite
+	want float64
+	err  string
+}
+
+func TestTemporalFunctions(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		steps  []step
+	}{
+		{
+			name:   "integral pela regra do trapézio",
+			source: "integral([1])",
+			steps: []step{
+				{env: mapEnv{1: 0.0}, at: 10 * time.Second, want: 0},
+				{env: mapEnv{1: 2.0}, at: 20 * time.Second, want: 10},
+				{env: mapEnv{1: 2.0}, at: 30 * time.Second, want: 30},
+				{env: mapEnv{1: 2.0}, at: 30 * time.Second, want: 30}, // Sem tempo decorrido
+			},
+		},
+		{
+			name:   "integral reposta no início de cada hora",
+			source: "integral([1], 3600)",
+			steps: []step{
+				{env: mapEnv{1: 1.0}, at: time.Hour - 20*time.Second, want: 0},
+				{env: mapEnv{1: 1.0}, at: time.Hour - 10*time.Second, want: 10},
+				{env: mapEnv{1: 1.0}, at: time.Hour + 5*time.Second, want: 5},
+				{env: mapEnv{1: 1.0}, at: time.Hour + 15*time.Second, want: 15},
+			},
+		},
+		{
+			name:   "integral com período acima de um dia é diária",
+			source: "integral([1], 1e300)",
+			steps: []step{
+				{env: mapEnv{1: 1.0}, at: 10 * time.Second, want: 0},
+				{env: mapEnv{1: 1.0}, at: 20 * time.Second, want: 10},
+			},
+		},
+		{
+			name:   "integral com período abaixo de um segundo",
+			source: "integral([1], 1e-10)",
+			steps: []step{
+				{env: mapEnv{1: 1.0}, at: 10 * time.Second, err: "pelo menos 1 segundo"},
+				{env: mapEnv{1: 1.0}, at: 20 * time.Second, err: "pelo menos 1 segundo"},
+			},
+		},
+		{
+			name:   "integral com período vindo de uma tag",
+			source: "integral([1], [2])",
+			steps: []step{
+				{env: mapEnv{1: 1.0, 2: 60.0}, at: 10 * time.Second, want: 0},
+				{env: mapEnv{1: 1.0, 2: 0.0}, at: 20 * time.Second, err: "pelo menos 1 segundo"},
+				{env: mapEnv{1: 1.0, 2: math.Inf(1)}, at: 30 * time.Second, err: "pelo menos 1 segundo"},
+				{env: mapEnv{1: 1.0, 2: math.NaN()}, at: 40 * time.Second, err: "pelo menos 1 segundo"},
+				{env: mapEnv{1: 1.0, 2: -5.0}, at: 50 * time.Second, err: "pelo menos 1 segundo"},
+			},
+		},
+		{
+			name:   "ontime conta enquanto a condição é verdadeira",
+			source: "ontime([1] > 5)",
+			steps: []step{
+				{env: mapEnv{1: 0.0}, at: 0, want: 0},
+				{env: mapEnv{1: 10.0}, at: 10 * time.Second, want: 0},
+				{env: mapEnv{1: 10.0}, at: 25 * time.Second, want: 15},
+				{env: mapEnv{1: 0.0}, at: 30 * time.Second, want: 0},
+				{env: mapEnv{1: 10.0}, at: 40 * time.Second, want: 0},
+				{env: mapEnv{1: 10.0}, at: 42 * time.Second, want: 2},
+			},
+		},
+		{
+			name:   "chamadas distintas acumulam em separado",
+			source: "integral([1]) - integral([1] * 2)",
+			steps: []step{
+				{env: mapEnv{1: 1.0}, at: 0, want: 0},
+				{env: mapEnv{1: 1.0}, at: 10 * time.Second, want: -10},
+			},
+		},
+	}
+
+	midnight := time.Date(2024, 3, 10, 0, 0, 0, 0, time.Local)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program, err := Compile(tt.source)
+			if err != nil {
+				t.Fatalf("Compile(%q): %v", tt.source, err)
+			}
+
+			for i, s := range tt.steps {
+				got, err := program.Eval(s.env, midnight.Add(s.at))
+				if s.err != "" {
+					if err == nil || !strings.Contains(err.Error(), s.err) {
+						t.Errorf("passo %d: erro = %v, esperado %q", i, err, s.err)
+					}
+					continue
+				}
+				if err != nil {
+					t.Errorf("passo %d: erro inesperado %v", i, err)
+					continue
+				}
+				if f, _ := got.(float64); math.Abs(f-s.want) > 1e-9 {
+					t.Errorf("passo %d: %v, esperado %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
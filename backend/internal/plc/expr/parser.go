@@ -0,0 +1,376 @@
+// Package expr compila e avalia as expressões das tags virtuais.
+//
+// Uma expressão combina valores de outras tags, referidas pelo ID entre parênteses retos ([12]),
+// com números, true/false e operadores aritméticos (+ - * / %), de comparação
+// (== != < <= > >=) e booleanos (&& || ! ou and, or, not), por exemplo:
+//
+//	[12] - [13]
+//	[20] && ![21]
+//	if([5] > 0, integral([5], 86400), 0)
+//
+// Funções disponíveis: min, max, abs, round, floor, ceil, sqrt, pow, if, now, hour, minute,
+// second, weekday, day, month, integral e ontime (ver funcs).
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Program é uma expressão compilada. Guarda o estado das funções temporais (integral, ontime),
+// por isso cada tag virtual deve ter o seu próprio Program e não o avaliar em paralelo.
+type Program struct {
+	source   string
+	root     node
+	refs     []uint
+	temporal bool
+}
+
+// Source retorna o texto da expressão
+func (p *Program) Source() string {
+	return p.source
+}
+
+// Refs retorna os IDs das tags referidas pela expressão, sem repetições
+func (p *Program) Refs() []uint {
+	return p.refs
+}
+
+// Temporal indica se a expressão usa funções de tempo e deve ser reavaliada periodicamente
+func (p *Program) Temporal() bool {
+	return p.temporal
+}
+
+// Compile interpreta uma expressão
+func Compile(source string) (*Program, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens, seen: make(map[uint]bool)}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("posição %d: símbolo inesperado %q", tok.pos, tok.text)
+	}
+
+	return &Program{source: source, root: root, refs: p.refs, temporal: p.temporal}, nil
+}
+
+// RewriteRefs substitui os IDs das tags referidas pela expressão, mantendo o resto do texto.
+// Usado ao copiar tags entre instalações, onde os IDs mudam.
+func RewriteRefs(source string, mapping func(id uint) (uint, bool)) (string, error) {
+	tokens, err := tokenize(source)
+	if err != nil {
+		return "", err
+	}
+
+	runes := []rune(source)
+	var result strings.Builder
+	last := 0
+	for _, tok := range tokens {
+		if tok.kind != tokRef {
+			continue
+		}
+		id, ok := mapping(tok.ref)
+		if !ok {
+			return "", fmt.Errorf("tag [%d] não encontrada", tok.ref)
+		}
+		result.WriteString(string(runes[last:tok.pos]))
+		result.WriteString(fmt.Sprintf("[%d]", id))
+		last = tok.pos + len([]rune(tok.text))
+	}
+	result.WriteString(string(runes[last:]))
+
+	return result.String(), nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokIdent
+	tokRef
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+	num  float64
+	ref  uint
+}
+
+// Operadores reconhecidos, os de dois caracteres primeiro
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "+", "-", "*", "/", "%", "<", ">", "!"}
+
+// tokenize divide a expressão em símbolos
+func tokenize(source string) ([]token, error) {
+	var tokens []token
+	runes := []rune(source)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				((runes[i] == '+' || runes[i] == '-') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			text := string(runes[start:i])
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("posição %d: número inválido %q", start, text)
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: text, pos: start, num: num})
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_') {
+				i++
+			}
+			text := string(runes[start:i])
+			switch strings.ToLower(text) {
+			case "and":
+				tokens = append(tokens, token{kind: tokOp, text: "&&", pos: start})
+			case "or":
+				tokens = append(tokens, token{kind: tokOp, text: "||", pos: start})
+			case "not":
+				tokens = append(tokens, token{kind: tokOp, text: "!", pos: start})
+			default:
+				tokens = append(tokens, token{kind: tokIdent, text: strings.ToLower(text), pos: start})
+			}
+
+		case r == '[':
+			start := i
+			end := start + 1
+			for end < len(runes) && runes[end] != ']' {
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("posição %d: referência de tag sem ']'", start)
+			}
+			text := strings.TrimSpace(string(runes[start+1 : end]))
+			id, err := strconv.ParseUint(text, 10, 32)
+			if err != nil || id == 0 {
+				return nil, fmt.Errorf("posição %d: referência de tag inválida [%s], use o ID da tag", start, text)
+			}
+			tokens = append(tokens, token{kind: tokRef, text: string(runes[start : end+1]), pos: start, ref: uint(id)})
+			i = end + 1
+
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokComma, text: ",", pos: i})
+			i++
+
+		default:
+			matched := false
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+					i += len([]rune(op))
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("posição %d: carácter inesperado %q", i, r)
+			}
+		}
+	}
+
+	return append(tokens, token{kind: tokEOF, pos: len(runes)}), nil
+}
+
+// parser implementa uma descida recursiva com um nível por precedência
+type parser struct {
+	tokens   []token
+	pos      int
+	refs     []uint
+	seen     map[uint]bool
+	temporal bool
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// acceptOp consome o operador se for um dos indicados
+func (p *parser) acceptOp(ops ...string) (string, bool) {
+	tok := p.peek()
+	if tok.kind != tokOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if tok.text == op {
+			p.next()
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// parseBinary interpreta uma cadeia associativa à esquerda de operadores do mesmo nível
+func (p *parser) parseBinary(operand func() (node, error), ops ...string) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		op, ok := p.acceptOp(ops...)
+		if !ok {
+			return left, nil
+		}
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *parser) parseOr() (node, error) {
+	return p.parseBinary(p.parseAnd, "||")
+}
+
+func (p *parser) parseAnd() (node, error) {
+	return p.parseBinary(p.parseEquality, "&&")
+}
+
+func (p *parser) parseEquality() (node, error) {
+	return p.parseBinary(p.parseComparison, "==", "!=")
+}
+
+func (p *parser) parseComparison() (node, error) {
+	return p.parseBinary(p.parseAdditive, "<", "<=", ">", ">=")
+}
+
+func (p *parser) parseAdditive() (node, error) {
+	return p.parseBinary(p.parseMultiplicative, "+", "-")
+}
+
+func (p *parser) parseMultiplicative() (node, error) {
+	return p.parseBinary(p.parseUnary, "*", "/", "%")
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if op, ok := p.acceptOp("-", "!", "+"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if op == "+" {
+			return operand, nil
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		return &constNode{value: tok.num}, nil
+
+	case tokRef:
+		if !p.seen[tok.ref] {
+			p.seen[tok.ref] = true
+			p.refs = append(p.refs, tok.ref)
+		}
+		return &refNode{id: tok.ref}, nil
+
+	case tokLParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, fmt.Errorf("posição %d: esperado ')'", closing.pos)
+		}
+		return inner, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &constNode{value: true}, nil
+		case "false":
+			return &constNode{value: false}, nil
+		}
+		return p.parseCall(tok)
+
+	case tokEOF:
+		return nil, fmt.Errorf("expressão incompleta")
+	}
+
+	return nil, fmt.Errorf("posição %d: símbolo inesperado %q", tok.pos, tok.text)
+}
+
+// parseCall interpreta a chamada de uma função e valida o número de argumentos
+func (p *parser) parseCall(name token) (node, error) {
+	def, exists := funcs[name.text]
+	if !exists {
+		return nil, fmt.Errorf("posição %d: função desconhecida %s", name.pos, name.text)
+	}
+	if open := p.next(); open.kind != tokLParen {
+		return nil, fmt.Errorf("posição %d: esperado '(' depois de %s", open.pos, name.text)
+	}
+
+	var args []node
+	if p.peek().kind != tokRParen {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+
+			if p.peek().kind != tokComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if closing := p.next(); closing.kind != tokRParen {
+		return nil, fmt.Errorf("posição %d: esperado ')' em %s", closing.pos, name.text)
+	}
+
+	if len(args) < def.minArgs || (def.maxArgs >= 0 && len(args) > def.maxArgs) {
+		return nil, fmt.Errorf("posição %d: número de argumentos inválido para %s", name.pos, name.text)
+	}
+	if def.temporal {
+		p.temporal = true
+	}
+
+	return &callNode{name: name.text, def: def, args: args}, nil
+}
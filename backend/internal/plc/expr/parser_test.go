@@ -0,0 +1,103 @@
+package expr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		source   string
+		refs     []uint
+		temporal bool
+		err      string
+	}{
+		{source: "1 + 2"},
+		{source: "[12] - [13]", refs: []uint{12, 13}},
+		{source: "[12] + [12] * [3]", refs: []uint{12, 3}},
+		{source: "[20] && ![21]", refs: []uint{20, 21}},
+		{source: "[1] and not [2] or [3]", refs: []uint{1, 2, 3}},
+		{source: "if([5] > 0, integral([5], 86400), 0)", refs: []uint{5}, temporal: true},
+		{source: "hour() >= 8", temporal: true},
+		{source: "1.5e-3 * [ 7 ]", refs: []uint{7}},
+		{source: "MAX(1, 2, 3)"},
+
+		{source: "", err: "expressão incompleta"},
+		{source: "1 +", err: "expressão incompleta"},
+		{source: "(1 + 2", err: "esperado ')'"},
+		{source: "1 2", err: "símbolo inesperado"},
+		{source: "[0]", err: "referência de tag inválida"},
+		{source: "[abc]", err: "referência de tag inválida"},
+		{source: "[12", err: "sem ']'"},
+		{source: "foo(1)", err: "função desconhecida foo"},
+		{source: "abs(1, 2)", err: "número de argumentos inválido"},
+		{source: "if(1, 2)", err: "número de argumentos inválido"},
+		{source: "now", err: "esperado '('"},
+		{source: "1 $ 2", err: "carácter inesperado"},
+		{source: "1.2.3", err: "número inválido"},
+	}
+
+	for _, tt := range tests {
+		program, err := Compile(tt.source)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Compile(%q): erro = %v, esperado %q", tt.source, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Compile(%q): erro inesperado %v", tt.source, err)
+			continue
+		}
+		if !reflect.DeepEqual(program.Refs(), tt.refs) {
+			t.Errorf("Compile(%q): refs = %v, esperado %v", tt.source, program.Refs(), tt.refs)
+		}
+		if program.Temporal() != tt.temporal {
+			t.Errorf("Compile(%q): temporal = %v, esperado %v", tt.source, program.Temporal(), tt.temporal)
+		}
+		if program.Source() != tt.source {
+			t.Errorf("Compile(%q): source = %q", tt.source, program.Source())
+		}
+	}
+}
+
+func TestRewriteRefs(t *testing.T) {
+	mapping := map[uint]uint{1: 101, 2: 102, 12: 7}
+	lookup := func(id uint) (uint, bool) {
+		target, ok := mapping[id]
+		return target, ok
+	}
+
+	tests := []struct {
+		source string
+		want   string
+		err    string
+	}{
+		{source: "1 + 2", want: "1 + 2"},
+		{source: "[1]", want: "[101]"},
+		{source: "[1] - [2]", want: "[101] - [102]"},
+		{source: "if([12] > 0,[12],  [1])", want: "if([7] > 0,[7],  [101])"},
+		{source: "[ 2 ] * 2", want: "[102] * 2"},
+		{source: "ção([1])", want: "ção([101])"}, // Posições em runas, não em bytes
+		{source: "[1] + [3]", err: "tag [3] não encontrada"},
+		{source: "[1", err: "sem ']'"},
+	}
+
+	for _, tt := range tests {
+		got, err := RewriteRefs(tt.source, lookup)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("RewriteRefs(%q): erro = %v, esperado %q", tt.source, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("RewriteRefs(%q): erro inesperado %v", tt.source, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("RewriteRefs(%q) = %q, esperado %q", tt.source, got, tt.want)
+		}
+	}
+}
@@ -47,6 +47,14 @@ func (c *FaultController) GetAllFaultDefinitions(ctx *fiber.Ctx) error {
 	query := config.DB.Order("eclusa, subsistema, word_name, bit_offset")
 
 	// Aplicar filtros se fornecidos
+	assetIDs, err := assetFilterIDs(ctx)
+	if err != nil {
+		return assetError(ctx, "Erro ao obter subárvore do ativo", err)
+	}
+	if assetIDs != nil {
+		query = query.Where("ativo_id IN ?", assetIDs)
+	}
+
 	if eclusa := ctx.Query("eclusa"); eclusa != "" {
 		query = query.Where("eclusa = ?", eclusa)
 	}
@@ -125,6 +133,16 @@ func (c *FaultController) CreateFaultDefinition(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if definition.Endereco != "" {
+		if err := applyFaultAddress(&definition); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Endereço inválido",
+				"erro":     err.Error(),
+			})
+		}
+	}
+
 	// Validar dados
 	if definition.BitOffset < 0 || definition.BitOffset > 15 {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -143,6 +161,14 @@ func (c *FaultController) CreateFaultDefinition(ctx *fiber.Ctx) error {
 		})
 	}
 
+	// Ligar à hierarquia de ativos
+	if err := resolveFaultAsset(config.DB, &definition); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
 	// Verificar se já existe uma definição para este bit nesta word
 	var count int64
 	config.DB.Model(&FaultDefinition{}).
@@ -180,6 +206,7 @@ func (c *FaultController) CreateFaultDefinition(ctx *fiber.Ctx) error {
 		map[string]interface{}{
 			"id":         definition.ID,
 			"plc_id":     definition.PLCID,
+			"ativo_id":   definition.AtivoID,
 			"eclusa":     definition.Eclusa,
 			"subsistema": definition.Subsistema,
 			"word_name":  definition.WordName,
@@ -222,6 +249,12 @@ func (c *FaultController) UpdateFaultDefinition(ctx *fiber.Ctx) error {
 	oldDBNumber := definition.DBNumber
 	oldByteOffset := definition.ByteOffset
 	oldBitOffset := definition.BitOffset
+	oldAtivoID := copyPtr(definition.AtivoID) // Cópia: o BodyParser escreve sobre o valor apontado
+	oldEclusa := definition.Eclusa
+	oldSubsistema := definition.Subsistema
+
+	// O endereço só é reinterpretado se vier no pedido
+	definition.Endereco = ""
 
 	if err := ctx.BodyParser(&definition); err != nil {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -234,6 +267,16 @@ func (c *FaultController) UpdateFaultDefinition(ctx *fiber.Ctx) error {
 	// Garantir que o ID não mude
 	definition.ID = uint(id)
 
+	if definition.Endereco != "" {
+		if err := applyFaultAddress(&definition); err != nil {
+			return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"sucesso":  false,
+				"mensagem": "Endereço inválido",
+				"erro":     err.Error(),
+			})
+		}
+	}
+
 	// Validar dados
 	if definition.BitOffset < 0 || definition.BitOffset > 15 {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -252,6 +295,18 @@ func (c *FaultController) UpdateFaultDefinition(ctx *fiber.Ctx) error {
 		})
 	}
 
+	// Nomes de eclusa ou subsistema alterados sem ativo_id são procurados na hierarquia
+	if uintPtrEqual(definition.AtivoID, oldAtivoID) &&
+		(definition.Eclusa != oldEclusa || definition.Subsistema != oldSubsistema) {
+		definition.AtivoID = nil
+	}
+	if err := resolveFaultAsset(config.DB, &definition); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
 	// Se os detalhes da word/bit mudaram, verificar por conflito
 	if oldPLCID != definition.PLCID ||
 		oldDBNumber != definition.DBNumber ||
@@ -295,6 +350,7 @@ func (c *FaultController) UpdateFaultDefinition(ctx *fiber.Ctx) error {
 		map[string]interface{}{
 			"id":         definition.ID,
 			"plc_id":     definition.PLCID,
+			"ativo_id":   definition.AtivoID,
 			"eclusa":     definition.Eclusa,
 			"subsistema": definition.Subsistema,
 			"word_name":  definition.WordName,
@@ -356,6 +412,7 @@ func (c *FaultController) DeleteFaultDefinition(ctx *fiber.Ctx) error {
 		map[string]interface{}{
 			"id":         definition.ID,
 			"plc_id":     definition.PLCID,
+			"ativo_id":   definition.AtivoID,
 			"eclusa":     definition.Eclusa,
 			"subsistema": definition.Subsistema,
 			"word_name":  definition.WordName,
@@ -371,8 +428,13 @@ func (c *FaultController) DeleteFaultDefinition(ctx *fiber.Ctx) error {
 	})
 }
 
-// GetActiveFaults retorna todas as falhas ativas no momento
+// GetActiveFaults retorna todas as falhas ativas no momento, opcionalmente de uma subárvore de ativos
 func (c *FaultController) GetActiveFaults(ctx *fiber.Ctx) error {
+	assetIDs, err := assetFilterIDs(ctx)
+	if err != nil {
+		return assetError(ctx, "Erro ao obter subárvore do ativo", err)
+	}
+
 	events, err := c.faultManager.GetActiveFaults()
 	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -382,6 +444,20 @@ func (c *FaultController) GetActiveFaults(ctx *fiber.Ctx) error {
 		})
 	}
 
+	if assetIDs != nil {
+		inTree := make(map[uint]bool, len(assetIDs))
+		for _, id := range assetIDs {
+			inTree[id] = true
+		}
+		filtered := []FaultEvent{}
+		for _, event := range events {
+			if event.AtivoID != nil && inTree[*event.AtivoID] {
+				filtered = append(filtered, event)
+			}
+		}
+		events = filtered
+	}
+
 	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
 		"sucesso": true,
 		"dados":   events,
@@ -431,6 +507,13 @@ func (c *FaultController) GetFaultHistory(ctx *fiber.Ctx) error {
 		Joins("JOIN fault_definitions ON fault_history.fault_id = fault_definitions.id")
 
 	// Aplicar filtros
+	assetIDs, err := assetFilterIDs(ctx)
+	if err != nil {
+		return assetError(ctx, "Erro ao obter subárvore do ativo", err)
+	}
+	if assetIDs != nil {
+		query = query.Where("fault_definitions.ativo_id IN ?", assetIDs)
+	}
 	if eclusa != "" {
 		query = query.Where("fault_definitions.eclusa = ?", eclusa)
 	}
@@ -450,7 +533,7 @@ func (c *FaultController) GetFaultHistory(ctx *fiber.Ctx) error {
 
 	// Consulta paginada
 	var history []FaultHistory
-	err := query.Order("fault_history.inicio_timestamp DESC").
+	err = query.Order("fault_history.inicio_timestamp DESC").
 		Limit(pageSize).
 		Offset(offset).
 		Find(&history).Error
@@ -527,19 +610,14 @@ func (c *FaultController) AcknowledgeFault(ctx *fiber.Ctx) error {
 	})
 }
 
-// GetEclusasList retorna a lista de eclusas disponíveis
+// GetEclusasList retorna os nomes das eclusas da hierarquia de ativos
 func (c *FaultController) GetEclusasList(ctx *fiber.Ctx) error {
-	var eclusas []string
-
-	result := config.DB.Model(&FaultDefinition{}).
-		Distinct().
-		Pluck("eclusa", &eclusas)
-
-	if result.Error != nil {
+	eclusas, err := assetNamesList(NivelEclusa, "")
+	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"sucesso":  false,
 			"mensagem": "Erro ao obter lista de eclusas",
-			"erro":     result.Error.Error(),
+			"erro":     err.Error(),
 		})
 	}
 
@@ -549,23 +627,14 @@ func (c *FaultController) GetEclusasList(ctx *fiber.Ctx) error {
 	})
 }
 
-// GetSubsistemasList retorna a lista de subsistemas disponíveis
+// GetSubsistemasList retorna os nomes dos subsistemas da hierarquia de ativos, opcionalmente de uma eclusa
 func (c *FaultController) GetSubsistemasList(ctx *fiber.Ctx) error {
-	var subsistemas []string
-	query := config.DB.Model(&FaultDefinition{}).Distinct()
-
-	// Filtrar por eclusa se fornecido
-	if eclusa := ctx.Query("eclusa"); eclusa != "" {
-		query = query.Where("eclusa = ?", eclusa)
-	}
-
-	result := query.Pluck("subsistema", &subsistemas)
-
-	if result.Error != nil {
+	subsistemas, err := assetNamesList(NivelSubsistema, ctx.Query("eclusa"))
+	if err != nil {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"sucesso":  false,
 			"mensagem": "Erro ao obter lista de subsistemas",
-			"erro":     result.Error.Error(),
+			"erro":     err.Error(),
 		})
 	}
 
@@ -601,6 +670,18 @@ func (c *FaultController) ImportFaultDefinitions(ctx *fiber.Ctx) error {
 	errors := []string{}
 
 	for _, def := range defs {
+		if def.Endereco != "" {
+			if err := applyFaultAddress(&def); err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %v", def.WordName, err))
+				continue
+			}
+		}
+
+		if err := resolveFaultAsset(tx, &def); err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %v", def.WordName, err))
+			continue
+		}
+
 		// Verificar se já existe uma definição para este bit nesta word
 		var count int64
 		tx.Model(&FaultDefinition{}).
@@ -197,9 +197,9 @@ func (fm *FaultManager) StopMonitoring(plcID uint) {
 
 // monitorDBWords monitora words em um DB específico
 func (fm *FaultManager) monitorDBWords(plc *PLC, dbNumber int, monitors []*WordMonitorInfo, stopChan chan struct{}) {
-	s7Client, ok := plc.Client.(*S7Client)
-	if !ok {
-		log.Printf("Erro: Cliente S7 não disponível para PLC %s (ID: %d)", plc.Nome, plc.ID)
+	client := plc.Client
+	if client == nil {
+		log.Printf("Erro: Driver não disponível para PLC %s (ID: %d)", plc.Nome, plc.ID)
 		return
 	}
 
@@ -214,7 +214,8 @@ func (fm *FaultManager) monitorDBWords(plc *PLC, dbNumber int, monitors []*WordM
 			log.Printf("Parando monitoramento do DB %d no PLC %s", dbNumber, plc.Nome)
 			return
 		case <-ticker.C:
-			if !plc.Conectado {
+			// Com o disjuntor aberto não insistir no PLC até o supervisor refazer a conexão
+			if !canRead(plc) {
 				continue
 			}
 
@@ -223,23 +224,23 @@ func (fm *FaultManager) monitorDBWords(plc *PLC, dbNumber int, monitors []*WordM
 			// Para cada monitor neste DB
 			for _, monitor := range monitors {
 				// Ler word do PLC
-				tmpTag := Tag{
-					DBNumber:   dbNumber,
-					ByteOffset: monitor.ByteOffset,
-					Tipo:       "Word",
-				}
+				tmpTag := faultWordTag(dbNumber, monitor.ByteOffset)
 
-				valueInterface, err := s7Client.ReadTag(&tmpTag)
+				valueInterface, err := client.ReadTag(&tmpTag)
+				reportRead(plc, client, err)
 				if err != nil {
-					log.Printf("Erro ao ler word DB%d.DBW%d no PLC %s: %v",
-						dbNumber, monitor.ByteOffset, plc.Nome, err)
+					log.Printf("Erro ao ler word %s no PLC %s: %v",
+						tagAddress(&tmpTag), plc.Nome, err)
+					if !canRead(plc) {
+						break // Conexão perdida ou disjuntor aberto - não ler as restantes words
+					}
 					continue // Falha na leitura - tentar próxima vez
 				}
 
 				newValue, ok := valueInterface.(uint16)
 				if !ok {
-					log.Printf("Tipo inválido retornado para DB%d.DBW%d no PLC %s",
-						dbNumber, monitor.ByteOffset, plc.Nome)
+					log.Printf("Tipo inválido retornado para %s no PLC %s",
+						tagAddress(&tmpTag), plc.Nome)
 					continue // Tipo inválido
 				}
 
@@ -272,6 +273,7 @@ func (fm *FaultManager) monitorDBWords(plc *PLC, dbNumber int, monitors []*WordM
 						// Enviado com sucesso
 					default:
 						// Canal cheio - log para diagnóstico
+						faultDroppedChanges.Inc()
 						log.Printf("AVISO: Canal de processamento cheio - descartando atualização para %s", key)
 					}
 				}
@@ -327,6 +329,7 @@ func (fm *FaultManager) processChangeBatch(changes []WordValueChange) {
 	if len(changes) == 0 {
 		return
 	}
+	faultBatchSize.Observe(float64(len(changes)))
 
 	// log.Printf("Processando lote de %d mudanças de words", len(changes))
 
@@ -501,6 +504,7 @@ func (fm *FaultManager) publishFaultEvent(def *FaultDefinition, isActive bool, t
 		"plc_nome":   plcNome,
 		"word_name":  def.WordName,
 		"bit_offset": def.BitOffset,
+		"ativo_id":   def.AtivoID,
 		"eclusa":     def.Eclusa,
 		"subsistema": def.Subsistema,
 		"descricao":  def.Descricao,
@@ -531,7 +535,7 @@ func (fm *FaultManager) GetActiveFaults() ([]FaultEvent, error) {
 	rows, err := config.DB.Raw(`
 		SELECT 
 			fd.id, fd.plc_id, p.nome as plc_nome, fd.word_name, fd.bit_offset, 
-			fd.eclusa, fd.subsistema, fd.descricao, fd.tipo, 
+			fd.ativo_id, fd.eclusa, fd.subsistema, fd.descricao, fd.tipo,
 			fs.ativo, fs.inicio_timestamp, fs.reconhecido
 		FROM 
 			fault_status fs
@@ -556,7 +560,7 @@ func (fm *FaultManager) GetActiveFaults() ([]FaultEvent, error) {
 
 		err := rows.Scan(
 			&event.ID, &event.PLCID, &event.PLCNome, &event.WordName, &event.BitOffset,
-			&event.Eclusa, &event.Subsistema, &event.Descricao, &event.Tipo,
+			&event.AtivoID, &event.Eclusa, &event.Subsistema, &event.Descricao, &event.Tipo,
 			&event.Ativo, &inicioTimestamp, &event.Reconhecido,
 		)
 
@@ -648,6 +652,7 @@ func (fm *FaultManager) AcknowledgeFault(faultID uint, userID uint, userName str
 			"plc_nome":        plc.Nome,
 			"word_name":       def.WordName,
 			"bit_offset":      def.BitOffset,
+			"ativo_id":        def.AtivoID,
 			"eclusa":          def.Eclusa,
 			"subsistema":      def.Subsistema,
 			"descricao":       def.Descricao,
@@ -2,6 +2,8 @@ package plc
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // FaultDefinition representa a definição de uma falha/evento monitorado
@@ -9,11 +11,13 @@ type FaultDefinition struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
 	PLCID      uint      `json:"plc_id" gorm:"not null;column:plc_id"`
 	WordName   string    `json:"word_name" gorm:"size:100;not null"`
+	Endereco   string    `json:"endereco" gorm:"-"` // Ex.: DB10.DBX4.3
 	DBNumber   int       `json:"db_number" gorm:"not null;column:db_number"`
 	ByteOffset int       `json:"byte_offset" gorm:"not null;column:byte_offset"`
 	BitOffset  int       `json:"bit_offset" gorm:"not null;check:bit_offset >= 0 AND bit_offset <= 15"`
-	Eclusa     string    `json:"eclusa" gorm:"size:50;not null"`
-	Subsistema string    `json:"subsistema" gorm:"size:50;not null"`
+	AtivoID    *uint     `json:"ativo_id" gorm:"index;column:ativo_id"` // Subsistema ou equipamento da hierarquia de ativos
+	Eclusa     string    `json:"eclusa" gorm:"size:50;not null"`        // Copiado do nó da hierarquia
+	Subsistema string    `json:"subsistema" gorm:"size:50;not null"`    // Copiado do nó da hierarquia
 	Descricao  string    `json:"descricao" gorm:"type:text;not null"`
 	Tipo       string    `json:"tipo" gorm:"size:20;not null"` // 'Alarme' ou 'Evento'
 	Ativo      bool      `json:"ativo" gorm:"not null;default:true"`
@@ -60,6 +64,18 @@ func (FaultDefinition) TableName() string {
 	return "fault_definitions"
 }
 
+// AfterFind preenche o endereço canónico do bit monitorado
+func (d *FaultDefinition) AfterFind(tx *gorm.DB) error {
+	d.Endereco = faultAddress(d).String()
+	return nil
+}
+
+// AfterSave preenche o endereço canónico do bit monitorado
+func (d *FaultDefinition) AfterSave(tx *gorm.DB) error {
+	d.Endereco = faultAddress(d).String()
+	return nil
+}
+
 // TableName define o nome da tabela para FaultStatus
 func (FaultStatus) TableName() string {
 	return "fault_status"
@@ -82,6 +98,7 @@ type FaultEvent struct {
 	PLCNome         string    `json:"plc_nome"`
 	WordName        string    `json:"word_name"`
 	BitOffset       int       `json:"bit_offset"`
+	AtivoID         *uint     `json:"ativo_id"`
 	Eclusa          string    `json:"eclusa"`
 	Subsistema      string    `json:"subsistema"`
 	Descricao       string    `json:"descricao"`
@@ -0,0 +1,268 @@
+package plc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/plc/dbsource"
+	"gorm.io/gorm"
+)
+
+// Ações da importação de uma fonte de DB sobre cada tag
+const (
+	ImportacaoCriar      = "criar"
+	ImportacaoAtualizar  = "atualizar"
+	ImportacaoInalterada = "inalterada"
+)
+
+// dbSourceTypes converte os tipos declarados na fonte (em minúsculas) nos tipos de tag suportados.
+// Os tipos sem sinal de 8 e 16 bits são lidos como Byte e Word, que têm a mesma representação.
+var dbSourceTypes = map[string]string{
+	"bool":          "Bool",
+	"byte":          "Byte",
+	"usint":         "Byte",
+	"char":          "Char",
+	"int":           "Int",
+	"word":          "Word",
+	"uint":          "Word",
+	"dint":          "DInt",
+	"dword":         "DWord",
+	"udint":         "UDInt",
+	"real":          "Real",
+	"lreal":         "LReal",
+	"time":          "Time",
+	"date":          "Date",
+	"time_of_day":   "TOD",
+	"tod":           "TOD",
+	"dtl":           "DTL",
+	"date_and_time": "DATE_AND_TIME",
+	"dt":            "DATE_AND_TIME",
+	"string":        "String",
+	"wstring":       "WString",
+	"s5time":        "S5Time",
+}
+
+// dbImportOptions são as opções de uma importação de fonte de DB
+type dbImportOptions struct {
+	Bloco          string  // Nome do DB, quando a fonte contém vários
+	DBNumber       int     // Número do DB; obrigatório se a fonte o identificar apenas pelo nome
+	Prefixo        *string // Prefixo do nome das tags; por omissão o nome do DB seguido de ponto
+	UpdateInterval int     // Intervalo de atualização das tags novas, em milissegundos
+	AtivoID        *uint   // Subsistema ou equipamento das tags importadas
+}
+
+// dbImportItem é uma tag resultante da importação
+type dbImportItem struct {
+	Nome      string  `json:"nome"`
+	Endereco  string  `json:"endereco"`
+	Tipo      string  `json:"tipo"`
+	Tamanho   int     `json:"tamanho"`
+	Descricao *string `json:"descricao,omitempty"`
+	Acao      string  `json:"acao"`
+	TagID     uint    `json:"tag_id,omitempty"`
+
+	tag *Tag // Configuração a gravar
+}
+
+// dbImportPlan é o resultado da análise de uma fonte de DB, mostrado antes de ser aplicado
+type dbImportPlan struct {
+	Bloco        string         `json:"bloco"`
+	DBNumber     int            `json:"db_number"`
+	TamanhoBytes int            `json:"tamanho_bytes"`
+	Tags         []dbImportItem `json:"tags"`
+	Avisos       []string       `json:"avisos"`
+	Criar        int            `json:"criar"`
+	Atualizar    int            `json:"atualizar"`
+	Inalteradas  int            `json:"inalteradas"`
+}
+
+// planDBImport interpreta a fonte e compara os membros do DB com as tags já configuradas no PLC.
+// As tags são associadas pelo nome; membros de tipos não suportados são ignorados com um aviso.
+func planDBImport(plc *PLC, source string, opts dbImportOptions) (*dbImportPlan, error) {
+	blocks, err := dbsource.Parse(source, Config.DBImportMaxTags)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := selectDBSourceBlock(blocks, opts.Bloco)
+	if err != nil {
+		return nil, err
+	}
+
+	dbNumber := block.Number
+	if opts.DBNumber > 0 {
+		dbNumber = opts.DBNumber
+	}
+	if dbNumber <= 0 {
+		return nil, fmt.Errorf("a fonte identifica o DB %s apenas pelo nome; indique db_number", block.Name)
+	}
+
+	prefixo := block.Name + "."
+	if opts.Prefixo != nil {
+		prefixo = *opts.Prefixo
+	}
+
+	// Ativo comum a todas as tags, resolvido uma vez
+	var asset Tag
+	if opts.AtivoID != nil {
+		asset.AtivoID = opts.AtivoID
+		if err := resolveTagAsset(config.DB, &asset); err != nil {
+			return nil, err
+		}
+	}
+
+	var existing []Tag
+	if err := config.DB.Where("plc_id = ?", plc.ID).Find(&existing).Error; err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Tag, len(existing))
+	for i := range existing {
+		byName[existing[i].Nome] = &existing[i]
+	}
+
+	plan := &dbImportPlan{
+		Bloco:        block.Name,
+		DBNumber:     dbNumber,
+		TamanhoBytes: block.Size,
+		Tags:         []dbImportItem{},
+		Avisos:       []string{},
+	}
+
+	for _, member := range block.Members {
+		nome := prefixo + member.Path
+
+		tipo, supported := dbSourceTypes[strings.ToLower(member.Type)]
+		if !supported {
+			plan.Avisos = append(plan.Avisos, fmt.Sprintf("%s: tipo %s não suportado, ignorado", nome, member.Type))
+			continue
+		}
+		if utf8.RuneCountInString(nome) > 100 {
+			plan.Avisos = append(plan.Avisos, fmt.Sprintf("%s: nome com mais de 100 caracteres, ignorado", nome))
+			continue
+		}
+
+		tag := &Tag{
+			PLCID:          plc.ID,
+			Nome:           nome,
+			Ativo:          true,
+			UpdateInterval: opts.UpdateInterval,
+			Gravavel:       true,
+			HistoricoModo:  HistoricoNenhum,
+			OrdemPalavras:  OrdemABCD,
+		}
+		if member.Comment != "" {
+			comment := member.Comment
+			tag.Descricao = &comment
+		}
+
+		acao := ImportacaoCriar
+		if old, exists := byName[nome]; exists {
+			if isVirtualTag(old) {
+				plan.Avisos = append(plan.Avisos, fmt.Sprintf("%s: já existe uma tag virtual com este nome, ignorado", nome))
+				continue
+			}
+
+			// Manter a restante configuração da tag (escala, histórico, política de escrita, ...)
+			updated := *old
+			if tag.Descricao == nil {
+				tag.Descricao = old.Descricao
+			}
+			updated.Descricao = tag.Descricao
+			tag = &updated
+
+			acao = ImportacaoAtualizar
+		}
+
+		tag.Area = AreaDB
+		tag.DBNumber = dbNumber
+		tag.ByteOffset = member.ByteOffset
+		tag.BitOffset = member.BitOffset
+		tag.Tipo = tipo
+		tag.Tamanho = 1
+		if tipo == "String" || tipo == "WString" {
+			tag.Tamanho = member.Length
+		}
+		if opts.AtivoID != nil {
+			tag.AtivoID = asset.AtivoID
+			tag.Subsistema = asset.Subsistema
+		}
+
+		if old, exists := byName[nome]; exists && sameTagAddress(old, tag) &&
+			stringPtrEqual(old.Descricao, tag.Descricao) && uintPtrEqual(old.AtivoID, tag.AtivoID) {
+			acao = ImportacaoInalterada
+		}
+
+		if err := validateTagConfig(config.DB, tag, plc); err != nil {
+			plan.Avisos = append(plan.Avisos, fmt.Sprintf("%s: %v, ignorado", nome, err))
+			continue
+		}
+
+		switch acao {
+		case ImportacaoCriar:
+			plan.Criar++
+		case ImportacaoAtualizar:
+			plan.Atualizar++
+		default:
+			plan.Inalteradas++
+		}
+
+		plan.Tags = append(plan.Tags, dbImportItem{
+			Nome:      tag.Nome,
+			Endereco:  tagEndereco(tag),
+			Tipo:      tag.Tipo,
+			Tamanho:   tag.Tamanho,
+			Descricao: tag.Descricao,
+			Acao:      acao,
+			TagID:     tag.ID,
+			tag:       tag,
+		})
+	}
+
+	return plan, nil
+}
+
+// selectDBSourceBlock escolhe o DB a importar entre os da fonte
+func selectDBSourceBlock(blocks []*dbsource.Block, name string) (*dbsource.Block, error) {
+	if name != "" {
+		for _, block := range blocks {
+			if strings.EqualFold(block.Name, name) {
+				return block, nil
+			}
+		}
+		return nil, fmt.Errorf("a fonte não contém o DB %s", name)
+	}
+
+	if len(blocks) == 1 {
+		return blocks[0], nil
+	}
+
+	names := make([]string, len(blocks))
+	for i, block := range blocks {
+		names[i] = block.Name
+	}
+	return nil, fmt.Errorf("a fonte contém %d DBs (%s); indique o bloco a importar", len(blocks), strings.Join(names, ", "))
+}
+
+// applyDBImport grava as tags novas e alteradas do plano numa única transação
+func applyDBImport(plan *dbImportPlan) error {
+	return config.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range plan.Tags {
+			item := &plan.Tags[i]
+
+			switch item.Acao {
+			case ImportacaoCriar:
+				if err := tx.Create(item.tag).Error; err != nil {
+					return fmt.Errorf("%s: %v", item.Nome, err)
+				}
+				item.TagID = item.tag.ID
+			case ImportacaoAtualizar:
+				if err := tx.Save(item.tag).Error; err != nil {
+					return fmt.Errorf("%s: %v", item.Nome, err)
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,378 @@
+package plc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+)
+
+// Modos de registo histórico de uma tag
+const (
+	HistoricoNenhum    = "nenhum"    // Sem histórico
+	HistoricoTodas     = "todas"     // Cada leitura bem-sucedida
+	HistoricoMudanca   = "mudanca"   // Apenas quando o valor muda além da banda morta
+	HistoricoPeriodico = "periodico" // Uma amostra a cada historico_intervalo_s
+)
+
+// ModosHistoricoSuportados lista os valores aceites no campo HistoricoModo da tag
+var ModosHistoricoSuportados = []string{HistoricoNenhum, HistoricoTodas, HistoricoMudanca, HistoricoPeriodico}
+
+// TagSample é uma amostra histórica de uma tag.
+// A tabela é particionada por mês e criada em RunMigrations, não pelo AutoMigrate.
+type TagSample struct {
+	TagID      uint      `json:"tag_id" gorm:"column:tag_id"`
+	PLCID      uint      `json:"plc_id" gorm:"column:plc_id"`
+	Timestamp  time.Time `json:"timestamp" gorm:"column:timestamp"`
+	ValorNum   *float64  `json:"valor_num,omitempty" gorm:"column:valor_num"`
+	ValorTexto *string   `json:"valor_texto,omitempty" gorm:"column:valor_texto"`
+	Qualidade  string    `json:"qualidade" gorm:"column:qualidade"`
+}
+
+// TableName define o nome da tabela para TagSample
+func (TagSample) TableName() string {
+	return "tag_historico"
+}
+
+// Historian armazena amostras de tags em lotes, sem bloquear a leitura dos PLCs
+type Historian struct {
+	samples    chan TagSample
+	stopChan   chan struct{}
+	wg         sync.WaitGroup
+	partitions map[string]bool // Partições mensais já garantidas
+	dropped    atomic.Int64    // Amostras descartadas por buffer cheio
+}
+
+// NewHistorian cria um historian com o buffer configurado
+func NewHistorian() *Historian {
+	return &Historian{
+		samples:    make(chan TagSample, Config.HistorianBufferSize),
+		stopChan:   make(chan struct{}),
+		partitions: make(map[string]bool),
+	}
+}
+
+// Start inicia as goroutines de escrita em lote e de retenção
+func (h *Historian) Start() {
+	now := time.Now().UTC()
+	for _, month := range []time.Time{now, now.AddDate(0, 1, 0)} {
+		if err := h.ensurePartition(month); err != nil {
+			log.Printf("Aviso: falha ao criar partição do histórico: %v", err)
+		}
+	}
+
+	h.wg.Add(2)
+	go h.runWriter()
+	go h.runRetention()
+}
+
+// Stop grava as amostras pendentes e para o historian
+func (h *Historian) Stop() {
+	close(h.stopChan)
+	h.wg.Wait()
+}
+
+// Record enfileira uma amostra. Se o buffer estiver cheio a amostra é descartada,
+// para que a leitura dos PLCs nunca fique à espera do banco de dados.
+func (h *Historian) Record(sample TagSample) {
+	select {
+	case h.samples <- sample:
+	default:
+		if dropped := h.dropped.Add(1); dropped%1000 == 1 {
+			log.Printf("Aviso: buffer do histórico cheio, %d amostras descartadas", dropped)
+		}
+	}
+}
+
+// validateTagHistorian verifica o modo, o intervalo e a retenção do histórico da tag
+func validateTagHistorian(tag *Tag) error {
+	switch tag.HistoricoModo {
+	case "", HistoricoNenhum, HistoricoTodas, HistoricoMudanca:
+	case HistoricoPeriodico:
+		if tag.HistoricoIntervaloS <= 0 {
+			return fmt.Errorf("histórico periódico requer historico_intervalo_s maior que zero")
+		}
+	default:
+		return fmt.Errorf("historico_modo inválido: %s (válidos: %v)", tag.HistoricoModo, ModosHistoricoSuportados)
+	}
+	if tag.HistoricoIntervaloS < 0 {
+		return fmt.Errorf("historico_intervalo_s não pode ser negativo")
+	}
+	if tag.HistoricoRetencaoDias < 0 {
+		return fmt.Errorf("historico_retencao_dias não pode ser negativo")
+	}
+	return nil
+}
+
+// newTagSample converte o valor de uma tag numa amostra histórica
+func newTagSample(plc *PLC, tag *Tag, value interface{}, qualidade string, timestamp time.Time) TagSample {
+	sample := TagSample{
+		TagID:     tag.ID,
+		PLCID:     plc.ID,
+		Timestamp: timestamp,
+		Qualidade: qualidade,
+	}
+
+	switch v := value.(type) {
+	case nil:
+	case bool:
+		f := 0.0
+		if v {
+			f = 1
+		}
+		sample.ValorNum = &f
+	case string:
+		sample.ValorTexto = &v
+	default:
+		if f, err := toFloat64(v); err == nil {
+			sample.ValorNum = &f
+		} else {
+			text := fmt.Sprintf("%v", v)
+			sample.ValorTexto = &text
+		}
+	}
+
+	return sample
+}
+
+// shouldRecord decide, pelo modo de histórico da tag, se o valor lido deve ser registado
+func shouldRecord(tag *Tag, value interface{}, now time.Time) bool {
+	switch tag.HistoricoModo {
+	case HistoricoTodas:
+		return true
+	case HistoricoMudanca:
+		return tag.HistoricoUltimoTempo.IsZero() || valueExceedsDeadband(tag, tag.HistoricoUltimoValor, value)
+	case HistoricoPeriodico:
+		interval := time.Duration(tag.HistoricoIntervaloS) * time.Second
+		return now.Sub(tag.HistoricoUltimoTempo) >= interval
+	}
+	return false
+}
+
+// recordTagValue regista um valor lido de acordo com o modo de histórico da tag
+func (m *Manager) recordTagValue(plc *PLC, tag *Tag, value interface{}, now time.Time) {
+	if m.historian == nil || !shouldRecord(tag, value, now) {
+		return
+	}
+
+	tag.HistoricoUltimoValor = value
+	tag.HistoricoUltimoTempo = now
+	m.historian.Record(newTagSample(plc, tag, value, QualidadeBoa, now))
+}
+
+// recordTagQuality regista a perda de qualidade de uma tag com histórico, sem valor
+func (m *Manager) recordTagQuality(plc *PLC, tag *Tag, qualidade string) {
+	if m.historian == nil || tag.HistoricoModo == "" || tag.HistoricoModo == HistoricoNenhum {
+		return
+	}
+	// A próxima leitura boa é sempre registada, marcando o fim da falha
+	tag.HistoricoUltimoValor = nil
+	tag.HistoricoUltimoTempo = time.Time{}
+	m.historian.Record(newTagSample(plc, tag, nil, qualidade, time.Now()))
+}
+
+// runWriter grava as amostras em lotes, por tamanho ou por tempo
+func (h *Historian) runWriter() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(Config.HistorianFlushPeriod)
+	defer ticker.Stop()
+
+	batch := make([]TagSample, 0, Config.HistorianBatchSize)
+
+	for {
+		select {
+		case sample := <-h.samples:
+			batch = append(batch, sample)
+			if len(batch) >= Config.HistorianBatchSize {
+				h.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				h.flush(batch)
+				batch = batch[:0]
+			}
+		case <-h.stopChan:
+			// Esvaziar o buffer antes de terminar
+			for {
+				select {
+				case sample := <-h.samples:
+					batch = append(batch, sample)
+				default:
+					if len(batch) > 0 {
+						h.flush(batch)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush insere um lote, garantindo antes as partições dos meses envolvidos
+func (h *Historian) flush(batch []TagSample) {
+	for _, sample := range batch {
+		if err := h.ensurePartition(sample.Timestamp); err != nil {
+			log.Printf("Erro ao criar partição do histórico: %v", err)
+			return
+		}
+	}
+
+	if err := config.DB.CreateInBatches(batch, Config.HistorianBatchSize).Error; err != nil {
+		log.Printf("Erro ao gravar %d amostras no histórico: %v", len(batch), err)
+	}
+}
+
+// partitionName retorna o nome da partição mensal que contém o instante
+func partitionName(t time.Time) string {
+	return fmt.Sprintf("tag_historico_%s", t.UTC().Format("200601"))
+}
+
+// ensurePartition cria, se necessário, a partição mensal que contém o instante
+func (h *Historian) ensurePartition(t time.Time) error {
+	name := partitionName(t)
+	if h.partitions[name] {
+		return nil
+	}
+
+	start := time.Date(t.UTC().Year(), t.UTC().Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	err := config.DB.Exec(fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF tag_historico FOR VALUES FROM ('%s') TO ('%s')`,
+		name, start.Format(time.RFC3339), end.Format(time.RFC3339),
+	)).Error
+	if err != nil {
+		return err
+	}
+
+	h.partitions[name] = true
+	return nil
+}
+
+// runRetention aplica periodicamente a retenção configurada em cada tag
+func (h *Historian) runRetention() {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(Config.HistorianRetentionPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.stopChan:
+			return
+		case <-ticker.C:
+			if err := applyRetention(time.Now()); err != nil {
+				log.Printf("Erro ao aplicar retenção do histórico: %v", err)
+			}
+		}
+	}
+}
+
+// tagRetentionDays retorna a retenção efetiva de uma tag em dias
+func tagRetentionDays(tag *Tag) int {
+	if tag.HistoricoRetencaoDias > 0 {
+		return tag.HistoricoRetencaoDias
+	}
+	return Config.HistorianDefaultRetentionDays
+}
+
+// applyRetention apaga amostras mais antigas que a retenção de cada tag e remove
+// as partições mensais que já não contêm amostras dentro de nenhuma retenção
+func applyRetention(now time.Time) error {
+	var tags []Tag
+	if err := config.DB.Select("id", "historico_retencao_dias").Find(&tags).Error; err != nil {
+		return err
+	}
+
+	// Agrupar tags por retenção para apagar com uma consulta por grupo
+	byRetention := make(map[int][]uint)
+	maxRetention := Config.HistorianDefaultRetentionDays
+	for i := range tags {
+		days := tagRetentionDays(&tags[i])
+		byRetention[days] = append(byRetention[days], tags[i].ID)
+		if days > maxRetention {
+			maxRetention = days
+		}
+	}
+
+	for days, ids := range byRetention {
+		limit := now.AddDate(0, 0, -days)
+		result := config.DB.Exec(`DELETE FROM tag_historico WHERE tag_id IN ? AND timestamp < ?`, ids, limit)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Histórico: %d amostras com mais de %d dias removidas", result.RowsAffected, days)
+		}
+	}
+
+	// Amostras de tags apagadas ficam com a retenção padrão
+	limit := now.AddDate(0, 0, -Config.HistorianDefaultRetentionDays)
+	if err := config.DB.Exec(`DELETE FROM tag_historico WHERE tag_id NOT IN (SELECT id FROM tags) AND timestamp < ?`, limit).Error; err != nil {
+		return err
+	}
+
+	return dropExpiredPartitions(now.AddDate(0, 0, -maxRetention))
+}
+
+// dropExpiredPartitions remove as partições mensais que terminam antes do limite
+func dropExpiredPartitions(limit time.Time) error {
+	var names []string
+	err := config.DB.Raw(`
+		SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		JOIN pg_class p ON p.oid = i.inhparent
+		WHERE p.relname = 'tag_historico'`).Scan(&names).Error
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		month, ok := partitionMonth(name)
+		if !ok {
+			continue // Partição padrão ou criada fora do historiador
+		}
+		if month.AddDate(0, 1, 0).Before(limit) {
+			if err := config.DB.Exec(fmt.Sprintf(`DROP TABLE IF EXISTS %s`, name)).Error; err != nil {
+				return err
+			}
+			log.Printf("Histórico: partição %s removida", name)
+		}
+	}
+
+	return nil
+}
+
+// partitionMonth extrai o mês do nome de uma partição mensal (tag_historico_AAAAMM)
+func partitionMonth(name string) (time.Time, bool) {
+	const prefix = "tag_historico_"
+	if !strings.HasPrefix(name, prefix) {
+		return time.Time{}, false
+	}
+	month, err := time.Parse("200601", name[len(prefix):])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// createHistorianTable cria a tabela particionada do histórico
+func createHistorianTable() error {
+	return config.DB.Exec(`
+		CREATE TABLE IF NOT EXISTS tag_historico (
+			tag_id      integer NOT NULL,
+			plc_id      integer NOT NULL,
+			timestamp   timestamptz NOT NULL,
+			valor_num   double precision,
+			valor_texto text,
+			qualidade   varchar(20) NOT NULL
+		) PARTITION BY RANGE (timestamp);
+		CREATE INDEX IF NOT EXISTS idx_tag_historico_tag_timestamp ON tag_historico (tag_id, timestamp);
+	`).Error
+}
@@ -0,0 +1,29 @@
+package plc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPartitionMonth(t *testing.T) {
+	tests := []struct {
+		name  string
+		month time.Time
+		ok    bool
+	}{
+		{name: "tag_historico_202403", month: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), ok: true},
+		{name: "tag_historico_default"},
+		{name: "tag_historico_2024"},
+		{name: "tag_historico_"},
+		{name: "tag_hist"},
+		{name: ""},
+		{name: "outra_tabela_202403"},
+	}
+
+	for _, tt := range tests {
+		month, ok := partitionMonth(tt.name)
+		if ok != tt.ok || !month.Equal(tt.month) {
+			t.Errorf("partitionMonth(%q) = %v, %v; esperado %v, %v", tt.name, month, ok, tt.month, tt.ok)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package plc
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -18,17 +17,24 @@ import (
 type Manager struct {
 	plcs         map[uint]*PLC
 	redisClient  *RedisClient
-	natsClient   *NatsClient   // Cliente NATS para comunicação em tempo real
-	faultManager *FaultManager // Novo: Gerenciador de falhas
+	natsClient   *NatsClient    // Cliente NATS para comunicação em tempo real
+	faultManager *FaultManager  // Novo: Gerenciador de falhas
+	historian    *Historian     // Armazenamento das amostras das tags
+	stats        *statsRegistry // Estatísticas de comunicação por PLC e por tag
+	virtual      *virtualEngine // Expressões das tags virtuais
 	stopChan     chan struct{}
 	wg           sync.WaitGroup
 	mutex        sync.RWMutex
+
+	statsPersistMutex sync.Mutex
 }
 
 // NewManager cria um novo gerenciador PLC
 func NewManager() *Manager {
 	return &Manager{
 		plcs:     make(map[uint]*PLC),
+		stats:    newStatsRegistry(),
+		virtual:  newVirtualEngine(),
 		stopChan: make(chan struct{}),
 	}
 }
@@ -60,6 +66,10 @@ func (m *Manager) Initialize(app *fiber.App) error {
 		log.Printf("Aviso: Falha ao inicializar gerenciador de falhas: %v", err)
 	}
 
+	// Iniciar o histórico antes das leituras
+	m.historian = NewHistorian()
+	m.historian.Start()
+
 	// Carregar PLCs do banco de dados
 	err := m.loadPLCs()
 	if err != nil {
@@ -69,6 +79,23 @@ func (m *Manager) Initialize(app *fiber.App) error {
 	// Iniciar conexões e coleta de dados
 	m.startAll()
 
+	// Compilar as expressões das tags virtuais e reavaliar periodicamente as que dependem do tempo
+	m.rebuildVirtualTags()
+	m.wg.Add(1)
+	go m.monitorVirtualTags()
+
+	// Verificar periodicamente valores antigos
+	m.wg.Add(1)
+	go m.monitorStaleTags()
+
+	// Verificar periodicamente o estado RUN/STOP das CPUs
+	m.wg.Add(1)
+	go m.monitorCPUState()
+
+	// Gravar periodicamente a disponibilidade diária dos PLCs
+	m.wg.Add(1)
+	go m.runStatsPersistence()
+
 	return nil
 }
 
@@ -79,45 +106,25 @@ func (m *Manager) GetFaultManager() *FaultManager {
 
 // loadPLCs consulta o banco de dados para PLCs e suas tags
 func (m *Manager) loadPLCs() error {
-	// Consultar PLCs
-	rows, err := config.DB.Raw("SELECT id, nome, ip_address, rack, slot, gateway, ativo FROM plcs").Rows()
-	if err != nil {
-		return err
+	// Consultar apenas PLCs ativos, com todos os parâmetros de conexão
+	var plcs []PLC
+	result := config.DB.Where("ativo = ?", true).Find(&plcs)
+	if result.Error != nil {
+		return result.Error
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var plc PLC
-		var gateway sql.NullString // Usar sql.NullString para colunas que podem ser NULL
 
-		// Escanear para variáveis, usando gateway como NullString
-		err := rows.Scan(&plc.ID, &plc.Nome, &plc.IPAddress, &plc.Rack, &plc.Slot, &gateway, &plc.Ativo)
-		if err != nil {
-			return err
-		}
-
-		// Converter o valor NULL ou string para a estrutura
-		if gateway.Valid {
-			gatewayStr := gateway.String
-			plc.Gateway = &gatewayStr
-		} else {
-			plc.Gateway = nil
-		}
-
-		// Apenas considerar PLCs ativos
-		if !plc.Ativo {
-			continue
-		}
+	for i := range plcs {
+		plc := &plcs[i]
 
 		// Carregar tags para este PLC
-		err = m.loadTags(&plc)
+		err := m.loadTags(plc)
 		if err != nil {
 			log.Printf("Falha ao carregar tags para PLC %d: %v", plc.ID, err)
 			continue
 		}
 
 		m.mutex.Lock()
-		m.plcs[plc.ID] = &plc
+		m.plcs[plc.ID] = plc
 		m.mutex.Unlock()
 	}
 
@@ -127,65 +134,14 @@ func (m *Manager) loadPLCs() error {
 
 // loadTags consulta o banco de dados para tags associadas a um PLC
 func (m *Manager) loadTags(plc *PLC) error {
-	rows, err := config.DB.Raw(`
-		SELECT id, plc_id, nome, db_number, byte_offset, bit_offset, 
-		       tipo, tamanho, subsistema, descricao, ativo, 
-		       update_interval_ms, only_on_change 
-		FROM tags 
-		WHERE plc_id = ? AND ativo = true
-	`, plc.ID).Rows()
-
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
 	var tags []Tag
 
-	for rows.Next() {
-		var tag Tag
-		var subsistema sql.NullString
-		var descricao sql.NullString
-		var bitOffset sql.NullInt32
-
-		err := rows.Scan(
-			&tag.ID, &tag.PLCID, &tag.Nome, &tag.DBNumber,
-			&tag.ByteOffset, &bitOffset, &tag.Tipo,
-			&tag.Tamanho, &subsistema, &descricao,
-			&tag.Ativo, &tag.UpdateInterval, &tag.OnlyOnChange,
-		)
-		if err != nil {
-			return err
-		}
-
-		// Converter bitOffset de NullInt32 para ponteiro *int
-		if bitOffset.Valid {
-			bitOffsetValue := int(bitOffset.Int32)
-			tag.BitOffset = &bitOffsetValue
-		} else {
-			tag.BitOffset = nil
-		}
-
-		// Converter o valor NULL ou string para a estrutura
-		if subsistema.Valid {
-			subsistemaStr := subsistema.String
-			tag.Subsistema = &subsistemaStr
-		} else {
-			tag.Subsistema = nil
-		}
-
-		// Converter o valor NULL ou string para a estrutura
-		if descricao.Valid {
-			descricaoStr := descricao.String
-			tag.Descricao = &descricaoStr
-		} else {
-			tag.Descricao = nil
-		}
-
-		tags = append(tags, tag)
+	result := config.DB.Where("plc_id = ? AND ativo = true", plc.ID).Find(&tags)
+	if result.Error != nil {
+		return result.Error
 	}
 
-	plc.Tags = tags
+	plc.setTags(tags)
 	log.Printf("Carregadas %d tags para PLC %s (ID: %d)", len(tags), plc.Nome, plc.ID)
 
 	return nil
@@ -197,199 +153,211 @@ func (m *Manager) startAll() {
 	defer m.mutex.RUnlock()
 
 	for _, plc := range m.plcs {
-		m.wg.Add(1)
-		go m.startPLC(plc)
+		m.launchPLC(plc)
 	}
 }
 
+// launchPLC cria os canais de ciclo de vida do PLC e arranca a sua goroutine de conexão
+func (m *Manager) launchPLC(plc *PLC) {
+	plc.stop = make(chan struct{})
+	plc.done = make(chan struct{})
+
+	m.wg.Add(1)
+	go m.startPLC(plc)
+}
+
 // startPLC inicializa uma conexão com um PLC e inicia coleta de dados
 func (m *Manager) startPLC(plc *PLC) {
 	defer m.wg.Done()
+	defer close(plc.done)
 
-	client, err := NewS7Client(plc)
+	client, err := NewDriver(plc)
 	if err != nil {
-		log.Printf("Falha ao criar cliente S7 para PLC %s: %v", plc.Nome, err)
+		log.Printf("Falha ao criar driver para PLC %s: %v", plc.Nome, err)
 		plc.UltimoErro = err.Error()
 		return
 	}
 
 	plc.Client = client
 
+	// Contabilizar o tempo conectado e desconectado enquanto o PLC é gerido
+	stats := m.stats.get(plc.ID)
+	stats.start()
+	defer stats.stop()
+
 	// Criar um stopChan para este PLC
 	plcStopChan := make(chan struct{})
 
 	// Criar um WaitGroup para as goroutines específicas deste PLC
 	var plcWg sync.WaitGroup
 
-	// Escutar pelo sinal global de parada
+	// Escutar pelo sinal global de parada e pela remoção do PLC
 	plcWg.Add(1)
 	go func() {
 		defer plcWg.Done()
 		select {
 		case <-m.stopChan:
-			close(plcStopChan)
+		case <-plc.stop:
 		}
+		close(plcStopChan)
 	}()
 
+	// O supervisor decide a espera entre tentativas e quando a conexão deve ser refeita
+	sup := newConnSupervisor()
+	plc.supervisor = sup
+
+	shutdown := func() {
+		client.Disconnect()
+
+		// Esperar todas as goroutines do PLC terminarem
+		plcWg.Wait()
+
+		// Parar monitoramento de falhas
+		if m.faultManager != nil {
+			m.faultManager.StopMonitoring(plc.ID)
+		}
+	}
+
 	// Loop de tentativa de conexão
 	for {
 		select {
 		case <-plcStopChan:
-			client.Disconnect()
-
-			// Esperar todas as goroutines do PLC terminarem
-			plcWg.Wait()
-
-			// Parar monitoramento de falhas
-			if m.faultManager != nil {
-				m.faultManager.StopMonitoring(plc.ID)
-			}
-
+			shutdown()
 			return
 		default:
-			err := client.Connect()
-			if err != nil {
-				log.Printf("Falha ao conectar com PLC %s: %v. Tentando novamente em %v...",
-					plc.Nome, err, Config.ConnectionRetryDelay)
-				plc.Conectado = false
-				plc.UltimoErro = err.Error()
-
-				// Publicar status de conexão
-				m.publishPLCStatus(plc)
-
-				// Esperar antes de tentar novamente
-				time.Sleep(Config.ConnectionRetryDelay)
-				continue
-			}
+		}
 
-			plc.Conectado = true
-			plc.UltimoErro = ""
-			log.Printf("Conectado ao PLC %s em %s", plc.Nome, plc.IPAddress)
+		err := client.Connect()
+		if err != nil {
+			plc.Conectado = false
+			plc.UltimoErro = err.Error()
+			stats.disconnected()
+
+			sup.connectFailed(err)
+			delay := sup.nextDelay()
+			log.Printf("Falha ao conectar com PLC %s: %v. Tentando novamente em %v...",
+				plc.Nome, err, delay.Round(time.Millisecond))
 
 			// Publicar status de conexão
-			m.publishPLCStatus(plc)
+			m.updateConnectionState(plc, sup)
+			m.setPLCTagsQuality(plc, QualidadeFalhaComunicacao)
 
-			// Iniciar leitores de tag
-			tagStopChans := make([]chan struct{}, len(plc.Tags))
+			// Esperar antes de tentar novamente
+			if !waitOrStop(plcStopChan, delay) {
+				shutdown()
+				return
+			}
+			continue
+		}
 
-			for i := range plc.Tags {
-				tagStopChans[i] = make(chan struct{})
-				m.wg.Add(1)
-				plcWg.Add(1)
+		plc.Conectado = true
+		plc.UltimoErro = ""
+		stats.connected()
+		sup.connected()
+		log.Printf("Conectado ao PLC %s em %s", plc.Nome, plc.IPAddress)
 
-				// Capturar as variáveis no loop para evitar problemas de closure
-				tagIndex := i
-				tagChan := tagStopChans[i]
+		// Publicar status de conexão
+		m.updateConnectionState(plc, sup)
 
-				go func() {
-					defer plcWg.Done()
-					m.readTag(plc, &plc.Tags[tagIndex], tagChan)
-				}()
-			}
+		// Iniciar leitores de tag agrupados em blocos
+		m.startTagReaders(plc, client)
 
-			// Iniciar monitoramento de falhas
-			if m.faultManager != nil {
-				m.faultManager.StartMonitoring(plc)
-			}
+		// Iniciar monitoramento de falhas
+		if m.faultManager != nil {
+			m.faultManager.StartMonitoring(plc)
+		}
 
-			// Monitorar conexão
-			disconnected := false
-
-			for !disconnected {
-				select {
-				case <-plcStopChan:
-					// Fechar todos os canais de parada de tag
-					for _, ch := range tagStopChans {
-						close(ch)
-					}
-
-					client.Disconnect()
-
-					// Parar monitoramento de falhas
-					if m.faultManager != nil {
-						m.faultManager.StopMonitoring(plc.ID)
-					}
-
-					return
-
-				case <-time.After(Config.ConnectionCheckPeriod):
-					// Verificação periódica de conexão
-					if !client.IsConnected() {
-						log.Printf("Perdeu conexão com PLC %s. Reconectando...", plc.Nome)
-						plc.Conectado = false
-						disconnected = true
-
-						// Fechar todos os canais de parada de tag
-						for _, ch := range tagStopChans {
-							close(ch)
-						}
-
-						// Parar monitoramento de falhas
-						if m.faultManager != nil {
-							m.faultManager.StopMonitoring(plc.ID)
-						}
-
-						// Publicar status de conexão
-						m.publishPLCStatus(plc)
-					}
+		// Monitorar conexão: falhas de leitura sinalizam a quebra de imediato,
+		// a verificação periódica cobre os períodos sem leituras
+		checkTicker := time.NewTicker(Config.ConnectionCheckPeriod)
+		lost := false
+
+		for !lost {
+			select {
+			case <-plcStopChan:
+				checkTicker.Stop()
+				// Parar os leitores de tag
+				m.stopTagReaders(plc)
+				shutdown()
+				return
+
+			case <-sup.lost:
+				lost = true
+
+			case <-checkTicker.C:
+				if !client.IsConnected() {
+					sup.lose("conexão perdida")
+					lost = true
 				}
 			}
 		}
-	}
-}
+		checkTicker.Stop()
 
-// readTag lê periodicamente uma tag do PLC
-func (m *Manager) readTag(plc *PLC, tag *Tag, stopChan chan struct{}) {
-	defer m.wg.Done()
+		estado, motivo, _ := sup.state()
+		plc.Conectado = false
+		plc.UltimoErro = motivo
+		stats.disconnected()
 
-	interval := time.Duration(tag.UpdateInterval) * time.Millisecond
-	if interval < 10*time.Millisecond {
-		interval = Config.DefaultTagInterval // Usar valor padrão se intervalo for muito pequeno
-	}
+		// Parar os leitores de tag e o monitoramento de falhas antes de largar a conexão
+		m.stopTagReaders(plc)
+		if m.faultManager != nil {
+			m.faultManager.StopMonitoring(plc.ID)
+		}
+		client.Disconnect()
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+		delay := sup.nextDelay()
+		if estado == EstadoConexaoCircuitoAberto {
+			log.Printf("PLC %s: disjuntor aberto após %d leituras falhadas (%s). Reconectando em %v...",
+				plc.Nome, Config.CircuitBreakerThreshold, motivo, delay.Round(time.Millisecond))
+		} else {
+			log.Printf("Perdeu conexão com PLC %s (%s). Reconectando em %v...",
+				plc.Nome, motivo, delay.Round(time.Millisecond))
+		}
 
-	s7Client, ok := plc.Client.(*S7Client)
-	if !ok {
-		log.Printf("Erro: Cliente S7 inválido para PLC %s (ID: %d)", plc.Nome, plc.ID)
-		return
-	}
+		// Publicar status de conexão
+		m.updateConnectionState(plc, sup)
+		m.setPLCTagsQuality(plc, QualidadeFalhaComunicacao)
 
-	for {
-		select {
-		case <-stopChan:
+		if !waitOrStop(plcStopChan, delay) {
+			shutdown()
 			return
-		case <-ticker.C:
-			if !plc.Conectado {
-				continue
-			}
+		}
+	}
+}
 
-			value, err := s7Client.ReadTag(tag)
+// processTagValue aplica a escala ao valor bruto, atualiza o último valor da tag e publica-o quando necessário
+func (m *Manager) processTagValue(plc *PLC, tag *Tag, raw interface{}) {
+	value := scaleValue(tag, raw)
+	now := time.Now()
+	tag.UltimaLeituraBoa = now
 
-			tag.UltimaLeitura = time.Now()
+	// Verificar se o valor mudou além da banda morta
+	valueChanged := tagValueChanged(tag, value)
 
-			if err != nil {
-				tag.UltimoErro = err.Error()
-				tag.UltimoErroTime = time.Now()
-				log.Printf("\033[31m[ERRO] PLC %s - Tag %s: %v\033[0m\n", plc.Nome, tag.Nome, err)
-				continue
-			}
+	// Uma leitura boa depois de falhas ou de valor antigo é sempre publicada
+	qualityChanged := tag.Qualidade != QualidadeBoa
+	tag.Qualidade = QualidadeBoa
 
-			// Verificar se o valor mudou
-			valueChanged := tag.UltimoValor != value
+	// Registar no histórico conforme o modo da tag
+	m.recordTagValue(plc, tag, value, now)
 
-			// Publicar apenas se o valor mudou ou não estamos publicando apenas em mudanças
-			if !tag.OnlyOnChange || valueChanged {
-				tag.UltimoValor = value
+	// Publicar se o valor ou a qualidade mudaram, se não estamos publicando apenas em mudanças
+	// ou se a tag está em silêncio há mais tempo que o permitido
+	if !tag.OnlyOnChange || valueChanged || qualityChanged || tagSilenceExpired(tag, now) {
+		tag.UltimoValor = value
+		tag.UltimoValorBruto = raw
+		tag.UltimaPublicacao = now
 
-				// Log com cores para console
-				logTagValue(plc, tag, value)
+		// Log com cores para console
+		logTagValue(plc, tag, value)
 
-				// Publicação só depois de definir o valor para garantir consistência
-				m.publishTagValue(plc, tag, value)
-			}
-		}
+		// Publicação só depois de definir o valor para garantir consistência
+		m.publishTagValue(plc, tag, value)
+	}
+
+	// Recalcular as tags virtuais que usam esta tag
+	if valueChanged || qualityChanged {
+		m.evaluateDependents(tag.ID)
 	}
 }
 
@@ -411,7 +379,7 @@ func logTagValue(plc *PLC, tag *Tag, value interface{}) {
 		}
 	case float32, float64:
 		valueStr = fmt.Sprintf("\033[36m%.2f\033[0m", v) // Ciano para floats
-	case int, int16, int32, int64, uint, uint16, uint32, uint64:
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
 		valueStr = fmt.Sprintf("\033[33m%v\033[0m", v) // Amarelo para inteiros
 	case string:
 		valueStr = fmt.Sprintf("\033[35m\"%s\"\033[0m", v) // Roxo para strings
@@ -419,6 +387,10 @@ func logTagValue(plc *PLC, tag *Tag, value interface{}) {
 		valueStr = fmt.Sprintf("%v", v)
 	}
 
+	if tag.Unidade != nil {
+		valueStr += " " + *tag.Unidade
+	}
+
 	fmt.Printf("\033[1m[PLC]\033[0m \033[34m%s\033[0m - \033[36m%s%s\033[0m: %s\n",
 		plc.Nome, tagInfo, tag.Nome, valueStr)
 }
@@ -436,12 +408,13 @@ func (m *Manager) publishPLCStatus(plc *PLC) {
 	if m.redisClient != nil {
 		// Criar dados de status
 		status := map[string]interface{}{
-			"id":          plc.ID,
-			"nome":        plc.Nome,
-			"ip_address":  plc.IPAddress,
-			"conectado":   plc.Conectado,
-			"ultimo_erro": plc.UltimoErro,
-			"timestamp":   time.Now(),
+			"id":             plc.ID,
+			"nome":           plc.Nome,
+			"ip_address":     plc.IPAddress,
+			"conectado":      plc.Conectado,
+			"estado_conexao": plc.EstadoConexao,
+			"ultimo_erro":    plc.UltimoErro,
+			"timestamp":      time.Now(),
 		}
 
 		// Converter para JSON
@@ -465,12 +438,15 @@ func (m *Manager) publishTagValue(plc *PLC, tag *Tag, value interface{}) {
 	if m.redisClient != nil {
 		// Criar dados de valor
 		data := map[string]interface{}{
-			"plc_id":    plc.ID,
-			"plc_nome":  plc.Nome,
-			"tag_id":    tag.ID,
-			"tag_nome":  tag.Nome,
-			"valor":     value,
-			"timestamp": tag.UltimaLeitura,
+			"plc_id":      plc.ID,
+			"plc_nome":    plc.Nome,
+			"tag_id":      tag.ID,
+			"tag_nome":    tag.Nome,
+			"valor":       value,
+			"valor_bruto": tag.UltimoValorBruto,
+			"unidade":     tag.Unidade,
+			"qualidade":   tag.Qualidade,
+			"timestamp":   tag.UltimaLeitura,
 		}
 
 		// Converter para JSON
@@ -508,6 +484,11 @@ func (m *Manager) Stop() {
 	close(m.stopChan)
 	m.wg.Wait()
 
+	// Gravar as amostras pendentes do histórico
+	if m.historian != nil {
+		m.historian.Stop()
+	}
+
 	// Fechar conexão NATS
 	if m.natsClient != nil {
 		m.natsClient.Close()
@@ -547,8 +528,8 @@ func (m *Manager) AddPLC(plc *PLC) {
 	m.plcs[plc.ID] = plc
 	m.mutex.Unlock()
 
-	m.wg.Add(1)
-	go m.startPLC(plc)
+	m.launchPLC(plc)
+	m.rebuildVirtualTags()
 
 	log.Printf("PLC adicionado ao gerenciador: %s (ID: %d)", plc.Nome, plc.ID)
 }
@@ -563,15 +544,14 @@ func (m *Manager) RemovePLC(id uint) {
 	m.mutex.Unlock()
 
 	if exists {
-		// Se o cliente existir, desconectar
-		if s7Client, ok := plc.Client.(*S7Client); ok {
-			s7Client.Disconnect()
+		// Parar a goroutine de conexão, que desliga os leitores, o monitoramento de falhas e o driver
+		if plc.stop != nil {
+			close(plc.stop)
+			<-plc.done
 		}
 
-		// Parar monitoramento de falhas
-		if m.faultManager != nil {
-			m.faultManager.StopMonitoring(id)
-		}
+		m.stats.get(id).stop()
+		m.rebuildVirtualTags()
 
 		log.Printf("PLC removido do gerenciador: %s (ID: %d)", plc.Nome, plc.ID)
 	}
@@ -579,118 +559,115 @@ func (m *Manager) RemovePLC(id uint) {
 
 // RestartPLC reinicia a conexão com um PLC
 func (m *Manager) RestartPLC(plc *PLC) {
-	// Primeiro paramos o monitoramento de falhas
-	if m.faultManager != nil {
-		m.faultManager.StopMonitoring(plc.ID)
-	}
-
-	// Depois removemos e adicionamos o PLC novamente
 	m.RemovePLC(plc.ID)
 	m.AddPLC(plc)
 }
 
-// AddTagToPLC adiciona uma tag a um PLC gerenciado
-func (m *Manager) AddTagToPLC(plcID uint, tag *Tag) {
-	m.mutex.RLock()
-	plc, exists := m.plcs[plcID]
-	m.mutex.RUnlock()
-
+// UpdatePLC aplica a nova configuração de um PLC ativo. A conexão só é reiniciada
+// se os parâmetros de conexão mudaram; caso contrário as tags continuam a ser lidas.
+func (m *Manager) UpdatePLC(plc *PLC) {
+	active, exists := m.GetPLC(plc.ID)
 	if !exists {
-		log.Printf("Tentativa de adicionar tag a PLC não gerenciado: %d", plcID)
+		m.AddPLC(plc)
 		return
 	}
 
-	// Verificar se a tag já existe
-	for i, existingTag := range plc.Tags {
-		if existingTag.ID == tag.ID {
-			// Atualizar tag existente
-			plc.Tags[i] = *tag
-			log.Printf("Tag atualizada no PLC %s: %s (ID: %d)", plc.Nome, tag.Nome, tag.ID)
-			return
-		}
+	if plcConnectionChanged(active, plc) {
+		log.Printf("Parâmetros de conexão do PLC %s alterados, reiniciando conexão", plc.Nome)
+		m.RestartPLC(plc)
+		return
 	}
 
-	// Adicionar nova tag
-	plc.Tags = append(plc.Tags, *tag)
-
-	// Iniciar leitura da tag
-	m.wg.Add(1)
-	tagStopChan := make(chan struct{})
-	go m.readTag(plc, tag, tagStopChan)
+	m.mutex.Lock()
+	active.Nome = plc.Nome
+	m.mutex.Unlock()
 
-	log.Printf("Tag adicionada ao PLC %s: %s (ID: %d)", plc.Nome, tag.Nome, tag.ID)
+	log.Printf("PLC atualizado sem reiniciar a conexão: %s (ID: %d)", plc.Nome, plc.ID)
 }
 
-// RemoveTagFromPLC remove uma tag de um PLC gerenciado
-func (m *Manager) RemoveTagFromPLC(plcID uint, tagID uint) {
-	m.mutex.RLock()
-	plc, exists := m.plcs[plcID]
-	m.mutex.RUnlock()
-
-	if !exists {
-		return
-	}
-
-	// Encontrar e remover a tag
-	for i, tag := range plc.Tags {
-		if tag.ID == tagID {
-			// Remover tag do slice
-			plc.Tags = append(plc.Tags[:i], plc.Tags[i+1:]...)
-			log.Printf("Tag removida do PLC %s: ID %d", plc.Nome, tagID)
-			return
-		}
-	}
+// plcConnectionChanged indica se algum parâmetro usado pelo driver mudou
+func plcConnectionChanged(a, b *PLC) bool {
+	return plcProtocolo(a) != plcProtocolo(b) ||
+		a.IPAddress != b.IPAddress ||
+		a.Porta != b.Porta ||
+		a.Rack != b.Rack ||
+		a.Slot != b.Slot ||
+		a.UnitID != b.UnitID ||
+		!stringPtrEqual(a.Gateway, b.Gateway) ||
+		a.TipoConexao != b.TipoConexao ||
+		!intPtrEqual(a.LocalTSAP, b.LocalTSAP) ||
+		!intPtrEqual(a.RemoteTSAP, b.RemoteTSAP) ||
+		a.PDUPreferida != b.PDUPreferida ||
+		a.TimeoutMs != b.TimeoutMs ||
+		a.TimeoutInatividadeMs != b.TimeoutInatividadeMs ||
+		!stringPtrEqual(a.SubredeS7, b.SubredeS7) ||
+		!intPtrEqual(a.EnderecoMPI, b.EnderecoMPI)
 }
 
-// UpdateTagInPLC atualiza a configuração de uma tag em um PLC gerenciado
-func (m *Manager) UpdateTagInPLC(plcID uint, tag *Tag) {
-	m.RemoveTagFromPLC(plcID, tag.ID)
-	m.AddTagToPLC(plcID, tag)
+// stringPtrEqual compara dois textos opcionais
+func stringPtrEqual(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
 }
 
-// ReadTag lê o valor atual de uma tag específica
-func (m *Manager) ReadTag(plcID uint, tagID uint) (interface{}, error) {
+// ReadTag lê o valor atual de uma tag específica, devolvendo o valor escalado e o valor bruto
+func (m *Manager) ReadTag(plcID uint, tagID uint) (interface{}, interface{}, error) {
 	m.mutex.RLock()
 	plc, exists := m.plcs[plcID]
 	m.mutex.RUnlock()
 
 	if !exists {
-		return nil, fmt.Errorf("PLC não encontrado")
+		return nil, nil, fmt.Errorf("PLC não encontrado")
 	}
 
-	if !plc.Conectado {
-		return nil, fmt.Errorf("PLC não está conectado")
+	// Encontrar a tag
+	tagToRead := plc.findTag(tagID)
+	if tagToRead == nil {
+		return nil, nil, fmt.Errorf("Tag não encontrada")
 	}
 
-	// Encontrar a tag
-	var tagToRead *Tag
-	for i := range plc.Tags {
-		if plc.Tags[i].ID == tagID {
-			tagToRead = &plc.Tags[i]
-			break
-		}
+	// Tags virtuais não existem no PLC: o valor atual é o último calculado
+	if isVirtualTag(tagToRead) {
+		return tagToRead.UltimoValor, tagToRead.UltimoValorBruto, nil
 	}
 
-	if tagToRead == nil {
-		return nil, fmt.Errorf("Tag não encontrada")
+	if !canRead(plc) {
+		return nil, nil, readUnavailableError(plc)
 	}
 
 	// Ler valor da tag
-	s7Client := plc.Client.(*S7Client)
-	value, err := s7Client.ReadTag(tagToRead)
+	raw, err := plc.Client.ReadTag(tagToRead)
+	reportRead(plc, plc.Client, err)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	value := scaleValue(tagToRead, raw)
 
 	// Atualizar último valor
 	tagToRead.UltimoValor = value
+	tagToRead.UltimoValorBruto = raw
 	tagToRead.UltimaLeitura = time.Now()
+	tagToRead.UltimaLeituraBoa = tagToRead.UltimaLeitura
 
-	return value, nil
+	return value, raw, nil
 }
 
 // WriteTag escreve um valor em uma tag específica
-func (m *Manager) WriteTag(plcID uint, tagID uint, value interface{}) error {
+func (m *Manager) WriteTag(plcID uint, tagID uint, value interface{}, wc WriteContext) error {
+	return m.writeTag(plcID, tagID, value, wc, false)
+}
+
+// restoreTag repõe o valor anterior de uma tag ao reverter uma escrita, como no download de
+// receitas. Aplica a política de escrita exceto a taxa máxima, que recusaria a reposição logo
+// após a escrita que se está a desfazer, e regista a reposição na auditoria.
+func (m *Manager) restoreTag(plcID uint, tagID uint, value interface{}, wc WriteContext) error {
+	return m.writeTag(plcID, tagID, value, wc, true)
+}
+
+// writeTag escreve o valor na tag; em reposições a taxa máxima não é verificada
+func (m *Manager) writeTag(plcID uint, tagID uint, value interface{}, wc WriteContext, reposicao bool) error {
 	m.mutex.RLock()
 	plc, exists := m.plcs[plcID]
 	m.mutex.RUnlock()
@@ -699,36 +676,53 @@ func (m *Manager) WriteTag(plcID uint, tagID uint, value interface{}) error {
 		return fmt.Errorf("PLC não encontrado")
 	}
 
-	if !plc.Conectado {
-		return fmt.Errorf("PLC não está conectado")
+	// Encontrar a tag
+	tagToWrite := plc.findTag(tagID)
+	if tagToWrite == nil {
+		return fmt.Errorf("Tag não encontrada")
+	}
+	if isVirtualTag(tagToWrite) {
+		return fmt.Errorf("tags virtuais não podem ser escritas")
 	}
 
-	// Encontrar a tag
-	var tagToWrite *Tag
-	for i := range plc.Tags {
-		if plc.Tags[i].ID == tagID {
-			tagToWrite = &plc.Tags[i]
-			break
-		}
+	// Aplicar a política de escrita da tag, registando as recusas
+	policyErr := checkWriteLimits(tagToWrite, value, wc)
+	if policyErr == nil && !reposicao {
+		policyErr = checkWriteRate(tagToWrite, value, time.Now())
+	}
+	if policyErr != nil {
+		auditWriteRejected(plc, tagToWrite, value, wc, policyErr)
+		return policyErr
 	}
 
-	if tagToWrite == nil {
-		return fmt.Errorf("Tag não encontrada")
+	if !canRead(plc) {
+		return readUnavailableError(plc)
 	}
 
-	// Escrever valor na tag
-	s7Client := plc.Client.(*S7Client)
-	err := s7Client.WriteTag(tagToWrite, value)
+	// Converter de unidades de engenharia para o valor bruto do PLC
+	raw, err := unscaleValue(tagToWrite, value)
+	if err != nil {
+		return err
+	}
+
+	// Escrever valor na tag; as escritas também contam para o supervisor da conexão
+	err = plc.Client.WriteTag(tagToWrite, raw)
+	reportRead(plc, plc.Client, err)
 	if err != nil {
 		return err
 	}
 
 	// Atualizar último valor
+	value = scaleValue(tagToWrite, raw)
 	tagToWrite.UltimoValor = value
+	tagToWrite.UltimoValorBruto = raw
 	tagToWrite.UltimaLeitura = time.Now()
+	tagToWrite.UltimaPublicacao = tagToWrite.UltimaLeitura
+	tagToWrite.UltimaEscrita = tagToWrite.UltimaLeitura
 
 	// Publicar o novo valor no Redis (compatibilidade)
 	m.publishTagValue(plc, tagToWrite, value)
+	m.evaluateDependents(tagToWrite.ID)
 
 	// Publicar no NATS
 	if m.natsClient != nil && m.natsClient.IsConnected() {
@@ -738,18 +732,23 @@ func (m *Manager) WriteTag(plcID uint, tagID uint, value interface{}) error {
 	}
 
 	// Registrar ação no log de auditoria
+	acao := "Escrever"
+	if reposicao {
+		acao = "Repor"
+	}
 	models.RegistrarAuditoria(
-		0, // Usuário não autenticado ou sistema
-		"Sistema",
-		"Escrever",
+		wc.UtilizadorID,
+		wc.NomeUtilizador,
+		acao,
 		"Tag",
-		"NATS",
+		wc.Origem,
 		map[string]interface{}{
-			"plc_id":    plcID,
-			"tag_id":    tagID,
-			"tag_nome":  tagToWrite.Nome,
-			"valor":     value,
-			"timestamp": time.Now(),
+			"plc_id":      plcID,
+			"tag_id":      tagID,
+			"tag_nome":    tagToWrite.Nome,
+			"valor":       value,
+			"valor_bruto": raw,
+			"timestamp":   time.Now(),
 		},
 	)
 
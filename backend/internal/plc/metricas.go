@@ -0,0 +1,107 @@
+package plc
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Métricas do gerenciador de falhas, atualizadas no caminho de processamento dos lotes
+var (
+	faultBatchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "edp_fault_batch_size",
+		Help:    "Mudanças de words processadas por lote no gerenciador de falhas.",
+		Buckets: []float64{1, 2, 5, 10, 20, 50, 100},
+	})
+
+	faultDroppedChanges = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "edp_fault_changes_dropped_total",
+		Help: "Mudanças de words descartadas por o canal de lotes estar cheio.",
+	})
+)
+
+var (
+	plcLabels = []string{"plc_id", "plc"}
+
+	descPLCUp = prometheus.NewDesc("edp_plc_up",
+		"1 se o PLC está conectado.", plcLabels, nil)
+	descPLCReads = prometheus.NewDesc("edp_plc_reads_total",
+		"Leituras ao PLC, por resultado (ok ou falha).", append(plcLabels, "resultado"), nil)
+	descPLCLatency = prometheus.NewDesc("edp_plc_read_latency_seconds",
+		"Latência das leituras ao PLC (média e p95 das últimas leituras).", append(plcLabels, "estatistica"), nil)
+	descPLCReconnects = prometheus.NewDesc("edp_plc_reconnects_total",
+		"Reconexões ao PLC desde o arranque.", plcLabels, nil)
+	descPLCDisconnected = prometheus.NewDesc("edp_plc_disconnected_seconds_total",
+		"Tempo passado sem conexão ao PLC desde o arranque.", plcLabels, nil)
+	descNatsUp = prometheus.NewDesc("edp_nats_up",
+		"1 se o cliente NATS está conectado.", nil, nil)
+	descHistorianDropped = prometheus.NewDesc("edp_historian_samples_dropped_total",
+		"Amostras do histórico descartadas por o buffer estar cheio.", nil, nil)
+)
+
+// managerCollector exporta o estado do gerenciador PLC a cada recolha do Prometheus
+type managerCollector struct {
+	manager *Manager
+}
+
+// MetricsCollectors retorna os coletores Prometheus do gerenciador PLC e do gerenciador de falhas
+func (m *Manager) MetricsCollectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		&managerCollector{manager: m},
+		faultBatchSize,
+		faultDroppedChanges,
+	}
+}
+
+// Describe envia as descrições das métricas
+func (c *managerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- descPLCUp
+	ch <- descPLCReads
+	ch <- descPLCLatency
+	ch <- descPLCReconnects
+	ch <- descPLCDisconnected
+	ch <- descNatsUp
+	ch <- descHistorianDropped
+}
+
+// Collect envia os valores atuais das métricas
+func (c *managerCollector) Collect(ch chan<- prometheus.Metric) {
+	m := c.manager
+
+	m.mutex.RLock()
+	plcs := make([]*PLC, 0, len(m.plcs))
+	for _, plc := range m.plcs {
+		plcs = append(plcs, plc)
+	}
+	m.mutex.RUnlock()
+
+	for _, plc := range plcs {
+		id := strconv.FormatUint(uint64(plc.ID), 10)
+		stats := m.plcStatsSummary(plc.ID)
+
+		ch <- prometheus.MustNewConstMetric(descPLCUp, prometheus.GaugeValue, boolMetric(plc.Conectado), id, plc.Nome)
+		ch <- prometheus.MustNewConstMetric(descPLCReads, prometheus.CounterValue, float64(stats.LeiturasOK), id, plc.Nome, "ok")
+		ch <- prometheus.MustNewConstMetric(descPLCReads, prometheus.CounterValue, float64(stats.LeiturasFalha), id, plc.Nome, "falha")
+		ch <- prometheus.MustNewConstMetric(descPLCLatency, prometheus.GaugeValue, stats.LatenciaMediaMs/1000, id, plc.Nome, "media")
+		ch <- prometheus.MustNewConstMetric(descPLCLatency, prometheus.GaugeValue, stats.LatenciaP95Ms/1000, id, plc.Nome, "p95")
+		ch <- prometheus.MustNewConstMetric(descPLCReconnects, prometheus.CounterValue, float64(stats.Reconexoes), id, plc.Nome)
+		ch <- prometheus.MustNewConstMetric(descPLCDisconnected, prometheus.CounterValue, stats.SegundosDesconectado, id, plc.Nome)
+	}
+
+	natsUp := m.natsClient != nil && m.natsClient.IsConnected()
+	ch <- prometheus.MustNewConstMetric(descNatsUp, prometheus.GaugeValue, boolMetric(natsUp))
+
+	var dropped int64
+	if m.historian != nil {
+		dropped = m.historian.dropped.Load()
+	}
+	ch <- prometheus.MustNewConstMetric(descHistorianDropped, prometheus.CounterValue, float64(dropped))
+}
+
+// boolMetric converte um booleano em 0 ou 1
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,32 @@
+package plc
+
+import (
+	"log"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+)
+
+// RunMigrations aplica migrações de dados que o AutoMigrate não cobre.
+// Deve ser chamada depois do AutoMigrate dos modelos do pacote.
+func RunMigrations() error {
+	// Tags criadas antes da existência do campo area são sempre de data blocks
+	result := config.DB.Exec(`UPDATE tags SET area = ? WHERE area IS NULL OR area = ''`, AreaDB)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Migração: %d tags atribuídas à área DB", result.RowsAffected)
+	}
+
+	// Hierarquia de ativos a partir dos nomes livres de eclusa e subsistema
+	if err := migrateAssetHierarchy(); err != nil {
+		return err
+	}
+
+	// Tabela do histórico, particionada por mês (não suportado pelo AutoMigrate)
+	if err := createHistorianTable(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,250 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Client é um cliente Modbus TCP. As requisições são serializadas numa única conexão.
+type Client struct {
+	Address string // host:porta
+	UnitID  byte
+	Timeout time.Duration
+
+	mutex       sync.Mutex
+	conn        net.Conn
+	transaction uint16
+}
+
+// NewClient cria um cliente para o endereço e unidade indicados
+func NewClient(address string, unitID byte) *Client {
+	return &Client{
+		Address: address,
+		UnitID:  unitID,
+		Timeout: 5 * time.Second,
+	}
+}
+
+// Connect abre a conexão TCP com o equipamento
+func (c *Client) Connect() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	conn, err := net.DialTimeout("tcp", c.Address, c.Timeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	return nil
+}
+
+// Close fecha a conexão
+func (c *Client) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// IsConnected indica se há uma conexão aberta
+func (c *Client) IsConnected() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.conn != nil
+}
+
+// ReadCoils lê count coils a partir de start, devolvendo um byte (0 ou 1) por coil
+func (c *Client) ReadCoils(start, count int) ([]byte, error) {
+	return c.readBits(FuncReadCoils, start, count)
+}
+
+// ReadDiscreteInputs lê count entradas discretas a partir de start, devolvendo um byte (0 ou 1) por entrada
+func (c *Client) ReadDiscreteInputs(start, count int) ([]byte, error) {
+	return c.readBits(FuncReadDiscreteInputs, start, count)
+}
+
+// ReadHoldingRegisters lê count holding registers, devolvendo 2 bytes big endian por registo
+func (c *Client) ReadHoldingRegisters(start, count int) ([]byte, error) {
+	return c.readRegisters(FuncReadHoldingRegisters, start, count)
+}
+
+// ReadInputRegisters lê count input registers, devolvendo 2 bytes big endian por registo
+func (c *Client) ReadInputRegisters(start, count int) ([]byte, error) {
+	return c.readRegisters(FuncReadInputRegisters, start, count)
+}
+
+// WriteSingleCoil liga ou desliga um coil
+func (c *Client) WriteSingleCoil(address int, value bool) error {
+	req := make([]byte, 5)
+	req[0] = FuncWriteSingleCoil
+	binary.BigEndian.PutUint16(req[1:], uint16(address))
+	if value {
+		binary.BigEndian.PutUint16(req[3:], 0xFF00)
+	}
+	_, err := c.send(req)
+	return err
+}
+
+// WriteMultipleCoils escreve coils consecutivos a partir de start (um byte 0 ou 1 por coil)
+func (c *Client) WriteMultipleCoils(start int, values []byte) error {
+	if len(values) == 0 || len(values) > MaxWriteBits {
+		return fmt.Errorf("quantidade de coils inválida: %d", len(values))
+	}
+
+	packed := packBits(values)
+	req := make([]byte, 6+len(packed))
+	req[0] = FuncWriteMultipleCoils
+	binary.BigEndian.PutUint16(req[1:], uint16(start))
+	binary.BigEndian.PutUint16(req[3:], uint16(len(values)))
+	req[5] = byte(len(packed))
+	copy(req[6:], packed)
+
+	_, err := c.send(req)
+	return err
+}
+
+// WriteMultipleRegisters escreve registos consecutivos a partir de start (2 bytes big endian por registo)
+func (c *Client) WriteMultipleRegisters(start int, data []byte) error {
+	count := len(data) / 2
+	if len(data)%2 != 0 || count == 0 || count > MaxWriteRegisters {
+		return fmt.Errorf("quantidade de registos inválida: %d bytes", len(data))
+	}
+
+	req := make([]byte, 6+len(data))
+	req[0] = FuncWriteMultipleRegisters
+	binary.BigEndian.PutUint16(req[1:], uint16(start))
+	binary.BigEndian.PutUint16(req[3:], uint16(count))
+	req[5] = byte(len(data))
+	copy(req[6:], data)
+
+	_, err := c.send(req)
+	return err
+}
+
+// readBits executa uma leitura de coils ou entradas discretas
+func (c *Client) readBits(function byte, start, count int) ([]byte, error) {
+	if count <= 0 || count > MaxReadBits {
+		return nil, fmt.Errorf("quantidade de bits inválida: %d", count)
+	}
+
+	resp, err := c.send(readRequest(function, start, count))
+	if err != nil {
+		return nil, err
+	}
+
+	byteCount := (count + 7) / 8
+	if len(resp) < 2 || int(resp[1]) != byteCount || len(resp) < 2+byteCount {
+		return nil, fmt.Errorf("resposta Modbus com tamanho inválido")
+	}
+
+	return unpackBits(resp[2:], count), nil
+}
+
+// readRegisters executa uma leitura de holding ou input registers
+func (c *Client) readRegisters(function byte, start, count int) ([]byte, error) {
+	if count <= 0 || count > MaxReadRegisters {
+		return nil, fmt.Errorf("quantidade de registos inválida: %d", count)
+	}
+
+	resp, err := c.send(readRequest(function, start, count))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp) < 2 || int(resp[1]) != 2*count || len(resp) < 2+2*count {
+		return nil, fmt.Errorf("resposta Modbus com tamanho inválido")
+	}
+
+	return resp[2 : 2+2*count], nil
+}
+
+// readRequest monta a PDU de uma função de leitura
+func readRequest(function byte, start, count int) []byte {
+	req := make([]byte, 5)
+	req[0] = function
+	binary.BigEndian.PutUint16(req[1:], uint16(start))
+	binary.BigEndian.PutUint16(req[3:], uint16(count))
+	return req
+}
+
+// send envia uma PDU e devolve a PDU de resposta.
+// Erros de rede fecham a conexão; exceções Modbus são devolvidas como *ExceptionError.
+func (c *Client) send(pdu []byte) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.conn == nil {
+		return nil, fmt.Errorf("não conectado")
+	}
+
+	c.transaction++
+	transaction := c.transaction
+
+	resp, err := c.roundTrip(transaction, pdu)
+	if err != nil {
+		c.conn.Close()
+		c.conn = nil
+		return nil, err
+	}
+
+	if resp[0] == pdu[0]|0x80 {
+		if len(resp) < 2 {
+			return nil, fmt.Errorf("resposta de exceção Modbus incompleta")
+		}
+		return nil, &ExceptionError{Function: pdu[0], Code: resp[1]}
+	}
+	if resp[0] != pdu[0] {
+		return nil, fmt.Errorf("resposta Modbus com função inesperada 0x%02X", resp[0])
+	}
+
+	return resp, nil
+}
+
+// roundTrip escreve a trama e lê a resposta da mesma transação
+func (c *Client) roundTrip(transaction uint16, pdu []byte) ([]byte, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.Timeout)); err != nil {
+		return nil, err
+	}
+
+	frame := append(encodeMBAP(transaction, c.UnitID, len(pdu)), pdu...)
+	if _, err := c.conn.Write(frame); err != nil {
+		return nil, err
+	}
+
+	for {
+		header := make([]byte, mbapHeaderSize)
+		if _, err := io.ReadFull(c.conn, header); err != nil {
+			return nil, err
+		}
+
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || length > 254 {
+			return nil, fmt.Errorf("comprimento de trama Modbus inválido: %d", length)
+		}
+
+		resp := make([]byte, length-1)
+		if _, err := io.ReadFull(c.conn, resp); err != nil {
+			return nil, err
+		}
+
+		// Descartar respostas atrasadas de requisições anteriores que expiraram
+		if binary.BigEndian.Uint16(header[0:]) == transaction {
+			return resp, nil
+		}
+	}
+}
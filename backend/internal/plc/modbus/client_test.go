@@ -0,0 +1,245 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startServer serve um Server em memória numa porta local e retorna um cliente conectado a ele
+func startServer(t *testing.T, size int) (*Server, *Client) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	srv := NewServer(size)
+	go srv.Serve(listener)
+
+	client := NewClient(listener.Addr().String(), 7)
+	client.Timeout = 2 * time.Second
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return srv, client
+}
+
+// TestClientFraming verifica o cabeçalho MBAP das requisições (transação crescente, protocolo 0,
+// comprimento e unit ID) e que respostas atrasadas de outra transação são descartadas
+func TestClientFraming(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	type frame struct {
+		header []byte
+		pdu    []byte
+	}
+	frames := make(chan frame, 3)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		for {
+			header := make([]byte, mbapHeaderSize)
+			if _, err := io.ReadFull(conn, header); err != nil {
+				return
+			}
+			pdu := make([]byte, int(binary.BigEndian.Uint16(header[4:]))-1)
+			if _, err := io.ReadFull(conn, pdu); err != nil {
+				return
+			}
+			frames <- frame{header, pdu}
+
+			transaction := binary.BigEndian.Uint16(header[0:])
+			resp := []byte{pdu[0], 2, 0x12, 0x34}
+
+			// Antes da resposta certa, uma resposta atrasada de uma transação anterior
+			stale := append(encodeMBAP(transaction-1, header[6], 4), pdu[0], 2, 0xDE, 0xAD)
+			conn.Write(append(stale, append(encodeMBAP(transaction, header[6], len(resp)), resp...)...))
+		}
+	}()
+
+	client := NewClient(listener.Addr().String(), 0x11)
+	client.Timeout = 2 * time.Second
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	for i := 1; i <= 3; i++ {
+		data, err := client.ReadHoldingRegisters(40, 1)
+		if err != nil {
+			t.Fatalf("leitura %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(data, []byte{0x12, 0x34}) {
+			t.Errorf("leitura %d = % X, esperado 12 34 (resposta atrasada não descartada)", i, data)
+		}
+
+		f := <-frames
+		want := []byte{0, byte(i), 0, 0, 0, 6, 0x11}
+		if !reflect.DeepEqual(f.header, want) {
+			t.Errorf("MBAP da requisição %d = % X, esperado % X", i, f.header, want)
+		}
+		if !reflect.DeepEqual(f.pdu, []byte{FuncReadHoldingRegisters, 0, 40, 0, 1}) {
+			t.Errorf("PDU da requisição %d = % X", i, f.pdu)
+		}
+	}
+}
+
+// TestClientRegisters escreve e lê registos através do servidor em memória
+func TestClientRegisters(t *testing.T) {
+	srv, client := startServer(t, 16)
+
+	if err := client.WriteMultipleRegisters(3, []byte{0x01, 0x02, 0xAB, 0xCD}); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.HoldingRegister(3); got != 0x0102 {
+		t.Errorf("HR3 = %#04x, esperado 0x0102", got)
+	}
+	if got := srv.HoldingRegister(4); got != 0xABCD {
+		t.Errorf("HR4 = %#04x, esperado 0xABCD", got)
+	}
+
+	data, err := client.ReadHoldingRegisters(2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0, 0x01, 0x02, 0xAB, 0xCD}; !reflect.DeepEqual(data, want) {
+		t.Errorf("ReadHoldingRegisters = % X, esperado % X", data, want)
+	}
+
+	srv.SetInputRegister(15, 0xBEEF)
+	data, err = client.ReadInputRegisters(15, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, []byte{0xBE, 0xEF}) {
+		t.Errorf("ReadInputRegisters = % X, esperado BE EF", data)
+	}
+
+	if err := client.WriteMultipleRegisters(0, []byte{1, 2, 3}); err == nil {
+		t.Error("escrita de um número ímpar de bytes aceite")
+	}
+}
+
+// TestClientCoils verifica a compactação de bits em quantidades que não são múltiplas de 8
+func TestClientCoils(t *testing.T) {
+	srv, client := startServer(t, 32)
+
+	values := []byte{1, 0, 1, 1, 0, 0, 0, 1, 1, 0, 1}
+	if err := client.WriteMultipleCoils(5, values); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.ReadCoils(5, len(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, values) {
+		t.Errorf("ReadCoils = %v, esperado %v", got, values)
+	}
+
+	// Os coils vizinhos não são tocados pelo último byte parcial
+	got, err = client.ReadCoils(0, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append(append([]byte{0, 0, 0, 0, 0}, values...), 0, 0, 0, 0)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadCoils(0, 20) = %v, esperado %v", got, want)
+	}
+
+	if err := client.WriteSingleCoil(6, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.WriteSingleCoil(5, false); err != nil {
+		t.Fatal(err)
+	}
+	got, err = client.ReadCoils(5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []byte{0, 1}) {
+		t.Errorf("coils 5 e 6 = %v, esperado [0 1]", got)
+	}
+
+	srv.SetDiscreteInput(9, true)
+	got, err = client.ReadDiscreteInputs(0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadDiscreteInputs = %v, esperado %v", got, want)
+	}
+}
+
+// TestClientExceptions verifica que as respostas de exceção chegam como *ExceptionError
+// sem fechar a conexão
+func TestClientExceptions(t *testing.T) {
+	_, client := startServer(t, 8)
+
+	tests := []struct {
+		name     string
+		call     func() error
+		function byte
+		code     byte
+	}{
+		{
+			name:     "registos fora da tabela",
+			call:     func() error { _, err := client.ReadHoldingRegisters(6, 4); return err },
+			function: FuncReadHoldingRegisters,
+			code:     ExceptionIllegalAddress,
+		},
+		{
+			name:     "coil fora da tabela",
+			call:     func() error { return client.WriteSingleCoil(8, true) },
+			function: FuncWriteSingleCoil,
+			code:     ExceptionIllegalAddress,
+		},
+		{
+			name:     "quantidade zero",
+			call:     func() error { _, err := client.send(readRequest(FuncReadCoils, 0, 0)); return err },
+			function: FuncReadCoils,
+			code:     ExceptionIllegalValue,
+		},
+		{
+			name:     "função não suportada",
+			call:     func() error { _, err := client.send([]byte{0x2B, 0, 0, 0, 0}); return err },
+			function: 0x2B,
+			code:     ExceptionIllegalFunction,
+		},
+	}
+
+	for _, tt := range tests {
+		err := tt.call()
+		var exc *ExceptionError
+		if !errors.As(err, &exc) {
+			t.Errorf("%s: erro = %v, esperado *ExceptionError", tt.name, err)
+			continue
+		}
+		if exc.Function != tt.function || exc.Code != tt.code {
+			t.Errorf("%s: exceção = função 0x%02X código %d, esperado função 0x%02X código %d",
+				tt.name, exc.Function, exc.Code, tt.function, tt.code)
+		}
+		if !client.IsConnected() {
+			t.Fatalf("%s: a exceção fechou a conexão", tt.name)
+		}
+	}
+
+	if _, err := client.ReadHoldingRegisters(0, 8); err != nil {
+		t.Errorf("leitura válida depois das exceções: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package modbus implementa o subconjunto do protocolo Modbus TCP usado pelos
+// equipamentos auxiliares das eclusas (bombas, sensores de nível, variadores):
+// leitura e escrita de coils, entradas discretas e registos.
+package modbus
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Códigos de função suportados
+const (
+	FuncReadCoils              byte = 0x01
+	FuncReadDiscreteInputs     byte = 0x02
+	FuncReadHoldingRegisters   byte = 0x03
+	FuncReadInputRegisters     byte = 0x04
+	FuncWriteSingleCoil        byte = 0x05
+	FuncWriteSingleRegister    byte = 0x06
+	FuncWriteMultipleCoils     byte = 0x0F
+	FuncWriteMultipleRegisters byte = 0x10
+)
+
+// Limites de quantidade por requisição definidos pela especificação
+const (
+	MaxReadBits       = 2000
+	MaxReadRegisters  = 125
+	MaxWriteBits      = 1968
+	MaxWriteRegisters = 123
+)
+
+// DefaultPort é a porta TCP padrão do Modbus
+const DefaultPort = 502
+
+// Códigos de exceção
+const (
+	ExceptionIllegalFunction    byte = 0x01
+	ExceptionIllegalAddress     byte = 0x02
+	ExceptionIllegalValue       byte = 0x03
+	ExceptionServerDeviceFailed byte = 0x04
+)
+
+// mbapHeaderSize é o tamanho do cabeçalho MBAP (transação, protocolo, comprimento, unidade)
+const mbapHeaderSize = 7
+
+// ExceptionError é uma resposta de exceção devolvida pelo equipamento
+type ExceptionError struct {
+	Function byte
+	Code     byte
+}
+
+// Error descreve a exceção em texto
+func (e *ExceptionError) Error() string {
+	var desc string
+	switch e.Code {
+	case ExceptionIllegalFunction:
+		desc = "função não suportada"
+	case ExceptionIllegalAddress:
+		desc = "endereço inválido"
+	case ExceptionIllegalValue:
+		desc = "valor inválido"
+	case ExceptionServerDeviceFailed:
+		desc = "falha no equipamento"
+	default:
+		desc = fmt.Sprintf("código %d", e.Code)
+	}
+	return fmt.Sprintf("exceção Modbus na função 0x%02X: %s", e.Function, desc)
+}
+
+// packBits compacta valores booleanos (um por byte, 0 ou 1) no formato de bits do Modbus
+func packBits(values []byte) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v != 0 {
+			packed[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return packed
+}
+
+// unpackBits expande count bits para um byte por valor (0 ou 1)
+func unpackBits(packed []byte, count int) []byte {
+	values := make([]byte, count)
+	for i := range values {
+		if packed[i/8]&(1<<uint(i%8)) != 0 {
+			values[i] = 1
+		}
+	}
+	return values
+}
+
+// encodeMBAP monta o cabeçalho MBAP para uma PDU
+func encodeMBAP(transaction uint16, unitID byte, pduLength int) []byte {
+	header := make([]byte, mbapHeaderSize)
+	binary.BigEndian.PutUint16(header[0:], transaction)
+	binary.BigEndian.PutUint16(header[2:], 0) // Identificador de protocolo Modbus
+	binary.BigEndian.PutUint16(header[4:], uint16(pduLength+1))
+	header[6] = unitID
+	return header
+}
@@ -0,0 +1,223 @@
+package modbus
+
+import (
+	"encoding/binary"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Server é um servidor Modbus TCP em memória, usado como substituto local dos equipamentos em testes.
+// Responde a qualquer unit ID.
+type Server struct {
+	mutex            sync.RWMutex
+	coils            []byte // Um byte (0 ou 1) por coil
+	discreteInputs   []byte // Um byte (0 ou 1) por entrada
+	holdingRegisters []uint16
+	inputRegisters   []uint16
+}
+
+// NewServer cria um servidor com size posições em cada tabela
+func NewServer(size int) *Server {
+	return &Server{
+		coils:            make([]byte, size),
+		discreteInputs:   make([]byte, size),
+		holdingRegisters: make([]uint16, size),
+		inputRegisters:   make([]uint16, size),
+	}
+}
+
+// SetCoil altera o valor de um coil
+func (s *Server) SetCoil(address int, value bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.coils[address] = boolByte(value)
+}
+
+// SetDiscreteInput altera o valor de uma entrada discreta
+func (s *Server) SetDiscreteInput(address int, value bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.discreteInputs[address] = boolByte(value)
+}
+
+// SetHoldingRegister altera o valor de um holding register
+func (s *Server) SetHoldingRegister(address int, value uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.holdingRegisters[address] = value
+}
+
+// SetInputRegister altera o valor de um input register
+func (s *Server) SetInputRegister(address int, value uint16) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.inputRegisters[address] = value
+}
+
+// HoldingRegister retorna o valor de um holding register
+func (s *Server) HoldingRegister(address int) uint16 {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.holdingRegisters[address]
+}
+
+// ListenAndServe aceita conexões no endereço indicado até ocorrer um erro
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve aceita conexões do listener, tratando cada uma numa goroutine
+func (s *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn processa as tramas de uma conexão até ela ser fechada
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		header := make([]byte, mbapHeaderSize)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			if err != io.EOF {
+				log.Printf("Modbus: erro ao ler de %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		length := int(binary.BigEndian.Uint16(header[4:]))
+		if length < 2 || length > 254 {
+			log.Printf("Modbus: trama inválida de %s", conn.RemoteAddr())
+			return
+		}
+
+		pdu := make([]byte, length-1)
+		if _, err := io.ReadFull(conn, pdu); err != nil {
+			return
+		}
+
+		resp := s.handle(pdu)
+		frame := append(encodeMBAP(binary.BigEndian.Uint16(header[0:]), header[6], len(resp)), resp...)
+		if _, err := conn.Write(frame); err != nil {
+			return
+		}
+	}
+}
+
+// handle executa uma PDU de requisição e monta a PDU de resposta
+func (s *Server) handle(pdu []byte) []byte {
+	function := pdu[0]
+	if len(pdu) < 5 {
+		return exception(function, ExceptionIllegalValue)
+	}
+
+	start := int(binary.BigEndian.Uint16(pdu[1:]))
+	count := int(binary.BigEndian.Uint16(pdu[3:]))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	switch function {
+	case FuncReadCoils, FuncReadDiscreteInputs:
+		table := s.coils
+		if function == FuncReadDiscreteInputs {
+			table = s.discreteInputs
+		}
+		if count == 0 || count > MaxReadBits {
+			return exception(function, ExceptionIllegalValue)
+		}
+		if start+count > len(table) {
+			return exception(function, ExceptionIllegalAddress)
+		}
+		packed := packBits(table[start : start+count])
+		return append([]byte{function, byte(len(packed))}, packed...)
+
+	case FuncReadHoldingRegisters, FuncReadInputRegisters:
+		table := s.holdingRegisters
+		if function == FuncReadInputRegisters {
+			table = s.inputRegisters
+		}
+		if count == 0 || count > MaxReadRegisters {
+			return exception(function, ExceptionIllegalValue)
+		}
+		if start+count > len(table) {
+			return exception(function, ExceptionIllegalAddress)
+		}
+		resp := make([]byte, 2+2*count)
+		resp[0] = function
+		resp[1] = byte(2 * count)
+		for i := 0; i < count; i++ {
+			binary.BigEndian.PutUint16(resp[2+2*i:], table[start+i])
+		}
+		return resp
+
+	case FuncWriteSingleCoil:
+		if start >= len(s.coils) {
+			return exception(function, ExceptionIllegalAddress)
+		}
+		switch count {
+		case 0xFF00:
+			s.coils[start] = 1
+		case 0x0000:
+			s.coils[start] = 0
+		default:
+			return exception(function, ExceptionIllegalValue)
+		}
+		return pdu[:5]
+
+	case FuncWriteSingleRegister:
+		if start >= len(s.holdingRegisters) {
+			return exception(function, ExceptionIllegalAddress)
+		}
+		s.holdingRegisters[start] = uint16(count)
+		return pdu[:5]
+
+	case FuncWriteMultipleCoils:
+		if len(pdu) < 6 || count == 0 || count > MaxWriteBits || len(pdu) < 6+int(pdu[5]) || int(pdu[5]) < (count+7)/8 {
+			return exception(function, ExceptionIllegalValue)
+		}
+		if start+count > len(s.coils) {
+			return exception(function, ExceptionIllegalAddress)
+		}
+		copy(s.coils[start:], unpackBits(pdu[6:], count))
+		return pdu[:5]
+
+	case FuncWriteMultipleRegisters:
+		if len(pdu) < 6 || count == 0 || count > MaxWriteRegisters || int(pdu[5]) != 2*count || len(pdu) < 6+2*count {
+			return exception(function, ExceptionIllegalValue)
+		}
+		if start+count > len(s.holdingRegisters) {
+			return exception(function, ExceptionIllegalAddress)
+		}
+		for i := 0; i < count; i++ {
+			s.holdingRegisters[start+i] = binary.BigEndian.Uint16(pdu[6+2*i:])
+		}
+		return pdu[:5]
+	}
+
+	return exception(function, ExceptionIllegalFunction)
+}
+
+// exception monta uma PDU de resposta de exceção
+func exception(function byte, code byte) []byte {
+	return []byte{function | 0x80, code}
+}
+
+// boolByte converte um booleano para 0 ou 1
+func boolByte(value bool) byte {
+	if value {
+		return 1
+	}
+	return 0
+}
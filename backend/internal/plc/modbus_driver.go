@@ -0,0 +1,220 @@
+package plc
+
+import (
+	"fmt"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/plc/modbus"
+)
+
+// Áreas Modbus suportadas pelas tags
+const (
+	AreaHoldingRegisters = "HR" // Holding registers (leitura e escrita)
+	AreaInputRegisters   = "IR" // Input registers (somente leitura)
+	AreaCoils            = "CO" // Coils (leitura e escrita)
+	AreaDiscreteInputs   = "DI" // Entradas discretas (somente leitura)
+)
+
+// AreasModbusSuportadas lista as áreas aceites em tags de PLCs Modbus
+var AreasModbusSuportadas = []string{
+	AreaHoldingRegisters, AreaInputRegisters, AreaCoils, AreaDiscreteInputs,
+}
+
+// Ordem das palavras de valores com mais de um registo (A = byte mais significativo)
+const (
+	OrdemABCD = "ABCD" // Big endian (padrão)
+	OrdemCDAB = "CDAB" // Registos trocados
+	OrdemBADC = "BADC" // Bytes trocados em cada registo
+	OrdemDCBA = "DCBA" // Little endian
+)
+
+// Tipos que podem ser mapeados em registos Modbus
+var tiposRegistoModbus = []string{"Int", "Word", "DInt", "DWord", "UDInt", "Real", "LReal"}
+
+// isRegisterArea indica se a área é de registos Modbus de 16 bits
+func isRegisterArea(area string) bool {
+	return area == AreaHoldingRegisters || area == AreaInputRegisters
+}
+
+// validateModbusTagArea verifica área, tipo e ordem de palavras de uma tag Modbus
+func validateModbusTagArea(tag *Tag) error {
+	area := tagArea(tag)
+
+	switch area {
+	case AreaCoils, AreaDiscreteInputs:
+		if tag.Tipo != "Bool" || tag.BitOffset != nil {
+			return fmt.Errorf("tags nas áreas CO e DI devem ser do tipo Bool, sem bit_offset")
+		}
+	case AreaHoldingRegisters, AreaInputRegisters:
+		valid := false
+		for _, t := range tiposRegistoModbus {
+			if t == tag.Tipo {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("tags em registos Modbus devem ser de um dos tipos %v", tiposRegistoModbus)
+		}
+	default:
+		return fmt.Errorf("área Modbus não suportada: %s (válidas: %v)", area, AreasModbusSuportadas)
+	}
+
+	switch tag.OrdemPalavras {
+	case "", OrdemABCD, OrdemCDAB, OrdemBADC, OrdemDCBA:
+	default:
+		return fmt.Errorf("ordem_palavras inválida: %s (válidas: ABCD, CDAB, BADC, DCBA)", tag.OrdemPalavras)
+	}
+
+	if tag.DBNumber != 0 {
+		return fmt.Errorf("db_number não é usado em tags Modbus")
+	}
+
+	return nil
+}
+
+// applyWordOrder converte entre a ordem de bytes do equipamento e o big endian usado na descodificação.
+// A conversão é simétrica, servindo tanto para leitura como para escrita.
+func applyWordOrder(tag *Tag, buffer []byte) []byte {
+	ordem := tag.OrdemPalavras
+	if ordem == "" || ordem == OrdemABCD || len(buffer) < 2 || len(buffer)%2 != 0 {
+		return buffer
+	}
+
+	result := make([]byte, len(buffer))
+	words := len(buffer) / 2
+
+	for i := 0; i < words; i++ {
+		src := i
+		if ordem == OrdemCDAB || ordem == OrdemDCBA {
+			src = words - 1 - i
+		}
+
+		hi, lo := buffer[2*src], buffer[2*src+1]
+		if ordem == OrdemBADC || ordem == OrdemDCBA {
+			hi, lo = lo, hi
+		}
+		result[2*i] = hi
+		result[2*i+1] = lo
+	}
+
+	return result
+}
+
+// ModbusDriver gerencia uma conexão Modbus TCP com um equipamento auxiliar
+type ModbusDriver struct {
+	client *modbus.Client
+	plc    *PLC
+	status driverStatus
+}
+
+// NewModbusDriver cria um novo ModbusDriver
+func NewModbusDriver(plc *PLC) (*ModbusDriver, error) {
+	if plc.UnitID < 0 || plc.UnitID > 255 {
+		return nil, fmt.Errorf("unit_id inválido: %d", plc.UnitID)
+	}
+
+	porta := plc.Porta
+	if porta == 0 {
+		porta = modbus.DefaultPort
+	}
+
+	return &ModbusDriver{
+		client: modbus.NewClient(fmt.Sprintf("%s:%d", plc.IPAddress, porta), byte(plc.UnitID)),
+		plc:    plc,
+	}, nil
+}
+
+// Connect estabelece a conexão TCP com o equipamento
+func (d *ModbusDriver) Connect() error {
+	d.client.Timeout = plcTimeout(d.plc)
+
+	err := d.client.Connect()
+	d.status.record(err)
+	if err != nil {
+		return fmt.Errorf("falha ao conectar com equipamento Modbus %s em %s: %v", d.plc.Nome, d.client.Address, err)
+	}
+	return nil
+}
+
+// Disconnect fecha a conexão
+func (d *ModbusDriver) Disconnect() error {
+	return d.client.Close()
+}
+
+// IsConnected retorna o status da conexão. Erros de rede fecham a conexão,
+// o que faz o Manager reconectar na próxima verificação.
+func (d *ModbusDriver) IsConnected() bool {
+	return d.client.IsConnected()
+}
+
+// ReadTag lê uma tag do equipamento
+func (d *ModbusDriver) ReadTag(tag *Tag) (interface{}, error) {
+	return readTagWith(d, tag)
+}
+
+// ReadBytes lê uma faixa de uma área Modbus.
+// Registos ocupam 2 bytes no buffer; coils e entradas discretas ocupam um byte (0 ou 1) cada.
+func (d *ModbusDriver) ReadBytes(area string, dbNumber int, start int, size int) ([]byte, error) {
+	if !d.client.IsConnected() {
+		return nil, fmt.Errorf("não conectado ao equipamento")
+	}
+
+	var buffer []byte
+	var err error
+
+	switch area {
+	case AreaHoldingRegisters:
+		buffer, err = d.client.ReadHoldingRegisters(start/2, (size+1)/2)
+	case AreaInputRegisters:
+		buffer, err = d.client.ReadInputRegisters(start/2, (size+1)/2)
+	case AreaCoils:
+		buffer, err = d.client.ReadCoils(start, size)
+	case AreaDiscreteInputs:
+		buffer, err = d.client.ReadDiscreteInputs(start, size)
+	default:
+		return nil, fmt.Errorf("área Modbus não suportada: %s", area)
+	}
+
+	d.status.record(err)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer[:size], nil
+}
+
+// WriteTag escreve um valor numa tag de holding registers ou coils
+func (d *ModbusDriver) WriteTag(tag *Tag, value interface{}) error {
+	if !d.client.IsConnected() {
+		return fmt.Errorf("não conectado ao equipamento")
+	}
+
+	buffer, err := encodeTagWrite(d, tag, value)
+	if err != nil {
+		return err
+	}
+
+	switch tagArea(tag) {
+	case AreaHoldingRegisters:
+		err = d.client.WriteMultipleRegisters(tag.ByteOffset, buffer)
+	case AreaCoils:
+		err = d.client.WriteSingleCoil(tag.ByteOffset, buffer[0] != 0)
+	case AreaInputRegisters, AreaDiscreteInputs:
+		return fmt.Errorf("área %s é somente leitura", tagArea(tag))
+	default:
+		return fmt.Errorf("área Modbus não suportada: %s", tagArea(tag))
+	}
+
+	d.status.record(err)
+	return err
+}
+
+// MaxBlockSize retorna o maior bloco lido numa requisição (125 registos)
+func (d *ModbusDriver) MaxBlockSize() int {
+	return 2 * modbus.MaxReadRegisters
+}
+
+// Health retorna um resumo do estado da conexão Modbus
+func (d *ModbusDriver) Health() DriverHealth {
+	return d.status.health("modbus", d.client.IsConnected())
+}
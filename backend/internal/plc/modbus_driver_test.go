@@ -0,0 +1,184 @@
+package plc
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/plc/modbus"
+)
+
+// startModbusDriver serve um modbus.Server em memória numa porta local e retorna um driver conectado a ele
+func startModbusDriver(t *testing.T) (*modbus.Server, *ModbusDriver) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	srv := modbus.NewServer(64)
+	go srv.Serve(listener)
+
+	plc := &PLC{
+		ID:        1,
+		Nome:      "bomba",
+		Protocolo: ProtocoloModbus,
+		IPAddress: "127.0.0.1",
+		Porta:     listener.Addr().(*net.TCPAddr).Port,
+		UnitID:    1,
+	}
+	driver, err := NewModbusDriver(plc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { driver.Disconnect() })
+	return srv, driver
+}
+
+// modbusTag cria uma tag Modbus com o tipo e a ordem de palavras indicados
+func modbusTag(t *testing.T, id uint, endereco, tipo, ordem string) *Tag {
+	t.Helper()
+	tag := &Tag{ID: id, Endereco: endereco, Tipo: tipo, OrdemPalavras: ordem, UpdateInterval: 100, Ativo: true}
+	if err := applyTagAddress(tag); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateModbusTagArea(tag); err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+// TestModbusDriverBlockReads lê tags de holding registers, input registers, coils e entradas
+// discretas em blocos, com valores de 32 bits em cada ordem de palavras
+func TestModbusDriverBlockReads(t *testing.T) {
+	srv, driver := startModbusDriver(t)
+
+	registers := map[int]uint16{
+		0: 0xFFFE,            // Int -2
+		2: 0x0000, 3: 0x4148, // Real 12.5 em CDAB
+		4: 0x0201, 5: 0x0403, // DInt 0x01020304 em BADC
+		6: 0x0D0C, 7: 0x0B0A, // DWord 0x0A0B0C0D em DCBA
+		8: 0x0001, 9: 0x0002, // DInt 65538 em ABCD
+	}
+	for address, value := range registers {
+		srv.SetHoldingRegister(address, value)
+	}
+	srv.SetInputRegister(3, 0x1234)
+	srv.SetCoil(2, true)
+	srv.SetCoil(9, false)
+	srv.SetCoil(10, true)
+	srv.SetDiscreteInput(4, true)
+
+	tags := []*Tag{
+		modbusTag(t, 1, "HR0", "Int", ""),
+		modbusTag(t, 2, "HR2", "Real", OrdemCDAB),
+		modbusTag(t, 3, "HR4", "DInt", OrdemBADC),
+		modbusTag(t, 4, "HR6", "DWord", OrdemDCBA),
+		modbusTag(t, 5, "HR8", "DInt", OrdemABCD),
+		modbusTag(t, 6, "IR3", "Word", ""),
+		modbusTag(t, 7, "CO2", "Bool", ""),
+		modbusTag(t, 8, "CO9", "Bool", ""),
+		modbusTag(t, 9, "CO10", "Bool", ""),
+		modbusTag(t, 10, "DI4", "Bool", ""),
+	}
+	want := map[uint]interface{}{
+		1: float64(-2), 2: 12.5, 3: float64(0x01020304), 4: float64(0x0A0B0C0D), 5: float64(65538),
+		6: float64(0x1234), 7: true, 8: false, 9: true, 10: true,
+	}
+
+	groups := buildReadGroups(tags, driver.MaxBlockSize())
+	if len(groups) != 1 {
+		t.Fatalf("%d grupos, esperado 1", len(groups))
+	}
+
+	sizes := make(map[string]int)
+	for _, block := range groups[0].Blocks {
+		sizes[block.Area] = block.Size
+
+		buffer, err := driver.ReadBytes(block.Area, block.DBNumber, block.Start, block.Size)
+		if err != nil {
+			t.Fatalf("bloco %s: %v", block.Area, err)
+		}
+		if len(buffer) != block.Size {
+			t.Fatalf("bloco %s: %d bytes, esperado %d", block.Area, len(buffer), block.Size)
+		}
+
+		for _, tag := range block.Tags {
+			value, err := decodeTagValue(tag, buffer[tagBufferOffset(tag)-block.Start:])
+			if err != nil {
+				t.Errorf("%s: %v", tag.Endereco, err)
+				continue
+			}
+			if b, ok := value.(bool); ok {
+				if b != want[tag.ID] {
+					t.Errorf("%s = %v, esperado %v", tag.Endereco, b, want[tag.ID])
+				}
+				continue
+			}
+			if v, err := toFloat64(value); err != nil || v != want[tag.ID] {
+				t.Errorf("%s (%s) = %v, esperado %v", tag.Endereco, tag.OrdemPalavras, value, want[tag.ID])
+			}
+		}
+	}
+
+	// Registos ocupam 2 bytes por endereço; coils e entradas um byte por bit
+	expected := map[string]int{AreaHoldingRegisters: 20, AreaInputRegisters: 2, AreaCoils: 9, AreaDiscreteInputs: 1}
+	for area, size := range expected {
+		if sizes[area] != size {
+			t.Errorf("bloco %s com %d bytes, esperado %d", area, sizes[area], size)
+		}
+	}
+}
+
+// TestModbusDriverWrite escreve em holding registers e coils e recusa as áreas somente leitura
+func TestModbusDriverWrite(t *testing.T) {
+	srv, driver := startModbusDriver(t)
+
+	valor := modbusTag(t, 1, "HR10", "Real", OrdemCDAB)
+	if err := driver.WriteTag(valor, 3.5); err != nil {
+		t.Fatal(err)
+	}
+	// 3.5 = 0x40600000, com as palavras trocadas no equipamento
+	if lo, hi := srv.HoldingRegister(10), srv.HoldingRegister(11); lo != 0x0000 || hi != 0x4060 {
+		t.Errorf("HR10..11 = %#04x %#04x, esperado 0x0000 0x4060", lo, hi)
+	}
+	if value, err := driver.ReadTag(valor); err != nil || value != float32(3.5) {
+		t.Errorf("ReadTag(HR10) = %v (%v), esperado 3.5", value, err)
+	}
+
+	word := modbusTag(t, 2, "HR20", "Int", "")
+	if err := driver.WriteTag(word, int64(-300)); err != nil {
+		t.Fatal(err)
+	}
+	if got := srv.HoldingRegister(20); got != uint16(0xFED4) {
+		t.Errorf("HR20 = %#04x, esperado 0xFED4", got)
+	}
+
+	coil := modbusTag(t, 3, "CO12", "Bool", "")
+	for _, value := range []bool{true, false, true} {
+		if err := driver.WriteTag(coil, value); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := driver.ReadTag(coil); err != nil || got != value {
+			t.Errorf("CO12 = %v (%v), esperado %v", got, err, value)
+		}
+	}
+
+	readOnly := []struct {
+		endereco, tipo string
+		value          interface{}
+	}{
+		{"IR0", "Word", 1},
+		{"DI0", "Bool", true},
+	}
+	for _, tt := range readOnly {
+		err := driver.WriteTag(modbusTag(t, 4, tt.endereco, tt.tipo, ""), tt.value)
+		if err == nil || !strings.Contains(err.Error(), "somente leitura") {
+			t.Errorf("escrita em %s: erro = %v, esperado área somente leitura", tt.endereco, err)
+		}
+	}
+}
@@ -2,24 +2,50 @@ package plc
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
-// PLC representa a conexão com um CLP Siemens
+// PLC representa a conexão com um CLP Siemens ou um equipamento Modbus TCP
 type PLC struct {
 	ID        uint    `json:"id" gorm:"primaryKey"`
 	Nome      string  `json:"nome" gorm:"size:100;not null"`
+	Protocolo string  `json:"protocolo" gorm:"size:10;not null;default:'s7'"` // s7 ou modbus
 	IPAddress string  `json:"ip_address" gorm:"size:15;not null"`
+	Porta     int     `json:"porta" gorm:"not null;default:0"` // 0 = porta padrão do protocolo
 	Rack      int     `json:"rack" gorm:"not null;default:0"`
 	Slot      int     `json:"slot" gorm:"not null;default:0"`
-	Gateway   *string `json:"gateway" gorm:"size:15"` // Ponteiro para permitir NULL
+	UnitID    int     `json:"unit_id" gorm:"not null;default:1;column:unit_id"` // Apenas Modbus
+	Gateway   *string `json:"gateway" gorm:"size:15"`                           // S7: endereço TCP usado em vez de ip_address
 	Ativo     bool    `json:"ativo" gorm:"not null;default:true"`
 
+	// Parâmetros de conexão (0 ou NULL = valor padrão)
+	TipoConexao          string `json:"tipo_conexao" gorm:"size:5;not null;default:'PG'"` // S7: PG, OP ou BASIC
+	LocalTSAP            *int   `json:"local_tsap" gorm:"column:local_tsap"`              // S7: padrão 0x0100
+	RemoteTSAP           *int   `json:"remote_tsap" gorm:"column:remote_tsap"`            // S7: padrão derivado de tipo, rack e slot
+	PDUPreferida         int    `json:"pdu_preferida" gorm:"not null;default:0"`          // S7: limita a PDU negociada
+	TimeoutMs            int    `json:"timeout_ms" gorm:"not null;default:0"`
+	TimeoutInatividadeMs int    `json:"timeout_inatividade_ms" gorm:"not null;default:0"`
+
+	// Encaminhamento S7: a conexão TCP é feita ao gateway, que a encaminha para a sub-rede indicada
+	SubredeS7   *string `json:"subrede_s7" gorm:"size:9;column:subrede_s7"` // ID da sub-rede de destino (ex.: 0052-0001)
+	EnderecoMPI *int    `json:"endereco_mpi" gorm:"column:endereco_mpi"`    // Nó MPI/PROFIBUS de destino; NULL = ip_address
+
 	// Campos em tempo de execução (não armazenados no banco)
-	Conectado     bool        `json:"conectado" gorm:"-"`
-	UltimoErro    string      `json:"ultimo_erro" gorm:"-"`
-	UltimaLeitura time.Time   `json:"ultima_leitura" gorm:"-"`
-	Tags          []Tag       `json:"tags" gorm:"-"`
-	Client        interface{} `json:"-" gorm:"-"` // Armazena o cliente S7
+	Conectado        bool          `json:"conectado" gorm:"-"`
+	UltimoErro       string        `json:"ultimo_erro" gorm:"-"`
+	UltimaLeitura    time.Time     `json:"ultima_leitura" gorm:"-"`
+	EstadoCPU        string        `json:"estado_cpu,omitempty" gorm:"-"`        // RUN, STOP ou DESCONHECIDO
+	EstadoConexao    string        `json:"estado_conexao,omitempty" gorm:"-"`    // conectado, desconectado ou circuito_aberto
+	ProximaTentativa *time.Time    `json:"proxima_tentativa,omitempty" gorm:"-"` // Próxima tentativa de conexão
+	Tags             []*Tag        `json:"tags" gorm:"-"`                        // Alterar apenas através do registo de tags
+	Saude            *DriverHealth `json:"saude,omitempty" gorm:"-"`
+	Client           Driver        `json:"-" gorm:"-"` // Driver de comunicação com o CLP
+
+	supervisor *connSupervisor // Supervisor da conexão, criado ao iniciar o PLC
+	registry   *tagRegistry    // Tags ativas e respetivos leitores
+	stop       chan struct{}   // Fechado por RemovePLC para parar a goroutine de conexão
+	done       chan struct{}   // Fechado quando a goroutine de conexão termina
 }
 
 // Tag representa um ponto de dados em um CLP
@@ -27,22 +53,62 @@ type Tag struct {
 	ID             uint    `json:"id" gorm:"primaryKey"`
 	PLCID          uint    `json:"plc_id" gorm:"not null;column:plc_id"`
 	Nome           string  `json:"nome" gorm:"size:100;not null"`
+	Endereco       string  `json:"endereco" gorm:"-"`                        // Ex.: DB10.DBX4.3, MW20, %I0.1
+	Area           string  `json:"area" gorm:"size:2;not null;default:'DB'"` // S7: DB, I, Q, M, T, C; Modbus: HR, IR, CO, DI
 	DBNumber       int     `json:"db_number" gorm:"not null;column:db_number"`
 	ByteOffset     int     `json:"byte_offset" gorm:"not null;column:byte_offset"`
 	BitOffset      *int    `json:"bit_offset" gorm:"column:bit_offset"`
 	Tipo           string  `json:"tipo" gorm:"size:20;not null"`
 	Tamanho        int     `json:"tamanho" gorm:"default:1"`
-	Subsistema     *string `json:"subsistema" gorm:"size:50"`  // Modificado para ponteiro
-	Descricao      *string `json:"descricao" gorm:"type:text"` // Modificado para ponteiro
+	AtivoID        *uint   `json:"ativo_id" gorm:"index;column:ativo_id"` // Nó da hierarquia de ativos
+	Subsistema     *string `json:"subsistema" gorm:"size:50"`             // Copiado do nó da hierarquia
+	Descricao      *string `json:"descricao" gorm:"type:text"`            // Modificado para ponteiro
 	Ativo          bool    `json:"ativo" gorm:"not null;default:true"`
 	UpdateInterval int     `json:"update_interval_ms" gorm:"not null;default:1000;column:update_interval_ms"`
 	OnlyOnChange   bool    `json:"only_on_change" gorm:"not null;default:false;column:only_on_change"`
+	OrdemPalavras  string  `json:"ordem_palavras" gorm:"size:4;not null;default:'ABCD'"` // Apenas registos Modbus: ABCD, CDAB, BADC ou DCBA
+	Expressao      *string `json:"expressao" gorm:"type:text"`                           // Tag virtual: valor calculado a partir de outras tags, ex.: [12] - [13]
+
+	// Escala linear opcional do valor bruto para unidades de engenharia
+	BrutoMin *float64 `json:"bruto_min" gorm:"column:bruto_min"`
+	BrutoMax *float64 `json:"bruto_max" gorm:"column:bruto_max"`
+	EngMin   *float64 `json:"eng_min" gorm:"column:eng_min"`
+	EngMax   *float64 `json:"eng_max" gorm:"column:eng_max"`
+	Limitar  bool     `json:"limitar" gorm:"not null;default:false"` // Limitar o valor escalado a [eng_min, eng_max]
+	Unidade  *string  `json:"unidade" gorm:"size:20"`
+	Precisao *int     `json:"precisao"` // Casas decimais do valor publicado
+
+	// Filtro de publicação com only_on_change
+	BandaMorta    *float64 `json:"banda_morta" gorm:"column:banda_morta"`                          // Variação absoluta mínima (unidades de engenharia)
+	BandaMortaPct *float64 `json:"banda_morta_pct" gorm:"column:banda_morta_pct"`                  // Variação mínima em % da faixa de engenharia
+	SilencioMaxS  int      `json:"silencio_max_s" gorm:"not null;default:0;column:silencio_max_s"` // Republicar após N segundos sem publicação (0 = nunca)
+
+	// Histórico
+	HistoricoModo         string `json:"historico_modo" gorm:"size:10;not null;default:'nenhum'"` // nenhum, todas, mudanca ou periodico
+	HistoricoIntervaloS   int    `json:"historico_intervalo_s" gorm:"not null;default:0"`         // Intervalo do modo periodico
+	HistoricoRetencaoDias int    `json:"historico_retencao_dias" gorm:"not null;default:0"`       // 0 = retenção padrão
+
+	// Política de escrita (limites em unidades de engenharia)
+	Gravavel          bool     `json:"gravavel" gorm:"not null;default:true"`
+	EscritaMin        *float64 `json:"escrita_min" gorm:"column:escrita_min"`
+	EscritaMax        *float64 `json:"escrita_max" gorm:"column:escrita_max"`
+	ValoresPermitidos *string  `json:"valores_permitidos" gorm:"size:255"`    // Lista separada por vírgulas, ex: "0,1,2"
+	TaxaMaxima        *float64 `json:"taxa_maxima" gorm:"column:taxa_maxima"` // Variação máxima por segundo desde a última escrita
+	PerfilEscrita     *string  `json:"perfil_escrita" gorm:"size:50"`         // Perfil exigido para escrever (Administrador pode sempre)
 
 	// Campos em tempo de execução (não armazenados no banco)
-	UltimoValor    interface{} `json:"ultimo_valor" gorm:"-"`
-	UltimaLeitura  time.Time   `json:"ultima_leitura" gorm:"-"`
-	UltimoErroTime time.Time   `json:"ultimo_erro_time" gorm:"-"`
-	UltimoErro     string      `json:"ultimo_erro" gorm:"-"`
+	UltimoValor      interface{} `json:"ultimo_valor" gorm:"-"`
+	UltimoValorBruto interface{} `json:"ultimo_valor_bruto" gorm:"-"`
+	UltimaLeitura    time.Time   `json:"ultima_leitura" gorm:"-"`
+	UltimaPublicacao time.Time   `json:"ultima_publicacao" gorm:"-"`
+	UltimaEscrita    time.Time   `json:"ultima_escrita" gorm:"-"`
+	UltimaLeituraBoa time.Time   `json:"ultima_leitura_boa" gorm:"-"`
+	Qualidade        string      `json:"qualidade" gorm:"-"` // good, bad-comm, bad-config ou uncertain-stale
+	UltimoErroTime   time.Time   `json:"ultimo_erro_time" gorm:"-"`
+	UltimoErro       string      `json:"ultimo_erro" gorm:"-"`
+
+	HistoricoUltimoValor interface{} `json:"-" gorm:"-"` // Último valor registado no histórico
+	HistoricoUltimoTempo time.Time   `json:"-" gorm:"-"`
 }
 
 // TableName especifica o nome da tabela para o modelo PLC
@@ -54,3 +120,23 @@ func (PLC) TableName() string {
 func (Tag) TableName() string {
 	return "tags"
 }
+
+// AfterFind preenche o endereço canónico da tag
+func (t *Tag) AfterFind(tx *gorm.DB) error {
+	t.Endereco = tagEndereco(t)
+	return nil
+}
+
+// AfterSave preenche o endereço canónico da tag
+func (t *Tag) AfterSave(tx *gorm.DB) error {
+	t.Endereco = tagEndereco(t)
+	return nil
+}
+
+// tagEndereco retorna o endereço canónico da tag; as tags virtuais não têm endereço
+func tagEndereco(t *Tag) string {
+	if isVirtualTag(t) {
+		return ""
+	}
+	return tagAddress(t).String()
+}
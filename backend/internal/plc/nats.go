@@ -4,8 +4,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/danilo/edp_gestao_utilizadores/internal/middleware"
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
 	"github.com/nats-io/nats.go"
 )
 
@@ -31,6 +35,7 @@ func NewNatsClient() *NatsClient {
 			"tag_updates": "plc.tags.updates",
 			"plc_updates": "plc.updates",
 			"tag_write":   "plc.tags.write",
+			"cpu_state":   "plc.cpu.estado",
 		},
 		connected: false,
 	}
@@ -61,6 +66,15 @@ func (c *NatsClient) Connect(url string) error {
 		}),
 	}
 
+	// Com o servidor em modo de contas, o backend autentica-se com credenciais emitidas por si
+	if os.Getenv("NATS_ACCOUNT_SEED") != "" {
+		account, err := natsAccountKey()
+		if err != nil {
+			return fmt.Errorf("falha ao emitir credenciais NATS do backend: %v", err)
+		}
+		opts = append(opts, natsServiceAuth(account, natsServiceCredentialsTTL))
+	}
+
 	var err error
 	c.conn, err = nats.Connect(url, opts...)
 	if err != nil {
@@ -96,8 +110,18 @@ func (c *NatsClient) PublishPLCStatus(plc *PLC) error {
 		"ip_address":  plc.IPAddress,
 		"conectado":   plc.Conectado,
 		"ultimo_erro": plc.UltimoErro,
+		"estado_cpu":  plc.EstadoCPU,
 		"timestamp":   time.Now(),
 	}
+	if plc.EstadoConexao != "" {
+		status["estado_conexao"] = plc.EstadoConexao
+	}
+	if plc.ProximaTentativa != nil {
+		status["proxima_tentativa"] = *plc.ProximaTentativa
+	}
+	if c.manager != nil {
+		status["estatisticas"] = c.manager.plcStatsSummary(plc.ID)
+	}
 
 	// Publicar para o subject específico deste PLC e para o subject geral
 	specificSubject := fmt.Sprintf("%s.%d", c.subjects["plc_status"], plc.ID)
@@ -132,12 +156,15 @@ func (c *NatsClient) PublishTagValue(plc *PLC, tag *Tag, value interface{}) erro
 	}
 
 	data := map[string]interface{}{
-		"plc_id":    plc.ID,
-		"plc_nome":  plc.Nome,
-		"tag_id":    tag.ID,
-		"tag_nome":  tag.Nome,
-		"valor":     value,
-		"timestamp": tag.UltimaLeitura,
+		"plc_id":      plc.ID,
+		"plc_nome":    plc.Nome,
+		"tag_id":      tag.ID,
+		"tag_nome":    tag.Nome,
+		"valor":       value,
+		"valor_bruto": tag.UltimoValorBruto,
+		"unidade":     tag.Unidade,
+		"qualidade":   tag.Qualidade,
+		"timestamp":   tag.UltimaLeitura,
 	}
 
 	// Definir subjects para publicação
@@ -172,14 +199,43 @@ func (c *NatsClient) PublishTagValue(plc *PLC, tag *Tag, value interface{}) erro
 	return nil
 }
 
-// handleTagWriteCommand processa comandos de escrita de tags recebidos via NATS
-func (c *NatsClient) handleTagWriteCommand(msg *nats.Msg) {
-	log.Printf("[NATS] Recebido comando de escrita: %s", string(msg.Data))
+// natsWriteToken extrai o token de acesso de um comando de escrita: cabeçalho
+// "Authorization: Bearer <token>" ou, em alternativa, o campo token do corpo
+func natsWriteToken(msg *nats.Msg, bodyToken string) string {
+	if msg.Header != nil {
+		if auth := msg.Header.Get("Authorization"); auth != "" {
+			return strings.TrimPrefix(auth, "Bearer ")
+		}
+	}
+	return bodyToken
+}
 
+// canWriteTags indica se o perfil pode escrever em tags por comandos NATS ou pelo envio de receitas
+func canWriteTags(perfil string) (bool, error) {
+	if perfil == "Administrador" {
+		return true, nil
+	}
+	return models.PerfilTemPermissao(perfil, PermissaoModuloPLC, PermissaoAcaoEscrever)
+}
+
+// replyWriteCommand responde a um comando de escrita, se houver um reply subject
+func (c *NatsClient) replyWriteCommand(msg *nats.Msg, response map[string]interface{}) {
+	if msg.Reply == "" {
+		return
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	c.conn.Publish(msg.Reply, responseJSON)
+}
+
+// handleTagWriteCommand processa comandos de escrita de tags recebidos via NATS.
+// O comando deve trazer o token de acesso do utilizador, validado como no AuthMiddleware.
+func (c *NatsClient) handleTagWriteCommand(msg *nats.Msg) {
 	var comando struct {
 		TagID uint        `json:"tag_id"`
 		PLCID uint        `json:"plc_id"`
 		Valor interface{} `json:"valor"`
+		Token string      `json:"token"`
 	}
 
 	if err := json.Unmarshal(msg.Data, &comando); err != nil {
@@ -187,47 +243,113 @@ func (c *NatsClient) handleTagWriteCommand(msg *nats.Msg) {
 		return
 	}
 
+	log.Printf("[NATS] Recebido comando de escrita: plc %d, tag %d, valor %v", comando.PLCID, comando.TagID, comando.Valor)
+
 	if c.manager == nil {
 		log.Printf("[NATS] Gerenciador PLC não configurado")
 		return
 	}
 
+	// Autenticar o utilizador
+	token := natsWriteToken(msg, comando.Token)
+	if token == "" {
+		c.rejectWriteCommand(msg, comando.PLCID, comando.TagID, comando.Valor, nil, "Acesso não autorizado: Token não fornecido")
+		return
+	}
+
+	user, err := middleware.ValidateAccessToken(token)
+	if err != nil {
+		c.rejectWriteCommand(msg, comando.PLCID, comando.TagID, comando.Valor, nil, err.Error())
+		return
+	}
+
+	// Verificar permissão de escrita
+	allowed, err := canWriteTags(user.Perfil)
+	if err != nil {
+		log.Printf("[NATS] Erro ao verificar permissões do utilizador %d: %v", user.ID, err)
+	}
+	if !allowed {
+		c.rejectWriteCommand(msg, comando.PLCID, comando.TagID, comando.Valor, user, "Utilizador sem permissão para escrever em tags")
+		return
+	}
+
+	utilizador := map[string]interface{}{
+		"id":   user.ID,
+		"nome": user.Nome,
+	}
+
 	// Verificar se o PLC existe
 	if _, exists := c.manager.GetPLC(comando.PLCID); !exists {
 		log.Printf("[NATS] PLC ID %d não encontrado", comando.PLCID)
+		c.replyWriteCommand(msg, map[string]interface{}{
+			"sucesso":    false,
+			"mensagem":   "PLC não encontrado",
+			"utilizador": utilizador,
+		})
 		return
 	}
 
-	// Escrever valor na tag
-	err := c.manager.WriteTag(comando.PLCID, comando.TagID, comando.Valor)
+	// Escrever valor na tag; a política de escrita e a auditoria são aplicadas pelo gerenciador
+	err = c.manager.WriteTag(comando.PLCID, comando.TagID, comando.Valor, WriteContext{
+		UtilizadorID:   user.ID,
+		NomeUtilizador: user.Nome,
+		Perfil:         user.Perfil,
+		Origem:         "NATS",
+	})
 	if err != nil {
 		log.Printf("[NATS] Erro ao escrever na tag %d: %v", comando.TagID, err)
-
-		// Responder com erro se houver um reply subject
-		if msg.Reply != "" {
-			response := map[string]interface{}{
-				"sucesso":  false,
-				"mensagem": fmt.Sprintf("Erro ao escrever na tag: %v", err),
-			}
-
-			responseJSON, _ := json.Marshal(response)
-			c.conn.Publish(msg.Reply, responseJSON)
-		}
+		c.replyWriteCommand(msg, map[string]interface{}{
+			"sucesso":    false,
+			"mensagem":   fmt.Sprintf("Erro ao escrever na tag: %v", err),
+			"utilizador": utilizador,
+		})
 		return
 	}
 
-	log.Printf("[NATS] Valor escrito com sucesso na tag ID %d", comando.TagID)
+	log.Printf("[NATS] Valor escrito com sucesso na tag ID %d por %s", comando.TagID, user.Nome)
 
-	// Responder com sucesso se houver um reply subject
-	if msg.Reply != "" {
-		response := map[string]interface{}{
-			"sucesso":  true,
-			"mensagem": "Valor escrito com sucesso",
-		}
+	c.replyWriteCommand(msg, map[string]interface{}{
+		"sucesso":    true,
+		"mensagem":   "Valor escrito com sucesso",
+		"utilizador": utilizador,
+	})
+}
+
+// rejectWriteCommand recusa um comando de escrita não autenticado ou não autorizado,
+// registando-o no log de auditoria
+func (c *NatsClient) rejectWriteCommand(msg *nats.Msg, plcID, tagID uint, valor interface{}, user *middleware.AuthenticatedUser, motivo string) {
+	log.Printf("[NATS] Comando de escrita recusado para tag %d: %s", tagID, motivo)
 
-		responseJSON, _ := json.Marshal(response)
-		c.conn.Publish(msg.Reply, responseJSON)
+	var userID uint
+	userName := "Desconhecido"
+	response := map[string]interface{}{
+		"sucesso":  false,
+		"mensagem": motivo,
 	}
+	if user != nil {
+		userID, userName = user.ID, user.Nome
+		response["utilizador"] = map[string]interface{}{
+			"id":   user.ID,
+			"nome": user.Nome,
+		}
+	}
+
+	models.RegistrarAuditoria(
+		userID,
+		userName,
+		"Escrita Recusada",
+		"Tag",
+		"NATS",
+		map[string]interface{}{
+			"plc_id":    plcID,
+			"tag_id":    tagID,
+			"valor":     valor,
+			"motivo":    motivo,
+			"timestamp": time.Now(),
+		},
+	)
+
+	c.replyWriteCommand(msg, response)
 }
 
 // Close fecha a conexão NATS
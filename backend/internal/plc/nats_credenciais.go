@@ -0,0 +1,272 @@
+package plc
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// NatsSubjects lista os subjects NATS usados pelo backend e pelos clientes
+var NatsSubjects = map[string]string{
+	"plc_status":  "plc.status",
+	"tag_updates": "plc.tags.updates",
+	"plc_updates": "plc.updates",
+	"tag_write":   "plc.tags.write",
+	"cpu_state":   "plc.cpu.estado",
+	// Tópicos para falhas
+	"fault_updates": "eclusa.falhas",
+	"fault_ack":     "eclusa.falhas.reconhecidas",
+}
+
+// Validade padrão das credenciais NATS emitidas para clientes
+const defaultNatsCredentialsTTL = 15 * time.Minute
+
+// Validade das credenciais NATS do backend; ao expirarem o servidor fecha a conexão
+// e a reconexão emite credenciais novas
+const natsServiceCredentialsTTL = time.Hour
+
+// NatsCredentials são as credenciais de utilizador NATS emitidas para um cliente.
+// O cliente deve usar PrefixoInbox como prefixo das inboxes (inboxPrefix no nats.ws,
+// nats.CustomInboxPrefix no nats.go): só pode assinar as inboxes com esse prefixo,
+// por isso os pedidos com o prefixo padrão _INBOX não recebem resposta.
+type NatsCredentials struct {
+	URL          string            `json:"url"`
+	JWT          string            `json:"jwt"`
+	Seed         string            `json:"seed"`
+	ExpiraEm     time.Time         `json:"expira_em"`
+	Subjects     map[string]string `json:"subjects"`
+	PrefixoInbox string            `json:"prefixo_inbox"`
+	Publicar     []string          `json:"publicar"` // Subjects em que o cliente pode publicar
+	Assinar      []string          `json:"assinar"`  // Subjects que o cliente pode assinar
+}
+
+// NatsPublicURL retorna o URL do NATS para clientes, convertendo para WebSocket
+// quando não há NATS_PUBLIC_URL definido
+func NatsPublicURL() string {
+	natsURL := os.Getenv("NATS_PUBLIC_URL")
+	if natsURL == "" {
+		natsURL = os.Getenv("NATS_URL")
+	}
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+
+	// Se o URL começar com nats:// e não tivermos um NATS_PUBLIC_URL,
+	// converter para ws:// para navegadores
+	if strings.HasPrefix(natsURL, "nats://") && os.Getenv("NATS_PUBLIC_URL") == "" {
+		natsURL = "ws://" + natsURL[len("nats://"):]
+		// Usar porta 8443 para WebSocket, caso esteja usando a padrão 4222
+		if strings.HasSuffix(natsURL, ":4222") {
+			natsURL = natsURL[:len(natsURL)-len(":4222")] + ":8443"
+		}
+	}
+
+	return natsURL
+}
+
+// natsAccountKey carrega a chave da conta NATS (NATS_ACCOUNT_SEED) que assina as credenciais
+func natsAccountKey() (nkeys.KeyPair, error) {
+	seed := os.Getenv("NATS_ACCOUNT_SEED")
+	if seed == "" {
+		return nil, fmt.Errorf("NATS_ACCOUNT_SEED não configurado")
+	}
+
+	account, err := nkeys.FromSeed([]byte(seed))
+	if err != nil {
+		return nil, fmt.Errorf("NATS_ACCOUNT_SEED inválido: %v", err)
+	}
+	if pub, err := account.PublicKey(); err != nil || !nkeys.IsValidPublicAccountKey(pub) {
+		return nil, fmt.Errorf("NATS_ACCOUNT_SEED deve ser a seed de uma conta (SA...)")
+	}
+
+	return account, nil
+}
+
+// natsCredentialsTTL retorna a validade das credenciais (NATS_CREDENTIALS_TTL, ex: 15m)
+func natsCredentialsTTL() time.Duration {
+	if ttl, err := time.ParseDuration(os.Getenv("NATS_CREDENTIALS_TTL")); err == nil && ttl > 0 {
+		return ttl
+	}
+	return defaultNatsCredentialsTTL
+}
+
+// natsInboxPrefix retorna o prefixo das inboxes do utilizador. Cada utilizador só pode assinar
+// as suas, para não ler as respostas aos comandos de escrita de outros utilizadores.
+func natsInboxPrefix(userID uint) string {
+	return fmt.Sprintf("_INBOX.u%d", userID)
+}
+
+// natsUserPermissions deriva as permissões NATS do utilizador. Todos podem assinar atualizações,
+// falhas e as próprias inboxes; apenas quem tem permissão de escrita em tags (ver canWriteTags)
+// pode publicar comandos em plc.tags.write.
+func natsUserPermissions(userID uint, escrever bool) (publicar []string, assinar []string) {
+	assinar = []string{
+		NatsSubjects["plc_status"],
+		NatsSubjects["plc_status"] + ".>",
+		NatsSubjects["tag_updates"] + ".>",
+		NatsSubjects["plc_updates"],
+		NatsSubjects["plc_updates"] + ".>",
+		NatsSubjects["cpu_state"],
+		NatsSubjects["cpu_state"] + ".>",
+		NatsSubjects["fault_updates"],
+		NatsSubjects["fault_ack"],
+		natsInboxPrefix(userID) + ".>", // Respostas aos comandos de escrita
+	}
+
+	if escrever {
+		publicar = []string{NatsSubjects["tag_write"]}
+	}
+
+	return publicar, assinar
+}
+
+// IssueNatsCredentials emite um JWT de utilizador NATS de curta duração, assinado pela conta,
+// com as permissões derivadas do perfil do utilizador
+func IssueNatsCredentials(user *models.Utilizador, perfil string) (*NatsCredentials, error) {
+	account, err := natsAccountKey()
+	if err != nil {
+		return nil, err
+	}
+
+	escrever, err := canWriteTags(perfil)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao obter permissões do perfil: %v", err)
+	}
+
+	return issueNatsCredentials(account, user, escrever, natsCredentialsTTL())
+}
+
+// issueNatsCredentials assina as credenciais do utilizador com a chave da conta
+func issueNatsCredentials(account nkeys.KeyPair, user *models.Utilizador, escrever bool, ttl time.Duration) (*NatsCredentials, error) {
+	publicar, assinar := natsUserPermissions(user.ID, escrever)
+
+	// Cada emissão usa um par de chaves novo; a seed só é devolvida ao cliente
+	userKey, err := nkeys.CreateUser()
+	if err != nil {
+		return nil, err
+	}
+	userPub, err := userKey.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	userSeed, err := userKey.Seed()
+	if err != nil {
+		return nil, err
+	}
+
+	expiraEm := time.Now().Add(ttl)
+
+	claims := jwt.NewUserClaims(userPub)
+	claims.Name = fmt.Sprintf("%s (%d)", user.Nome, user.ID)
+	claims.Expires = expiraEm.Unix()
+	claims.Sub.Allow.Add(assinar...)
+	if len(publicar) > 0 {
+		claims.Pub.Allow.Add(publicar...)
+	} else {
+		// Sem lista de permissões o NATS permite tudo; negar explicitamente
+		claims.Pub.Deny.Add(">")
+	}
+
+	token, err := claims.Encode(account)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao assinar credenciais NATS: %v", err)
+	}
+
+	return &NatsCredentials{
+		URL:          NatsPublicURL(),
+		JWT:          token,
+		Seed:         string(userSeed),
+		ExpiraEm:     expiraEm,
+		Subjects:     NatsSubjects,
+		PrefixoInbox: natsInboxPrefix(user.ID),
+		Publicar:     publicar,
+		Assinar:      assinar,
+	}, nil
+}
+
+// natsServicePermissions lista os subjects do próprio backend: publica estados, valores de tags,
+// estados da CPU e falhas, e assina os comandos de escrita. As respostas a esses comandos são
+// autorizadas pela permissão de resposta, sem dar acesso às inboxes dos utilizadores.
+func natsServicePermissions() (publicar []string, assinar []string) {
+	publicar = []string{
+		NatsSubjects["plc_status"],
+		NatsSubjects["plc_status"] + ".>",
+		NatsSubjects["tag_updates"],
+		NatsSubjects["tag_updates"] + ".>",
+		NatsSubjects["plc_updates"],
+		NatsSubjects["plc_updates"] + ".>",
+		NatsSubjects["cpu_state"],
+		NatsSubjects["cpu_state"] + ".>",
+		NatsSubjects["fault_updates"],
+		NatsSubjects["fault_ack"],
+	}
+	assinar = []string{NatsSubjects["tag_write"]}
+
+	return publicar, assinar
+}
+
+// natsServiceCredentials emite as credenciais do próprio backend, limitadas aos subjects de
+// natsServicePermissions e válidas durante ttl. São emitidas de novo a cada (re)conexão.
+func natsServiceCredentials(account nkeys.KeyPair, ttl time.Duration) (string, nkeys.KeyPair, error) {
+	publicar, assinar := natsServicePermissions()
+
+	userKey, err := nkeys.CreateUser()
+	if err != nil {
+		return "", nil, err
+	}
+	userPub, err := userKey.PublicKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims := jwt.NewUserClaims(userPub)
+	claims.Name = "PLC Manager"
+	claims.Expires = time.Now().Add(ttl).Unix()
+	claims.Pub.Allow.Add(publicar...)
+	claims.Sub.Allow.Add(assinar...)
+	claims.Resp = &jwt.ResponsePermission{MaxMsgs: 1, Expires: time.Minute}
+
+	token, err := claims.Encode(account)
+	if err != nil {
+		return "", nil, fmt.Errorf("falha ao assinar credenciais NATS do backend: %v", err)
+	}
+	return token, userKey, nil
+}
+
+// natsServiceAuth retorna a opção de autenticação do backend. O nats.go pede o JWT a cada
+// (re)conexão, incluindo a que se segue à expiração das credenciais, e assina o nonce do
+// servidor com a chave emitida nesse pedido.
+func natsServiceAuth(account nkeys.KeyPair, ttl time.Duration) nats.Option {
+	var (
+		mu      sync.Mutex
+		userKey nkeys.KeyPair
+	)
+
+	return nats.UserJWT(
+		func() (string, error) {
+			token, key, err := natsServiceCredentials(account, ttl)
+			if err != nil {
+				return "", err
+			}
+			mu.Lock()
+			userKey = key
+			mu.Unlock()
+			return token, nil
+		},
+		func(nonce []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if userKey == nil {
+				return nil, fmt.Errorf("credenciais NATS do backend não emitidas")
+			}
+			return userKey.Sign(nonce)
+		},
+	)
+}
@@ -0,0 +1,323 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+	"github.com/nats-io/jwt/v2"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nkeys"
+)
+
+// startNatsServer inicia um nats-server em modo de contas e retorna o URL e a chave da conta
+// que assina as credenciais. O teste é ignorado se o nats-server não estiver no PATH.
+func startNatsServer(t *testing.T) (string, nkeys.KeyPair) {
+	t.Helper()
+
+	bin, err := exec.LookPath("nats-server")
+	if err != nil {
+		t.Skip("nats-server não encontrado no PATH")
+	}
+
+	operator, _ := nkeys.CreateOperator()
+	operatorPub, _ := operator.PublicKey()
+	operatorJWT, err := jwt.NewOperatorClaims(operatorPub).Encode(operator)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newAccount := func(name string) (nkeys.KeyPair, string, string) {
+		account, _ := nkeys.CreateAccount()
+		pub, _ := account.PublicKey()
+		claims := jwt.NewAccountClaims(pub)
+		claims.Name = name
+		token, err := claims.Encode(operator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return account, pub, token
+	}
+	_, systemPub, systemJWT := newAccount("SYS")
+	account, accountPub, accountJWT := newAccount("EDP")
+
+	// Porta livre para o servidor
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	_, port, _ := net.SplitHostPort(addr)
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "nats-server.conf")
+	conf := fmt.Sprintf(`listen: 127.0.0.1:%s
+operator: %s
+system_account: %s
+resolver: MEMORY
+resolver_preload: {
+  %s: %s
+  %s: %s
+}
+`, port, operatorJWT, systemPub, systemPub, systemJWT, accountPub, accountJWT)
+	if err := os.WriteFile(configFile, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(bin, "-c", configFile)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("nats-server não iniciou: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return "nats://" + addr, account
+}
+
+// permissionErrors recolhe os erros de permissão assíncronos de uma conexão
+type permissionErrors struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (p *permissionErrors) handler(_ *nats.Conn, _ *nats.Subscription, err error) {
+	if errors.Is(err, nats.ErrPermissionViolation) {
+		p.mu.Lock()
+		p.errors = append(p.errors, err.Error())
+		p.mu.Unlock()
+	}
+}
+
+// contains indica se algum erro recolhido refere o subject
+func (p *permissionErrors) contains(subject string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, e := range p.errors {
+		if strings.Contains(e, `"`+subject+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// connectUser liga ao servidor com as credenciais emitidas para o utilizador
+func connectUser(t *testing.T, url string, creds *NatsCredentials, errs *permissionErrors) *nats.Conn {
+	t.Helper()
+	conn, err := nats.Connect(url,
+		nats.UserJWTAndSeed(creds.JWT, creds.Seed),
+		nats.CustomInboxPrefix(creds.PrefixoInbox),
+		nats.ErrorHandler(errs.handler),
+	)
+	if err != nil {
+		t.Fatalf("conexão com credenciais de %s: %v", creds.PrefixoInbox, err)
+	}
+	t.Cleanup(conn.Close)
+	return conn
+}
+
+// TestNatsCredentialsScope verifica num nats-server real que as credenciais de um utilizador sem
+// permissão de escrita não publicam comandos de escrita nem leem as inboxes de outro utilizador
+func TestNatsCredentialsScope(t *testing.T) {
+	url, account := startNatsServer(t)
+	writeSubject := NatsSubjects["tag_write"]
+
+	// Backend: credenciais de serviço da mesma conta, responde aos comandos de escrita
+	service, err := nats.Connect(url, natsServiceAuth(account, time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	commands := make(chan string, 10)
+	if _, err := service.Subscribe(writeSubject, func(msg *nats.Msg) {
+		commands <- string(msg.Data)
+		msg.Respond([]byte("ok"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	service.Flush()
+
+	operador, err := issueNatsCredentials(account, &models.Utilizador{ID: 1, Nome: "operador"}, true, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	visualizador, err := issueNatsCredentials(account, &models.Utilizador{ID: 2, Nome: "visualizador"}, false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	operadorErrs, visualizadorErrs := &permissionErrors{}, &permissionErrors{}
+	operadorConn := connectUser(t, url, operador, operadorErrs)
+	visualizadorConn := connectUser(t, url, visualizador, visualizadorErrs)
+
+	// O visualizador tenta ler as inboxes do operador, com o prefixo dele e com o padrão
+	spied := make(chan string, 10)
+	for _, subject := range []string{operador.PrefixoInbox + ".>", "_INBOX.>"} {
+		if _, err := visualizadorConn.Subscribe(subject, func(msg *nats.Msg) {
+			spied <- msg.Subject
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// O visualizador tenta publicar um comando de escrita
+	if err := visualizadorConn.Publish(writeSubject, []byte("visualizador")); err != nil {
+		t.Fatal(err)
+	}
+	visualizadorConn.Flush()
+
+	// O operador escreve e recebe a resposta na sua inbox
+	reply, err := operadorConn.Request(writeSubject, []byte("operador"), 2*time.Second)
+	if err != nil {
+		t.Fatalf("pedido do operador sem resposta: %v", err)
+	}
+	if string(reply.Data) != "ok" {
+		t.Errorf("resposta = %q", reply.Data)
+	}
+	if !strings.HasPrefix(reply.Subject, operador.PrefixoInbox+".") {
+		t.Errorf("resposta em %s, fora da inbox do operador", reply.Subject)
+	}
+
+	// Dar tempo ao servidor para entregar mensagens indevidas e erros assíncronos
+	time.Sleep(200 * time.Millisecond)
+
+	select {
+	case command := <-commands:
+		if command != "operador" {
+			t.Errorf("comando do visualizador entregue: %q", command)
+		}
+	default:
+		t.Error("comando do operador não entregue")
+	}
+	select {
+	case command := <-commands:
+		t.Errorf("comando inesperado entregue: %q", command)
+	default:
+	}
+
+	select {
+	case subject := <-spied:
+		t.Errorf("visualizador leu a resposta ao operador em %s", subject)
+	default:
+	}
+
+	if !visualizadorErrs.contains(writeSubject) {
+		t.Errorf("publicação do visualizador em %s sem violação de permissão", writeSubject)
+	}
+	for _, subject := range []string{operador.PrefixoInbox + ".>", "_INBOX.>"} {
+		if !visualizadorErrs.contains(subject) {
+			t.Errorf("assinatura do visualizador em %s sem violação de permissão", subject)
+		}
+	}
+	if len(operadorErrs.errors) > 0 {
+		t.Errorf("erros de permissão do operador: %v", operadorErrs.errors)
+	}
+}
+
+// TestNatsServiceCredentials verifica que as credenciais do backend se limitam aos subjects que
+// publica e assina, e que são emitidas de novo quando o servidor fecha a conexão por expiração
+func TestNatsServiceCredentials(t *testing.T) {
+	url, account := startNatsServer(t)
+
+	errs := &permissionErrors{}
+	reconnected := make(chan struct{}, 1)
+	service, err := nats.Connect(url,
+		natsServiceAuth(account, 2*time.Second),
+		nats.ReconnectWait(100*time.Millisecond),
+		nats.MaxReconnects(-1),
+		nats.ErrorHandler(errs.handler),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			select {
+			case reconnected <- struct{}{}:
+			default:
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer service.Close()
+
+	operador, err := issueNatsCredentials(account, &models.Utilizador{ID: 1, Nome: "operador"}, true, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	operadorConn := connectUser(t, url, operador, &permissionErrors{})
+
+	updates := make(chan string, 10)
+	if _, err := operadorConn.Subscribe(NatsSubjects["plc_status"]+".>", func(msg *nats.Msg) {
+		updates <- msg.Subject
+	}); err != nil {
+		t.Fatal(err)
+	}
+	operadorConn.Flush()
+
+	// Subjects fora das listas do backend são recusados pelo servidor
+	service.Publish("outro.subject", []byte("x"))
+	service.Subscribe("_INBOX.>", func(*nats.Msg) {})
+	service.Flush()
+
+	// Os comandos de escrita são assinados e respondidos na inbox de quem pediu
+	if _, err := service.Subscribe(NatsSubjects["tag_write"], func(msg *nats.Msg) {
+		msg.Respond([]byte("ok"))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	service.Flush()
+	if _, err := operadorConn.Request(NatsSubjects["tag_write"], []byte("{}"), 2*time.Second); err != nil {
+		t.Errorf("resposta do backend não entregue: %v", err)
+	}
+
+	publishStatus := func() {
+		t.Helper()
+		if err := service.Publish(NatsSubjects["plc_status"]+".1", []byte("{}")); err != nil {
+			t.Fatal(err)
+		}
+		service.Flush()
+		select {
+		case <-updates:
+		case <-time.After(2 * time.Second):
+			t.Error("estado publicado pelo backend não entregue")
+		}
+	}
+	publishStatus()
+
+	time.Sleep(200 * time.Millisecond)
+	for _, subject := range []string{"outro.subject", "_INBOX.>"} {
+		if !errs.contains(subject) {
+			t.Errorf("%s sem violação de permissão", subject)
+		}
+	}
+
+	// Ao expirar, o servidor fecha a conexão e o backend volta a ligar com credenciais novas
+	select {
+	case <-reconnected:
+	case <-time.After(10 * time.Second):
+		t.Fatal("backend não reconectou após a expiração das credenciais")
+	}
+	publishStatus()
+}
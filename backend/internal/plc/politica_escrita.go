@@ -0,0 +1,175 @@
+package plc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+)
+
+// Permissão que autoriza a escrita em tags por comandos NATS
+const (
+	PermissaoModuloPLC    = "PLC"
+	PermissaoAcaoEscrever = "Escrever"
+)
+
+// WriteContext identifica quem pede uma escrita e por que via
+type WriteContext struct {
+	UtilizadorID   uint
+	NomeUtilizador string
+	Perfil         string
+	Origem         string // IP do pedido HTTP ou "NATS"
+}
+
+// WriteRejectedError indica que a escrita foi recusada pela política de escrita da tag
+type WriteRejectedError struct {
+	Motivo string
+}
+
+func (e *WriteRejectedError) Error() string {
+	return "escrita recusada: " + e.Motivo
+}
+
+// validateTagWritePolicy verifica a configuração da política de escrita da tag
+func validateTagWritePolicy(tag *Tag) error {
+	hasLimits := tag.EscritaMin != nil || tag.EscritaMax != nil || tag.TaxaMaxima != nil
+	if hasLimits && !isTipoNumerico(tag.Tipo) {
+		return fmt.Errorf("limites de escrita só são suportados em tags numéricas, não em %s", tag.Tipo)
+	}
+	if tag.EscritaMin != nil && tag.EscritaMax != nil && *tag.EscritaMin > *tag.EscritaMax {
+		return fmt.Errorf("escrita_min não pode ser maior que escrita_max")
+	}
+	if tag.TaxaMaxima != nil && *tag.TaxaMaxima <= 0 {
+		return fmt.Errorf("taxa_maxima deve ser maior que zero")
+	}
+	return nil
+}
+
+// allowedValues retorna a lista de valores permitidos da tag, vazia se não houver restrição
+func allowedValues(tag *Tag) []string {
+	if tag.ValoresPermitidos == nil {
+		return nil
+	}
+
+	var values []string
+	for _, v := range strings.Split(*tag.ValoresPermitidos, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// checkWritePolicy verifica se a escrita do valor (em unidades de engenharia) é permitida
+func checkWritePolicy(tag *Tag, value interface{}, wc WriteContext, now time.Time) error {
+	if err := checkWriteLimits(tag, value, wc); err != nil {
+		return err
+	}
+	return checkWriteRate(tag, value, now)
+}
+
+// checkWriteLimits verifica a política de escrita da tag exceto a taxa máxima: permissões,
+// valores permitidos e limites mínimo e máximo
+func checkWriteLimits(tag *Tag, value interface{}, wc WriteContext) error {
+	if !tag.Gravavel {
+		return &WriteRejectedError{Motivo: "tag não é gravável"}
+	}
+
+	// Administradores podem escrever em qualquer tag gravável
+	if tag.PerfilEscrita != nil && *tag.PerfilEscrita != "" &&
+		wc.Perfil != *tag.PerfilEscrita && wc.Perfil != "Administrador" {
+		return &WriteRejectedError{Motivo: fmt.Sprintf("requer perfil %s", *tag.PerfilEscrita)}
+	}
+
+	if values := allowedValues(tag); len(values) > 0 {
+		allowed := false
+		for _, v := range values {
+			if valuesEqual(v, value) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &WriteRejectedError{Motivo: fmt.Sprintf("valor %v não está entre os permitidos (%s)", value, *tag.ValoresPermitidos)}
+		}
+	}
+
+	if tag.EscritaMin == nil && tag.EscritaMax == nil {
+		return nil
+	}
+
+	number, err := toFloat64(value)
+	if err != nil {
+		return &WriteRejectedError{Motivo: fmt.Sprintf("valor não numérico: %v", value)}
+	}
+
+	if tag.EscritaMin != nil && number < *tag.EscritaMin {
+		return &WriteRejectedError{Motivo: fmt.Sprintf("valor %v abaixo do mínimo %v", number, *tag.EscritaMin)}
+	}
+	if tag.EscritaMax != nil && number > *tag.EscritaMax {
+		return &WriteRejectedError{Motivo: fmt.Sprintf("valor %v acima do máximo %v", number, *tag.EscritaMax)}
+	}
+
+	return nil
+}
+
+// checkWriteRate verifica a taxa máxima de variação da tag em relação ao último valor
+func checkWriteRate(tag *Tag, value interface{}, now time.Time) error {
+	if tag.TaxaMaxima == nil {
+		return nil
+	}
+
+	number, err := toFloat64(value)
+	if err != nil {
+		return &WriteRejectedError{Motivo: fmt.Sprintf("valor não numérico: %v", value)}
+	}
+
+	current, err := toFloat64(tag.UltimoValor)
+	if err != nil {
+		return &WriteRejectedError{Motivo: "valor atual desconhecido, não é possível verificar a taxa máxima"}
+	}
+
+	// Sem escrita anterior conta como um segundo, limitando o primeiro passo a taxa_maxima
+	elapsed := 1.0
+	if !tag.UltimaEscrita.IsZero() {
+		elapsed = math.Max(1, now.Sub(tag.UltimaEscrita).Seconds())
+	}
+
+	if step := math.Abs(number - current); step > *tag.TaxaMaxima*elapsed {
+		return &WriteRejectedError{Motivo: fmt.Sprintf("variação de %v excede a taxa máxima de %v/s", step, *tag.TaxaMaxima)}
+	}
+
+	return nil
+}
+
+// valuesEqual compara um valor permitido (texto) com o valor pedido, numericamente quando possível
+func valuesEqual(allowed string, value interface{}) bool {
+	if number, err := toFloat64(value); err == nil {
+		if a, err := strconv.ParseFloat(allowed, 64); err == nil {
+			return a == number
+		}
+	}
+	return strings.EqualFold(allowed, fmt.Sprintf("%v", value))
+}
+
+// auditWriteRejected regista no log de auditoria uma escrita recusada
+func auditWriteRejected(plc *PLC, tag *Tag, value interface{}, wc WriteContext, err error) {
+	models.RegistrarAuditoria(
+		wc.UtilizadorID,
+		wc.NomeUtilizador,
+		"Escrita Recusada",
+		"Tag",
+		wc.Origem,
+		map[string]interface{}{
+			"plc_id":    plc.ID,
+			"tag_id":    tag.ID,
+			"tag_nome":  tag.Nome,
+			"valor":     value,
+			"motivo":    err.Error(),
+			"timestamp": time.Now(),
+		},
+	)
+}
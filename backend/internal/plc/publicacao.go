@@ -0,0 +1,99 @@
+package plc
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// validateTagConfig executa todas as validações de configuração da tag para o PLC indicado.
+// As tags referidas por tags virtuais são procuradas em db, que pode ser uma transação em curso.
+func validateTagConfig(db *gorm.DB, tag *Tag, plc *PLC) error {
+	if isVirtualTag(tag) {
+		if err := validateVirtualTag(db, tag); err != nil {
+			return err
+		}
+	} else if err := validateTagArea(tag, plcProtocolo(plc)); err != nil {
+		return err
+	}
+	if err := validateTagScaling(tag); err != nil {
+		return err
+	}
+	if err := validateTagDeadband(tag); err != nil {
+		return err
+	}
+	if err := validateTagHistorian(tag); err != nil {
+		return err
+	}
+	return validateTagWritePolicy(tag)
+}
+
+// validateTagDeadband verifica a banda morta e o intervalo máximo de silêncio da tag
+func validateTagDeadband(tag *Tag) error {
+	if (tag.BandaMorta != nil || tag.BandaMortaPct != nil) && !isTipoNumerico(tag.Tipo) {
+		return fmt.Errorf("banda morta só é suportada em tags numéricas, não em %s", tag.Tipo)
+	}
+	if tag.BandaMorta != nil && *tag.BandaMorta < 0 {
+		return fmt.Errorf("banda_morta não pode ser negativa")
+	}
+	if tag.BandaMortaPct != nil && (*tag.BandaMortaPct < 0 || *tag.BandaMortaPct > 100) {
+		return fmt.Errorf("banda_morta_pct deve estar entre 0 e 100")
+	}
+	if tag.SilencioMaxS < 0 {
+		return fmt.Errorf("silencio_max_s não pode ser negativo")
+	}
+	return nil
+}
+
+// tagDeadband retorna a maior variação que ainda é considerada "sem mudança".
+// A percentagem é relativa à faixa de engenharia quando há escala, ou ao último valor publicado.
+func tagDeadband(tag *Tag, last float64) float64 {
+	band := 0.0
+	if tag.BandaMorta != nil {
+		band = *tag.BandaMorta
+	}
+
+	if tag.BandaMortaPct != nil {
+		reference := math.Abs(last)
+		if hasScaling(tag) {
+			reference = math.Abs(*tag.EngMax - *tag.EngMin)
+		}
+		band = math.Max(band, reference**tag.BandaMortaPct/100)
+	}
+
+	return band
+}
+
+// tagValueChanged indica se o novo valor difere do último publicado além da banda morta
+func tagValueChanged(tag *Tag, value interface{}) bool {
+	return valueExceedsDeadband(tag, tag.UltimoValor, value)
+}
+
+// valueExceedsDeadband indica se o valor difere da referência além da banda morta da tag
+func valueExceedsDeadband(tag *Tag, reference interface{}, value interface{}) bool {
+	if reference == nil {
+		return true
+	}
+
+	if tag.BandaMorta == nil && tag.BandaMortaPct == nil {
+		return reference != value
+	}
+
+	last, errLast := toFloat64(reference)
+	current, errCurrent := toFloat64(value)
+	if errLast != nil || errCurrent != nil {
+		return reference != value
+	}
+
+	return math.Abs(current-last) > tagDeadband(tag, last)
+}
+
+// tagSilenceExpired indica se a tag deve ser republicada por ter atingido o silêncio máximo
+func tagSilenceExpired(tag *Tag, now time.Time) bool {
+	if tag.SilencioMaxS <= 0 || tag.UltimaPublicacao.IsZero() {
+		return false
+	}
+	return now.Sub(tag.UltimaPublicacao) >= time.Duration(tag.SilencioMaxS)*time.Second
+}
@@ -0,0 +1,82 @@
+package plc
+
+import (
+	"time"
+)
+
+// Códigos de qualidade dos valores publicados, no estilo OPC
+const (
+	QualidadeBoa               = "good"            // Valor lido com sucesso dentro do prazo
+	QualidadeFalhaComunicacao  = "bad-comm"        // PLC desconectado ou leitura falhou
+	QualidadeFalhaConfiguracao = "bad-config"      // Tag mal configurada (tipo, endereço ou tamanho)
+	QualidadeIncertaAntiga     = "uncertain-stale" // Última leitura boa mais antiga que o permitido
+)
+
+// setTagQuality altera a qualidade da tag e publica o último valor quando houve transição
+func (m *Manager) setTagQuality(plc *PLC, tag *Tag, qualidade string) {
+	if tag.Qualidade == qualidade {
+		return
+	}
+
+	tag.Qualidade = qualidade
+	tag.UltimaPublicacao = time.Now()
+	if qualidade != QualidadeBoa {
+		m.recordTagQuality(plc, tag, qualidade)
+	}
+	m.publishTagValue(plc, tag, tag.UltimoValor)
+	m.evaluateDependents(tag.ID)
+}
+
+// setPLCTagsQuality altera a qualidade de todas as tags lidas de um PLC.
+// As tags virtuais herdam a qualidade das suas entradas.
+func (m *Manager) setPLCTagsQuality(plc *PLC, qualidade string) {
+	for _, tag := range plc.tagList() {
+		if isVirtualTag(tag) {
+			continue
+		}
+		m.setTagQuality(plc, tag, qualidade)
+	}
+}
+
+// tagStaleAfter retorna a idade a partir da qual o valor de uma tag é considerado antigo
+func tagStaleAfter(tag *Tag) time.Duration {
+	return time.Duration(float64(tagInterval(tag)) * Config.StaleMultiplier)
+}
+
+// monitorStaleTags marca periodicamente como antigas as tags sem leitura boa recente
+func (m *Manager) monitorStaleTags() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(Config.StaleCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case now := <-ticker.C:
+			m.mutex.RLock()
+			plcs := make([]*PLC, 0, len(m.plcs))
+			for _, plc := range m.plcs {
+				plcs = append(plcs, plc)
+			}
+			m.mutex.RUnlock()
+
+			for _, plc := range plcs {
+				// Com o PLC desconectado as tags já estão em bad-comm
+				if !plc.Conectado {
+					continue
+				}
+
+				for _, tag := range plc.tagList() {
+					if isVirtualTag(tag) || tag.Qualidade != QualidadeBoa || tag.UltimaLeituraBoa.IsZero() {
+						continue
+					}
+					if now.Sub(tag.UltimaLeituraBoa) > tagStaleAfter(tag) {
+						m.setTagQuality(plc, tag, QualidadeIncertaAntiga)
+					}
+				}
+			}
+		}
+	}
+}
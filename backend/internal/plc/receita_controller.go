@@ -0,0 +1,510 @@
+package plc
+
+import (
+	"strconv"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// RecipeController gerencia endpoints da API para receitas
+type RecipeController struct {
+	manager *Manager
+}
+
+// NewRecipeController cria um novo controlador de receitas
+func NewRecipeController(manager *Manager) *RecipeController {
+	return &RecipeController{
+		manager: manager,
+	}
+}
+
+// recipePayload é o corpo aceite na criação e atualização de receitas
+type recipePayload struct {
+	Nome      string  `json:"nome"`
+	Descricao *string `json:"descricao"`
+	Ativo     *bool   `json:"ativo"`
+	TagIDs    []uint  `json:"tag_ids"` // Tags pela ordem de escrita
+}
+
+// writeContextFromCtx monta o contexto de escrita a partir do utilizador autenticado
+func writeContextFromCtx(ctx *fiber.Ctx) WriteContext {
+	return WriteContext{
+		UtilizadorID:   ctx.Locals("user_id").(uint),
+		NomeUtilizador: ctx.Locals("user_name").(string),
+		Perfil:         ctx.Locals("user_profile").(string),
+		Origem:         ctx.IP(),
+	}
+}
+
+// recipeTags converte a lista de IDs nas tags da receita, verificando que existem e não se repetem
+func recipeTags(ids []uint) ([]ReceitaTag, error) {
+	if len(ids) == 0 {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "A receita deve ter pelo menos uma tag")
+	}
+
+	seen := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Tag repetida na receita: "+strconv.Itoa(int(id)))
+		}
+		seen[id] = true
+	}
+
+	var count int64
+	if err := config.DB.Model(&Tag{}).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if int(count) != len(ids) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Uma ou mais tags não existem")
+	}
+
+	tags := make([]ReceitaTag, len(ids))
+	for i, id := range ids {
+		tags[i] = ReceitaTag{TagID: id, Ordem: i}
+	}
+	return tags, nil
+}
+
+// GetAllRecipes retorna todas as receitas com as suas tags
+func (c *RecipeController) GetAllRecipes(ctx *fiber.Ctx) error {
+	var receitas []Receita
+	result := config.DB.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("ordem, id")
+	}).Order("nome").Find(&receitas)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao obter receitas",
+			"erro":     result.Error.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   receitas,
+		"total":   len(receitas),
+	})
+}
+
+// GetRecipeByID retorna uma receita com as suas tags e a lista de versões (sem valores)
+func (c *RecipeController) GetRecipeByID(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var receita Receita
+	result := config.DB.
+		Preload("Tags", func(db *gorm.DB) *gorm.DB { return db.Order("ordem, id") }).
+		Preload("Tags.Tag").
+		Preload("Versoes", func(db *gorm.DB) *gorm.DB { return db.Order("versao DESC") }).
+		First(&receita, id)
+	if result.Error != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Receita não encontrada",
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   receita,
+	})
+}
+
+// CreateRecipe cria uma nova definição de receita
+func (c *RecipeController) CreateRecipe(ctx *fiber.Ctx) error {
+	var payload recipePayload
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Formato de solicitação inválido",
+			"erro":     err.Error(),
+		})
+	}
+
+	if payload.Nome == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Nome da receita é obrigatório",
+		})
+	}
+
+	tags, err := recipeTags(payload.TagIDs)
+	if err != nil {
+		return recipeError(ctx, err)
+	}
+
+	receita := Receita{
+		Nome:      payload.Nome,
+		Descricao: payload.Descricao,
+		Ativo:     payload.Ativo == nil || *payload.Ativo,
+		Tags:      tags,
+	}
+
+	if err := config.DB.Create(&receita).Error; err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao criar receita",
+			"erro":     err.Error(),
+		})
+	}
+
+	models.RegistrarAuditoria(
+		ctx.Locals("user_id").(uint),
+		ctx.Locals("user_name").(string),
+		"Criar",
+		"Receita",
+		ctx.IP(),
+		map[string]interface{}{
+			"id":      receita.ID,
+			"nome":    receita.Nome,
+			"tag_ids": payload.TagIDs,
+		},
+	)
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Receita criada com sucesso",
+		"dados":    receita,
+	})
+}
+
+// UpdateRecipe atualiza nome, descrição, estado e tags de uma receita.
+// As versões existentes mantêm-se; as que não cobrirem as novas tags deixam de poder ser enviadas.
+func (c *RecipeController) UpdateRecipe(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var receita Receita
+	if err := config.DB.First(&receita, id).Error; err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Receita não encontrada",
+		})
+	}
+
+	var payload recipePayload
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Formato de solicitação inválido",
+			"erro":     err.Error(),
+		})
+	}
+
+	if payload.Nome != "" {
+		receita.Nome = payload.Nome
+	}
+	if payload.Descricao != nil {
+		receita.Descricao = payload.Descricao
+	}
+	if payload.Ativo != nil {
+		receita.Ativo = *payload.Ativo
+	}
+
+	var tags []ReceitaTag
+	if payload.TagIDs != nil {
+		if tags, err = recipeTags(payload.TagIDs); err != nil {
+			return recipeError(ctx, err)
+		}
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags", "Versoes").Save(&receita).Error; err != nil {
+			return err
+		}
+		if tags == nil {
+			return nil
+		}
+		if err := tx.Where("receita_id = ?", receita.ID).Delete(&ReceitaTag{}).Error; err != nil {
+			return err
+		}
+		for i := range tags {
+			tags[i].ReceitaID = receita.ID
+		}
+		return tx.Create(&tags).Error
+	})
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao atualizar receita",
+			"erro":     err.Error(),
+		})
+	}
+
+	models.RegistrarAuditoria(
+		ctx.Locals("user_id").(uint),
+		ctx.Locals("user_name").(string),
+		"Atualizar",
+		"Receita",
+		ctx.IP(),
+		map[string]interface{}{
+			"id":      receita.ID,
+			"nome":    receita.Nome,
+			"ativo":   receita.Ativo,
+			"tag_ids": payload.TagIDs,
+		},
+	)
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Receita atualizada com sucesso",
+		"dados":    receita,
+	})
+}
+
+// DeleteRecipe exclui uma receita com as suas tags e versões
+func (c *RecipeController) DeleteRecipe(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var receita Receita
+	if err := config.DB.First(&receita, id).Error; err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Receita não encontrada",
+		})
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		versoes := tx.Model(&ReceitaVersao{}).Select("id").Where("receita_id = ?", receita.ID)
+		if err := tx.Where("versao_id IN (?)", versoes).Delete(&ReceitaValor{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("receita_id = ?", receita.ID).Delete(&ReceitaVersao{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("receita_id = ?", receita.ID).Delete(&ReceitaTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&receita).Error
+	})
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao excluir receita",
+			"erro":     err.Error(),
+		})
+	}
+
+	models.RegistrarAuditoria(
+		ctx.Locals("user_id").(uint),
+		ctx.Locals("user_name").(string),
+		"Excluir",
+		"Receita",
+		ctx.IP(),
+		map[string]interface{}{
+			"id":   receita.ID,
+			"nome": receita.Nome,
+		},
+	)
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Receita excluída com sucesso",
+	})
+}
+
+// GetRecipeVersion retorna os valores de uma versão da receita (0 = mais recente)
+func (c *RecipeController) GetRecipeVersion(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	versao, err := strconv.Atoi(ctx.Params("versao"))
+	if err != nil || versao < 0 {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Versão inválida",
+		})
+	}
+
+	_, v, err := loadRecipeVersion(uint(id), versao)
+	if err != nil {
+		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso": true,
+		"dados":   v,
+	})
+}
+
+// CreateRecipeVersion cria uma nova versão com os valores indicados
+func (c *RecipeController) CreateRecipeVersion(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var payload struct {
+		Descricao *string        `json:"descricao"`
+		Valores   []ReceitaValor `json:"valores"`
+	}
+	if err := ctx.BodyParser(&payload); err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Formato de solicitação inválido",
+			"erro":     err.Error(),
+		})
+	}
+
+	wc := writeContextFromCtx(ctx)
+	v, err := CreateRecipeVersion(uint(id), payload.Valores, payload.Descricao, wc)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao criar versão da receita",
+			"erro":     err.Error(),
+		})
+	}
+
+	models.RegistrarAuditoria(
+		wc.UtilizadorID,
+		wc.NomeUtilizador,
+		"Criar Versão",
+		"Receita",
+		wc.Origem,
+		map[string]interface{}{
+			"receita_id": id,
+			"versao":     v.Versao,
+			"valores":    v.Valores,
+		},
+	)
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Versão criada com sucesso",
+		"dados":    v,
+	})
+}
+
+// UploadRecipe lê os valores atuais do PLC e grava-os como uma nova versão da receita
+func (c *RecipeController) UploadRecipe(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	var payload struct {
+		Descricao *string `json:"descricao"`
+	}
+	// Corpo opcional
+	_ = ctx.BodyParser(&payload)
+
+	v, err := c.manager.UploadRecipe(uint(id), payload.Descricao, writeContextFromCtx(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao capturar valores da receita",
+			"erro":     err.Error(),
+		})
+	}
+
+	return ctx.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Valores capturados com sucesso",
+		"dados":    v,
+	})
+}
+
+// DownloadRecipe escreve no PLC os valores de uma versão da receita (versao 0 ou omitida = mais recente)
+func (c *RecipeController) DownloadRecipe(ctx *fiber.Ctx) error {
+	id, err := strconv.ParseUint(ctx.Params("id"), 10, 32)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "ID inválido",
+		})
+	}
+
+	// O envio escreve nas tags do PLC: requer a mesma permissão que a escrita por comandos NATS
+	allowed, err := canWriteTags(ctx.Locals("user_profile").(string))
+	if err != nil {
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao verificar permissões",
+			"erro":     err.Error(),
+		})
+	}
+	if !allowed {
+		return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Utilizador sem permissão para escrever em tags",
+		})
+	}
+
+	var payload struct {
+		Versao int `json:"versao"`
+	}
+	// Corpo opcional
+	_ = ctx.BodyParser(&payload)
+
+	result, err := c.manager.DownloadRecipe(uint(id), payload.Versao, writeContextFromCtx(ctx))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Erro ao enviar receita",
+			"erro":     err.Error(),
+		})
+	}
+
+	if !result.Sucesso {
+		return ctx.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": "Envio da receita falhou; valores anteriores repostos",
+			"dados":    result,
+		})
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(fiber.Map{
+		"sucesso":  true,
+		"mensagem": "Receita enviada com sucesso",
+		"dados":    result,
+	})
+}
+
+// recipeError converte erros de validação (fiber.Error) e de banco de dados em respostas
+func recipeError(ctx *fiber.Ctx, err error) error {
+	if fe, ok := err.(*fiber.Error); ok {
+		return ctx.Status(fe.Code).JSON(fiber.Map{
+			"sucesso":  false,
+			"mensagem": fe.Message,
+		})
+	}
+	return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"sucesso":  false,
+		"mensagem": "Erro ao validar tags da receita",
+		"erro":     err.Error(),
+	})
+}
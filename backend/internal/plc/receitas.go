@@ -0,0 +1,442 @@
+package plc
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Receita representa um conjunto nomeado de tags cujos valores são enviados ao PLC numa única operação
+type Receita struct {
+	ID        uint            `json:"id" gorm:"primaryKey"`
+	Nome      string          `json:"nome" gorm:"size:100;not null;uniqueIndex"`
+	Descricao *string         `json:"descricao" gorm:"type:text"`
+	Ativo     bool            `json:"ativo" gorm:"not null;default:true"`
+	Tags      []ReceitaTag    `json:"tags" gorm:"foreignKey:ReceitaID"`
+	Versoes   []ReceitaVersao `json:"versoes,omitempty" gorm:"foreignKey:ReceitaID"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// ReceitaTag associa uma tag à definição da receita, na ordem de escrita
+type ReceitaTag struct {
+	ID        uint `json:"id" gorm:"primaryKey"`
+	ReceitaID uint `json:"receita_id" gorm:"not null;uniqueIndex:idx_receita_tag"`
+	TagID     uint `json:"tag_id" gorm:"not null;uniqueIndex:idx_receita_tag"`
+	Ordem     int  `json:"ordem" gorm:"not null;default:0"`
+	Tag       *Tag `json:"tag,omitempty" gorm:"foreignKey:TagID"`
+}
+
+// ReceitaVersao é um conjunto imutável de valores para as tags de uma receita
+type ReceitaVersao struct {
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	ReceitaID     uint           `json:"receita_id" gorm:"not null;uniqueIndex:idx_receita_versao"`
+	Versao        int            `json:"versao" gorm:"not null;uniqueIndex:idx_receita_versao"`
+	Descricao     *string        `json:"descricao" gorm:"type:text"`
+	Origem        string         `json:"origem" gorm:"size:20;not null"` // manual ou upload
+	CriadoPor     uint           `json:"criado_por"`
+	CriadoPorNome string         `json:"criado_por_nome" gorm:"size:100"`
+	Valores       []ReceitaValor `json:"valores,omitempty" gorm:"foreignKey:VersaoID"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+// ReceitaValor é o valor de uma tag numa versão da receita, em unidades de engenharia
+type ReceitaValor struct {
+	ID        uint        `json:"id" gorm:"primaryKey"`
+	VersaoID  uint        `json:"versao_id" gorm:"not null;index"`
+	TagID     uint        `json:"tag_id" gorm:"not null"`
+	ValorJSON string      `json:"-" gorm:"column:valor;type:jsonb;not null"`
+	Valor     interface{} `json:"valor" gorm:"-"`
+}
+
+// Origens de uma versão de receita
+const (
+	OrigemReceitaManual = "manual" // Valores indicados pelo utilizador
+	OrigemReceitaUpload = "upload" // Valores lidos do PLC
+)
+
+// TableName define o nome da tabela para Receita
+func (Receita) TableName() string {
+	return "receitas"
+}
+
+// TableName define o nome da tabela para ReceitaTag
+func (ReceitaTag) TableName() string {
+	return "receita_tags"
+}
+
+// TableName define o nome da tabela para ReceitaVersao
+func (ReceitaVersao) TableName() string {
+	return "receita_versoes"
+}
+
+// TableName define o nome da tabela para ReceitaValor
+func (ReceitaValor) TableName() string {
+	return "receita_valores"
+}
+
+// BeforeSave serializa o valor para a coluna jsonb
+func (v *ReceitaValor) BeforeSave(tx *gorm.DB) error {
+	data, err := json.Marshal(v.Valor)
+	if err != nil {
+		return err
+	}
+	v.ValorJSON = string(data)
+	return nil
+}
+
+// AfterFind desserializa o valor da coluna jsonb
+func (v *ReceitaValor) AfterFind(tx *gorm.DB) error {
+	return json.Unmarshal([]byte(v.ValorJSON), &v.Valor)
+}
+
+// RecipeStepResult é o resultado da escrita de uma tag durante o download de uma receita
+type RecipeStepResult struct {
+	TagID      uint        `json:"tag_id"`
+	TagNome    string      `json:"tag_nome"`
+	Valor      interface{} `json:"valor"`
+	Lido       interface{} `json:"lido"`     // Valor lido após a escrita
+	Anterior   interface{} `json:"anterior"` // Valor antes do download
+	Sucesso    bool        `json:"sucesso"`
+	Restaurado bool        `json:"restaurado"` // Valor anterior reposto após falha do download
+	Erro       string      `json:"erro,omitempty"`
+	ErroRepor  string      `json:"erro_repor,omitempty"` // Motivo da falha ao repor o valor anterior
+}
+
+// RecipeDownloadResult é o resultado do download de uma versão de receita
+type RecipeDownloadResult struct {
+	ReceitaID uint               `json:"receita_id"`
+	Receita   string             `json:"receita"`
+	Versao    int                `json:"versao"`
+	Sucesso   bool               `json:"sucesso"`
+	Passos    []RecipeStepResult `json:"passos"`
+}
+
+// findActiveTag procura uma tag nos PLCs geridos
+func (m *Manager) findActiveTag(tagID uint) (*PLC, *Tag) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, plc := range m.plcs {
+		if tag := plc.findTag(tagID); tag != nil {
+			return plc, tag
+		}
+	}
+	return nil, nil
+}
+
+// validateRecipeValue verifica se o valor pode ser escrito na tag, convertendo-o como na escrita real
+func validateRecipeValue(tag *Tag, value interface{}) error {
+	if value == nil {
+		return fmt.Errorf("valor em falta")
+	}
+	raw, err := unscaleValue(tag, value)
+	if err != nil {
+		return err
+	}
+	_, err = encodeTagValue(tag, raw)
+	return err
+}
+
+// recipeValueTolerance retorna a diferença aceite entre o valor escrito e o lido,
+// tendo em conta a resolução da escala, o arredondamento e a precisão de Real
+func recipeValueTolerance(tag *Tag, expected float64) float64 {
+	tolerance := 1e-9
+	if tag.Tipo == "Real" {
+		tolerance = math.Max(tolerance, math.Abs(expected)*1e-6)
+	}
+	if hasScaling(tag) && tag.Tipo != "Real" && tag.Tipo != "LReal" {
+		step := math.Abs((*tag.EngMax - *tag.EngMin) / (*tag.BrutoMax - *tag.BrutoMin))
+		tolerance = math.Max(tolerance, step/2+1e-9)
+	}
+	if tag.Precisao != nil {
+		tolerance = math.Max(tolerance, math.Pow(10, -float64(*tag.Precisao))/2+1e-9)
+	}
+	return tolerance
+}
+
+// recipeValueMatches compara o valor pedido com o valor lido do PLC
+func recipeValueMatches(tag *Tag, expected, actual interface{}) bool {
+	e, errE := toFloat64(expected)
+	a, errA := toFloat64(actual)
+	if errE == nil && errA == nil {
+		return math.Abs(e-a) <= recipeValueTolerance(tag, e)
+	}
+	return fmt.Sprintf("%v", expected) == fmt.Sprintf("%v", actual)
+}
+
+// loadRecipeVersion carrega a receita e a versão indicada (0 = mais recente) com os valores
+func loadRecipeVersion(receitaID uint, versao int) (*Receita, *ReceitaVersao, error) {
+	var receita Receita
+	if err := config.DB.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("ordem, id")
+	}).First(&receita, receitaID).Error; err != nil {
+		return nil, nil, fmt.Errorf("receita não encontrada")
+	}
+
+	query := config.DB.Preload("Valores").Where("receita_id = ?", receitaID)
+	if versao > 0 {
+		query = query.Where("versao = ?", versao)
+	} else {
+		query = query.Order("versao DESC")
+	}
+
+	var v ReceitaVersao
+	if err := query.First(&v).Error; err != nil {
+		return nil, nil, fmt.Errorf("versão da receita não encontrada")
+	}
+
+	return &receita, &v, nil
+}
+
+// DownloadRecipe escreve no PLC os valores de uma versão da receita, pela ordem da definição.
+// Todos os valores são validados antes da primeira escrita; cada escrita passa pela política
+// de escrita da tag e é verificada por leitura. Se uma escrita ou verificação falhar, os valores
+// já escritos são repostos (em melhor esforço) e o download é dado como falhado.
+func (m *Manager) DownloadRecipe(receitaID uint, versao int, wc WriteContext) (*RecipeDownloadResult, error) {
+	receita, v, err := loadRecipeVersion(receitaID, versao)
+	if err != nil {
+		return nil, err
+	}
+	if !receita.Ativo {
+		return nil, fmt.Errorf("receita inativa")
+	}
+
+	valores := make(map[uint]interface{}, len(v.Valores))
+	for _, valor := range v.Valores {
+		valores[valor.TagID] = valor.Valor
+	}
+
+	result := &RecipeDownloadResult{
+		ReceitaID: receita.ID,
+		Receita:   receita.Nome,
+		Versao:    v.Versao,
+	}
+
+	// Validar todos os valores antes de escrever qualquer um
+	type step struct {
+		plc   *PLC
+		tag   *Tag
+		value interface{}
+	}
+	var steps []step
+	var invalid []string
+
+	for _, rt := range receita.Tags {
+		value, ok := valores[rt.TagID]
+		if !ok {
+			invalid = append(invalid, fmt.Sprintf("tag %d: sem valor na versão %d", rt.TagID, v.Versao))
+			continue
+		}
+
+		plc, tag := m.findActiveTag(rt.TagID)
+		if tag == nil {
+			invalid = append(invalid, fmt.Sprintf("tag %d: não está ativa em nenhum PLC", rt.TagID))
+			continue
+		}
+		if !plc.Conectado {
+			invalid = append(invalid, fmt.Sprintf("tag %s: PLC %s não está conectado", tag.Nome, plc.Nome))
+			continue
+		}
+		if err := validateRecipeValue(tag, value); err != nil {
+			invalid = append(invalid, fmt.Sprintf("tag %s: %v", tag.Nome, err))
+			continue
+		}
+		if err := checkWritePolicy(tag, value, wc, time.Now()); err != nil {
+			invalid = append(invalid, fmt.Sprintf("tag %s: %v", tag.Nome, err))
+			continue
+		}
+
+		steps = append(steps, step{plc: plc, tag: tag, value: value})
+	}
+
+	if len(invalid) > 0 {
+		auditRecipeDownload(receita, v, wc, false, invalid)
+		return nil, fmt.Errorf("valores inválidos: %v", invalid)
+	}
+
+	// Escrever e verificar cada valor
+	result.Sucesso = true
+	for _, s := range steps {
+		r := RecipeStepResult{
+			TagID:   s.tag.ID,
+			TagNome: s.tag.Nome,
+			Valor:   s.value,
+		}
+
+		if r.Anterior, _, err = m.ReadTag(s.plc.ID, s.tag.ID); err != nil {
+			r.Erro = fmt.Sprintf("falha ao ler valor anterior: %v", err)
+		} else if err = m.WriteTag(s.plc.ID, s.tag.ID, s.value, wc); err != nil {
+			r.Erro = err.Error()
+		} else if r.Lido, _, err = m.ReadTag(s.plc.ID, s.tag.ID); err != nil {
+			r.Erro = fmt.Sprintf("falha na verificação: %v", err)
+		} else if !recipeValueMatches(s.tag, s.value, r.Lido) {
+			r.Erro = fmt.Sprintf("verificação falhou: escrito %v, lido %v", s.value, r.Lido)
+		} else {
+			r.Sucesso = true
+		}
+
+		result.Passos = append(result.Passos, r)
+		if !r.Sucesso {
+			result.Sucesso = false
+			break
+		}
+	}
+
+	// Repor os valores anteriores das tags já alteradas, da última para a primeira
+	if !result.Sucesso {
+		for i := len(result.Passos) - 1; i >= 0; i-- {
+			r := &result.Passos[i]
+			if r.Anterior == nil {
+				continue
+			}
+			if err := m.restoreTag(steps[i].plc.ID, r.TagID, r.Anterior, wc); err != nil {
+				r.ErroRepor = err.Error()
+			} else {
+				r.Restaurado = true
+			}
+		}
+	}
+
+	auditRecipeDownload(receita, v, wc, result.Sucesso, result.Passos)
+	return result, nil
+}
+
+// auditRecipeDownload regista o download de uma receita no log de auditoria
+func auditRecipeDownload(receita *Receita, v *ReceitaVersao, wc WriteContext, sucesso bool, detalhes interface{}) {
+	models.RegistrarAuditoria(
+		wc.UtilizadorID,
+		wc.NomeUtilizador,
+		"Download Receita",
+		"Receita",
+		wc.Origem,
+		map[string]interface{}{
+			"receita_id": receita.ID,
+			"receita":    receita.Nome,
+			"versao":     v.Versao,
+			"sucesso":    sucesso,
+			"detalhes":   detalhes,
+			"timestamp":  time.Now(),
+		},
+	)
+}
+
+// UploadRecipe lê do PLC os valores atuais das tags da receita e grava-os como uma nova versão
+func (m *Manager) UploadRecipe(receitaID uint, descricao *string, wc WriteContext) (*ReceitaVersao, error) {
+	var receita Receita
+	if err := config.DB.Preload("Tags").First(&receita, receitaID).Error; err != nil {
+		return nil, fmt.Errorf("receita não encontrada")
+	}
+
+	valores := make([]ReceitaValor, 0, len(receita.Tags))
+	for _, rt := range receita.Tags {
+		plc, tag := m.findActiveTag(rt.TagID)
+		if tag == nil {
+			return nil, fmt.Errorf("tag %d não está ativa em nenhum PLC", rt.TagID)
+		}
+
+		value, _, err := m.ReadTag(plc.ID, tag.ID)
+		if err != nil {
+			return nil, fmt.Errorf("falha ao ler tag %s: %v", tag.Nome, err)
+		}
+		valores = append(valores, ReceitaValor{TagID: tag.ID, Valor: value})
+	}
+
+	v, err := createRecipeVersion(&receita, valores, descricao, OrigemReceitaUpload, wc)
+	if err != nil {
+		return nil, err
+	}
+
+	models.RegistrarAuditoria(
+		wc.UtilizadorID,
+		wc.NomeUtilizador,
+		"Upload Receita",
+		"Receita",
+		wc.Origem,
+		map[string]interface{}{
+			"receita_id": receita.ID,
+			"receita":    receita.Nome,
+			"versao":     v.Versao,
+			"valores":    valores,
+		},
+	)
+
+	return v, nil
+}
+
+// CreateRecipeVersion valida os valores indicados contra o tipo de cada tag e grava-os como uma nova versão
+func CreateRecipeVersion(receitaID uint, valores []ReceitaValor, descricao *string, wc WriteContext) (*ReceitaVersao, error) {
+	var receita Receita
+	if err := config.DB.Preload("Tags.Tag").First(&receita, receitaID).Error; err != nil {
+		return nil, fmt.Errorf("receita não encontrada")
+	}
+
+	// Reconstruir a lista para ignorar IDs enviados pelo cliente
+	byTag := make(map[uint]interface{}, len(valores))
+	for _, v := range valores {
+		byTag[v.TagID] = v.Valor
+	}
+	valores = make([]ReceitaValor, 0, len(byTag))
+	for _, rt := range receita.Tags {
+		if value, ok := byTag[rt.TagID]; ok {
+			valores = append(valores, ReceitaValor{TagID: rt.TagID, Valor: value})
+		}
+	}
+	if len(byTag) != len(receita.Tags) || len(valores) != len(receita.Tags) {
+		return nil, fmt.Errorf("a versão deve ter exatamente um valor para cada uma das %d tags da receita", len(receita.Tags))
+	}
+
+	for _, rt := range receita.Tags {
+		value, ok := byTag[rt.TagID]
+		if !ok {
+			return nil, fmt.Errorf("falta o valor da tag %d", rt.TagID)
+		}
+		if rt.Tag == nil {
+			return nil, fmt.Errorf("tag %d não encontrada", rt.TagID)
+		}
+		if err := validateRecipeValue(rt.Tag, value); err != nil {
+			return nil, fmt.Errorf("tag %s: %v", rt.Tag.Nome, err)
+		}
+	}
+
+	return createRecipeVersion(&receita, valores, descricao, OrigemReceitaManual, wc)
+}
+
+// createRecipeVersion grava uma nova versão com o número seguinte ao da última
+func createRecipeVersion(receita *Receita, valores []ReceitaValor, descricao *string, origem string, wc WriteContext) (*ReceitaVersao, error) {
+	v := &ReceitaVersao{
+		ReceitaID:     receita.ID,
+		Descricao:     descricao,
+		Origem:        origem,
+		CriadoPor:     wc.UtilizadorID,
+		CriadoPorNome: wc.NomeUtilizador,
+		Valores:       valores,
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Bloquear a receita para numerar as versões sem colisões
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&Receita{}, receita.ID).Error; err != nil {
+			return err
+		}
+
+		var last int
+		if err := tx.Model(&ReceitaVersao{}).Where("receita_id = ?", receita.ID).
+			Select("COALESCE(MAX(versao), 0)").Scan(&last).Error; err != nil {
+			return err
+		}
+		v.Versao = last + 1
+
+		return tx.Create(v).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("falha ao gravar versão da receita: %v", err)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,109 @@
+package plc
+
+import (
+	"fmt"
+)
+
+// Áreas de memória do S7 suportadas pelas tags
+const (
+	AreaDB             = "DB" // Data blocks
+	AreaEntradas       = "I"  // Imagem de processo das entradas
+	AreaSaidas         = "Q"  // Imagem de processo das saídas
+	AreaMarcadores     = "M"  // Merkers
+	AreaTemporizadores = "T"  // Temporizadores S5
+	AreaContadores     = "C"  // Contadores S5
+)
+
+// AreasTagSuportadas lista as áreas de memória aceites no campo Area da tag
+var AreasTagSuportadas = []string{
+	AreaDB, AreaEntradas, AreaSaidas, AreaMarcadores, AreaTemporizadores, AreaContadores,
+}
+
+// Códigos de área e de comprimento de palavra do protocolo S7 (os da gos7 não são exportados)
+const (
+	s7AreaPE = 0x81
+	s7AreaPA = 0x82
+	s7AreaMK = 0x83
+	s7AreaDB = 0x84
+	s7AreaCT = 0x1C
+	s7AreaTM = 0x1D
+
+	s7WLCounter = 0x1C
+	s7WLTimer   = 0x1D
+)
+
+// tagArea retorna a área da tag, assumindo DB para registos antigos sem área
+func tagArea(tag *Tag) string {
+	if tag.Area == "" {
+		return AreaDB
+	}
+	return tag.Area
+}
+
+// isElementArea indica se a área é endereçada por número de elemento (temporizadores e contadores)
+func isElementArea(area string) bool {
+	return area == AreaTemporizadores || area == AreaContadores
+}
+
+// tagBufferOffset retorna a posição da tag no espaço de bytes lido da área.
+// Temporizadores, contadores e registos Modbus ocupam 2 bytes por elemento e são endereçados pelo número.
+func tagBufferOffset(tag *Tag) int {
+	area := tagArea(tag)
+	if isElementArea(area) || isRegisterArea(area) {
+		return tag.ByteOffset * 2
+	}
+	return tag.ByteOffset
+}
+
+// defaultTagArea retorna a área assumida para tags criadas sem área
+func defaultTagArea(plc *PLC) string {
+	if plcProtocolo(plc) == ProtocoloModbus {
+		return AreaHoldingRegisters
+	}
+	return AreaDB
+}
+
+// validateTagArea verifica se a área e o tipo da tag são compatíveis com o protocolo do PLC
+func validateTagArea(tag *Tag, protocolo string) error {
+	if protocolo == ProtocoloModbus {
+		return validateModbusTagArea(tag)
+	}
+
+	if tag.OrdemPalavras != "" && tag.OrdemPalavras != OrdemABCD {
+		return fmt.Errorf("ordem_palavras só é válida para registos Modbus")
+	}
+
+	area := tagArea(tag)
+
+	valid := false
+	for _, a := range AreasTagSuportadas {
+		if a == area {
+			valid = true
+			break
+		}
+	}
+	if !valid {
+		return fmt.Errorf("área de memória não suportada: %s", area)
+	}
+
+	switch area {
+	case AreaTemporizadores:
+		if tag.Tipo != "S5Time" && tag.Tipo != "Word" {
+			return fmt.Errorf("tags na área T devem ser do tipo S5Time ou Word")
+		}
+	case AreaContadores:
+		if tag.Tipo != "Counter" && tag.Tipo != "Word" {
+			return fmt.Errorf("tags na área C devem ser do tipo Counter ou Word")
+		}
+	default:
+		if tag.Tipo == "Counter" {
+			return fmt.Errorf("o tipo Counter só é válido na área C")
+		}
+	}
+
+	if area != AreaDB && tag.DBNumber != 0 {
+		return fmt.Errorf("db_number só é válido para a área DB")
+	}
+
+	return nil
+}
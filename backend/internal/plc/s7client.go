@@ -2,8 +2,9 @@ package plc
 
 import (
 	"fmt"
-	"math" // Para conversão de float32
-	"time"
+	"net"
+	"regexp"
+	"strconv"
 
 	"github.com/robinson/gos7"
 )
@@ -14,20 +15,121 @@ type S7Client struct {
 	plc       *PLC
 	handler   *gos7.TCPClientHandler
 	conectado bool
+	status    driverStatus
 }
 
-// NewS7Client cria um novo S7Client
+// Tipos de conexão S7 (primeiro byte do TSAP remoto)
+const (
+	TipoConexaoPG    = "PG"
+	TipoConexaoOP    = "OP"
+	TipoConexaoBasic = "BASIC"
+)
+
+// TiposConexaoS7 lista os valores aceites no campo TipoConexao do PLC
+var TiposConexaoS7 = []string{TipoConexaoPG, TipoConexaoOP, TipoConexaoBasic}
+
+// TSAP local usado pela gos7 quando não é configurado
+const defaultLocalTSAP = 0x0100
+
+// s7ConnectionType converte o tipo de conexão do PLC no código usado no TSAP remoto
+func s7ConnectionType(plc *PLC) int {
+	switch plc.TipoConexao {
+	case TipoConexaoOP:
+		return 2
+	case TipoConexaoBasic:
+		return 3
+	}
+	return 1 // PG
+}
+
+// subredeS7Pattern valida o ID de sub-rede S7 no formato mostrado pelo STEP 7 (ex.: 0052-0001)
+var subredeS7Pattern = regexp.MustCompile(`^[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}$`)
+
+// s7Endpoint retorna o endereço TCP a usar. Com gateway configurado a conexão TCP é feita ao gateway:
+// sem sub-rede S7 o gateway apenas substitui o ip_address (router NAT, IE/PB Link com TSAP próprio);
+// com sub-rede S7 o gateway encaminha a conexão para o nó de destino (ver s7Routing).
+func s7Endpoint(plc *PLC) string {
+	host := plc.IPAddress
+	if plc.Gateway != nil && *plc.Gateway != "" {
+		host = *plc.Gateway
+	}
+	if plc.Porta > 0 {
+		return fmt.Sprintf("%s:%d", host, plc.Porta)
+	}
+	return host
+}
+
+// validateS7Conexao verifica os parâmetros de conexão S7 do PLC
+func validateS7Conexao(plc *PLC) error {
+	switch plc.TipoConexao {
+	case "", TipoConexaoPG, TipoConexaoOP, TipoConexaoBasic:
+	default:
+		return fmt.Errorf("tipo_conexao inválido: %s (válidos: %v)", plc.TipoConexao, TiposConexaoS7)
+	}
+
+	if plc.Rack < 0 || plc.Rack > 7 {
+		return fmt.Errorf("rack deve estar entre 0 e 7")
+	}
+	if plc.Slot < 0 || plc.Slot > 31 {
+		return fmt.Errorf("slot deve estar entre 0 e 31")
+	}
+	if plc.LocalTSAP != nil && (*plc.LocalTSAP <= 0 || *plc.LocalTSAP > 0xFFFF) {
+		return fmt.Errorf("local_tsap deve estar entre 0x0001 e 0xFFFF")
+	}
+	if plc.RemoteTSAP != nil && (*plc.RemoteTSAP <= 0 || *plc.RemoteTSAP > 0xFFFF) {
+		return fmt.Errorf("remote_tsap deve estar entre 0x0001 e 0xFFFF")
+	}
+	if plc.SubredeS7 != nil {
+		if !subredeS7Pattern.MatchString(*plc.SubredeS7) {
+			return fmt.Errorf("subrede_s7 deve ter o formato XXXX-XXXX em hexadecimal (ex.: 0052-0001)")
+		}
+		if plc.Gateway == nil || *plc.Gateway == "" {
+			return fmt.Errorf("o encaminhamento S7 (subrede_s7) requer o gateway")
+		}
+		if plc.EnderecoMPI == nil && net.ParseIP(plc.IPAddress).To4() == nil {
+			return fmt.Errorf("o destino do encaminhamento S7 é o ip_address, que deve ser um endereço IPv4, ou o endereco_mpi")
+		}
+	}
+	if plc.EnderecoMPI != nil {
+		if plc.SubredeS7 == nil {
+			return fmt.Errorf("endereco_mpi só é usado com encaminhamento S7 (subrede_s7)")
+		}
+		if *plc.EnderecoMPI < 0 || *plc.EnderecoMPI > 126 {
+			return fmt.Errorf("endereco_mpi deve estar entre 0 e 126")
+		}
+	}
+	// A gos7 pede sempre uma PDU de 480 bytes; a preferida só pode reduzir o valor negociado
+	if plc.PDUPreferida != 0 && (plc.PDUPreferida < 240 || plc.PDUPreferida > 960) {
+		return fmt.Errorf("pdu_preferida deve estar entre 240 e 960 bytes (0 = negociada)")
+	}
+
+	return nil
+}
+
+// NewS7Client cria um novo S7Client com os parâmetros de conexão do PLC
 func NewS7Client(plc *PLC) (*S7Client, error) {
-	handler := gos7.NewTCPClientHandler(plc.IPAddress, plc.Rack, plc.Slot)
-	handler.Timeout = 5 * time.Second
-	handler.IdleTimeout = 10 * time.Second
-
-	// Se você precisa usar o gateway, descomente o código abaixo
-	/*
-		if plc.Gateway != nil {
-			handler.Gateway = *plc.Gateway
+	if err := validateS7Conexao(plc); err != nil {
+		return nil, err
+	}
+
+	// O TSAP remoto é tipo<<8 + rack*0x20 + slot, salvo se for configurado explicitamente
+	remoteTSAP := s7ConnectionType(plc)<<8 + plc.Rack*0x20 + plc.Slot
+	if plc.RemoteTSAP != nil {
+		remoteTSAP = *plc.RemoteTSAP
+	}
+	localTSAP := defaultLocalTSAP
+	if plc.LocalTSAP != nil {
+		localTSAP = *plc.LocalTSAP
+	}
+
+	handler := gos7.NewTCPClientHandlerWithConnectType(s7Endpoint(plc), plc.Rack, plc.Slot, remoteTSAP>>8)
+	handler.SetConnectionParams(uint16(localTSAP), uint16(remoteTSAP))
+
+	if subnetID, destination, ok := s7Routing(plc); ok {
+		if err := handler.SetRouting(subnetID, destination); err != nil {
+			return nil, err
 		}
-	*/
+	}
 
 	client := gos7.NewClient(handler)
 
@@ -38,16 +140,34 @@ func NewS7Client(plc *PLC) (*S7Client, error) {
 	}, nil
 }
 
+// s7Routing retorna o ID da sub-rede S7 e o endereço do nó de destino do encaminhamento:
+// o endereço MPI/PROFIBUS quando configurado, senão o ip_address do PLC
+func s7Routing(plc *PLC) (uint32, []byte, bool) {
+	if plc.SubredeS7 == nil || plc.Gateway == nil || *plc.Gateway == "" {
+		return 0, nil, false
+	}
+
+	// O formato já foi validado: duas words em hexadecimal separadas por hífen
+	high, _ := strconv.ParseUint((*plc.SubredeS7)[:4], 16, 16)
+	low, _ := strconv.ParseUint((*plc.SubredeS7)[5:], 16, 16)
+	subnetID := uint32(high)<<16 | uint32(low)
+
+	if plc.EnderecoMPI != nil {
+		return subnetID, []byte{byte(*plc.EnderecoMPI)}, true
+	}
+	return subnetID, net.ParseIP(plc.IPAddress).To4(), true
+}
+
 // Connect estabelece uma conexão com o CLP
 func (s *S7Client) Connect() error {
-	// Usar o timeout da configuração
-	s.handler.Timeout = Config.ConnectionTimeout
-	s.handler.IdleTimeout = Config.ConnectionTimeout * 2
+	s.handler.Timeout = plcTimeout(s.plc)
+	s.handler.IdleTimeout = plcIdleTimeout(s.plc)
 
 	err := s.handler.Connect()
+	s.status.record(err)
 	if err != nil {
 		s.conectado = false
-		return fmt.Errorf("falha ao conectar com PLC %s em %s: %v", s.plc.Nome, s.plc.IPAddress, err)
+		return fmt.Errorf("falha ao conectar com PLC %s em %s: %v", s.plc.Nome, s.handler.Address, err)
 	}
 	s.conectado = true
 	return nil
@@ -70,83 +190,91 @@ func (s *S7Client) ReadTag(tag *Tag) (interface{}, error) {
 		return nil, fmt.Errorf("não conectado ao PLC")
 	}
 
-	var buffer []byte
-	var result interface{}
-	var err error
+	return readTagWith(s, tag)
+}
 
-	switch tag.Tipo {
-	case "Bool":
-		buffer = make([]byte, 1)
-		err = s.client.AGReadDB(tag.DBNumber, tag.ByteOffset, 1, buffer)
-		if err != nil {
-			return nil, err
-		}
+// ReadBytes lê uma faixa contígua de bytes de uma área numa única operação.
+// Para temporizadores e contadores, start e size referem-se ao espaço de 2 bytes por elemento.
+func (s *S7Client) ReadBytes(area string, dbNumber int, start int, size int) ([]byte, error) {
+	if !s.conectado {
+		return nil, fmt.Errorf("não conectado ao PLC")
+	}
 
-		if tag.BitOffset != nil {
-			// Extrair o bit
-			result = (buffer[0] & (1 << uint(*tag.BitOffset))) > 0
-		} else {
-			result = buffer[0] > 0
-		}
+	buffer := make([]byte, size)
+	var err error
 
-	case "Int":
-		buffer = make([]byte, 2)
-		err = s.client.AGReadDB(tag.DBNumber, tag.ByteOffset, 2, buffer)
-		if err != nil {
-			return nil, err
+	switch area {
+	case AreaDB:
+		err = s.client.AGReadDB(dbNumber, start, size, buffer)
+	case AreaEntradas:
+		err = s.client.AGReadEB(start, size, buffer)
+	case AreaSaidas:
+		err = s.client.AGReadAB(start, size, buffer)
+	case AreaMarcadores:
+		err = s.client.AGReadMB(start, size, buffer)
+	case AreaTemporizadores, AreaContadores:
+		// AGReadTM/AGReadCT da gos7 truncam cada elemento para um byte,
+		// por isso lemos através de uma requisição multi-item com o comprimento correto
+		item := gos7.S7DataItem{
+			Area:    s7AreaTM,
+			WordLen: s7WLTimer,
+			Start:   start / 2,
+			Amount:  size / 2,
+			Data:    buffer,
 		}
-		// Converter os bytes para int16 (big endian)
-		result = int16(uint16(buffer[0])<<8 | uint16(buffer[1]))
-
-	case "Word":
-		buffer = make([]byte, 2)
-		err = s.client.AGReadDB(tag.DBNumber, tag.ByteOffset, 2, buffer)
-		if err != nil {
-			return nil, err
+		if area == AreaContadores {
+			item.Area = s7AreaCT
+			item.WordLen = s7WLCounter
 		}
-		// Converter os bytes para uint16 (big endian)
-		result = uint16(buffer[0])<<8 | uint16(buffer[1])
 
-	case "Real":
-		buffer = make([]byte, 4)
-		err = s.client.AGReadDB(tag.DBNumber, tag.ByteOffset, 4, buffer)
-		if err != nil {
-			return nil, err
-		}
-		// Converter para float32 usando a função auxiliar
-		result = s.byteToFloat32(buffer)
-
-	case "String":
-		// Para strings, precisamos ler o comprimento primeiro e depois a string em si
-		lengthBuffer := make([]byte, 2)
-		err = s.client.AGReadDB(tag.DBNumber, tag.ByteOffset, 2, lengthBuffer)
-		if err != nil {
-			return nil, err
+		items := []gos7.S7DataItem{item}
+		err = s.client.AGReadMulti(items, 1)
+		if err == nil && items[0].Error != "" {
+			err = fmt.Errorf("%s", items[0].Error)
 		}
+	default:
+		return nil, fmt.Errorf("área de memória não suportada: %s", area)
+	}
 
-		maxLength := int(lengthBuffer[0])
-		actualLength := int(lengthBuffer[1])
+	s.status.record(err)
+	if err != nil {
+		return nil, err
+	}
 
-		if actualLength > maxLength {
-			actualLength = maxLength
-		}
+	return buffer, nil
+}
 
-		if actualLength > 0 {
-			stringBuffer := make([]byte, actualLength)
-			err = s.client.AGReadDB(tag.DBNumber, tag.ByteOffset+2, actualLength, stringBuffer)
-			if err != nil {
-				return nil, err
-			}
-			result = string(stringBuffer)
-		} else {
-			result = ""
-		}
+// writeBytes escreve uma faixa contígua de bytes numa área
+func (s *S7Client) writeBytes(area string, dbNumber int, start int, buffer []byte) error {
+	switch area {
+	case AreaDB:
+		return s.client.AGWriteDB(dbNumber, start, len(buffer), buffer)
+	case AreaEntradas:
+		return s.client.AGWriteEB(start, len(buffer), buffer)
+	case AreaSaidas:
+		return s.client.AGWriteAB(start, len(buffer), buffer)
+	case AreaMarcadores:
+		return s.client.AGWriteMB(start, len(buffer), buffer)
+	case AreaTemporizadores, AreaContadores:
+		return fmt.Errorf("escrita em temporizadores e contadores não é suportada")
+	}
+	return fmt.Errorf("área de memória não suportada: %s", area)
+}
 
-	default:
-		return nil, fmt.Errorf("tipo de tag não suportado: %s", tag.Tipo)
+// MaxBlockSize retorna o maior número de bytes que cabe na resposta de uma única PDU,
+// limitado pela PDU preferida do PLC quando configurada
+func (s *S7Client) MaxBlockSize() int {
+	pdu := s.handler.PDULength
+	if s.plc.PDUPreferida > 0 && (pdu == 0 || s.plc.PDUPreferida < pdu) {
+		pdu = s.plc.PDUPreferida
 	}
 
-	return result, nil
+	// 18 bytes = cabeçalho do telegrama de resposta de leitura
+	if pdu > 18 {
+		return pdu - 18
+	}
+	// PDU mínima garantida por qualquer CPU S7 (240 bytes)
+	return 240 - 18
 }
 
 // WriteTag escreve um valor em uma tag no CLP
@@ -155,130 +283,17 @@ func (s *S7Client) WriteTag(tag *Tag, value interface{}) error {
 		return fmt.Errorf("não conectado ao PLC")
 	}
 
-	var buffer []byte
-	var err error
-
-	switch tag.Tipo {
-	case "Bool":
-		buffer = make([]byte, 1)
-
-		// Se temos um deslocamento de bit, precisamos ler o valor atual primeiro
-		if tag.BitOffset != nil {
-			err = s.client.AGReadDB(tag.DBNumber, tag.ByteOffset, 1, buffer)
-			if err != nil {
-				return err
-			}
-
-			if val, ok := value.(bool); ok {
-				if val {
-					// Setar o bit
-					buffer[0] |= (1 << uint(*tag.BitOffset))
-				} else {
-					// Limpar o bit
-					buffer[0] &= ^(1 << uint(*tag.BitOffset))
-				}
-			} else {
-				return fmt.Errorf("valor booleano esperado para tag Bool")
-			}
-		} else {
-			if val, ok := value.(bool); ok {
-				if val {
-					buffer[0] = 1
-				} else {
-					buffer[0] = 0
-				}
-			} else {
-				return fmt.Errorf("valor booleano esperado para tag Bool")
-			}
-		}
-
-		err = s.client.AGWriteDB(tag.DBNumber, tag.ByteOffset, 1, buffer)
-
-	case "Int":
-		buffer = make([]byte, 2)
-		if val, ok := value.(int); ok {
-			// Converter para big endian
-			buffer[0] = byte(int16(val) >> 8)
-			buffer[1] = byte(int16(val))
-		} else if val, ok := value.(int16); ok {
-			// Converter para big endian
-			buffer[0] = byte(val >> 8)
-			buffer[1] = byte(val)
-		} else {
-			return fmt.Errorf("valor inteiro esperado para tag Int")
-		}
-		err = s.client.AGWriteDB(tag.DBNumber, tag.ByteOffset, 2, buffer)
-
-	case "Word":
-		buffer = make([]byte, 2)
-		if val, ok := value.(uint); ok {
-			// Converter para big endian
-			buffer[0] = byte(uint16(val) >> 8)
-			buffer[1] = byte(uint16(val))
-		} else if val, ok := value.(uint16); ok {
-			// Converter para big endian
-			buffer[0] = byte(val >> 8)
-			buffer[1] = byte(val)
-		} else {
-			return fmt.Errorf("valor unsigned esperado para tag Word")
-		}
-		err = s.client.AGWriteDB(tag.DBNumber, tag.ByteOffset, 2, buffer)
-
-	case "Real":
-		buffer = make([]byte, 4)
-		if val, ok := value.(float32); ok {
-			buffer = s.float32ToByte(val)
-		} else if val, ok := value.(float64); ok {
-			buffer = s.float32ToByte(float32(val))
-		} else {
-			return fmt.Errorf("valor float esperado para tag Real")
-		}
-		err = s.client.AGWriteDB(tag.DBNumber, tag.ByteOffset, 4, buffer)
-
-	case "String":
-		if val, ok := value.(string); ok {
-			maxLength := tag.Tamanho
-			actualLength := len(val)
-
-			if actualLength > maxLength {
-				actualLength = maxLength
-			}
-
-			buffer = make([]byte, 2+actualLength)
-			buffer[0] = byte(maxLength)
-			buffer[1] = byte(actualLength)
-
-			copy(buffer[2:], val)
-
-			err = s.client.AGWriteDB(tag.DBNumber, tag.ByteOffset, 2+actualLength, buffer)
-		} else {
-			return fmt.Errorf("valor string esperado para tag String")
-		}
-
-	default:
-		return fmt.Errorf("tipo de tag não suportado: %s", tag.Tipo)
+	buffer, err := encodeTagWrite(s, tag, value)
+	if err != nil {
+		return err
 	}
 
+	err = s.writeBytes(tagArea(tag), tag.DBNumber, tag.ByteOffset, buffer)
+	s.status.record(err)
 	return err
 }
 
-// float32ToByte converte float32 para bytes (IEEE 754)
-func (s *S7Client) float32ToByte(value float32) []byte {
-	bits := math.Float32bits(value)
-	bytes := make([]byte, 4)
-
-	// Big endian (Siemens)
-	bytes[0] = byte(bits >> 24)
-	bytes[1] = byte(bits >> 16)
-	bytes[2] = byte(bits >> 8)
-	bytes[3] = byte(bits)
-
-	return bytes
-}
-
-// byteToFloat32 converte bytes (IEEE 754) para float32
-func (s *S7Client) byteToFloat32(bytes []byte) float32 {
-	// Big endian (Siemens)
-	bits := uint32(bytes[0])<<24 | uint32(bytes[1])<<16 | uint32(bytes[2])<<8 | uint32(bytes[3])
-	return math.Float32frombits(bits)
+// Health retorna um resumo do estado da conexão S7
+func (s *S7Client) Health() DriverHealth {
+	return s.status.health("s7", s.conectado)
 }
@@ -0,0 +1,204 @@
+package plc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// serveS7Handshake aceita uma conexão, devolve o pedido de conexão ISO recebido e responde
+// à negociação da PDU com 240 bytes, como uma CPU S7
+func serveS7Handshake(listener net.Listener, requests chan<- []byte) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	readTelegram := func() []byte {
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return nil
+		}
+		telegram := make([]byte, binary.BigEndian.Uint16(header[2:]))
+		copy(telegram, header)
+		if _, err := io.ReadFull(conn, telegram[4:]); err != nil {
+			return nil
+		}
+		return telegram
+	}
+
+	request := readTelegram()
+	requests <- request
+	if request == nil {
+		return
+	}
+
+	// Connection confirm (0xD0)
+	cc := make([]byte, 22)
+	copy(cc, []byte{3, 0, 0, 22, 17, 0xD0, 0, 1, 0, 1, 0})
+	conn.Write(cc)
+
+	if readTelegram() == nil {
+		return
+	}
+	conn.Write([]byte{
+		3, 0, 0, 27, 2, 0xF0, 0x80,
+		0x32, 3, 0, 0, 0, 0, 0, 8, 0, 0, 0, 0, // Cabeçalho S7 sem erro
+		0xF0, 0, 0, 1, 0, 1, 0, 240, // Setup communication com PDU de 240 bytes
+	})
+	io.Copy(io.Discard, conn)
+}
+
+// TestS7ConnectionRequest captura o pedido de conexão ISO enviado ao PLC e verifica os TSAP
+// e os parâmetros de encaminhamento S7
+func TestS7ConnectionRequest(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	strPtr := func(v string) *string { return &v }
+
+	// connectionRequest monta o pedido esperado a partir do TSAP local e do TSAP remoto
+	connectionRequest := func(local []byte, remote ...byte) []byte {
+		cr := []byte{3, 0, 0, 0, 0, 0xE0, 0, 0, 0, 1, 0, 0xC0, 1, 10, 0xC1, 2}
+		cr = append(cr, local...)
+		cr = append(cr, 0xC2, byte(len(remote)))
+		cr = append(cr, remote...)
+		cr[3] = byte(len(cr))
+		cr[4] = byte(len(cr) - 5)
+		return cr
+	}
+
+	tests := []struct {
+		name    string
+		plc     PLC
+		request []byte
+	}{
+		{
+			name:    "PG no rack 0, slot 2",
+			plc:     PLC{Rack: 0, Slot: 2},
+			request: connectionRequest([]byte{0x01, 0x00}, 0x01, 0x02),
+		},
+		{
+			name:    "OP com TSAP local configurado",
+			plc:     PLC{TipoConexao: TipoConexaoOP, Rack: 1, Slot: 3, LocalTSAP: intPtr(0x1000)},
+			request: connectionRequest([]byte{0x10, 0x00}, 0x02, 0x23),
+		},
+		{
+			name:    "TSAP remoto explícito",
+			plc:     PLC{RemoteTSAP: intPtr(0x4D57), LocalTSAP: intPtr(0x4D57)},
+			request: connectionRequest([]byte{0x4D, 0x57}, 0x4D, 0x57),
+		},
+		{
+			name: "encaminhamento para o IP do PLC",
+			plc: PLC{
+				IPAddress: "192.168.10.5", Slot: 2, SubredeS7: strPtr("0052-0001"),
+			},
+			request: connectionRequest([]byte{0x01, 0x00},
+				0x01, 0x02, 0x00, 0x52, 0x00, 0x00, 0x00, 0x01, 4, 192, 168, 10, 5),
+		},
+		{
+			name: "encaminhamento para um nó PROFIBUS",
+			plc: PLC{
+				TipoConexao: TipoConexaoBasic, Slot: 2, SubredeS7: strPtr("00A1-0B02"), EnderecoMPI: intPtr(4),
+			},
+			request: connectionRequest([]byte{0x01, 0x00},
+				0x03, 0x02, 0x00, 0xA1, 0x00, 0x00, 0x0B, 0x02, 1, 4),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+
+			requests := make(chan []byte, 1)
+			go serveS7Handshake(listener, requests)
+
+			plc := tt.plc
+			plc.Nome = "eclusa"
+			plc.Porta = listener.Addr().(*net.TCPAddr).Port
+			if plc.SubredeS7 != nil {
+				// O endereço TCP é o do gateway; o ip_address é o destino do encaminhamento
+				plc.Gateway = strPtr("127.0.0.1")
+			} else {
+				plc.IPAddress = "127.0.0.1"
+			}
+
+			client, err := NewS7Client(&plc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := client.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer client.Disconnect()
+
+			if request := <-requests; !bytes.Equal(request, tt.request) {
+				t.Errorf("pedido de conexão:\n  obtido   % X\n  esperado % X", request, tt.request)
+			}
+			if size := client.MaxBlockSize(); size != 240-18 {
+				t.Errorf("MaxBlockSize = %d, esperado %d (PDU negociada de 240 bytes)", size, 240-18)
+			}
+		})
+	}
+}
+
+func TestValidateS7Routing(t *testing.T) {
+	intPtr := func(v int) *int { return &v }
+	strPtr := func(v string) *string { return &v }
+
+	tests := []struct {
+		name string
+		plc  PLC
+		err  string
+	}{
+		{
+			name: "encaminhamento para IP",
+			plc:  PLC{IPAddress: "10.0.0.5", Gateway: strPtr("10.0.1.1"), SubredeS7: strPtr("0052-0001")},
+		},
+		{
+			name: "encaminhamento para MPI",
+			plc:  PLC{IPAddress: "plc-mpi", Gateway: strPtr("10.0.1.1"), SubredeS7: strPtr("0052-0001"), EnderecoMPI: intPtr(2)},
+		},
+		{
+			name: "sub-rede mal formatada",
+			plc:  PLC{IPAddress: "10.0.0.5", Gateway: strPtr("10.0.1.1"), SubredeS7: strPtr("52-1")},
+			err:  "XXXX-XXXX",
+		},
+		{
+			name: "sub-rede sem gateway",
+			plc:  PLC{IPAddress: "10.0.0.5", SubredeS7: strPtr("0052-0001")},
+			err:  "requer o gateway",
+		},
+		{
+			name: "destino sem IPv4 nem MPI",
+			plc:  PLC{IPAddress: "plc-mpi", Gateway: strPtr("10.0.1.1"), SubredeS7: strPtr("0052-0001")},
+			err:  "IPv4",
+		},
+		{
+			name: "MPI sem encaminhamento",
+			plc:  PLC{IPAddress: "10.0.0.5", EnderecoMPI: intPtr(2)},
+			err:  "só é usado com encaminhamento",
+		},
+		{
+			name: "MPI fora dos limites",
+			plc:  PLC{IPAddress: "10.0.0.5", Gateway: strPtr("10.0.1.1"), SubredeS7: strPtr("0052-0001"), EnderecoMPI: intPtr(127)},
+			err:  "entre 0 e 126",
+		},
+	}
+
+	for _, tt := range tests {
+		err := validateS7Conexao(&tt.plc)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: erro inesperado: %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: erro = %v, esperado %q", tt.name, err, tt.err)
+		}
+	}
+}
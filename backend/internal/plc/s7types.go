@@ -0,0 +1,546 @@
+package plc
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// TiposTagSuportados lista os tipos de dados S7 que podem ser lidos e escritos
+var TiposTagSuportados = []string{
+	"Bool", "Byte", "Char", "Int", "Word", "DInt", "DWord", "UDInt",
+	"Real", "LReal", "Time", "Date", "TOD", "DTL", "DATE_AND_TIME",
+	"String", "WString", "S5Time", "Counter",
+}
+
+// Formatos usados para representar datas e horas do PLC em JSON (hora local do PLC, sem fuso)
+const (
+	formatoData     = "2006-01-02"
+	formatoHora     = "15:04:05.000"
+	formatoDataHora = "2006-01-02T15:04:05.000"
+)
+
+// Época do tipo DATE do S7
+var epocaDateS7 = time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// IsTipoTagSuportado indica se o tipo de tag pode ser lido e escrito
+func IsTipoTagSuportado(tipo string) bool {
+	for _, t := range TiposTagSuportados {
+		if t == tipo {
+			return true
+		}
+	}
+	return false
+}
+
+// tagByteSize retorna quantos bytes a tag ocupa no DB (0 para tipos não suportados)
+func tagByteSize(tag *Tag) int {
+	switch tag.Tipo {
+	case "Bool", "Byte", "Char":
+		return 1
+	case "Int", "Word", "Date", "S5Time", "Counter":
+		return 2
+	case "DInt", "DWord", "UDInt", "Real", "Time", "TOD":
+		return 4
+	case "LReal", "DATE_AND_TIME":
+		return 8
+	case "DTL":
+		return 12
+	case "String":
+		// Tamanho é o comprimento máximo declarado; 2 bytes de cabeçalho (máximo e atual)
+		return 2 + stringMaxLength(tag)
+	case "WString":
+		// 4 bytes de cabeçalho (máximo e atual) e 2 bytes por caractere
+		return 4 + 2*wstringMaxLength(tag)
+	}
+	return 0
+}
+
+// stringMaxLength retorna o comprimento máximo de uma tag String
+func stringMaxLength(tag *Tag) int {
+	if tag.Tamanho <= 0 || tag.Tamanho > 254 {
+		return 254
+	}
+	return tag.Tamanho
+}
+
+// wstringMaxLength retorna o comprimento máximo de uma tag WString
+func wstringMaxLength(tag *Tag) int {
+	if tag.Tamanho <= 0 || tag.Tamanho > 16382 {
+		return 254
+	}
+	return tag.Tamanho
+}
+
+// errTipoNaoSuportado retorna o erro padrão para tipos de tag desconhecidos
+func errTipoNaoSuportado(tag *Tag) error {
+	return fmt.Errorf("tipo de tag não suportado: %s", tag.Tipo)
+}
+
+// decodeTagValue converte os bytes de uma tag (a partir do seu ByteOffset) no valor Go correspondente
+func decodeTagValue(tag *Tag, buffer []byte) (interface{}, error) {
+	size := tagByteSize(tag)
+	if size == 0 {
+		return nil, errTipoNaoSuportado(tag)
+	}
+
+	// Strings são lidas com o tamanho máximo declarado, o conteúdo real pode ser menor
+	isString := tag.Tipo == "String" || tag.Tipo == "WString"
+	if !isString && len(buffer) < size {
+		return nil, fmt.Errorf("buffer insuficiente para tag %s: %d bytes, esperado %d", tag.Nome, len(buffer), size)
+	}
+	if !isString {
+		buffer = applyWordOrder(tag, buffer[:size])
+	}
+
+	switch tag.Tipo {
+	case "Bool":
+		if tag.BitOffset != nil {
+			// Extrair o bit
+			return (buffer[0] & (1 << uint(*tag.BitOffset))) > 0, nil
+		}
+		return buffer[0] > 0, nil
+
+	case "Byte":
+		return buffer[0], nil
+
+	case "Char":
+		return string(rune(buffer[0])), nil
+
+	case "Int":
+		return int16(binary.BigEndian.Uint16(buffer)), nil
+
+	case "Word":
+		return binary.BigEndian.Uint16(buffer), nil
+
+	case "DInt":
+		return int32(binary.BigEndian.Uint32(buffer)), nil
+
+	case "DWord", "UDInt":
+		return binary.BigEndian.Uint32(buffer), nil
+
+	case "Real":
+		return math.Float32frombits(binary.BigEndian.Uint32(buffer)), nil
+
+	case "LReal":
+		return math.Float64frombits(binary.BigEndian.Uint64(buffer)), nil
+
+	case "Time":
+		// Duração em milissegundos (com sinal)
+		return int32(binary.BigEndian.Uint32(buffer)), nil
+
+	case "S5Time":
+		return int32(decodeS5Time(binary.BigEndian.Uint16(buffer)) / time.Millisecond), nil
+
+	case "Counter":
+		// Valor do contador em BCD (0 a 999)
+		v := binary.BigEndian.Uint16(buffer)
+		return int16(decodeBCD(byte(v>>8)&0x0F)*100 + decodeBCD(byte(v))), nil
+
+	case "Date":
+		days := binary.BigEndian.Uint16(buffer)
+		return epocaDateS7.AddDate(0, 0, int(days)).Format(formatoData), nil
+
+	case "TOD":
+		ms := binary.BigEndian.Uint32(buffer)
+		return time.Date(0, 1, 1, 0, 0, 0, 0, time.UTC).
+			Add(time.Duration(ms) * time.Millisecond).Format(formatoHora), nil
+
+	case "DTL":
+		t := time.Date(
+			int(binary.BigEndian.Uint16(buffer[0:])),
+			time.Month(buffer[2]), int(buffer[3]),
+			int(buffer[5]), int(buffer[6]), int(buffer[7]),
+			int(binary.BigEndian.Uint32(buffer[8:])), time.UTC)
+		return t.Format(formatoDataHora), nil
+
+	case "DATE_AND_TIME":
+		year := decodeBCD(buffer[0])
+		if year < 90 {
+			year += 2000
+		} else {
+			year += 1900
+		}
+		ms := decodeBCD(buffer[6])*10 + int(buffer[7]>>4)
+		t := time.Date(year, time.Month(decodeBCD(buffer[1])), decodeBCD(buffer[2]),
+			decodeBCD(buffer[3]), decodeBCD(buffer[4]), decodeBCD(buffer[5]),
+			ms*int(time.Millisecond), time.UTC)
+		return t.Format(formatoDataHora), nil
+
+	case "String":
+		if len(buffer) < 2 {
+			return nil, fmt.Errorf("buffer insuficiente para tag %s", tag.Nome)
+		}
+
+		actualLength := int(buffer[1])
+		if maxLength := int(buffer[0]); actualLength > maxLength {
+			actualLength = maxLength
+		}
+		if actualLength > len(buffer)-2 {
+			actualLength = len(buffer) - 2
+		}
+
+		return string(buffer[2 : 2+actualLength]), nil
+
+	case "WString":
+		if len(buffer) < 4 {
+			return nil, fmt.Errorf("buffer insuficiente para tag %s", tag.Nome)
+		}
+
+		actualLength := int(binary.BigEndian.Uint16(buffer[2:]))
+		if maxLength := int(binary.BigEndian.Uint16(buffer[0:])); actualLength > maxLength {
+			actualLength = maxLength
+		}
+		if actualLength > (len(buffer)-4)/2 {
+			actualLength = (len(buffer) - 4) / 2
+		}
+
+		chars := make([]uint16, actualLength)
+		for i := range chars {
+			chars[i] = binary.BigEndian.Uint16(buffer[4+2*i:])
+		}
+		return string(utf16.Decode(chars)), nil
+	}
+
+	return nil, errTipoNaoSuportado(tag)
+}
+
+// encodeTagValue converte um valor para os bytes da tag, aplicando a ordem de palavras configurada
+func encodeTagValue(tag *Tag, value interface{}) ([]byte, error) {
+	buffer, err := encodeTagBytes(tag, value)
+	if err != nil {
+		return nil, err
+	}
+	return applyWordOrder(tag, buffer), nil
+}
+
+// encodeTagBytes converte um valor (tipicamente vindo de JSON) nos bytes da tag em big endian.
+// Para Bool retorna um único byte com o valor 0 ou 1; o tratamento de bits é feito por quem escreve.
+func encodeTagBytes(tag *Tag, value interface{}) ([]byte, error) {
+	switch tag.Tipo {
+	case "Bool":
+		val, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("valor booleano esperado para tag Bool")
+		}
+		if val {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+
+	case "Byte":
+		val, err := toInt64(value, 0, math.MaxUint8)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag Byte: %v", err)
+		}
+		return []byte{byte(val)}, nil
+
+	case "Char":
+		val, ok := value.(string)
+		runes := []rune(val)
+		if !ok || len(runes) != 1 || runes[0] > 0xFF {
+			return nil, fmt.Errorf("um único caractere Latin-1 esperado para tag Char")
+		}
+		return []byte{byte(runes[0])}, nil
+
+	case "Int":
+		val, err := toInt64(value, math.MinInt16, math.MaxInt16)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag Int: %v", err)
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(int16(val))), nil
+
+	case "Word":
+		val, err := toInt64(value, 0, math.MaxUint16)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag Word: %v", err)
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(val)), nil
+
+	case "DInt", "Time":
+		val, err := toInt64(value, math.MinInt32, math.MaxInt32)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag %s: %v", tag.Tipo, err)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(val))), nil
+
+	case "DWord", "UDInt":
+		val, err := toInt64(value, 0, math.MaxUint32)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag %s: %v", tag.Tipo, err)
+		}
+		return binary.BigEndian.AppendUint32(nil, uint32(val)), nil
+
+	case "Real":
+		val, err := toFloat64(value)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag Real: %v", err)
+		}
+		return binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(val))), nil
+
+	case "LReal":
+		val, err := toFloat64(value)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag LReal: %v", err)
+		}
+		return binary.BigEndian.AppendUint64(nil, math.Float64bits(val)), nil
+
+	case "S5Time":
+		ms, err := toInt64(value, 0, 9990*1000)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag S5Time: %v", err)
+		}
+		return binary.BigEndian.AppendUint16(nil, encodeS5Time(time.Duration(ms)*time.Millisecond)), nil
+
+	case "Counter":
+		val, err := toInt64(value, 0, 999)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag Counter: %v", err)
+		}
+		return []byte{encodeBCD(int(val / 100)), encodeBCD(int(val % 100))}, nil
+
+	case "Date":
+		t, err := parseTimeValue(value, formatoData)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag Date: %v", err)
+		}
+		days := int(t.Sub(epocaDateS7).Hours() / 24)
+		if days < 0 || days > math.MaxUint16 {
+			return nil, fmt.Errorf("data fora do intervalo suportado pelo tipo Date")
+		}
+		return binary.BigEndian.AppendUint16(nil, uint16(days)), nil
+
+	case "TOD":
+		t, err := parseTimeValue(value, formatoHora, "15:04:05", "15:04")
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag TOD: %v", err)
+		}
+		midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+		return binary.BigEndian.AppendUint32(nil, uint32(t.Sub(midnight).Milliseconds())), nil
+
+	case "DTL":
+		t, err := parseTimeValue(value, formatoDataHora, "2006-01-02T15:04:05", time.RFC3339Nano)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag DTL: %v", err)
+		}
+		buffer := make([]byte, 12)
+		binary.BigEndian.PutUint16(buffer[0:], uint16(t.Year()))
+		buffer[2] = byte(t.Month())
+		buffer[3] = byte(t.Day())
+		buffer[4] = byte(t.Weekday()) + 1 // 1 = domingo no S7
+		buffer[5] = byte(t.Hour())
+		buffer[6] = byte(t.Minute())
+		buffer[7] = byte(t.Second())
+		binary.BigEndian.PutUint32(buffer[8:], uint32(t.Nanosecond()))
+		return buffer, nil
+
+	case "DATE_AND_TIME":
+		t, err := parseTimeValue(value, formatoDataHora, "2006-01-02T15:04:05", time.RFC3339Nano)
+		if err != nil {
+			return nil, fmt.Errorf("valor inválido para tag DATE_AND_TIME: %v", err)
+		}
+		if t.Year() < 1990 || t.Year() > 2089 {
+			return nil, fmt.Errorf("DATE_AND_TIME suporta apenas anos entre 1990 e 2089")
+		}
+		ms := t.Nanosecond() / int(time.Millisecond)
+		return []byte{
+			encodeBCD(t.Year() % 100),
+			encodeBCD(int(t.Month())),
+			encodeBCD(t.Day()),
+			encodeBCD(t.Hour()),
+			encodeBCD(t.Minute()),
+			encodeBCD(t.Second()),
+			encodeBCD(ms / 10),
+			byte(ms%10)<<4 | byte(t.Weekday()+1),
+		}, nil
+
+	case "String":
+		val, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("valor string esperado para tag String")
+		}
+		maxLength := stringMaxLength(tag)
+		if len(val) > maxLength {
+			val = val[:maxLength]
+		}
+		buffer := make([]byte, 2+len(val))
+		buffer[0] = byte(maxLength)
+		buffer[1] = byte(len(val))
+		copy(buffer[2:], val)
+		return buffer, nil
+
+	case "WString":
+		val, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("valor string esperado para tag WString")
+		}
+		maxLength := wstringMaxLength(tag)
+		chars := utf16.Encode([]rune(val))
+		if len(chars) > maxLength {
+			chars = chars[:maxLength]
+		}
+		buffer := make([]byte, 4+2*len(chars))
+		binary.BigEndian.PutUint16(buffer[0:], uint16(maxLength))
+		binary.BigEndian.PutUint16(buffer[2:], uint16(len(chars)))
+		for i, c := range chars {
+			binary.BigEndian.PutUint16(buffer[4+2*i:], c)
+		}
+		return buffer, nil
+	}
+
+	return nil, errTipoNaoSuportado(tag)
+}
+
+// toInt64 converte um valor numérico (JSON, Go ou texto) para int64 verificando os limites
+func toInt64(value interface{}, min, max int64) (int64, error) {
+	var result int64
+
+	switch v := value.(type) {
+	case int:
+		result = int64(v)
+	case int8:
+		result = int64(v)
+	case int16:
+		result = int64(v)
+	case int32:
+		result = int64(v)
+	case int64:
+		result = v
+	case uint:
+		result = int64(v)
+	case uint8:
+		result = int64(v)
+	case uint16:
+		result = int64(v)
+	case uint32:
+		result = int64(v)
+	case uint64:
+		if v > math.MaxInt64 {
+			return 0, fmt.Errorf("valor %d fora do intervalo [%d, %d]", v, min, max)
+		}
+		result = int64(v)
+	case float32:
+		return toInt64(float64(v), min, max)
+	case float64:
+		if v != math.Trunc(v) {
+			return 0, fmt.Errorf("valor inteiro esperado, recebido %v", v)
+		}
+		if v < float64(min) || v > float64(max) {
+			return 0, fmt.Errorf("valor %v fora do intervalo [%d, %d]", v, min, max)
+		}
+		result = int64(v)
+	case json.Number:
+		parsed, err := v.Int64()
+		if err != nil {
+			return 0, fmt.Errorf("valor inteiro esperado, recebido %v", v)
+		}
+		result = parsed
+	case string:
+		parsed, err := strconv.ParseInt(strings.TrimSpace(v), 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("valor inteiro esperado, recebido %q", v)
+		}
+		result = parsed
+	default:
+		return 0, fmt.Errorf("valor inteiro esperado, recebido %T", value)
+	}
+
+	if result < min || result > max {
+		return 0, fmt.Errorf("valor %d fora do intervalo [%d, %d]", result, min, max)
+	}
+
+	return result, nil
+}
+
+// toFloat64 converte um valor numérico (JSON, Go ou texto) para float64
+func toFloat64(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int8:
+		return float64(v), nil
+	case int16:
+		return float64(v), nil
+	case int32:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint8:
+		return float64(v), nil
+	case uint16:
+		return float64(v), nil
+	case uint32:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("valor numérico esperado, recebido %q", v)
+		}
+		return parsed, nil
+	}
+	return 0, fmt.Errorf("valor numérico esperado, recebido %T", value)
+}
+
+// parseTimeValue interpreta um texto de data/hora num dos formatos aceites
+func parseTimeValue(value interface{}, layouts ...string) (time.Time, error) {
+	text, ok := value.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("texto de data/hora esperado, recebido %T", value)
+	}
+
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(text)); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("formato de data/hora inválido: %q (esperado %s)", text, layouts[0])
+}
+
+// decodeBCD converte um byte em BCD para inteiro
+func decodeBCD(b byte) int {
+	return int(b>>4)*10 + int(b&0x0F)
+}
+
+// encodeBCD converte um inteiro de 0 a 99 para BCD
+func encodeBCD(value int) byte {
+	return byte((value/10)<<4 | value%10)
+}
+
+// Bases de tempo do formato S5TIME (bits 12 e 13)
+var basesS5Time = []time.Duration{
+	10 * time.Millisecond, 100 * time.Millisecond, time.Second, 10 * time.Second,
+}
+
+// decodeS5Time converte uma word S5TIME (base de tempo + 3 dígitos BCD) numa duração
+func decodeS5Time(v uint16) time.Duration {
+	base := basesS5Time[(v>>12)&0x03]
+	count := decodeBCD(byte(v>>8)&0x0F)*100 + decodeBCD(byte(v))
+	return time.Duration(count) * base
+}
+
+// encodeS5Time converte uma duração em S5TIME usando a menor base de tempo que a representa
+func encodeS5Time(d time.Duration) uint16 {
+	for i, base := range basesS5Time {
+		count := int(d / base)
+		if count <= 999 {
+			return uint16(i)<<12 | uint16(encodeBCD(count/100))<<8 | uint16(encodeBCD(count%100))
+		}
+	}
+	return 3<<12 | 0x0999
+}
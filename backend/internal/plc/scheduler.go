@@ -0,0 +1,187 @@
+package plc
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// tagBlock representa uma faixa contígua de bytes de uma área lida numa única requisição
+type tagBlock struct {
+	Area     string
+	DBNumber int
+	Start    int
+	Size     int
+	Tags     []*Tag
+}
+
+// tagReadGroup agrupa os blocos de tags que partilham o mesmo intervalo de atualização
+type tagReadGroup struct {
+	Interval time.Duration
+	Blocks   []*tagBlock
+}
+
+// tagInterval retorna o intervalo de leitura efetivo de uma tag
+func tagInterval(tag *Tag) time.Duration {
+	interval := time.Duration(tag.UpdateInterval) * time.Millisecond
+	if interval < 10*time.Millisecond {
+		interval = Config.DefaultTagInterval // Usar valor padrão se intervalo for muito pequeno
+	}
+	return interval
+}
+
+// blockKey identifica uma área de memória endereçável de forma contígua
+type blockKey struct {
+	Area     string
+	DBNumber int
+}
+
+// buildReadGroups agrupa as tags por intervalo e área e junta faixas de bytes
+// adjacentes ou sobrepostas em blocos que cabem numa PDU
+func buildReadGroups(tags []*Tag, maxBlockSize int) []*tagReadGroup {
+	// intervalo -> área/db -> tags
+	byInterval := make(map[time.Duration]map[blockKey][]*Tag)
+
+	for _, tag := range tags {
+		// Tags virtuais são calculadas, não lidas
+		if isVirtualTag(tag) {
+			continue
+		}
+		if tagByteSize(tag) == 0 {
+			log.Printf("Tag %s (ID: %d) ignorada: tipo não suportado %s", tag.Nome, tag.ID, tag.Tipo)
+			tag.Qualidade = QualidadeFalhaConfiguracao
+			continue
+		}
+
+		interval := tagInterval(tag)
+		if byInterval[interval] == nil {
+			byInterval[interval] = make(map[blockKey][]*Tag)
+		}
+		key := blockKey{Area: tagArea(tag), DBNumber: tag.DBNumber}
+		byInterval[interval][key] = append(byInterval[interval][key], tag)
+	}
+
+	groups := make([]*tagReadGroup, 0, len(byInterval))
+
+	for interval, byArea := range byInterval {
+		group := &tagReadGroup{Interval: interval}
+
+		for key, areaTags := range byArea {
+			group.Blocks = append(group.Blocks, mergeTagBlocks(key, areaTags, maxBlockSize)...)
+		}
+
+		groups = append(groups, group)
+	}
+
+	// Ordem estável facilita a leitura dos logs
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Interval < groups[j].Interval
+	})
+
+	return groups
+}
+
+// mergeTagBlocks junta as tags de uma mesma área em blocos contíguos
+func mergeTagBlocks(key blockKey, tags []*Tag, maxBlockSize int) []*tagBlock {
+	sort.Slice(tags, func(i, j int) bool {
+		return tagBufferOffset(tags[i]) < tagBufferOffset(tags[j])
+	})
+
+	var blocks []*tagBlock
+	var current *tagBlock
+
+	for _, tag := range tags {
+		start := tagBufferOffset(tag)
+		end := start + tagByteSize(tag)
+
+		if current != nil {
+			currentEnd := current.Start + current.Size
+			newEnd := currentEnd
+			if end > newEnd {
+				newEnd = end
+			}
+
+			// Juntar se a tag estiver próxima do bloco atual e o bloco continuar a caber numa PDU
+			if start <= currentEnd+Config.BlockMaxGap && newEnd-current.Start <= maxBlockSize {
+				current.Size = newEnd - current.Start
+				current.Tags = append(current.Tags, tag)
+				continue
+			}
+		}
+
+		current = &tagBlock{
+			Area:     key.Area,
+			DBNumber: key.DBNumber,
+			Start:    start,
+			Size:     end - start,
+			Tags:     []*Tag{tag},
+		}
+		blocks = append(blocks, current)
+	}
+
+	return blocks
+}
+
+// runReadGroup lê periodicamente todos os blocos de um leitor e publica os valores das tags.
+// A lista de blocos é obtida a cada ciclo, para que as alterações de tags não parem a leitura.
+func (m *Manager) runReadGroup(plc *PLC, client Driver, reader *tagReader) {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(reader.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-reader.stop:
+			return
+		case <-ticker.C:
+			if !canRead(plc) {
+				continue
+			}
+
+			for _, block := range *reader.blocks.Load() {
+				m.readBlock(plc, client, block)
+			}
+		}
+	}
+}
+
+// readBlock lê um bloco do PLC e descodifica cada tag a partir do buffer partilhado
+func (m *Manager) readBlock(plc *PLC, client Driver, block *tagBlock) {
+	start := time.Now()
+	buffer, err := client.ReadBytes(block.Area, block.DBNumber, block.Start, block.Size)
+	now := time.Now()
+	stats := m.stats.get(plc.ID)
+	stats.recordRead(block.Tags, now.Sub(start), err)
+	reportRead(plc, client, err)
+
+	if err != nil {
+		log.Printf("\033[31m[ERRO] PLC %s - Bloco %s%d offset %d (%d bytes): %v\033[0m\n",
+			plc.Nome, block.Area, block.DBNumber, block.Start, block.Size, err)
+
+		for _, tag := range block.Tags {
+			tag.UltimaLeitura = now
+			tag.UltimoErro = err.Error()
+			tag.UltimoErroTime = now
+			m.setTagQuality(plc, tag, QualidadeFalhaComunicacao)
+		}
+		return
+	}
+
+	for _, tag := range block.Tags {
+		tag.UltimaLeitura = now
+
+		offset := tagBufferOffset(tag) - block.Start
+		value, err := decodeTagValue(tag, buffer[offset:])
+		if err != nil {
+			tag.UltimoErro = err.Error()
+			tag.UltimoErroTime = now
+			log.Printf("\033[31m[ERRO] PLC %s - Tag %s: %v\033[0m\n", plc.Nome, tag.Nome, err)
+			stats.recordTagFailure(tag)
+			m.setTagQuality(plc, tag, QualidadeFalhaConfiguracao)
+			continue
+		}
+
+		m.processTagValue(plc, tag, value)
+	}
+}
@@ -0,0 +1,360 @@
+package plc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// SimulatorDriver é um driver em memória que imita um CLP S7.
+// Cada área (e cada DB) é uma imagem de bytes que cresce conforme é acedida.
+// Scripts (rampas, bits alternados, quedas de conexão) são avaliados a cada leitura.
+type SimulatorDriver struct {
+	plc       *PLC
+	mutex     sync.Mutex
+	images    map[blockKey][]byte
+	scripts   []simulatorScript
+	conectado bool
+	offline   time.Time // Conexão recusada até este instante
+	status    driverStatus
+}
+
+// simulatorScript é um comportamento periódico aplicado a um endereço da imagem
+type simulatorScript struct {
+	tag    Tag
+	inicio time.Time
+	apply  func(elapsed time.Duration) interface{}
+}
+
+// SimulatorScriptFile é o formato do ficheiro indicado em PLC_SIMULATOR_SCRIPT
+type SimulatorScriptFile struct {
+	Acoes []SimulatorAction `json:"acoes"`
+}
+
+// SimulatorAction descreve uma ação do ficheiro de script do simulador
+type SimulatorAction struct {
+	PLC      string      `json:"plc"`      // Nome do PLC (vazio = todos)
+	Acao     string      `json:"acao"`     // rampa, alternar_bit, valor ou desconectar
+	Endereco string      `json:"endereco"` // Endereço no estilo Siemens (ex.: DB10.DBD4)
+	Tipo     string      `json:"tipo"`     // Tipo S7 (opcional, deduzido do endereço)
+	Min      float64     `json:"min"`
+	Max      float64     `json:"max"`
+	Valor    interface{} `json:"valor"`
+	Periodo  string      `json:"periodo"` // Duração Go (ex.: 10s)
+	Duracao  string      `json:"duracao"` // Para desconectar
+	Inicio   string      `json:"inicio"`  // Atraso antes de desconectar
+}
+
+// NewSimulatorDriver cria um simulador vazio e carrega o script de PLC_SIMULATOR_SCRIPT, se definido
+func NewSimulatorDriver(plc *PLC) *SimulatorDriver {
+	s := &SimulatorDriver{
+		plc:    plc,
+		images: make(map[blockKey][]byte),
+	}
+
+	if path := os.Getenv("PLC_SIMULATOR_SCRIPT"); path != "" {
+		if err := s.LoadScriptFile(path); err != nil {
+			log.Printf("Aviso: erro ao carregar script do simulador %s: %v", path, err)
+		}
+	}
+
+	return s
+}
+
+// Connect simula a conexão, falhando enquanto houver uma queda injetada
+func (s *SimulatorDriver) Connect() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if time.Now().Before(s.offline) {
+		err := fmt.Errorf("simulador: PLC %s indisponível até %s", s.plc.Nome, s.offline.Format(formatoHora))
+		s.status.record(err)
+		return err
+	}
+
+	s.conectado = true
+	s.status.record(nil)
+	return nil
+}
+
+// Disconnect fecha a conexão simulada
+func (s *SimulatorDriver) Disconnect() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conectado = false
+	return nil
+}
+
+// IsConnected retorna o status da conexão, considerando quedas injetadas
+func (s *SimulatorDriver) IsConnected() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.isConnectedLocked()
+}
+
+// isConnectedLocked verifica a conexão com o mutex já adquirido
+func (s *SimulatorDriver) isConnectedLocked() bool {
+	if s.conectado && time.Now().Before(s.offline) {
+		s.conectado = false
+	}
+	return s.conectado
+}
+
+// ReadTag lê uma tag da imagem em memória
+func (s *SimulatorDriver) ReadTag(tag *Tag) (interface{}, error) {
+	return readTagWith(s, tag)
+}
+
+// WriteTag escreve uma tag na imagem em memória
+func (s *SimulatorDriver) WriteTag(tag *Tag, value interface{}) error {
+	buffer, err := encodeTagWrite(s, tag, value)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isConnectedLocked() {
+		return fmt.Errorf("não conectado ao PLC")
+	}
+
+	s.store(tag, buffer)
+	s.status.record(nil)
+	return nil
+}
+
+// ReadBytes copia uma faixa de bytes da imagem, depois de aplicar os scripts
+func (s *SimulatorDriver) ReadBytes(area string, dbNumber int, start int, size int) ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.isConnectedLocked() {
+		err := fmt.Errorf("não conectado ao PLC")
+		s.status.record(err)
+		return nil, err
+	}
+
+	s.runScripts(time.Now())
+
+	buffer := make([]byte, size)
+	copy(buffer, s.image(area, dbNumber, start+size)[start:])
+	s.status.record(nil)
+	return buffer, nil
+}
+
+// MaxBlockSize usa o mesmo limite de uma PDU S7 de 240 bytes
+func (s *SimulatorDriver) MaxBlockSize() int {
+	return 240 - 18
+}
+
+// Health retorna um resumo do estado do simulador
+func (s *SimulatorDriver) Health() DriverHealth {
+	return s.status.health("simulador", s.IsConnected())
+}
+
+// image retorna a imagem da área, aumentando-a para pelo menos size bytes
+func (s *SimulatorDriver) image(area string, dbNumber int, size int) []byte {
+	key := blockKey{Area: area, DBNumber: dbNumber}
+	img := s.images[key]
+	if len(img) < size {
+		grown := make([]byte, size)
+		copy(grown, img)
+		img = grown
+		s.images[key] = img
+	}
+	return img
+}
+
+// runScripts escreve na imagem os valores atuais de todos os scripts
+func (s *SimulatorDriver) runScripts(now time.Time) {
+	for i := range s.scripts {
+		script := &s.scripts[i]
+		value := script.apply(now.Sub(script.inicio))
+
+		buffer, err := encodeTagValue(&script.tag, value)
+		if err != nil {
+			continue
+		}
+		s.storeBit(&script.tag, buffer)
+	}
+}
+
+// store copia os bytes codificados de uma tag para a imagem
+func (s *SimulatorDriver) store(tag *Tag, buffer []byte) {
+	offset := tagBufferOffset(tag)
+	copy(s.image(tagArea(tag), tag.DBNumber, offset+len(buffer))[offset:], buffer)
+}
+
+// storeBit grava uma tag na imagem alterando apenas o seu bit quando é um Bool
+func (s *SimulatorDriver) storeBit(tag *Tag, buffer []byte) {
+	if tag.Tipo != "Bool" || tag.BitOffset == nil {
+		s.store(tag, buffer)
+		return
+	}
+
+	img := s.image(tagArea(tag), tag.DBNumber, tag.ByteOffset+1)
+	mask := byte(1 << uint(*tag.BitOffset))
+	if buffer[0] != 0 {
+		img[tag.ByteOffset] |= mask
+	} else {
+		img[tag.ByteOffset] &^= mask
+	}
+}
+
+// scriptTag converte um endereço e tipo numa tag usada pelos scripts
+func scriptTag(endereco string, tipo string) (Tag, error) {
+	tag := Tag{Endereco: endereco, Tipo: tipo}
+	if err := applyTagAddress(&tag); err != nil {
+		return Tag{}, err
+	}
+	if tag.Tipo == "" {
+		return Tag{}, fmt.Errorf("tipo não pode ser deduzido do endereço %s", endereco)
+	}
+	return tag, nil
+}
+
+// SetValue grava um valor fixo num endereço da imagem
+func (s *SimulatorDriver) SetValue(endereco string, tipo string, value interface{}) error {
+	tag, err := scriptTag(endereco, tipo)
+	if err != nil {
+		return err
+	}
+
+	buffer, err := encodeTagValue(&tag, value)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.storeBit(&tag, buffer)
+	return nil
+}
+
+// Ramp faz o valor do endereço subir linearmente de min a max a cada período, recomeçando em min
+func (s *SimulatorDriver) Ramp(endereco string, tipo string, min, max float64, periodo time.Duration) error {
+	if periodo <= 0 {
+		return fmt.Errorf("período da rampa deve ser positivo")
+	}
+
+	tag, err := scriptTag(endereco, tipo)
+	if err != nil {
+		return err
+	}
+
+	isFloat := tag.Tipo == "Real" || tag.Tipo == "LReal"
+	s.addScript(tag, func(elapsed time.Duration) interface{} {
+		fraction := float64(elapsed%periodo) / float64(periodo)
+		value := min + (max-min)*fraction
+		if isFloat {
+			return value
+		}
+		return int64(math.Round(value))
+	})
+	return nil
+}
+
+// ToggleBit alterna um bit a cada período
+func (s *SimulatorDriver) ToggleBit(endereco string, periodo time.Duration) error {
+	if periodo <= 0 {
+		return fmt.Errorf("período de alternância deve ser positivo")
+	}
+
+	tag, err := scriptTag(endereco, "Bool")
+	if err != nil {
+		return err
+	}
+
+	s.addScript(tag, func(elapsed time.Duration) interface{} {
+		return (elapsed/periodo)%2 == 1
+	})
+	return nil
+}
+
+// InjectDisconnect derruba a conexão simulada e recusa novas conexões durante a duração indicada
+func (s *SimulatorDriver) InjectDisconnect(duracao time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.offline = time.Now().Add(duracao)
+	s.conectado = false
+	s.status.record(fmt.Errorf("simulador: queda de conexão injetada por %v", duracao))
+}
+
+// addScript regista um script a partir do instante atual
+func (s *SimulatorDriver) addScript(tag Tag, apply func(elapsed time.Duration) interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.scripts = append(s.scripts, simulatorScript{tag: tag, inicio: time.Now(), apply: apply})
+}
+
+// LoadScriptFile carrega as ações de um ficheiro JSON de script do simulador
+func (s *SimulatorDriver) LoadScriptFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file SimulatorScriptFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("JSON inválido: %v", err)
+	}
+
+	for i, acao := range file.Acoes {
+		if acao.PLC != "" && acao.PLC != s.plc.Nome {
+			continue
+		}
+		if err := s.applyAction(acao); err != nil {
+			return fmt.Errorf("ação %d (%s): %v", i+1, acao.Acao, err)
+		}
+	}
+
+	return nil
+}
+
+// applyAction executa uma ação do ficheiro de script
+func (s *SimulatorDriver) applyAction(acao SimulatorAction) error {
+	switch acao.Acao {
+	case "valor":
+		return s.SetValue(acao.Endereco, acao.Tipo, acao.Valor)
+
+	case "rampa":
+		periodo, err := time.ParseDuration(acao.Periodo)
+		if err != nil {
+			return fmt.Errorf("período inválido: %v", err)
+		}
+		return s.Ramp(acao.Endereco, acao.Tipo, acao.Min, acao.Max, periodo)
+
+	case "alternar_bit":
+		periodo, err := time.ParseDuration(acao.Periodo)
+		if err != nil {
+			return fmt.Errorf("período inválido: %v", err)
+		}
+		return s.ToggleBit(acao.Endereco, periodo)
+
+	case "desconectar":
+		duracao, err := time.ParseDuration(acao.Duracao)
+		if err != nil {
+			return fmt.Errorf("duração inválida: %v", err)
+		}
+		inicio := time.Duration(0)
+		if acao.Inicio != "" {
+			if inicio, err = time.ParseDuration(acao.Inicio); err != nil {
+				return fmt.Errorf("início inválido: %v", err)
+			}
+		}
+		time.AfterFunc(inicio, func() { s.InjectDisconnect(duracao) })
+		return nil
+	}
+
+	return fmt.Errorf("ação desconhecida")
+}
@@ -0,0 +1,121 @@
+package plc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestManagerWithSimulator corre o gerenciador completo sobre o simulador com um script de rampa,
+// bit alternado e queda de conexão: as tags contíguas são lidas num único bloco, os valores
+// acompanham o script e a queda passa o PLC por desconectado até voltar a conectado
+func TestManagerWithSimulator(t *testing.T) {
+	saved := Config
+	t.Cleanup(func() { Config = saved })
+	Config.ConnectionRetryDelay = 20 * time.Millisecond
+	Config.ReconnectMaxDelay = 100 * time.Millisecond
+	Config.ConnectionCheckPeriod = 20 * time.Millisecond
+
+	script := filepath.Join(t.TempDir(), "simulador.json")
+	err := os.WriteFile(script, []byte(`{
+  "acoes": [
+    {"acao": "rampa", "endereco": "DB1.DBW0", "tipo": "Int", "min": 0, "max": 1000, "periodo": "2s"},
+    {"acao": "alternar_bit", "endereco": "DB1.DBX2.0", "periodo": "60ms"},
+    {"acao": "valor", "endereco": "DB1.DBD4", "tipo": "Real", "valor": 12.5},
+    {"acao": "desconectar", "inicio": "400ms", "duracao": "300ms"},
+    {"plc": "outro", "acao": "valor", "endereco": "DB1.DBD4", "tipo": "Real", "valor": 99}
+  ]
+}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PLC_DRIVER", "simulador")
+	t.Setenv("PLC_SIMULATOR_SCRIPT", script)
+
+	m := NewManager()
+	plc := &PLC{ID: 1, Nome: "eclusa", Ativo: true}
+	fixo := Tag{ID: 3, Nome: "tag3", Endereco: "DB1.DBD4", Tipo: "Real", UpdateInterval: 20, Ativo: true}
+	if err := applyTagAddress(&fixo); err != nil {
+		t.Fatal(err)
+	}
+	plc.setTags([]Tag{
+		testTag(t, 1, "DB1.DBW0", 20),
+		testTag(t, 2, "DB1.DBX2.0", 20),
+		fixo,
+	})
+	m.plcs[plc.ID] = plc
+
+	m.startAll()
+	defer m.Stop()
+
+	waitFor(t, "conexão inicial", func() bool { return plc.EstadoConexao == EstadoConexaoConectado })
+
+	// As três tags estão a menos de BlockMaxGap bytes entre si: um bloco, uma leitura por ciclo
+	waitFor(t, "leitor de 20ms", func() bool {
+		plc.registry.lifecycle.Lock()
+		defer plc.registry.lifecycle.Unlock()
+		return plc.registry.readers[20*time.Millisecond] != nil
+	})
+	plc.registry.lifecycle.Lock()
+	blocks := *plc.registry.readers[20*time.Millisecond].blocks.Load()
+	plc.registry.lifecycle.Unlock()
+	if len(blocks) != 1 || blocks[0].Start != 0 || blocks[0].Size != 8 || len(blocks[0].Tags) != 3 {
+		t.Fatalf("blocos = %+v, esperado um bloco de 8 bytes com as três tags", blocks)
+	}
+
+	// Rampa a subir, bit a alternar e valor fixo (a ação de outro PLC é ignorada)
+	var ramp []float64
+	seenTrue, seenFalse := false, false
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		if v, ok := tagValue(plc, 1); ok && (len(ramp) == 0 || v != ramp[len(ramp)-1]) {
+			ramp = append(ramp, v)
+		}
+		if tag := plc.findTag(2); tag != nil {
+			switch tag.UltimoValor {
+			case true:
+				seenTrue = true
+			case false:
+				seenFalse = true
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(ramp) < 3 {
+		t.Errorf("rampa com %d valores distintos: %v", len(ramp), ramp)
+	}
+	for i := 1; i < len(ramp); i++ {
+		if ramp[i] < ramp[i-1] || ramp[i] > 1000 {
+			t.Errorf("rampa fora de ordem ou de limites: %v", ramp)
+			break
+		}
+	}
+	if !seenTrue || !seenFalse {
+		t.Errorf("bit alternado: viu true=%v false=%v", seenTrue, seenFalse)
+	}
+	if v, ok := tagValue(plc, 3); !ok || v != 12.5 {
+		t.Errorf("valor fixo = %v, esperado 12.5", plc.findTag(3).UltimoValor)
+	}
+
+	// Queda injetada: o supervisor passa a desconectado e as tags perdem a qualidade
+	waitFor(t, "queda de conexão", func() bool { return plc.EstadoConexao == EstadoConexaoDesconectado })
+	waitFor(t, "qualidade de falha", func() bool {
+		tag := plc.findTag(1)
+		return tag.Qualidade == QualidadeFalhaComunicacao
+	})
+	if _, _, err := m.ReadTag(plc.ID, 1); err == nil {
+		t.Error("leitura sob demanda aceite com o PLC desconectado")
+	}
+	lost := time.Now()
+
+	// Fim da queda: reconexão com backoff e leituras boas de novo
+	waitFor(t, "reconexão", func() bool { return plc.EstadoConexao == EstadoConexaoConectado })
+	waitFor(t, "leitura depois da reconexão", func() bool {
+		tag := plc.findTag(1)
+		return tag.Qualidade == QualidadeBoa && tag.UltimaLeituraBoa.After(lost)
+	})
+	if _, _, err := m.ReadTag(plc.ID, 3); err != nil {
+		t.Errorf("leitura sob demanda depois da reconexão: %v", err)
+	}
+}
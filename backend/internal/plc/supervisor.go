@@ -0,0 +1,220 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Estados da conexão a um PLC
+const (
+	EstadoConexaoConectado      = "conectado"
+	EstadoConexaoDesconectado   = "desconectado"    // Em espera antes da próxima tentativa
+	EstadoConexaoCircuitoAberto = "circuito_aberto" // Leituras suspensas após falhas consecutivas
+)
+
+// connSupervisor decide quando reconectar a um PLC: backoff exponencial com jitter entre tentativas
+// e um disjuntor que suspende as leituras após falhas consecutivas
+type connSupervisor struct {
+	mutex sync.Mutex
+
+	estado         string
+	tentativas     int // Tentativas falhadas desde a última leitura boa (define o backoff)
+	falhasSeguidas int // Leituras falhadas consecutivas
+	motivo         string
+	proxima        time.Time
+
+	lost chan struct{} // Sinaliza ao ciclo de conexão que a ligação deve ser refeita
+}
+
+// newConnSupervisor cria um supervisor no estado inicial
+func newConnSupervisor() *connSupervisor {
+	return &connSupervisor{
+		lost: make(chan struct{}, 1),
+	}
+}
+
+// state retorna o estado atual, o motivo da última quebra e a hora da próxima tentativa
+func (s *connSupervisor) state() (string, string, time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.estado, s.motivo, s.proxima
+}
+
+// allowRead indica se os leitores podem usar a conexão (disjuntor fechado)
+func (s *connSupervisor) allowRead() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.estado == EstadoConexaoConectado
+}
+
+// connectFailed regista uma tentativa de conexão falhada. O disjuntor, se aberto,
+// mantém-se aberto até uma nova conexão ser estabelecida.
+func (s *connSupervisor) connectFailed(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.estado != EstadoConexaoCircuitoAberto {
+		s.estado = EstadoConexaoDesconectado
+	}
+	s.motivo = err.Error()
+}
+
+// lose regista a perda da conexão detetada fora das leituras
+func (s *connSupervisor) lose(motivo string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.estado = EstadoConexaoDesconectado
+	s.motivo = motivo
+}
+
+// connected regista uma conexão estabelecida; as leituras ficam permitidas
+func (s *connSupervisor) connected() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.estado = EstadoConexaoConectado
+	s.falhasSeguidas = 0
+	s.motivo = ""
+	s.proxima = time.Time{}
+
+	// Descartar sinais de quebra da conexão anterior
+	select {
+	case <-s.lost:
+	default:
+	}
+}
+
+// recordRead regista o resultado de uma leitura. Uma conexão perdida é refeita de imediato;
+// outros erros abrem o disjuntor ao fim de CircuitBreakerThreshold falhas consecutivas.
+func (s *connSupervisor) recordRead(err error, connectionLost bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.estado != EstadoConexaoConectado {
+		return
+	}
+
+	if err == nil {
+		s.falhasSeguidas = 0
+		s.tentativas = 0
+		return
+	}
+
+	s.falhasSeguidas++
+	switch {
+	case connectionLost:
+		s.estado = EstadoConexaoDesconectado
+		s.motivo = err.Error()
+	case s.falhasSeguidas >= Config.CircuitBreakerThreshold:
+		s.estado = EstadoConexaoCircuitoAberto
+		s.motivo = err.Error()
+	default:
+		return
+	}
+
+	select {
+	case s.lost <- struct{}{}:
+	default:
+	}
+}
+
+// nextDelay conta uma tentativa falhada e retorna a espera até à próxima,
+// com backoff exponencial limitado e jitter
+func (s *connSupervisor) nextDelay() time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delay := backoffDelay(s.tentativas)
+	s.tentativas++
+	s.proxima = time.Now().Add(delay)
+	return delay
+}
+
+// backoffDelay calcula a espera para a tentativa n (0 = primeira falha)
+func backoffDelay(n int) time.Duration {
+	delay := float64(Config.ConnectionRetryDelay) * math.Pow(2, float64(n))
+	if delay > float64(Config.ReconnectMaxDelay) {
+		delay = float64(Config.ReconnectMaxDelay)
+	}
+
+	// Jitter de ±ReconnectJitter para que vários PLCs não reconectem em simultâneo
+	jitter := Config.ReconnectJitter * (2*rand.Float64() - 1)
+	return time.Duration(delay * (1 + jitter))
+}
+
+// isConnectionError indica se o erro de leitura significa que a ligação TCP se perdeu
+func isConnectionError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+
+	// Timeouts contam para o disjuntor, não quebram a conexão de imediato
+	var netErr net.Error
+	return errors.As(err, &netErr) && !netErr.Timeout()
+}
+
+// reportRead encaminha o resultado de uma leitura ao supervisor da conexão do PLC.
+// Todos os acessos ao PLC (leitura de tags, escritas e monitoramento de falhas) devem ser reportados.
+func reportRead(plc *PLC, client Driver, err error) {
+	if plc.supervisor == nil {
+		return
+	}
+
+	connectionLost := err != nil && (isConnectionError(err) || !client.IsConnected())
+	plc.supervisor.recordRead(err, connectionLost)
+}
+
+// canRead indica se os leitores e as escritas do PLC podem usar a conexão
+func canRead(plc *PLC) bool {
+	if !plc.Conectado {
+		return false
+	}
+	return plc.supervisor == nil || plc.supervisor.allowRead()
+}
+
+// readUnavailableError explica porque é que os leitores não podem usar a conexão (ver canRead)
+func readUnavailableError(plc *PLC) error {
+	if plc.Conectado {
+		return fmt.Errorf("acesso ao PLC suspenso pelo disjuntor; a aguardar reconexão")
+	}
+	return fmt.Errorf("PLC não está conectado")
+}
+
+// updateConnectionState copia o estado do supervisor para o PLC e publica o status nas transições
+func (m *Manager) updateConnectionState(plc *PLC, sup *connSupervisor) {
+	estado, _, proxima := sup.state()
+	plc.ProximaTentativa = nil
+	if estado != EstadoConexaoConectado && !proxima.IsZero() {
+		plc.ProximaTentativa = &proxima
+	}
+
+	if plc.EstadoConexao == estado {
+		return
+	}
+	plc.EstadoConexao = estado
+	m.publishPLCStatus(plc)
+}
+
+// waitOrStop espera o tempo indicado, retornando false se o PLC for parado entretanto
+func waitOrStop(stopChan chan struct{}, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-stopChan:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,365 @@
+package plc
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+)
+
+// tagRegistry mantém as tags ativas de um PLC e os leitores que as lêem, um por intervalo de atualização.
+// A lista de tags nunca é alterada no lugar: cada alteração cria uma lista nova e substitui a tag,
+// para que os leitores em curso nunca vejam uma configuração a meio de uma alteração.
+type tagRegistry struct {
+	mutex     sync.RWMutex // Protege plc.Tags
+	lifecycle sync.Mutex   // Serializa arranques e paragens de leitores
+
+	client  Driver // Driver da conexão atual; nil enquanto não há leitores
+	readers map[time.Duration]*tagReader
+}
+
+// tagReader é a goroutine que lê um grupo de blocos com o mesmo intervalo. Quando as tags do
+// intervalo mudam, a lista de blocos é substituída sem parar a goroutine.
+type tagReader struct {
+	interval time.Duration
+	blocks   atomic.Pointer[[]*tagBlock]
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// setTags define as tags iniciais do PLC, carregadas da base de dados
+func (p *PLC) setTags(tags []Tag) {
+	if p.registry == nil {
+		p.registry = &tagRegistry{readers: make(map[time.Duration]*tagReader)}
+	}
+
+	list := make([]*Tag, len(tags))
+	for i := range tags {
+		tag := tags[i]
+		list[i] = &tag
+	}
+
+	p.registry.mutex.Lock()
+	p.Tags = list
+	p.registry.mutex.Unlock()
+}
+
+// tagList retorna as tags atuais do PLC. A lista devolvida não é alterada por alterações posteriores.
+func (p *PLC) tagList() []*Tag {
+	if p.registry == nil {
+		return p.Tags
+	}
+
+	p.registry.mutex.RLock()
+	defer p.registry.mutex.RUnlock()
+	return p.Tags
+}
+
+// findTag procura uma tag ativa do PLC pelo ID
+func (p *PLC) findTag(tagID uint) *Tag {
+	for _, tag := range p.tagList() {
+		if tag.ID == tagID {
+			return tag
+		}
+	}
+	return nil
+}
+
+// startTagReaders inicia um leitor por grupo de intervalo, lendo as tags em blocos contíguos
+func (m *Manager) startTagReaders(plc *PLC, client Driver) {
+	r := plc.registry
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	r.client = client
+	for _, group := range buildReadGroups(plc.tagList(), client.MaxBlockSize()) {
+		m.startTagReader(plc, group)
+	}
+}
+
+// stopTagReaders para todos os leitores do PLC e espera que terminem
+func (m *Manager) stopTagReaders(plc *PLC) {
+	r := plc.registry
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	for interval := range r.readers {
+		r.stopReader(interval)
+	}
+	r.client = nil
+}
+
+// startTagReader arranca o leitor de um grupo. Deve ser chamado com lifecycle bloqueado.
+func (m *Manager) startTagReader(plc *PLC, group *tagReadGroup) {
+	r := plc.registry
+	reader := &tagReader{
+		interval: group.Interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	reader.blocks.Store(&group.Blocks)
+	r.readers[group.Interval] = reader
+
+	log.Printf("PLC %s: %d blocos lidos a cada %v", plc.Nome, len(group.Blocks), group.Interval)
+
+	m.wg.Add(1)
+	go func() {
+		defer close(reader.done)
+		m.runReadGroup(plc, r.client, reader)
+	}()
+}
+
+// stopReader para o leitor de um intervalo e espera que termine. Deve ser chamado com lifecycle bloqueado.
+func (r *tagRegistry) stopReader(interval time.Duration) {
+	reader, exists := r.readers[interval]
+	if !exists {
+		return
+	}
+
+	close(reader.stop)
+	<-reader.done
+	delete(r.readers, interval)
+}
+
+// restartTagReaders reconstrói os blocos dos intervalos indicados, sem tocar nos restantes.
+// Os leitores que continuam a ter tags recebem a nova lista de blocos sem serem parados;
+// só se arrancam leitores para intervalos novos e se param os que ficaram sem tags.
+// Deve ser chamado com lifecycle bloqueado.
+func (m *Manager) restartTagReaders(plc *PLC, intervals map[time.Duration]bool) {
+	r := plc.registry
+
+	// Sem conexão os leitores são criados na próxima conexão
+	if r.client == nil {
+		return
+	}
+
+	var tags []*Tag
+	for _, tag := range plc.tagList() {
+		if intervals[tagInterval(tag)] {
+			tags = append(tags, tag)
+		}
+	}
+
+	groups := make(map[time.Duration]*tagReadGroup)
+	for _, group := range buildReadGroups(tags, r.client.MaxBlockSize()) {
+		groups[group.Interval] = group
+	}
+
+	for interval := range intervals {
+		group, hasTags := groups[interval]
+		reader, running := r.readers[interval]
+		switch {
+		case !hasTags:
+			r.stopReader(interval)
+		case running:
+			reader.blocks.Store(&group.Blocks)
+			log.Printf("PLC %s: %d blocos lidos a cada %v (atualizado)", plc.Nome, len(group.Blocks), interval)
+		default:
+			m.startTagReader(plc, group)
+		}
+	}
+}
+
+// sameTagAddress indica se duas configurações lêem o mesmo valor (endereço, tipo, escala e expressão)
+func sameTagAddress(a, b *Tag) bool {
+	return tagArea(a) == tagArea(b) &&
+		a.DBNumber == b.DBNumber &&
+		a.ByteOffset == b.ByteOffset &&
+		intPtrEqual(a.BitOffset, b.BitOffset) &&
+		a.Tipo == b.Tipo &&
+		a.Tamanho == b.Tamanho &&
+		a.OrdemPalavras == b.OrdemPalavras &&
+		floatPtrEqual(a.BrutoMin, b.BrutoMin) &&
+		floatPtrEqual(a.BrutoMax, b.BrutoMax) &&
+		floatPtrEqual(a.EngMin, b.EngMin) &&
+		floatPtrEqual(a.EngMax, b.EngMax) &&
+		a.Limitar == b.Limitar &&
+		stringPtrEqual(a.Expressao, b.Expressao)
+}
+
+// carryRuntimeState copia o estado de execução da tag antiga para a nova configuração.
+// Se a tag passou a ler outro valor, o último valor deixa de ser válido e não é copiado.
+func carryRuntimeState(old, tag *Tag) {
+	tag.UltimaEscrita = old.UltimaEscrita
+	tag.UltimaPublicacao = old.UltimaPublicacao
+
+	if !sameTagAddress(old, tag) {
+		return
+	}
+
+	tag.UltimoValor = old.UltimoValor
+	tag.UltimoValorBruto = old.UltimoValorBruto
+	tag.UltimaLeitura = old.UltimaLeitura
+	tag.UltimaLeituraBoa = old.UltimaLeituraBoa
+	tag.Qualidade = old.Qualidade
+	tag.UltimoErro = old.UltimoErro
+	tag.UltimoErroTime = old.UltimoErroTime
+	tag.HistoricoUltimoValor = old.HistoricoUltimoValor
+	tag.HistoricoUltimoTempo = old.HistoricoUltimoTempo
+}
+
+// intPtrEqual compara dois inteiros opcionais
+func intPtrEqual(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// floatPtrEqual compara dois números opcionais
+func floatPtrEqual(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// AddTagToPLC adiciona ou atualiza uma tag de um PLC gerido, reconstruindo apenas os blocos do seu intervalo
+func (m *Manager) AddTagToPLC(plcID uint, tag *Tag) {
+	plc, exists := m.GetPLC(plcID)
+	if !exists || plc.registry == nil {
+		log.Printf("Tentativa de adicionar tag a PLC não gerenciado: %d", plcID)
+		return
+	}
+
+	if !tag.Ativo {
+		m.RemoveTagFromPLC(plcID, tag.ID)
+		return
+	}
+
+	// Cópia própria: a tag do pedido continua a ser usada pelo controlador
+	newTag := *tag
+	newTag.UltimoValor = nil
+	newTag.UltimoValorBruto = nil
+	newTag.Qualidade = ""
+
+	r := plc.registry
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	intervals := map[time.Duration]bool{tagInterval(&newTag): true}
+	current := plc.tagList()
+	list := make([]*Tag, 0, len(current)+1)
+	var old *Tag
+
+	for _, existing := range current {
+		if existing.ID == newTag.ID {
+			old = existing
+			carryRuntimeState(old, &newTag)
+			intervals[tagInterval(old)] = true
+			list = append(list, &newTag)
+			continue
+		}
+		list = append(list, existing)
+	}
+	if old == nil {
+		list = append(list, &newTag)
+	}
+
+	r.mutex.Lock()
+	plc.Tags = list
+	r.mutex.Unlock()
+
+	m.restartTagReaders(plc, intervals)
+	m.rebuildVirtualTags()
+
+	if old != nil {
+		log.Printf("Tag atualizada no PLC %s: %s (ID: %d)", plc.Nome, newTag.Nome, newTag.ID)
+	} else {
+		log.Printf("Tag adicionada ao PLC %s: %s (ID: %d)", plc.Nome, newTag.Nome, newTag.ID)
+	}
+}
+
+// RemoveTagFromPLC remove uma tag de um PLC gerido e para a sua leitura
+func (m *Manager) RemoveTagFromPLC(plcID uint, tagID uint) {
+	plc, exists := m.GetPLC(plcID)
+	if !exists || plc.registry == nil {
+		return
+	}
+
+	r := plc.registry
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	current := plc.tagList()
+	list := make([]*Tag, 0, len(current))
+	var removed *Tag
+
+	for _, existing := range current {
+		if existing.ID == tagID {
+			removed = existing
+			continue
+		}
+		list = append(list, existing)
+	}
+	if removed == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	plc.Tags = list
+	r.mutex.Unlock()
+
+	m.restartTagReaders(plc, map[time.Duration]bool{tagInterval(removed): true})
+	m.stats.get(plcID).removeTag(tagID)
+	m.rebuildVirtualTags()
+
+	log.Printf("Tag removida do PLC %s: ID %d", plc.Nome, tagID)
+}
+
+// ReloadPLCTags recarrega da base de dados as tags ativas de um PLC gerido e reconstrói os blocos lidos.
+// Usado depois de alterações em massa, para não reconstruir os blocos uma vez por tag.
+func (m *Manager) ReloadPLCTags(plcID uint) error {
+	plc, exists := m.GetPLC(plcID)
+	if !exists || plc.registry == nil {
+		return nil
+	}
+
+	var tags []Tag
+	if err := config.DB.Where("plc_id = ? AND ativo = true", plcID).Find(&tags).Error; err != nil {
+		return err
+	}
+
+	r := plc.registry
+	r.lifecycle.Lock()
+	defer r.lifecycle.Unlock()
+
+	current := make(map[uint]*Tag)
+	intervals := make(map[time.Duration]bool)
+	for _, existing := range plc.tagList() {
+		current[existing.ID] = existing
+		intervals[tagInterval(existing)] = true
+	}
+
+	list := make([]*Tag, len(tags))
+	for i := range tags {
+		tag := tags[i]
+		if old, ok := current[tag.ID]; ok {
+			carryRuntimeState(old, &tag)
+			delete(current, tag.ID)
+		}
+		intervals[tagInterval(&tag)] = true
+		list[i] = &tag
+	}
+
+	r.mutex.Lock()
+	plc.Tags = list
+	r.mutex.Unlock()
+
+	m.restartTagReaders(plc, intervals)
+	for tagID := range current {
+		m.stats.get(plcID).removeTag(tagID)
+	}
+	m.rebuildVirtualTags()
+
+	log.Printf("Recarregadas %d tags para PLC %s (ID: %d)", len(list), plc.Nome, plc.ID)
+	return nil
+}
+
+// UpdateTagInPLC atualiza a configuração de uma tag em um PLC gerido
+func (m *Manager) UpdateTagInPLC(plcID uint, tag *Tag) {
+	m.AddTagToPLC(plcID, tag)
+}
@@ -0,0 +1,128 @@
+package plc
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testTag cria uma tag ativa a partir de um endereço no estilo Siemens
+func testTag(t *testing.T, id uint, endereco string, intervaloMs int) Tag {
+	t.Helper()
+	tag := Tag{ID: id, Nome: fmt.Sprintf("tag%d", id), Endereco: endereco, UpdateInterval: intervaloMs, Ativo: true}
+	if err := applyTagAddress(&tag); err != nil {
+		t.Fatal(err)
+	}
+	return tag
+}
+
+// waitFor espera até a condição ser verdadeira ou falha o teste
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("tempo esgotado à espera de: %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// tagValue retorna o último valor de uma tag ativa do PLC como número
+func tagValue(plc *PLC, tagID uint) (float64, bool) {
+	tag := plc.findTag(tagID)
+	if tag == nil || tag.UltimoValor == nil {
+		return 0, false
+	}
+	value, err := toFloat64(tag.UltimoValor)
+	return value, err == nil
+}
+
+// readerStopped indica se a goroutine do leitor terminou
+func readerStopped(reader *tagReader) bool {
+	select {
+	case <-reader.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// TestTagChangeKeepsReaders verifica que alterar as tags de um intervalo troca os blocos do
+// leitor sem o parar, e que só os intervalos que ficam sem tags perdem o seu leitor
+func TestTagChangeKeepsReaders(t *testing.T) {
+	const fast, slow = 20 * time.Millisecond, 50 * time.Millisecond
+
+	m := NewManager()
+	plc := &PLC{ID: 1, Nome: "teste"}
+	plc.setTags([]Tag{
+		testTag(t, 1, "DB1.DBW0", 20),
+		testTag(t, 2, "DB1.DBW10", 50),
+	})
+	m.plcs[plc.ID] = plc
+
+	sim := NewSimulatorDriver(plc)
+	if err := sim.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	for endereco, value := range map[string]int64{"DB1.DBW0": 7, "DB1.DBW2": 9, "DB1.DBW10": 11} {
+		if err := sim.SetValue(endereco, "Int", value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	plc.Conectado = true
+
+	m.startTagReaders(plc, sim)
+	defer m.stopTagReaders(plc)
+
+	readers := plc.registry.readers
+	fastReader, slowReader := readers[fast], readers[slow]
+	if fastReader == nil || slowReader == nil {
+		t.Fatalf("leitores iniciais: %v", readers)
+	}
+	waitFor(t, "leitura inicial", func() bool {
+		v1, ok1 := tagValue(plc, 1)
+		v2, ok2 := tagValue(plc, 2)
+		return ok1 && ok2 && v1 == 7 && v2 == 11
+	})
+
+	// Nova tag no intervalo rápido: o mesmo leitor passa a lê-la
+	tag3 := testTag(t, 3, "DB1.DBW2", 20)
+	m.AddTagToPLC(plc.ID, &tag3)
+	if readers[fast] != fastReader || readerStopped(fastReader) {
+		t.Error("adicionar uma tag reiniciou o leitor do seu intervalo")
+	}
+	if readers[slow] != slowReader || readerStopped(slowReader) {
+		t.Error("adicionar uma tag reiniciou o leitor de outro intervalo")
+	}
+	waitFor(t, "leitura da tag adicionada", func() bool {
+		v, ok := tagValue(plc, 3)
+		return ok && v == 9
+	})
+
+	// A tag 2 passa para o intervalo rápido: o leitor lento fica sem tags e é parado
+	tag2 := testTag(t, 2, "DB1.DBW10", 20)
+	m.AddTagToPLC(plc.ID, &tag2)
+	if readers[fast] != fastReader || readerStopped(fastReader) {
+		t.Error("mudar o intervalo de uma tag reiniciou o leitor de destino")
+	}
+	if _, exists := readers[slow]; exists || !readerStopped(slowReader) {
+		t.Error("o leitor sem tags continua ativo")
+	}
+	if blocks := *fastReader.blocks.Load(); len(blocks) != 1 || len(blocks[0].Tags) != 3 {
+		t.Errorf("blocos do leitor rápido: %d, esperado um bloco com as três tags", len(blocks))
+	}
+
+	// Remover uma tag mantém o leitor
+	m.RemoveTagFromPLC(plc.ID, 1)
+	if readers[fast] != fastReader || readerStopped(fastReader) {
+		t.Error("remover uma tag reiniciou o leitor do seu intervalo")
+	}
+	if err := sim.SetValue("DB1.DBW10", "Int", int64(12)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "leitura depois da remoção", func() bool {
+		v, ok := tagValue(plc, 2)
+		return ok && v == 12
+	})
+}
@@ -0,0 +1,336 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+)
+
+// Modos de consulta de tendências
+const (
+	TendenciaBruto    = "bruto"    // Amostras tal como foram gravadas
+	TendenciaAgregado = "agregado" // Estatísticas por intervalo de tempo
+	TendenciaLTTB     = "lttb"     // Série reduzida a N pontos mantendo a forma (Largest-Triangle-Three-Buckets)
+)
+
+// ModosTendenciaSuportados lista os valores aceites no parâmetro modo
+var ModosTendenciaSuportados = []string{TendenciaBruto, TendenciaAgregado, TendenciaLTTB}
+
+var (
+	// errTagNaoEncontrada indica que uma das tags da consulta não existe
+	errTagNaoEncontrada = errors.New("tag não encontrada")
+	// errConsultaInvalida indica que os parâmetros da consulta estão fora dos limites
+	errConsultaInvalida = errors.New("consulta inválida")
+)
+
+// TrendQuery contém os parâmetros de uma consulta de tendências
+type TrendQuery struct {
+	TagIDs    []uint
+	Inicio    time.Time
+	Fim       time.Time
+	Modo      string
+	Intervalo time.Duration // Tamanho dos intervalos no modo agregado
+	Pontos    int           // Máximo de pontos por série nos modos agregado e lttb
+}
+
+// TrendBucket contém as estatísticas de uma tag num intervalo de tempo
+type TrendBucket struct {
+	TagID    uint      `json:"-" gorm:"column:tag_id"`
+	Inicio   time.Time `json:"inicio" gorm:"column:inicio"`
+	Min      *float64  `json:"min" gorm:"column:min"`
+	Max      *float64  `json:"max" gorm:"column:max"`
+	Avg      *float64  `json:"avg" gorm:"column:avg"`
+	Primeiro *float64  `json:"first" gorm:"column:primeiro"`
+	Ultimo   *float64  `json:"last" gorm:"column:ultimo"`
+	Contagem int64     `json:"count" gorm:"column:contagem"`
+}
+
+// TrendSeries é o resultado de uma consulta de tendências para uma tag
+type TrendSeries struct {
+	TagID     uint          `json:"tag_id"`
+	Nome      string        `json:"nome"`
+	Unidade   *string       `json:"unidade"`
+	Modo      string        `json:"modo"`
+	Intervalo float64       `json:"intervalo_s,omitempty"`
+	Amostras  []TagSample   `json:"amostras,omitempty"`
+	Buckets   []TrendBucket `json:"buckets,omitempty"`
+	Truncado  bool          `json:"truncado"` // As amostras excederam o limite e foram reduzidas por intervalo
+}
+
+// validate completa os valores por omissão e verifica os limites da consulta
+func (q *TrendQuery) validate() error {
+	if len(q.TagIDs) == 0 {
+		return fmt.Errorf("nenhuma tag indicada")
+	}
+	if len(q.TagIDs) > Config.TrendMaxTags {
+		return fmt.Errorf("no máximo %d tags por consulta", Config.TrendMaxTags)
+	}
+
+	if q.Fim.IsZero() {
+		q.Fim = time.Now()
+	}
+	if q.Inicio.IsZero() {
+		q.Inicio = q.Fim.Add(-time.Hour)
+	}
+	if !q.Inicio.Before(q.Fim) {
+		return fmt.Errorf("inicio deve ser anterior a fim")
+	}
+
+	if q.Modo == "" {
+		q.Modo = TendenciaBruto
+	}
+	if q.Pontos == 0 {
+		q.Pontos = Config.TrendDefaultPoints
+	}
+	if q.Pontos < 3 || q.Pontos > Config.TrendMaxPoints {
+		return fmt.Errorf("pontos deve estar entre 3 e %d", Config.TrendMaxPoints)
+	}
+
+	switch q.Modo {
+	case TendenciaBruto, TendenciaLTTB:
+	case TendenciaAgregado:
+		if q.Intervalo == 0 {
+			q.Intervalo = q.Fim.Sub(q.Inicio) / time.Duration(q.Pontos)
+		}
+		if q.Intervalo < time.Second {
+			q.Intervalo = time.Second
+		}
+		if q.Fim.Sub(q.Inicio)/q.Intervalo > time.Duration(Config.TrendMaxPoints) {
+			return fmt.Errorf("intervalo demasiado pequeno: no máximo %d intervalos por série", Config.TrendMaxPoints)
+		}
+	default:
+		return fmt.Errorf("modo inválido: %s (válidos: %v)", q.Modo, ModosTendenciaSuportados)
+	}
+
+	return nil
+}
+
+// QueryTrends executa uma consulta de tendências, devolvendo uma série por tag
+func QueryTrends(q TrendQuery) ([]TrendSeries, error) {
+	if err := q.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", errConsultaInvalida, err)
+	}
+
+	var tags []Tag
+	if err := config.DB.Where("id IN ?", q.TagIDs).Find(&tags).Error; err != nil {
+		return nil, err
+	}
+	if len(tags) != len(q.TagIDs) {
+		return nil, errTagNaoEncontrada
+	}
+
+	series := make([]TrendSeries, 0, len(tags))
+	for _, tag := range tags {
+		s := TrendSeries{
+			TagID:   tag.ID,
+			Nome:    tag.Nome,
+			Unidade: tag.Unidade,
+			Modo:    q.Modo,
+		}
+
+		var err error
+		switch q.Modo {
+		case TendenciaAgregado:
+			s.Intervalo = q.Intervalo.Seconds()
+			s.Buckets, err = queryTrendBuckets(tag.ID, q)
+		default:
+			s.Amostras, s.Truncado, err = queryTrendSamples(tag.ID, q)
+			if err == nil && q.Modo == TendenciaLTTB {
+				s.Amostras = downsampleTrend(s.Amostras, q.Pontos)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		series = append(series, s)
+	}
+
+	return series, nil
+}
+
+// queryTrendSamples lê as amostras de uma tag no período. Se excederem o limite configurado,
+// o período é dividido em intervalos e de cada um são lidas apenas as amostras com o valor
+// mínimo e máximo e a primeira sem valor numérico, para que a série cubra todo o período.
+func queryTrendSamples(tagID uint, q TrendQuery) ([]TagSample, bool, error) {
+	var total int64
+	err := config.DB.Model(&TagSample{}).
+		Where("tag_id = ? AND timestamp >= ? AND timestamp < ?", tagID, q.Inicio, q.Fim).
+		Count(&total).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	var samples []TagSample
+	if total <= int64(Config.TrendMaxRawSamples) {
+		err = config.DB.
+			Where("tag_id = ? AND timestamp >= ? AND timestamp < ?", tagID, q.Inicio, q.Fim).
+			Order("timestamp").
+			Find(&samples).Error
+		return samples, false, err
+	}
+
+	// Até três amostras por intervalo: mínimo, máximo e início de lacuna
+	buckets := Config.TrendMaxRawSamples / 3
+	if buckets < 1 {
+		buckets = 1
+	}
+
+	err = config.DB.Raw(`
+		SELECT tag_id, plc_id, timestamp, valor_num, valor_texto, qualidade
+		FROM (
+			SELECT *,
+				row_number() OVER (PARTITION BY bucket, valor_num IS NULL ORDER BY valor_num, timestamp) AS ordem_min,
+				row_number() OVER (PARTITION BY bucket, valor_num IS NULL ORDER BY valor_num DESC, timestamp) AS ordem_max
+			FROM (
+				SELECT tag_id, plc_id, timestamp, valor_num, valor_texto, qualidade,
+					width_bucket(extract(epoch FROM timestamp)::float8, ?::float8, ?::float8, ?) AS bucket
+				FROM tag_historico
+				WHERE tag_id = ? AND timestamp >= ? AND timestamp < ?
+			) amostras
+		) ordenadas
+		WHERE ordem_min = 1 OR ordem_max = 1
+		ORDER BY timestamp`,
+		float64(q.Inicio.UnixNano())/1e9, float64(q.Fim.UnixNano())/1e9, buckets,
+		tagID, q.Inicio, q.Fim,
+	).Scan(&samples).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	return samples, true, nil
+}
+
+// queryTrendBuckets agrega as amostras de uma tag em intervalos de tempo fixos
+func queryTrendBuckets(tagID uint, q TrendQuery) ([]TrendBucket, error) {
+	seconds := q.Intervalo.Seconds()
+
+	var buckets []TrendBucket
+	err := config.DB.Raw(`
+		SELECT tag_id,
+			to_timestamp(floor(extract(epoch FROM timestamp) / ?) * ?) AS inicio,
+			min(valor_num) AS min,
+			max(valor_num) AS max,
+			avg(valor_num) AS avg,
+			(array_agg(valor_num ORDER BY timestamp) FILTER (WHERE valor_num IS NOT NULL))[1] AS primeiro,
+			(array_agg(valor_num ORDER BY timestamp DESC) FILTER (WHERE valor_num IS NOT NULL))[1] AS ultimo,
+			count(*) AS contagem
+		FROM tag_historico
+		WHERE tag_id = ? AND timestamp >= ? AND timestamp < ?
+		GROUP BY tag_id, inicio
+		ORDER BY inicio`,
+		seconds, seconds, tagID, q.Inicio, q.Fim,
+	).Scan(&buckets).Error
+
+	return buckets, err
+}
+
+// downsampleTrend reduz a série a no máximo pontos amostras com o algoritmo LTTB.
+// Amostras sem valor numérico (falhas de qualidade, textos) marcam lacunas no gráfico:
+// cada sequência delas é reduzida à primeira e as marcas contam para o limite de pontos.
+func downsampleTrend(samples []TagSample, pontos int) []TagSample {
+	if len(samples) <= pontos {
+		return samples
+	}
+
+	var numeric, gaps []TagSample
+	for i, s := range samples {
+		switch {
+		case s.ValorNum != nil:
+			numeric = append(numeric, s)
+		case i == 0 || samples[i-1].ValorNum != nil:
+			gaps = append(gaps, s)
+		}
+	}
+
+	// O LTTB precisa de pelo menos três pontos; se as lacunas não o permitirem, são elas que se reduzem
+	threshold := pontos - len(gaps)
+	if threshold < 3 {
+		threshold = 3
+		if len(numeric) < threshold {
+			threshold = len(numeric)
+		}
+		gaps = strideSamples(gaps, pontos-threshold)
+	}
+
+	result := append(lttb(numeric, threshold), gaps...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Timestamp.Before(result[j].Timestamp)
+	})
+	return result
+}
+
+// strideSamples escolhe n amostras distribuídas uniformemente, mantendo a ordem
+func strideSamples(samples []TagSample, n int) []TagSample {
+	if n >= len(samples) {
+		return samples
+	}
+
+	result := make([]TagSample, 0, n)
+	for i := 0; i < n; i++ {
+		result = append(result, samples[i*len(samples)/n])
+	}
+	return result
+}
+
+// lttb aplica o Largest-Triangle-Three-Buckets a amostras numéricas ordenadas por tempo
+func lttb(samples []TagSample, threshold int) []TagSample {
+	if threshold >= len(samples) || threshold < 3 {
+		return samples
+	}
+
+	origin := samples[0].Timestamp
+	x := func(i int) float64 { return samples[i].Timestamp.Sub(origin).Seconds() }
+	y := func(i int) float64 { return *samples[i].ValorNum }
+
+	result := make([]TagSample, 0, threshold)
+	result = append(result, samples[0])
+
+	// O primeiro e o último ponto são fixos; os restantes formam threshold-2 grupos
+	every := float64(len(samples)-2) / float64(threshold-2)
+	a := 0
+
+	for i := 0; i < threshold-2; i++ {
+		// Média do grupo seguinte, usada como terceiro vértice do triângulo
+		nextStart := int(math.Floor(float64(i+1)*every)) + 1
+		nextEnd := int(math.Floor(float64(i+2)*every)) + 1
+		if nextEnd > len(samples) {
+			nextEnd = len(samples)
+		}
+		if nextStart >= nextEnd {
+			nextStart = nextEnd - 1
+		}
+
+		avgX, avgY := 0.0, 0.0
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += x(j)
+			avgY += y(j)
+		}
+		n := float64(nextEnd - nextStart)
+		avgX /= n
+		avgY /= n
+
+		// Escolher no grupo atual o ponto com maior triângulo
+		start := int(math.Floor(float64(i)*every)) + 1
+		end := int(math.Floor(float64(i+1)*every)) + 1
+
+		maxArea := -1.0
+		chosen := start
+		for j := start; j < end; j++ {
+			area := math.Abs((x(a)-avgX)*(y(j)-y(a)) - (x(a)-x(j))*(avgY-y(a)))
+			if area > maxArea {
+				maxArea = area
+				chosen = j
+			}
+		}
+
+		result = append(result, samples[chosen])
+		a = chosen
+	}
+
+	return append(result, samples[len(samples)-1])
+}
@@ -0,0 +1,124 @@
+package plc
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// trendSeries cria amostras espaçadas de um segundo; valores NaN representam lacunas
+func trendSeries(values ...float64) []TagSample {
+	origin := time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC)
+	samples := make([]TagSample, len(values))
+	for i, v := range values {
+		samples[i] = TagSample{TagID: 1, Timestamp: origin.Add(time.Duration(i) * time.Second), Qualidade: "boa"}
+		if math.IsNaN(v) {
+			samples[i].Qualidade = "erro"
+		} else {
+			value := v
+			samples[i].ValorNum = &value
+		}
+	}
+	return samples
+}
+
+func TestLTTB(t *testing.T) {
+	values := make([]float64, 100)
+	values[37] = 50 // Pico isolado que tem de sobreviver à redução
+	samples := trendSeries(values...)
+
+	got := lttb(samples, 10)
+	if len(got) != 10 {
+		t.Fatalf("lttb devolveu %d pontos, esperado 10", len(got))
+	}
+	if !got[0].Timestamp.Equal(samples[0].Timestamp) || !got[9].Timestamp.Equal(samples[99].Timestamp) {
+		t.Errorf("lttb não manteve o primeiro e o último ponto")
+	}
+
+	peak := false
+	for i, s := range got {
+		if i > 0 && !got[i-1].Timestamp.Before(s.Timestamp) {
+			t.Errorf("lttb devolveu pontos fora de ordem na posição %d", i)
+		}
+		if *s.ValorNum == 50 {
+			peak = true
+		}
+	}
+	if !peak {
+		t.Errorf("lttb perdeu o pico da série")
+	}
+
+	if got := lttb(samples[:5], 10); len(got) != 5 {
+		t.Errorf("lttb com menos amostras que o limite devolveu %d pontos, esperado 5", len(got))
+	}
+}
+
+func TestDownsampleTrend(t *testing.T) {
+	nan := math.NaN()
+
+	// Série com lacunas longas (várias amostras seguidas sem valor) e lacunas isoladas
+	var values []float64
+	for i := 0; i < 200; i++ {
+		switch {
+		case i >= 50 && i < 80, i >= 120 && i < 125:
+			values = append(values, nan)
+		case i%20 == 0:
+			values = append(values, nan)
+		default:
+			values = append(values, float64(i))
+		}
+	}
+	withGaps := trendSeries(values...)
+
+	// Série com mais lacunas do que pontos pedidos
+	values = nil
+	for i := 0; i < 300; i++ {
+		if i%2 == 0 {
+			values = append(values, nan)
+		} else {
+			values = append(values, float64(i))
+		}
+	}
+	mostlyGaps := trendSeries(values...)
+
+	// Cada lacuna da série original fica com uma única marca, na primeira amostra sem valor
+	got := downsampleTrend(withGaps, 50)
+	for i := 1; i < len(got); i++ {
+		if got[i].ValorNum == nil && got[i-1].ValorNum == nil {
+			t.Errorf("marcas de lacuna seguidas em %v e %v", got[i-1].Timestamp, got[i].Timestamp)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		samples []TagSample
+		pontos  int
+		gaps    int // Marcas de lacuna esperadas no resultado
+	}{
+		{name: "abaixo do limite", samples: trendSeries(1, 2, 3), pontos: 10, gaps: 0},
+		{name: "lacunas seguidas reduzidas a uma marca", samples: withGaps, pontos: 50, gaps: 9},
+		{name: "lacunas acima do limite", samples: mostlyGaps, pontos: 20, gaps: 17},
+		{name: "poucos valores numéricos", samples: trendSeries(nan, 1, nan, 2, nan, nan, nan), pontos: 3, gaps: 1},
+		{name: "limite mínimo", samples: withGaps, pontos: 3, gaps: 0},
+	}
+
+	for _, tt := range tests {
+		got := downsampleTrend(tt.samples, tt.pontos)
+		if len(got) > tt.pontos {
+			t.Errorf("%s: %d pontos, esperado no máximo %d", tt.name, len(got), tt.pontos)
+		}
+
+		gaps := 0
+		for i, s := range got {
+			if i > 0 && got[i-1].Timestamp.After(s.Timestamp) {
+				t.Errorf("%s: pontos fora de ordem na posição %d", tt.name, i)
+			}
+			if s.ValorNum == nil {
+				gaps++
+			}
+		}
+		if gaps != tt.gaps {
+			t.Errorf("%s: %d marcas de lacuna, esperado %d", tt.name, gaps, tt.gaps)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package plc
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danilo/edp_gestao_utilizadores/internal/config"
+	"github.com/danilo/edp_gestao_utilizadores/internal/plc/expr"
+	"gorm.io/gorm"
+)
+
+// AreaVirtual identifica as tags calculadas a partir de uma expressão, sem endereço no PLC
+const AreaVirtual = "V"
+
+// isVirtualTag indica se a tag é calculada a partir de uma expressão
+func isVirtualTag(tag *Tag) bool {
+	return tag.Expressao != nil && strings.TrimSpace(*tag.Expressao) != ""
+}
+
+// prepareVirtualTag limpa os campos de endereço de uma tag virtual, que não é lida nem escrita no PLC
+func prepareVirtualTag(tag *Tag) {
+	tag.Area = AreaVirtual
+	tag.DBNumber = 0
+	tag.ByteOffset = 0
+	tag.BitOffset = nil
+	tag.OrdemPalavras = OrdemABCD
+	tag.Gravavel = false
+}
+
+// validateVirtualTag verifica a expressão de uma tag virtual: sintaxe, tipo do resultado,
+// existência das tags referidas e ausência de ciclos entre tags virtuais
+func validateVirtualTag(db *gorm.DB, tag *Tag) error {
+	if tag.Tipo != "Real" && tag.Tipo != "Bool" {
+		return fmt.Errorf("tags virtuais devem ser do tipo Real ou Bool")
+	}
+	if hasScaling(tag) || tag.BrutoMin != nil || tag.BrutoMax != nil {
+		return fmt.Errorf("tags virtuais não suportam escala; inclua a conversão na expressão")
+	}
+
+	program, err := expr.Compile(*tag.Expressao)
+	if err != nil {
+		return fmt.Errorf("expressão inválida: %v", err)
+	}
+
+	refs := program.Refs()
+	if len(refs) == 0 {
+		return fmt.Errorf("a expressão deve referir pelo menos uma tag")
+	}
+
+	var count int64
+	if err := db.Model(&Tag{}).Where("id IN ?", refs).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(refs) {
+		return fmt.Errorf("a expressão refere tags inexistentes")
+	}
+
+	// Grafo de dependências das tags virtuais gravadas, com a nova expressão no lugar da antiga
+	var virtuals []Tag
+	if err := db.Where("expressao IS NOT NULL AND expressao <> ''").Find(&virtuals).Error; err != nil {
+		return err
+	}
+
+	graph := map[uint][]uint{}
+	for i := range virtuals {
+		if virtuals[i].ID == tag.ID {
+			continue
+		}
+		if p, err := expr.Compile(*virtuals[i].Expressao); err == nil {
+			graph[virtuals[i].ID] = p.Refs()
+		}
+	}
+	if tag.ID != 0 {
+		graph[tag.ID] = refs
+		if hasDependencyCycle(graph, tag.ID) {
+			return fmt.Errorf("a expressão cria uma dependência circular entre tags virtuais")
+		}
+	}
+
+	return nil
+}
+
+// hasDependencyCycle indica se é possível voltar à tag inicial seguindo as referências das expressões
+func hasDependencyCycle(graph map[uint][]uint, start uint) bool {
+	visited := map[uint]bool{}
+	stack := append([]uint(nil), graph[start]...)
+
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		if id == start {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		stack = append(stack, graph[id]...)
+	}
+	return false
+}
+
+// virtualTagsReferencing retorna as tags virtuais gravadas cuja expressão refere a tag indicada
+func virtualTagsReferencing(tagID uint) ([]Tag, error) {
+	var virtuals []Tag
+	if err := config.DB.Where("expressao IS NOT NULL AND expressao <> ''").Find(&virtuals).Error; err != nil {
+		return nil, err
+	}
+
+	var result []Tag
+	for _, tag := range virtuals {
+		program, err := expr.Compile(*tag.Expressao)
+		if err != nil {
+			continue
+		}
+		for _, ref := range program.Refs() {
+			if ref == tagID {
+				result = append(result, tag)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// virtualEngine mantém as expressões compiladas das tags virtuais ativas e quem depende de cada tag
+type virtualEngine struct {
+	mutex      sync.RWMutex
+	tags       map[uint]*virtualTag // ID da tag virtual -> expressão
+	dependents map[uint][]uint      // ID da tag de entrada -> IDs das tags virtuais que a usam
+}
+
+// virtualTag é a expressão compilada de uma tag virtual. O mutex serializa as avaliações,
+// que guardam estado (integral, ontime) e alteram a tag.
+type virtualTag struct {
+	mutex   sync.Mutex
+	tagID   uint
+	program *expr.Program
+}
+
+// newVirtualEngine cria um motor sem tags virtuais
+func newVirtualEngine() *virtualEngine {
+	return &virtualEngine{
+		tags:       make(map[uint]*virtualTag),
+		dependents: make(map[uint][]uint),
+	}
+}
+
+// rebuildVirtualTags recompila as tags virtuais dos PLCs geridos depois de uma alteração de configuração.
+// As expressões inalteradas mantêm o estado das funções temporais.
+func (m *Manager) rebuildVirtualTags() {
+	m.mutex.RLock()
+	var tags []*Tag
+	for _, plc := range m.plcs {
+		for _, tag := range plc.tagList() {
+			if isVirtualTag(tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	m.mutex.RUnlock()
+
+	e := m.virtual
+	e.mutex.Lock()
+
+	compiled := make(map[uint]*virtualTag, len(tags))
+	graph := make(map[uint][]uint, len(tags))
+
+	for _, tag := range tags {
+		if existing, ok := e.tags[tag.ID]; ok && existing.program.Source() == *tag.Expressao {
+			compiled[tag.ID] = existing
+			graph[tag.ID] = existing.program.Refs()
+			continue
+		}
+
+		program, err := expr.Compile(*tag.Expressao)
+		if err != nil {
+			log.Printf("Tag virtual %s (ID: %d) ignorada: %v", tag.Nome, tag.ID, err)
+			continue
+		}
+		compiled[tag.ID] = &virtualTag{tagID: tag.ID, program: program}
+		graph[tag.ID] = program.Refs()
+	}
+
+	// Ciclos só entram por alterações feitas fora da API; as tags envolvidas não são avaliadas
+	for id := range compiled {
+		if hasDependencyCycle(graph, id) {
+			log.Printf("Tag virtual ID %d ignorada: dependência circular", id)
+			delete(compiled, id)
+		}
+	}
+
+	dependents := make(map[uint][]uint)
+	for id, vt := range compiled {
+		for _, ref := range vt.program.Refs() {
+			dependents[ref] = append(dependents[ref], id)
+		}
+	}
+
+	e.tags = compiled
+	e.dependents = dependents
+	e.mutex.Unlock()
+
+	// Recalcular de imediato: as tags novas ou alteradas e as que perderam entradas
+	now := time.Now()
+	for id := range compiled {
+		m.evaluateVirtualTag(id, now)
+	}
+}
+
+// evaluateDependents reavalia as tags virtuais que usam a tag indicada
+func (m *Manager) evaluateDependents(tagID uint) {
+	if m.virtual == nil {
+		return
+	}
+
+	m.virtual.mutex.RLock()
+	ids := m.virtual.dependents[tagID]
+	m.virtual.mutex.RUnlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		m.evaluateVirtualTag(id, now)
+	}
+}
+
+// virtualEnv fornece à expressão os valores atuais das tags de entrada e regista a pior qualidade
+type virtualEnv struct {
+	manager   *Manager
+	qualidade string
+}
+
+// Value retorna o último valor publicado de uma tag de entrada
+func (env *virtualEnv) Value(tagID uint) (interface{}, error) {
+	_, tag := env.manager.findActiveTag(tagID)
+	if tag == nil {
+		env.qualidade = worseQuality(env.qualidade, QualidadeFalhaConfiguracao)
+		return nil, fmt.Errorf("tag [%d] não está ativa", tagID)
+	}
+
+	if tag.Qualidade != "" && tag.Qualidade != QualidadeBoa {
+		env.qualidade = worseQuality(env.qualidade, tag.Qualidade)
+	}
+	return tag.UltimoValor, nil
+}
+
+// qualityRank ordena as qualidades da melhor para a pior
+var qualityRank = map[string]int{
+	QualidadeBoa:               0,
+	QualidadeIncertaAntiga:     1,
+	QualidadeFalhaComunicacao:  2,
+	QualidadeFalhaConfiguracao: 3,
+}
+
+// worseQuality retorna a pior de duas qualidades
+func worseQuality(a, b string) string {
+	if qualityRank[b] > qualityRank[a] {
+		return b
+	}
+	return a
+}
+
+// evaluateVirtualTag calcula o valor de uma tag virtual e publica-o como o de uma tag física.
+// Com uma entrada em má qualidade, a tag mantém o último valor e herda a pior qualidade das entradas.
+func (m *Manager) evaluateVirtualTag(id uint, now time.Time) {
+	m.virtual.mutex.RLock()
+	vt, exists := m.virtual.tags[id]
+	m.virtual.mutex.RUnlock()
+	if !exists {
+		return
+	}
+
+	vt.mutex.Lock()
+	defer vt.mutex.Unlock()
+
+	plc, tag := m.findActiveTag(id)
+	if tag == nil || !isVirtualTag(tag) {
+		return
+	}
+
+	env := &virtualEnv{manager: m, qualidade: QualidadeBoa}
+	result, err := vt.program.Eval(env, now)
+
+	if env.qualidade != QualidadeBoa {
+		m.setTagQuality(plc, tag, env.qualidade)
+		return
+	}
+
+	if err != nil {
+		// Entradas ainda sem valor: aguardar a primeira leitura
+		if errors.Is(err, expr.ErrNoValue) {
+			return
+		}
+
+		if tag.UltimoErro != err.Error() {
+			log.Printf("\033[31m[ERRO] PLC %s - Tag virtual %s: %v\033[0m\n", plc.Nome, tag.Nome, err)
+		}
+		tag.UltimaLeitura = now
+		tag.UltimoErro = err.Error()
+		tag.UltimoErroTime = now
+		m.setTagQuality(plc, tag, QualidadeFalhaConfiguracao)
+		return
+	}
+
+	tag.UltimaLeitura = now
+	m.processTagValue(plc, tag, virtualValue(tag, result))
+}
+
+// virtualValue converte o resultado da expressão no tipo da tag
+func virtualValue(tag *Tag, result interface{}) interface{} {
+	if tag.Tipo == "Bool" {
+		if b, ok := result.(bool); ok {
+			return b
+		}
+		f, _ := result.(float64)
+		return f != 0
+	}
+
+	if b, ok := result.(bool); ok {
+		if b {
+			return 1.0
+		}
+		return 0.0
+	}
+	return result
+}
+
+// monitorVirtualTags reavalia periodicamente as tags virtuais com funções de tempo
+func (m *Manager) monitorVirtualTags() {
+	defer m.wg.Done()
+
+	ticker := time.NewTicker(Config.VirtualTagPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case now := <-ticker.C:
+			m.virtual.mutex.RLock()
+			var ids []uint
+			for id, vt := range m.virtual.tags {
+				if vt.program.Temporal() {
+					ids = append(ids, id)
+				}
+			}
+			m.virtual.mutex.RUnlock()
+
+			for _, id := range ids {
+				m.evaluateVirtualTag(id, now)
+			}
+		}
+	}
+}
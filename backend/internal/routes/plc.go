@@ -13,17 +13,35 @@ func SetupPLCRoutes(router fiber.Router, manager *plc.Manager) {
 	router.Get("/", controller.GetAllPLCs)
 	router.Post("/", controller.CreatePLC)
 	router.Get("/:id", controller.GetPLCByID)
+	router.Get("/:id/diagnostico", controller.GetPLCDiagnostics)
+	router.Get("/:id/estatisticas", controller.GetPLCStatistics)
 	router.Put("/:id", controller.UpdatePLC)
 	router.Delete("/:id", controller.DeletePLC)
 
 	// Rotas para Tags
 	router.Get("/:id/tags", controller.GetPLCTags)
+	router.Get("/tags/historico", controller.GetTagsHistory)
 	router.Get("/tags/:id", controller.GetTagByID)
 	router.Post("/tags", controller.CreateTag)
 	router.Put("/tags/:id", controller.UpdateTag)
 	router.Delete("/tags/:id", controller.DeleteTag)
+	router.Post("/:id/tags/importar-db", controller.ImportDBSource)
 
 	// Rotas para operações de tags
 	router.Get("/tags/:id/value", controller.ReadTagValue)
 	router.Post("/tags/:id/value", controller.WriteTagValue)
+	router.Get("/tags/:id/historico", controller.GetTagHistory)
+
+	// Exportação e importação da configuração entre instalações
+	transfer := plc.NewConfigTransferController(manager, manager.GetFaultManager())
+	router.Get("/configuracao/exportar", transfer.ExportConfig)
+	router.Post("/configuracao/importar", transfer.ImportConfig)
+}
+
+// SetupNatsRoutes configura as rotas de ligação e credenciais NATS, disponíveis para todos os utilizadores autenticados
+func SetupNatsRoutes(router fiber.Router, manager *plc.Manager) {
+	controller := plc.NewController(manager)
+
+	router.Get("/info", controller.GetNatsInfo)
+	router.Post("/credenciais", controller.GetNatsCredentials)
 }
@@ -41,6 +41,15 @@ func SetupRoutes(app *fiber.App, plcManager *plc.Manager) {
 	SetupPreferencesRoutes(protected.Group("/preferencias"))
 	SetupSessionRoutes(protected.Group("/sessoes"))
 
+	// Credenciais NATS para clientes (permissões derivadas do perfil)
+	SetupNatsRoutes(protected.Group("/nats"), plcManager)
+
+	// Rotas para receitas (registadas antes do grupo de administração, que se aplica a todo o /api)
+	setupRecipeRoutes(protected.Group("/receitas"), plcManager)
+
+	// Hierarquia de ativos (consulta para todos, alterações apenas para administradores)
+	setupAssetRoutes(protected.Group("/ativos"), plcManager)
+
 	// Rotas PLC (requer autenticação e permissão de admin)
 	adminRouter := protected.Group("/", middleware.AdminOnlyMiddleware())
 	SetupPLCRoutes(adminRouter.Group("/plc"), plcManager)
@@ -182,3 +191,38 @@ func setupFaultRoutes(router fiber.Router, manager *plc.Manager, faultManager *p
 	adminRouter.Delete("/definicoes/:id", controller.DeleteFaultDefinition)
 	adminRouter.Post("/definicoes/importar", controller.ImportFaultDefinitions)
 }
+
+// setupAssetRoutes configura as rotas da hierarquia de ativos
+func setupAssetRoutes(router fiber.Router, manager *plc.Manager) {
+	controller := plc.NewAssetController(manager, manager.GetFaultManager())
+
+	router.Get("/", controller.GetAssetTree)
+	router.Get("/:id", controller.GetAssetByID)
+
+	adminRouter := router.Group("/", middleware.AdminOnlyMiddleware())
+	adminRouter.Post("/", controller.CreateAsset)
+	adminRouter.Put("/:id", controller.UpdateAsset)
+	adminRouter.Delete("/:id", controller.DeleteAsset)
+}
+
+// setupRecipeRoutes configura as rotas para receitas
+func setupRecipeRoutes(router fiber.Router, manager *plc.Manager) {
+	controller := plc.NewRecipeController(manager)
+
+	// Rotas para visualização (disponíveis para todos os usuários autenticados)
+	router.Get("/", controller.GetAllRecipes)
+	router.Get("/:id", controller.GetRecipeByID)
+	router.Get("/:id/versoes/:versao", controller.GetRecipeVersion)
+
+	// Envio para o PLC: requer a permissão de escrita em tags (PLC/Escrever), verificada
+	// no controlador; a política de escrita de cada tag continua a ser aplicada no envio
+	router.Post("/:id/download", controller.DownloadRecipe)
+
+	// Rotas para definição de receitas e dos seus valores (requerem permissão de administrador)
+	adminRouter := router.Group("/", middleware.AdminOnlyMiddleware())
+	adminRouter.Post("/", controller.CreateRecipe)
+	adminRouter.Put("/:id", controller.UpdateRecipe)
+	adminRouter.Delete("/:id", controller.DeleteRecipe)
+	adminRouter.Post("/:id/versoes", controller.CreateRecipeVersion)
+	adminRouter.Post("/:id/upload", controller.UploadRecipe)
+}
@@ -116,6 +116,7 @@ func initializePermissions() {
 		{Nome: "Ver Utilizadores Ativos", Descricao: "Visualizar utilizadores ativos no sistema", Modulo: "Status", Acao: "Visualizar"},
 		{Nome: "Gerir Sessões", Descricao: "Gerenciar sessões de utilizadores", Modulo: "Sessões", Acao: "Gerenciar"},
 		{Nome: "Ver Preferências", Descricao: "Visualizar preferências de utilizadores", Modulo: "Preferências", Acao: "Visualizar"},
+		{Nome: "Escrever Tags PLC", Descricao: "Escrever valores em tags dos PLCs por comandos NATS e enviar receitas", Modulo: "PLC", Acao: "Escrever"},
 	}
 
 	// Criar permissões se não existirem
@@ -51,7 +51,7 @@ export const useNats = () => {
     try {
       // Get NATS server info
       const response = await plcApi.getNatsInfo();
-      const { url, subjects: serverSubjects } = response.data;
+      const { url, subjects: serverSubjects } = response.data.dados;
       
       if (!url) {
         throw new Error('NATS URL não disponível');
@@ -177,7 +177,7 @@ export const plcApi = {
   async getNatsInfo(): Promise<AxiosResponse> {
     return apiService.request({
       method: 'GET',
-      url: '/nats-info'
+      url: '/api/nats/info'
     });
   }
 };